@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	openshiftconfig "github.com/openshift/api/config/v1"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/openshift/windows-machine-config-operator/controllers"
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/hostport"
 	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig/payload"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
@@ -61,8 +63,12 @@ func init() {
 
 func main() {
 	var debugLogging bool
+	var maxConfigFailures int
 
 	flag.BoolVar(&debugLogging, "debugLogging", false, "Log debug messages")
+	flag.IntVar(&maxConfigFailures, "maxConfigFailures", controllers.DefaultMaxConfigFailures,
+		"Number of consecutive configuration failures of a Windows instance after which its configuration is no "+
+			"longer retried. Disabled if not positive.")
 
 	// Add flags registered by imported packages (e.g. glog and
 	// controller-runtime)
@@ -156,7 +162,7 @@ func main() {
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
-			BindAddress: fmt.Sprintf("%s:%d", metrics.Host, metrics.Port),
+			BindAddress: hostport.Join(metrics.Host, strconv.Itoa(int(metrics.Port))),
 		},
 	})
 	if err != nil {
@@ -185,7 +191,8 @@ func main() {
 	setupLog.Info("operator", "namespace", watchNamespace)
 
 	// Setup all Controllers
-	winMachineReconciler, err := controllers.NewWindowsMachineReconciler(mgr, clusterConfig, watchNamespace)
+	winMachineReconciler, err := controllers.NewWindowsMachineReconciler(mgr, clusterConfig, watchNamespace,
+		maxConfigFailures)
 	if err != nil {
 		setupLog.Error(err, "unable to create Windows Machine reconciler")
 		os.Exit(1)
@@ -225,7 +232,8 @@ func main() {
 	}
 
 	proxyEnabled := cluster.IsProxyEnabled()
-	configMapReconciler, err := controllers.NewConfigMapReconciler(mgr, clusterConfig, watchNamespace, proxyEnabled)
+	configMapReconciler, err := controllers.NewConfigMapReconciler(mgr, clusterConfig, watchNamespace, proxyEnabled,
+		maxConfigFailures)
 	if err != nil {
 		setupLog.Error(err, "unable to create ConfigMap reconciler")
 		os.Exit(1)
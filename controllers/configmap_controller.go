@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"reflect"
@@ -87,7 +88,7 @@ type ConfigMapReconciler struct {
 
 // NewConfigMapReconciler returns a pointer to a ConfigMapReconciler
 func NewConfigMapReconciler(mgr manager.Manager, clusterConfig cluster.Config, watchNamespace string,
-	proxyEnabled bool) (*ConfigMapReconciler, error) {
+	proxyEnabled bool, maxConfigFailures int) (*ConfigMapReconciler, error) {
 	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
 	if err != nil {
 		return nil, fmt.Errorf("error creating kubernetes clientset: %w", err)
@@ -127,6 +128,7 @@ func NewConfigMapReconciler(mgr manager.Manager, clusterConfig cluster.Config, w
 			recorder:             mgr.GetEventRecorderFor(ConfigMapController),
 			prometheusNodeConfig: pc,
 			platform:             clusterConfig.Platform(),
+			maxConfigFailures:    maxConfigFailures,
 		},
 		servicesManifest: svcData,
 		proxyEnabled:     proxyEnabled,
@@ -315,6 +317,10 @@ func (r *ConfigMapReconciler) ensureInstancesAreUpToDate(instances []*instance.I
 		}
 		err = r.ensureInstanceIsUpToDate(instanceInfo, map[string]string{BYOHLabel: "true", nodeconfig.WorkerLabel: ""},
 			map[string]string{UsernameAnnotation: encryptedUsername})
+		if errors.Is(err, errConfigRetriesExhausted) || errors.Is(err, errConfigInProgress) {
+			// the instance cannot be configured for now, the other instances can still be configured
+			continue
+		}
 		if err != nil {
 			// It is better to return early like this, instead of trying to configure as many instances as possible in a
 			// single reconcile call, as it simplifies error collection. The order the map is read from is
@@ -525,6 +531,7 @@ func (r *ConfigMapReconciler) ensureTrustedCABundleInNode(ctx context.Context, c
 	}
 	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
 		winInstance, r.signer, nil, nil, r.platform)
+	recordSSHReachability(&node, nc, err)
 	if err != nil {
 		return fmt.Errorf("failed to create new nodeconfig: %w", err)
 	}
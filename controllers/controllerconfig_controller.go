@@ -32,7 +32,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/certificates"
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
 	"github.com/openshift/windows-machine-config-operator/pkg/signer"
 )
@@ -42,6 +44,8 @@ import (
 const (
 	// ControllerConfigController is the name of this controller in logs and other outputs.
 	ControllerConfigController = "controllerconfig"
+	// maxConcurrentKubeletCAUpdates is the maximum number of Windows nodes the kubelet CA is copied to at the same time
+	maxConcurrentKubeletCAUpdates = 10
 )
 
 // ControllerConfigReconciler holds the info required to reconcile information held in ControllerConfigs
@@ -90,15 +94,40 @@ func (r *ControllerConfigReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	if err = r.client.List(ctx, winNodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
 		return ctrl.Result{}, fmt.Errorf("error listing Windows nodes: %w", err)
 	}
-	// loop Windows nodes and trigger kubelet CA update
+	// trigger the kubelet CA update in all Windows nodes, a failure in one node does not block the others
+	var targets []certificates.BundleTarget
 	for _, winNode := range winNodes.Items {
-		if err := r.updateKubeletCA(winNode, cc.Spec.KubeAPIServerServingCAData); err != nil {
-			return ctrl.Result{}, fmt.Errorf("error updating kubelet CA certificate in node %s: %w", winNode.Name, err)
-		}
+		targets = append(targets, &kubeletCATarget{reconciler: &r.instanceReconciler, node: winNode})
+	}
+	err = certificates.DistributeBundleToNodes(ctx, targets, cc.Spec.KubeAPIServerServingCAData,
+		maxConcurrentKubeletCAUpdates)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("error updating kubelet CA certificate in Windows nodes: %w", err)
 	}
 	return ctrl.Result{}, nil
 }
 
+// kubeletCATarget is a Windows node the kubelet CA is copied to
+type kubeletCATarget struct {
+	reconciler *instanceReconciler
+	node       core.Node
+}
+
+func (t *kubeletCATarget) Name() string {
+	return t.node.Name
+}
+
+// UpdateKubeletClientCA copies the given kubelet CA to the node, recording the expiry of the CA on success
+func (t *kubeletCATarget) UpdateKubeletClientCA(contents []byte) error {
+	if err := t.reconciler.updateKubeletCA(t.node, contents); err != nil {
+		return err
+	}
+	if err := metrics.RecordCertificateExpiry(t.node.Name, contents); err != nil {
+		t.reconciler.log.Error(err, "unable to record kubelet CA certificate expiry", "node", t.node.Name)
+	}
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ControllerConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	mccName := "machine-config-controller"
@@ -2,9 +2,12 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	config "github.com/openshift/api/config/v1"
@@ -24,6 +27,7 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 	"github.com/openshift/windows-machine-config-operator/version"
 )
 
@@ -31,11 +35,19 @@ const (
 	// MaxParallelUpgrades is the default maximum allowed number of nodes that can be upgraded in parallel.
 	// It is a positive integer and cannot be used to stop upgrades, only to limit the number of concurrent upgrades.
 	MaxParallelUpgrades = 1
+	// DefaultMaxConfigFailures is the default number of consecutive configuration failures of an instance after which
+	// its configuration is no longer retried
+	DefaultMaxConfigFailures = 5
 )
 
 var (
 	// controllerLocker is used to synchronize upgrades between controllers
 	controllerLocker sync.Mutex
+	// errConfigRetriesExhausted is returned when an instance is not configured as its configuration failed too many
+	// consecutive times
+	errConfigRetriesExhausted = errors.New("maximum number of consecutive configuration failures reached")
+	// errConfigInProgress is returned when an instance is not configured as it is already being configured
+	errConfigInProgress = errors.New("configuration already in progress")
 )
 
 // instanceReconciler contains everything needed to perform actions on a Windows instance
@@ -57,11 +69,18 @@ type instanceReconciler struct {
 	recorder record.EventRecorder
 	// platform indicates the cloud on which the cluster is running
 	platform config.PlatformType
+	// maxConfigFailures is the number of consecutive configuration failures of an instance after which its
+	// configuration is no longer retried. Configuration is always retried if it is not positive.
+	maxConfigFailures int
 }
 
 // ensureInstanceIsUpToDate ensures that the given instance is configured as a node and upgraded to the specifications
 // defined by the current version of WMCO. If labelsToApply/annotationsToApply is not nil, the node will have the
 // specified annotations and/or labels applied to it.
+// Consecutive configuration failures of an instance already associated with a node are counted on the node. Once
+// maxConfigFailures is reached, an error wrapping errConfigRetriesExhausted is returned without attempting to
+// configure the instance, until the count is cleared or the node is labeled with metadata.RetryConfigLabel.
+// An error wrapping errConfigInProgress is returned if the instance is already being configured.
 func (r *instanceReconciler) ensureInstanceIsUpToDate(instanceInfo *instance.Info, labelsToApply, annotationsToApply map[string]string) error {
 	if instanceInfo == nil {
 		return fmt.Errorf("instance cannot be nil")
@@ -74,11 +93,22 @@ func (r *instanceReconciler) ensureInstanceIsUpToDate(instanceInfo *instance.Inf
 			instanceInfo.Node.GetAnnotations()[metadata.VersionAnnotation])
 		return nil
 	}
+	if instanceInfo.BootstrapState() == instance.BootstrapInProgress {
+		r.log.Info("not configuring instance", "node", instanceInfo.Node.GetName(), "reason",
+			errConfigInProgress.Error())
+		return fmt.Errorf("node %s: %w", instanceInfo.Node.GetName(), errConfigInProgress)
+	}
+	if r.configRetriesExhausted(instanceInfo.Node) {
+		r.log.Info("not configuring instance", "node", instanceInfo.Node.GetName(), "reason",
+			errConfigRetriesExhausted.Error())
+		return fmt.Errorf("node %s: %w", instanceInfo.Node.GetName(), errConfigRetriesExhausted)
+	}
 
 	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
 		instanceInfo, r.signer, labelsToApply, annotationsToApply, r.platform)
+	recordSSHReachability(instanceInfo.Node, nc, err)
 	if err != nil {
-		return fmt.Errorf("failed to create new nodeconfig: %w", err)
+		return r.configFailed(instanceInfo.Node, fmt.Errorf("failed to create new nodeconfig: %w", err))
 	}
 
 	// Check if the instance was configured by a previous version of WMCO and must be deconfigured before being
@@ -91,11 +121,74 @@ func (r *instanceReconciler) ensureInstanceIsUpToDate(instanceInfo *instance.Inf
 			return err
 		}
 		if err := nc.Deconfigure(); err != nil {
-			return err
+			return r.configFailed(instanceInfo.Node, err)
 		}
 	}
 
-	return nc.Configure()
+	if err := nc.Configure(); err != nil {
+		return r.configFailed(instanceInfo.Node, err)
+	}
+	return r.resetConfigFailures(context.TODO(), instanceInfo.Node)
+}
+
+// resetConfigFailures clears the count of consecutive configuration failures of the instance associated with the given
+// node, if any
+func (r *instanceReconciler) resetConfigFailures(ctx context.Context, node *core.Node) error {
+	if node == nil {
+		return nil
+	}
+	return metadata.PatchNodeAnnotations(ctx, r.client, node, nil, []string{metadata.ConfigFailuresAnnotation})
+}
+
+// configFailures returns the number of consecutive configuration failures annotated on the given node
+func configFailures(node *core.Node) int {
+	failures, err := strconv.Atoi(node.GetAnnotations()[metadata.ConfigFailuresAnnotation])
+	if err != nil || failures < 0 {
+		// a missing or invalid count is treated as no failure
+		return 0
+	}
+	return failures
+}
+
+// configRetriesExhausted returns true if the configuration of the instance associated with the given node must no
+// longer be retried
+func (r *instanceReconciler) configRetriesExhausted(node *core.Node) bool {
+	if node == nil || r.maxConfigFailures <= 0 {
+		return false
+	}
+	if _, present := node.GetLabels()[metadata.RetryConfigLabel]; present {
+		return false
+	}
+	return configFailures(node) >= r.maxConfigFailures
+}
+
+// configFailed records a configuration failure of the instance associated with the given node, returning the given
+// configuration error. Nothing is recorded for instances which are not associated with a node yet.
+func (r *instanceReconciler) configFailed(node *core.Node, configErr error) error {
+	if node == nil {
+		return configErr
+	}
+	if err := r.recordConfigFailure(context.TODO(), node); err != nil {
+		// the configuration error is the one worth surfacing
+		r.log.Error(err, "unable to record configuration failure", "node", node.GetName())
+	}
+	return configErr
+}
+
+// recordConfigFailure increments the number of consecutive configuration failures annotated on the given node, and
+// generates an event if the configuration of its instance will no longer be retried
+func (r *instanceReconciler) recordConfigFailure(ctx context.Context, node *core.Node) error {
+	failures := configFailures(node) + 1
+	if err := metadata.PatchNodeAnnotations(ctx, r.client, node,
+		map[string]string{metadata.ConfigFailuresAnnotation: strconv.Itoa(failures)}, nil); err != nil {
+		return err
+	}
+	if r.configRetriesExhausted(node) {
+		r.recorder.Eventf(node, core.EventTypeWarning, "ConfigurationRetriesExhausted",
+			"Configuration failed %d consecutive times and will not be retried until the %s annotation is removed "+
+				"or the %s label is applied", failures, metadata.ConfigFailuresAnnotation, metadata.RetryConfigLabel)
+	}
+	return nil
 }
 
 // instanceFromNode returns an instance object for the given node. Requires a username that can be used to SSH into the
@@ -132,6 +225,7 @@ func (r *instanceReconciler) updateKubeletCA(node core.Node, contents []byte) er
 	}
 	nodeConfig, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR,
 		r.watchNamespace, winInstance, r.signer, nil, nil, r.platform)
+	recordSSHReachability(winInstance.Node, nodeConfig, err)
 	if err != nil {
 		return fmt.Errorf("error creating nodeConfig for instance %s: %w", winInstance.Address, err)
 	}
@@ -139,6 +233,28 @@ func (r *instanceReconciler) updateKubeletCA(node core.Node, contents []byte) er
 	return nodeConfig.UpdateKubeletClientCA(contents)
 }
 
+// sshDialTimer reports how long establishing an SSH connection took, as implemented by windows.Windows
+type sshDialTimer interface {
+	SSHDialDuration() time.Duration
+}
+
+// recordSSHReachability records whether WMCO could connect over SSH to the instance associated with the given node,
+// based on the result of creating a nodeConfig for the instance. Failures unrelated to the SSH connection, and
+// instances without a node, are not recorded.
+func recordSSHReachability(node *core.Node, conn sshDialTimer, err error) {
+	if node == nil {
+		return
+	}
+	if err == nil {
+		metrics.RecordSSHReachability(node.GetName(), true, conn.SSHDialDuration())
+		return
+	}
+	var connErr *windows.ConnectionErr
+	if errors.As(err, &connErr) {
+		metrics.RecordSSHReachability(node.GetName(), false, connErr.DialDuration())
+	}
+}
+
 // GetAddress returns a non-ipv6 address that can be used to reach a Windows node. This can be either an ipv4
 // or dns address.
 func GetAddress(addresses []core.NodeAddress) (string, error) {
@@ -154,6 +270,22 @@ func GetAddress(addresses []core.NodeAddress) (string, error) {
 	return "", fmt.Errorf("no usable address")
 }
 
+// ResolveNodeAddresses returns the address of each of the given nodes, as returned by GetAddress, keyed by node name.
+// Nodes without a usable address are left out of the map, and an error is returned for each of them.
+func ResolveNodeAddresses(nodes []core.Node) (map[string]string, []error) {
+	addresses := make(map[string]string, len(nodes))
+	var errs []error
+	for _, node := range nodes {
+		addr, err := GetAddress(node.Status.Addresses)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to get address of node %s: %w", node.GetName(), err))
+			continue
+		}
+		addresses[node.GetName()] = addr
+	}
+	return addresses, errs
+}
+
 // deconfigureInstance deconfigures the instance associated with the given node, removing the node from the cluster.
 func (r *instanceReconciler) deconfigureInstance(node *core.Node) error {
 	instance, err := r.instanceFromNode(node)
@@ -163,6 +295,7 @@ func (r *instanceReconciler) deconfigureInstance(node *core.Node) error {
 
 	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
 		instance, r.signer, nil, nil, r.platform)
+	recordSSHReachability(instance.Node, nc, err)
 	if err != nil {
 		return fmt.Errorf("failed to create new nodeconfig: %w", err)
 	}
@@ -173,6 +306,8 @@ func (r *instanceReconciler) deconfigureInstance(node *core.Node) error {
 	if err = r.client.Delete(context.TODO(), instance.Node); err != nil {
 		return fmt.Errorf("error deleting node %s: %w", instance.Node.GetName(), err)
 	}
+	metrics.RemoveCertificateExpiry(instance.Node.GetName())
+	metrics.RemoveSSHReachability(instance.Node.GetName())
 	return nil
 }
 
@@ -182,21 +317,24 @@ func windowsNodeVersionChangePredicate() predicate.Funcs {
 	return predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
 			// catch Machine-backed Windows node upgrades as they are re-created
-			return isWindowsNode(e.Object) && e.Object.GetAnnotations()[metadata.VersionAnnotation] == version.Get()
+			return isWindowsNode(e.Object) &&
+				version.Equal(e.Object.GetAnnotations()[metadata.VersionAnnotation], version.Get())
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			// catch BYOH Windows node upgrades to the current WMCO version as they are re-configured in place
 			return isWindowsNode(e.ObjectNew) &&
 				(e.ObjectOld.GetAnnotations()[metadata.VersionAnnotation] !=
 					e.ObjectNew.GetAnnotations()[metadata.VersionAnnotation]) &&
-				e.ObjectNew.GetAnnotations()[metadata.VersionAnnotation] == version.Get()
+				version.Equal(e.ObjectNew.GetAnnotations()[metadata.VersionAnnotation], version.Get())
 		},
 		GenericFunc: func(e event.GenericEvent) bool {
-			return isWindowsNode(e.Object) && e.Object.GetAnnotations()[metadata.VersionAnnotation] == version.Get()
+			return isWindowsNode(e.Object) &&
+				version.Equal(e.Object.GetAnnotations()[metadata.VersionAnnotation], version.Get())
 		},
 		DeleteFunc: func(e event.DeleteEvent) bool {
 			// catch if a node stuck at an older WMCO version is deleted
-			return isWindowsNode(e.Object) && e.Object.GetAnnotations()[metadata.VersionAnnotation] != version.Get()
+			return isWindowsNode(e.Object) &&
+				!version.Equal(e.Object.GetAnnotations()[metadata.VersionAnnotation], version.Get())
 		},
 	}
 }
@@ -208,13 +346,13 @@ func outdatedWindowsNodePredicate(byoh bool) predicate.Funcs {
 	return predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
 			return isValidWindowsNode(e.Object, byoh) &&
-				e.Object.GetAnnotations()[metadata.VersionAnnotation] != version.Get()
+				!version.Equal(e.Object.GetAnnotations()[metadata.VersionAnnotation], version.Get())
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			if !isValidWindowsNode(e.ObjectNew, byoh) {
 				return false
 			}
-			if e.ObjectNew.GetAnnotations()[metadata.VersionAnnotation] != version.Get() ||
+			if !version.Equal(e.ObjectNew.GetAnnotations()[metadata.VersionAnnotation], version.Get()) ||
 				e.ObjectNew.GetAnnotations()[nodeconfig.PubKeyHashAnnotation] !=
 					e.ObjectOld.GetAnnotations()[nodeconfig.PubKeyHashAnnotation] {
 				return true
@@ -223,7 +361,7 @@ func outdatedWindowsNodePredicate(byoh bool) predicate.Funcs {
 		},
 		GenericFunc: func(e event.GenericEvent) bool {
 			return isValidWindowsNode(e.Object, byoh) &&
-				e.Object.GetAnnotations()[metadata.VersionAnnotation] != version.Get()
+				!version.Equal(e.Object.GetAnnotations()[metadata.VersionAnnotation], version.Get())
 		},
 		DeleteFunc: func(e event.DeleteEvent) bool {
 			return isValidWindowsNode(e.Object, byoh)
@@ -301,3 +439,19 @@ func findUpgradingNodes(ctx context.Context, c client.Client) (*core.NodeList, e
 	}
 	return nodeList, nil
 }
+
+// NodesPendingRestart returns the Windows nodes whose underlying instances are awaiting a restart, i.e. have the reboot
+// annotation present. The annotation is cleared once the instance has been safely rebooted.
+func NodesPendingRestart(ctx context.Context, c client.Client) ([]core.Node, error) {
+	nodeList := &core.NodeList{}
+	if err := c.List(ctx, nodeList, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+		return nil, fmt.Errorf("error listing Windows nodes: %w", err)
+	}
+	var pendingRestart []core.Node
+	for _, node := range nodeList.Items {
+		if _, present := node.GetAnnotations()[metadata.RebootAnnotation]; present {
+			pendingRestart = append(pendingRestart, node)
+		}
+	}
+	return pendingRestart, nil
+}
@@ -1,11 +1,19 @@
 package controllers
 
 import (
+	"context"
 	"testing"
 
+	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 )
 
 func TestGetAddress(t *testing.T) {
@@ -62,3 +70,140 @@ func TestGetAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveNodeAddresses(t *testing.T) {
+	nodes := []core.Node{
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "ipv4"},
+			Status: core.NodeStatus{Addresses: []core.NodeAddress{
+				{Type: core.NodeInternalIP, Address: "::1"},
+				{Type: core.NodeInternalIP, Address: "10.0.0.1"}}},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "dns"},
+			Status: core.NodeStatus{Addresses: []core.NodeAddress{
+				{Type: core.NodeInternalDNS, Address: "windows-node"}}},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "ipv6-only"},
+			Status: core.NodeStatus{Addresses: []core.NodeAddress{
+				{Type: core.NodeInternalIP, Address: "::1"}}},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "no-address"},
+		},
+	}
+
+	addresses, errs := ResolveNodeAddresses(nodes)
+	assert.Equal(t, map[string]string{"ipv4": "10.0.0.1", "dns": "windows-node"}, addresses)
+	require.Len(t, errs, 2)
+	assert.Contains(t, errs[0].Error(), "ipv6-only")
+	assert.Contains(t, errs[1].Error(), "no-address")
+
+	addresses, errs = ResolveNodeAddresses(nil)
+	assert.Empty(t, addresses)
+	assert.Empty(t, errs)
+}
+
+func TestNodesPendingRestart(t *testing.T) {
+	windowsLabels := map[string]string{core.LabelOSStable: "windows"}
+	rebootAnnotation := map[string]string{metadata.RebootAnnotation: ""}
+	nodes := []*core.Node{
+		{ObjectMeta: meta.ObjectMeta{Name: "pending", Labels: windowsLabels, Annotations: rebootAnnotation}},
+		{ObjectMeta: meta.ObjectMeta{Name: "not-pending", Labels: windowsLabels}},
+		{ObjectMeta: meta.ObjectMeta{Name: "linux", Labels: map[string]string{core.LabelOSStable: "linux"},
+			Annotations: rebootAnnotation}},
+	}
+	builder := clientfake.NewClientBuilder()
+	for _, node := range nodes {
+		builder = builder.WithObjects(node)
+	}
+
+	pending, err := NodesPendingRestart(context.TODO(), builder.Build())
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "pending", pending[0].GetName())
+}
+
+func TestConfigRetryBudget(t *testing.T) {
+	ctx := context.Background()
+	newNode := func(failures string, nodeLabels map[string]string) *core.Node {
+		// the annotations of a node are never empty, as the kubelet annotates it
+		node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node", Labels: nodeLabels,
+			Annotations: map[string]string{"volumes.kubernetes.io/controller-managed-attach-detach": "true"}}}
+		if failures != "" {
+			node.Annotations[metadata.ConfigFailuresAnnotation] = failures
+		}
+		return node
+	}
+	testCases := []struct {
+		name              string
+		node              *core.Node
+		maxConfigFailures int
+		expectedFailures  string
+		expectedExhausted bool
+		expectedEvent     bool
+	}{
+		{
+			name:              "first failure",
+			node:              newNode("", nil),
+			maxConfigFailures: 3,
+			expectedFailures:  "1",
+		},
+		{
+			name:              "invalid count",
+			node:              newNode("invalid", nil),
+			maxConfigFailures: 3,
+			expectedFailures:  "1",
+		},
+		{
+			name:              "breaker trips",
+			node:              newNode("2", nil),
+			maxConfigFailures: 3,
+			expectedFailures:  "3",
+			expectedExhausted: true,
+			expectedEvent:     true,
+		},
+		{
+			name:              "breaker overridden",
+			node:              newNode("2", map[string]string{metadata.RetryConfigLabel: ""}),
+			maxConfigFailures: 3,
+			expectedFailures:  "3",
+		},
+		{
+			name:             "breaker disabled",
+			node:             newNode("10", nil),
+			expectedFailures: "11",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			c := clientfake.NewClientBuilder().WithObjects(test.node).Build()
+			recorder := record.NewFakeRecorder(1)
+			r := &instanceReconciler{client: c, log: logr.Discard(), recorder: recorder,
+				maxConfigFailures: test.maxConfigFailures}
+			node := &core.Node{}
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: test.node.GetName()}, node))
+
+			require.NoError(t, r.recordConfigFailure(ctx, node))
+			assert.Equal(t, test.expectedExhausted, r.configRetriesExhausted(node))
+			current := &core.Node{}
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, current))
+			assert.Equal(t, test.expectedFailures, current.GetAnnotations()[metadata.ConfigFailuresAnnotation])
+			assert.Equal(t, test.expectedExhausted, r.configRetriesExhausted(current))
+			if test.expectedEvent {
+				require.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, "ConfigurationRetriesExhausted")
+			} else {
+				assert.Empty(t, recorder.Events)
+			}
+
+			// a successful configuration resets the count
+			require.NoError(t, r.resetConfigFailures(ctx, current))
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, current))
+			assert.NotContains(t, current.GetAnnotations(), metadata.ConfigFailuresAnnotation)
+			assert.False(t, r.configRetriesExhausted(current))
+		})
+	}
+	assert.NoError(t, (&instanceReconciler{}).resetConfigFailures(ctx, nil))
+}
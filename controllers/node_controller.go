@@ -94,6 +94,7 @@ func (r *nodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (resul
 	}
 
 	if _, ok := node.GetAnnotations()[metadata.RebootAnnotation]; ok {
+		r.log.V(1).Info("instance restart required", "node", node.GetName())
 		// Create a new signer using the private key that the instances will be reconciled with
 		signer, err := signer.Create(types.NamespacedName{Namespace: r.watchNamespace,
 			Name: secrets.PrivateKeySecret}, r.client)
@@ -106,6 +107,7 @@ func (r *nodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (resul
 		}
 		nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
 			instanceInfo, signer, nil, nil, r.platform)
+		recordSSHReachability(node, nc, err)
 		if err != nil {
 			return ctrl.Result{}, fmt.Errorf("failed to create new nodeconfig: %w", err)
 		}
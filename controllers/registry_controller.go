@@ -100,6 +100,7 @@ func (r *registryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (r
 		}
 		nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
 			winInstance, r.signer, nil, nil, r.platform)
+		recordSSHReachability(&node, nc, err)
 		if err != nil {
 			return ctrl.Result{}, fmt.Errorf("failed to create new nodeconfig: %w", err)
 		}
@@ -53,8 +53,11 @@ const (
 	MachineOSLabel = "machine.openshift.io/os-id"
 	// WindowsMachineController is the name of this controller in logs and other outputs.
 	WindowsMachineController = "windowsmachine"
-	// IgnoreLabel is a label that will cause machines to be ignored by the Windows Machine controller
+	// IgnoreLabel is a label that will cause machines to be ignored by the Windows Machine controller, when set to
+	// IgnoreLabelValue
 	IgnoreLabel = "windowsmachineconfig.openshift.io/ignore"
+	// IgnoreLabelValue is the value of IgnoreLabel that causes machines to be ignored
+	IgnoreLabelValue = "true"
 )
 
 // WindowsMachineReconciler is used to create a controller which manages Windows Machine objects
@@ -65,7 +68,8 @@ type WindowsMachineReconciler struct {
 }
 
 // NewWindowsMachineReconciler returns a pointer to a WindowsMachineReconciler
-func NewWindowsMachineReconciler(mgr manager.Manager, clusterConfig cluster.Config, watchNamespace string) (*WindowsMachineReconciler, error) {
+func NewWindowsMachineReconciler(mgr manager.Manager, clusterConfig cluster.Config, watchNamespace string,
+	maxConfigFailures int) (*WindowsMachineReconciler, error) {
 	// The client provided by the GetClient() method of the manager is a split client that will always hit the API
 	// server when writing. When reading, the client will either use a cache populated by the informers backing the
 	// controllers, or in certain cases read directly from the API server. It will read from the server both for
@@ -98,6 +102,7 @@ func NewWindowsMachineReconciler(mgr manager.Manager, clusterConfig cluster.Conf
 			watchNamespace:       watchNamespace,
 			prometheusNodeConfig: pc,
 			platform:             clusterConfig.Platform(),
+			maxConfigFailures:    maxConfigFailures,
 		},
 		machineClient: machineClient,
 	}, nil
@@ -140,7 +145,7 @@ func (r *WindowsMachineReconciler) mapNodeToMachine(_ context.Context, object cl
 
 	// Map the Node to the associated Machine through the Node's UID
 	machines, err := r.machineClient.Machines(cluster.MachineAPINamespace).List(context.TODO(),
-		meta.ListOptions{LabelSelector: MachineOSLabel + "=Windows," + IgnoreLabel + "!=true"})
+		meta.ListOptions{LabelSelector: MachineOSLabel + "=Windows," + IgnoreLabel + "!=" + IgnoreLabelValue})
 	if err != nil {
 		r.log.Error(err, "could not get a list of machines")
 	}
@@ -177,7 +182,7 @@ func isWindowsMachine(labels map[string]string) bool {
 
 // isValidMachine returns true if the Machine given object is a Machine with a properly populated status
 func (r *WindowsMachineReconciler) isValidMachine(obj client.Object) bool {
-	if value := obj.GetLabels()[IgnoreLabel]; value == "true" {
+	if value := obj.GetLabels()[IgnoreLabel]; value == IgnoreLabelValue {
 		return false
 	}
 	machine := &mapi.Machine{}
@@ -297,7 +302,7 @@ func (r *WindowsMachineReconciler) Reconcile(ctx context.Context,
 				}
 				return ctrl.Result{}, r.deleteMachine(machine)
 			}
-			if node.Annotations[metadata.VersionAnnotation] == version.Get() {
+			if version.Equal(node.Annotations[metadata.VersionAnnotation], version.Get()) {
 				// version annotation exists with a valid value, node is fully configured.
 				// configure Prometheus when we have already configured Windows Nodes. This is required to update
 				// Endpoints object if it gets reverted when the operator pod restarts.
@@ -354,6 +359,14 @@ func (r *WindowsMachineReconciler) Reconcile(ctx context.Context,
 				"Machine %s authentication failure", machine.Name)
 			return ctrl.Result{}, r.deleteMachine(machine)
 		}
+		if errors.Is(err, errConfigRetriesExhausted) {
+			// the failure has already been reported on the node, retrying would fail the same way
+			return ctrl.Result{}, nil
+		}
+		if errors.Is(err, errConfigInProgress) {
+			// check again once the ongoing configuration is over
+			return ctrl.Result{Requeue: true}, nil
+		}
 		r.recorder.Eventf(machine, core.EventTypeWarning, "MachineSetupFailure",
 			"Machine %s configuration failure", machine.Name)
 		return ctrl.Result{}, err
@@ -412,6 +425,7 @@ func (r *WindowsMachineReconciler) configureMachine(ipAddress, instanceID, machi
 	if err != nil {
 		return err
 	}
+	instanceInfo.MachineBacked = true
 	// Get private key to encrypt instance usernames
 	privateKeyBytes, err := secrets.GetPrivateKey(kubeTypes.NamespacedName{Namespace: r.watchNamespace,
 		Name: secrets.PrivateKeySecret}, r.client)
@@ -0,0 +1,74 @@
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/patch"
+)
+
+const (
+	// annotationsPath is the JSON patch path of an object's annotations
+	annotationsPath = "/metadata/annotations"
+	// wmcoPrefix is the prefix of the annotations WMCO sets
+	wmcoPrefix = "windowsmachineconfig.openshift.io/"
+)
+
+// OwnedByWMCO returns true if the given annotation key is one WMCO sets
+func OwnedByWMCO(key string) bool {
+	return strings.HasPrefix(key, wmcoPrefix)
+}
+
+// sortedKeys returns the keys of the given map in order, so that the same annotations always result in the same patch
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReconcilePatch creates a comma-separated list of operations transforming the given current annotations of an object
+// so that the annotations for which owned returns true match the given desired annotations: missing annotations are
+// added, annotations with a different value are replaced, and owned annotations which are not desired are removed.
+// Annotations which are not owned are left untouched, and must not be desired. The patch holds no operation if the
+// owned annotations already match.
+func ReconcilePatch(current, desired map[string]string, owned func(string) bool) ([]byte, error) {
+	for _, key := range sortedKeys(desired) {
+		if !owned(key) {
+			return nil, fmt.Errorf("desired annotation %s is not owned", key)
+		}
+	}
+	patches := []*patch.JSONPatch{}
+	if len(current) == 0 {
+		// an object without annotations has no annotations map for the keys to be added to
+		if len(desired) > 0 {
+			patches = append(patches, patch.NewJSONPatch("add", annotationsPath, desired))
+		}
+		return json.Marshal(patches)
+	}
+	for _, key := range sortedKeys(desired) {
+		value, present := current[key]
+		switch {
+		case !present:
+			patches = append(patches, patch.NewJSONPatch("add", keyPath(key), desired[key]))
+		case value != desired[key]:
+			patches = append(patches, patch.NewJSONPatch("replace", keyPath(key), desired[key]))
+		}
+	}
+	for _, key := range sortedKeys(current) {
+		if _, present := desired[key]; !present && owned(key) {
+			patches = append(patches, patch.NewJSONPatch("remove", keyPath(key), nil))
+		}
+	}
+	return json.Marshal(patches)
+}
+
+// keyPath returns the JSON patch path of the annotation with the given key
+func keyPath(key string) string {
+	return path.Join(annotationsPath, patch.EscapeJSONPointer(key))
+}
@@ -0,0 +1,95 @@
+package annotations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnedByWMCO(t *testing.T) {
+	assert.True(t, OwnedByWMCO("windowsmachineconfig.openshift.io/version"))
+	assert.False(t, OwnedByWMCO("machine.openshift.io/machine"))
+	assert.False(t, OwnedByWMCO("windowsmachineconfig.openshift.io"))
+}
+
+func TestReconcilePatch(t *testing.T) {
+	testCases := []struct {
+		name        string
+		current     map[string]string
+		desired     map[string]string
+		expectedOut string
+		expectedErr bool
+	}{
+		{
+			name:        "no annotations",
+			expectedOut: `[]`,
+		},
+		{
+			name: "already equal",
+			current: map[string]string{"windowsmachineconfig.openshift.io/version": "1.0",
+				"machine.openshift.io/machine": "m"},
+			desired:     map[string]string{"windowsmachineconfig.openshift.io/version": "1.0"},
+			expectedOut: `[]`,
+		},
+		{
+			name:    "add to an object without annotations",
+			desired: map[string]string{"windowsmachineconfig.openshift.io/version": "1.0"},
+			expectedOut: `[{"op":"add","path":"/metadata/annotations",` +
+				`"value":{"windowsmachineconfig.openshift.io/version":"1.0"}}]`,
+		},
+		{
+			name:    "add",
+			current: map[string]string{"machine.openshift.io/machine": "m"},
+			desired: map[string]string{"windowsmachineconfig.openshift.io/version": "1.0",
+				"windowsmachineconfig.openshift.io/desired-version": "1.0"},
+			expectedOut: `[{"op":"add","path":"/metadata/annotations/windowsmachineconfig.openshift.io~1desired-version",` +
+				`"value":"1.0"},` +
+				`{"op":"add","path":"/metadata/annotations/windowsmachineconfig.openshift.io~1version","value":"1.0"}]`,
+		},
+		{
+			name:    "change",
+			current: map[string]string{"windowsmachineconfig.openshift.io/version": "1.0"},
+			desired: map[string]string{"windowsmachineconfig.openshift.io/version": "2.0"},
+			expectedOut: `[{"op":"replace","path":"/metadata/annotations/windowsmachineconfig.openshift.io~1version",` +
+				`"value":"2.0"}]`,
+		},
+		{
+			name: "remove only owned annotations",
+			current: map[string]string{"windowsmachineconfig.openshift.io/reboot-required": "true",
+				"machine.openshift.io/machine": "m"},
+			expectedOut: `[{"op":"remove",` +
+				`"path":"/metadata/annotations/windowsmachineconfig.openshift.io~1reboot-required"}]`,
+		},
+		{
+			name: "add, change and remove",
+			current: map[string]string{"windowsmachineconfig.openshift.io/version": "1.0",
+				"windowsmachineconfig.openshift.io/reboot-required": "true", "machine.openshift.io/machine": "m"},
+			desired: map[string]string{"windowsmachineconfig.openshift.io/version": "2.0",
+				"windowsmachineconfig.openshift.io/desired-version": "2.0"},
+			expectedOut: `[{"op":"add","path":"/metadata/annotations/windowsmachineconfig.openshift.io~1desired-version",` +
+				`"value":"2.0"},` +
+				`{"op":"replace","path":"/metadata/annotations/windowsmachineconfig.openshift.io~1version",` +
+				`"value":"2.0"},` +
+				`{"op":"remove",` +
+				`"path":"/metadata/annotations/windowsmachineconfig.openshift.io~1reboot-required"}]`,
+		},
+		{
+			name:        "desired annotation not owned",
+			current:     map[string]string{"machine.openshift.io/machine": "m"},
+			desired:     map[string]string{"machine.openshift.io/machine": "other"},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := ReconcilePatch(test.current, test.desired, OwnedByWMCO)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedOut, string(out))
+		})
+	}
+}
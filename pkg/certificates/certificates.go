@@ -1,8 +1,14 @@
 package certificates
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"sort"
+	"time"
 
 	core "k8s.io/api/core/v1"
 )
@@ -44,3 +50,140 @@ func GetCAsFromConfigMap(configMap *core.ConfigMap, key string) ([]byte, error)
 		return nil, fmt.Errorf("%s not found in %s/%s", key, configMap.Namespace, configMap.Name)
 	}
 }
+
+// GetAllCAsFromConfigMap returns a PEM encoded CA bundle containing the de-duplicated certificates found across every
+// key of the given ConfigMap, along with the sorted list of keys the certificates were read from. Keys whose value does
+// not hold any PEM encoded certificate are ignored, so that a CA is not missed when a new key is added to the ConfigMap.
+func GetAllCAsFromConfigMap(configMap *core.ConfigMap) ([]byte, []string, error) {
+	if configMap == nil {
+		return nil, nil, fmt.Errorf("configMap cannot be nil")
+	}
+	keySet := make(map[string]struct{}, len(configMap.Data)+len(configMap.BinaryData))
+	for key := range configMap.Data {
+		keySet[key] = struct{}{}
+	}
+	for key := range configMap.BinaryData {
+		keySet[key] = struct{}{}
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var bundle bytes.Buffer
+	var consumedKeys []string
+	seen := make(map[[sha256.Size]byte]struct{})
+	for _, key := range keys {
+		data, err := GetCAsFromConfigMap(configMap, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs, err := ParseCertificates(data)
+		if err != nil || len(certs) == 0 {
+			// not CA material
+			continue
+		}
+		consumedKeys = append(consumedKeys, key)
+		for _, cert := range certs {
+			fingerprint := sha256.Sum256(cert.Raw)
+			if _, ok := seen[fingerprint]; ok {
+				continue
+			}
+			seen[fingerprint] = struct{}{}
+			if err := pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+				return nil, nil, fmt.Errorf("error encoding certificate %s: %w", cert.Subject, err)
+			}
+		}
+	}
+	return bundle.Bytes(), consumedKeys, nil
+}
+
+// MergeCABundles returns a PEM encoded CA bundle containing every certificate present in either the existing or the
+// incoming bundle, each once. Certificates are de-duplicated by their SHA256 fingerprint and expired certificates are
+// dropped.
+// The resulting bundle is sorted by the certificates' NotBefore time, using the fingerprint to break ties, so that
+// merging the same set of certificates always results in the same bundle.
+func MergeCABundles(existing, incoming []byte) ([]byte, error) {
+	existingCerts, err := ParseCertificates(existing)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing existing CA bundle: %w", err)
+	}
+	incomingCerts, err := ParseCertificates(incoming)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing incoming CA bundle: %w", err)
+	}
+
+	now := time.Now()
+	certsByFingerprint := make(map[[sha256.Size]byte]*x509.Certificate)
+	for _, cert := range append(existingCerts, incomingCerts...) {
+		if now.After(cert.NotAfter) {
+			// drop expired certificates, they can no longer be used to verify clients
+			continue
+		}
+		certsByFingerprint[sha256.Sum256(cert.Raw)] = cert
+	}
+
+	type fingerprintedCert struct {
+		fingerprint [sha256.Size]byte
+		cert        *x509.Certificate
+	}
+	merged := make([]fingerprintedCert, 0, len(certsByFingerprint))
+	for fingerprint, cert := range certsByFingerprint {
+		merged = append(merged, fingerprintedCert{fingerprint: fingerprint, cert: cert})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if !merged[i].cert.NotBefore.Equal(merged[j].cert.NotBefore) {
+			return merged[i].cert.NotBefore.Before(merged[j].cert.NotBefore)
+		}
+		return bytes.Compare(merged[i].fingerprint[:], merged[j].fingerprint[:]) < 0
+	})
+
+	var bundle bytes.Buffer
+	for _, entry := range merged {
+		if err := pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: entry.cert.Raw}); err != nil {
+			return nil, fmt.Errorf("error encoding certificate %s: %w", entry.cert.Subject, err)
+		}
+	}
+	return bundle.Bytes(), nil
+}
+
+// ParseCertificates returns the certificates contained in the given PEM data. Blocks which are not certificates are
+// ignored.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// FileReceiver fetches the contents of files on a remote system, as implemented by windows.Windows
+type FileReceiver interface {
+	// ReceiveFile returns the contents of the file at the given path
+	ReceiveFile(string) ([]byte, error)
+}
+
+// FetchCertificates returns the certificates in the PEM file at the given path on the remote system. Data which is not
+// a PEM encoded certificate is ignored, and an error is returned if the file holds no certificates.
+func FetchCertificates(node FileReceiver, remotePath string) ([]*x509.Certificate, error) {
+	data, err := node.ReceiveFile(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", remotePath, err)
+	}
+	certs, err := ParseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", remotePath, err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", remotePath)
+	}
+	return certs, nil
+}
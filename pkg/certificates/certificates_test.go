@@ -0,0 +1,271 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+)
+
+// generateCertPEM returns a PEM encoded self-signed CA certificate with the given common name and validity period
+func generateCertPEM(t *testing.T, commonName string, notBefore, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// commonNames returns the common names of the certificates in the given bundle, in order
+func commonNames(t *testing.T, bundle []byte) []string {
+	certs, err := ParseCertificates(bundle)
+	require.NoError(t, err)
+	var names []string
+	for _, cert := range certs {
+		names = append(names, cert.Subject.CommonName)
+	}
+	return names
+}
+
+func TestMergeCABundles(t *testing.T) {
+	now := time.Now()
+	oldCA := generateCertPEM(t, "old", now.Add(-48*time.Hour), now.Add(24*time.Hour))
+	newCA := generateCertPEM(t, "new", now.Add(-time.Hour), now.Add(365*24*time.Hour))
+	expiredCA := generateCertPEM(t, "expired", now.Add(-72*time.Hour), now.Add(-time.Hour))
+
+	testCases := []struct {
+		name        string
+		existing    []byte
+		incoming    []byte
+		expected    []string
+		expectedErr bool
+	}{
+		{
+			name:     "both empty",
+			existing: nil,
+			incoming: nil,
+			expected: nil,
+		},
+		{
+			name:     "disjoint bundles",
+			existing: oldCA,
+			incoming: newCA,
+			expected: []string{"old", "new"},
+		},
+		{
+			name:     "overlapping bundles",
+			existing: append(append([]byte{}, oldCA...), newCA...),
+			incoming: newCA,
+			expected: []string{"old", "new"},
+		},
+		{
+			name:     "duplicates within a single bundle",
+			existing: append(append([]byte{}, newCA...), newCA...),
+			incoming: nil,
+			expected: []string{"new"},
+		},
+		{
+			name:     "sorted regardless of input order",
+			existing: newCA,
+			incoming: oldCA,
+			expected: []string{"old", "new"},
+		},
+		{
+			name:     "expired certificates dropped",
+			existing: append(append([]byte{}, expiredCA...), oldCA...),
+			incoming: append(append([]byte{}, expiredCA...), newCA...),
+			expected: []string{"old", "new"},
+		},
+		{
+			name:        "invalid certificate",
+			existing:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}),
+			incoming:    newCA,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			merged, err := MergeCABundles(test.existing, test.incoming)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, commonNames(t, merged))
+			// merging a bundle with itself must be a no-op
+			remerged, err := MergeCABundles(merged, merged)
+			require.NoError(t, err)
+			assert.Equal(t, merged, remerged)
+		})
+	}
+}
+
+func TestGetAllCAsFromConfigMap(t *testing.T) {
+	now := time.Now()
+	firstCA := generateCertPEM(t, "first", now.Add(-time.Hour), now.Add(24*time.Hour))
+	secondCA := generateCertPEM(t, "second", now.Add(-time.Hour), now.Add(24*time.Hour))
+
+	testCases := []struct {
+		name         string
+		configMap    *core.ConfigMap
+		expectedCAs  []string
+		expectedKeys []string
+		expectedErr  bool
+	}{
+		{
+			name:        "nil ConfigMap",
+			configMap:   nil,
+			expectedErr: true,
+		},
+		{
+			name:      "no data",
+			configMap: &core.ConfigMap{},
+		},
+		{
+			name: "single key",
+			configMap: &core.ConfigMap{Data: map[string]string{
+				CABundleKey: string(firstCA),
+			}},
+			expectedCAs:  []string{"first"},
+			expectedKeys: []string{CABundleKey},
+		},
+		{
+			name: "multiple keys with duplicates",
+			configMap: &core.ConfigMap{
+				Data: map[string]string{
+					CABundleKey:      string(append(append([]byte{}, firstCA...), secondCA...)),
+					"new-bundle.crt": string(secondCA),
+				},
+				BinaryData: map[string][]byte{
+					"binary.crt": firstCA,
+				},
+			},
+			expectedCAs:  []string{"first", "second"},
+			expectedKeys: []string{"binary.crt", CABundleKey, "new-bundle.crt"},
+		},
+		{
+			name: "non-PEM keys ignored",
+			configMap: &core.ConfigMap{Data: map[string]string{
+				CABundleKey: string(secondCA),
+				"config":    "not a certificate",
+				"invalid":   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")})),
+			}},
+			expectedCAs:  []string{"second"},
+			expectedKeys: []string{CABundleKey},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			bundle, keys, err := GetAllCAsFromConfigMap(test.configMap)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedCAs, commonNames(t, bundle))
+			assert.Equal(t, test.expectedKeys, keys)
+		})
+	}
+}
+
+// fakeFileReceiver serves files from memory
+type fakeFileReceiver map[string][]byte
+
+func (f fakeFileReceiver) ReceiveFile(remotePath string) ([]byte, error) {
+	content, ok := f[remotePath]
+	if !ok {
+		return nil, fmt.Errorf("error opening remote file %s: %w", remotePath, os.ErrNotExist)
+	}
+	return content, nil
+}
+
+func TestFetchCertificates(t *testing.T) {
+	now := time.Now()
+	first := generateCertPEM(t, "first", now.Add(-time.Hour), now.Add(time.Hour))
+	second := generateCertPEM(t, "second", now.Add(-time.Hour), now.Add(time.Hour))
+	third := generateCertPEM(t, "third", now.Add(-time.Hour), now.Add(time.Hour))
+	bundle := bytes.Join([][]byte{first, second, third}, nil)
+	testCases := []struct {
+		name          string
+		content       []byte
+		expectedNames []string
+		expectedErr   bool
+	}{
+		{
+			name:          "multiple certificates",
+			content:       bundle,
+			expectedNames: []string{"first", "second", "third"},
+		},
+		{
+			name:          "CRLF line endings and surrounding whitespace",
+			content:       append([]byte("\r\n  \r\n"), bytes.ReplaceAll(bundle, []byte("\n"), []byte("\r\n"))...),
+			expectedNames: []string{"first", "second", "third"},
+		},
+		{
+			name:          "trailing garbage bytes",
+			content:       append(append([]byte{}, bundle...), []byte("\x00\xff garbage -----BEGIN")...),
+			expectedNames: []string{"first", "second", "third"},
+		},
+		{
+			name:          "non-certificate blocks",
+			content:       append(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}), first...),
+			expectedNames: []string{"first"},
+		},
+		{
+			name:        "no certificates",
+			content:     []byte("not a certificate"),
+			expectedErr: true,
+		},
+		{
+			name:        "corrupt certificate",
+			content:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("corrupt")}),
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			certs, err := FetchCertificates(fakeFileReceiver{"C:\\k\\kubelet-ca.crt": test.content},
+				"C:\\k\\kubelet-ca.crt")
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, cert := range certs {
+				names = append(names, cert.Subject.CommonName)
+			}
+			assert.Equal(t, test.expectedNames, names)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := FetchCertificates(fakeFileReceiver{}, "C:\\k\\kubelet-ca.crt")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
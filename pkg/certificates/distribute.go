@@ -0,0 +1,62 @@
+package certificates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// BundleTarget is a node the kubelet client CA bundle can be copied to
+type BundleTarget interface {
+	// Name returns the name of the node, used to identify it in errors
+	Name() string
+	// UpdateKubeletClientCA copies the given CA bundle to the node
+	UpdateKubeletClientCA([]byte) error
+}
+
+// DistributeBundleToNodes copies the given CA bundle to the given nodes, updating up to maxConcurrent nodes at a time.
+// A failure to update a node does not prevent the remaining nodes from being updated, the errors of all the nodes are
+// combined in the error returned. Nodes which have not been started on when the context is cancelled are skipped and
+// reported as failed.
+func DistributeBundleToNodes(ctx context.Context, nodes []BundleTarget, bundle []byte, maxConcurrent int) error {
+	if maxConcurrent < 1 {
+		return fmt.Errorf("invalid maximum number of concurrent updates %d, must be at least 1", maxConcurrent)
+	}
+	var mu sync.Mutex
+	var errs []error
+	addErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+
+	var wg sync.WaitGroup
+	// slots bounds the number of nodes being updated at the same time
+	slots := make(chan struct{}, maxConcurrent)
+	for i, node := range nodes {
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		// a free slot and a cancelled context may be ready at the same time, the cancellation takes precedence
+		if ctx.Err() != nil {
+			for _, skipped := range nodes[i:] {
+				addErr(fmt.Errorf("node %s: CA bundle not copied: %w", skipped.Name(), ctx.Err()))
+			}
+			break
+		}
+		wg.Add(1)
+		go func(node BundleTarget) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := node.UpdateKubeletClientCA(bundle); err != nil {
+				addErr(fmt.Errorf("node %s: %w", node.Name(), err))
+			}
+		}(node)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
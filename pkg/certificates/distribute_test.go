@@ -0,0 +1,142 @@
+package certificates
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBundleTarget records the bundles copied to it, failing with the given error if set
+type fakeBundleTarget struct {
+	name string
+	err  error
+	// delay is the time taken to copy a bundle
+	delay time.Duration
+	// active and maxActive, if set, track the number of targets being updated at the same time
+	active    *int32
+	maxActive *int32
+
+	mu       sync.Mutex
+	received [][]byte
+}
+
+func (f *fakeBundleTarget) Name() string { return f.name }
+
+func (f *fakeBundleTarget) UpdateKubeletClientCA(bundle []byte) error {
+	if f.active != nil {
+		current := atomic.AddInt32(f.active, 1)
+		defer atomic.AddInt32(f.active, -1)
+		for {
+			highest := atomic.LoadInt32(f.maxActive)
+			if current <= highest || atomic.CompareAndSwapInt32(f.maxActive, highest, current) {
+				break
+			}
+		}
+	}
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.received = append(f.received, bundle)
+	return f.err
+}
+
+func TestDistributeBundleToNodes(t *testing.T) {
+	bundle := []byte("bundle")
+	testCases := []struct {
+		name          string
+		nodes         []*fakeBundleTarget
+		maxConcurrent int
+		expectedErrs  []string
+	}{
+		{
+			name: "all nodes succeed",
+			nodes: []*fakeBundleTarget{
+				{name: "node-a"}, {name: "node-b"}, {name: "node-c"},
+			},
+			maxConcurrent: 2,
+		},
+		{
+			name: "some nodes fail",
+			nodes: []*fakeBundleTarget{
+				{name: "node-a"},
+				{name: "node-b", err: fmt.Errorf("connection refused")},
+				{name: "node-c"},
+				{name: "node-d", err: fmt.Errorf("no route to host")},
+			},
+			maxConcurrent: 2,
+			expectedErrs:  []string{"node node-b: connection refused", "node node-d: no route to host"},
+		},
+		{
+			name: "all nodes fail sequentially",
+			nodes: []*fakeBundleTarget{
+				{name: "node-a", err: fmt.Errorf("timeout")},
+				{name: "node-b", err: fmt.Errorf("timeout")},
+			},
+			maxConcurrent: 1,
+			expectedErrs:  []string{"node node-a: timeout", "node node-b: timeout"},
+		},
+		{
+			name:          "no nodes",
+			maxConcurrent: 1,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var targets []BundleTarget
+			for _, node := range test.nodes {
+				targets = append(targets, node)
+			}
+			err := DistributeBundleToNodes(context.Background(), targets, bundle, test.maxConcurrent)
+			// every node is attempted, regardless of the failures of others
+			for _, node := range test.nodes {
+				assert.Equal(t, [][]byte{bundle}, node.received, node.name)
+			}
+			if len(test.expectedErrs) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, expected := range test.expectedErrs {
+				assert.Contains(t, err.Error(), expected)
+			}
+			for _, node := range test.nodes {
+				if node.err == nil {
+					assert.NotContains(t, err.Error(), node.name)
+				}
+			}
+		})
+	}
+}
+
+func TestDistributeBundleToNodesConcurrency(t *testing.T) {
+	var active, maxActive int32
+	var targets []BundleTarget
+	for i := 0; i < 10; i++ {
+		targets = append(targets, &fakeBundleTarget{name: fmt.Sprintf("node-%d", i), delay: 10 * time.Millisecond,
+			active: &active, maxActive: &maxActive})
+	}
+	require.NoError(t, DistributeBundleToNodes(context.Background(), targets, []byte("bundle"), 3))
+	assert.LessOrEqual(t, maxActive, int32(3))
+	assert.Greater(t, maxActive, int32(1))
+
+	assert.Error(t, DistributeBundleToNodes(context.Background(), targets, []byte("bundle"), 0))
+}
+
+func TestDistributeBundleToNodesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	nodes := []*fakeBundleTarget{{name: "node-a"}, {name: "node-b"}}
+	err := DistributeBundleToNodes(ctx, []BundleTarget{nodes[0], nodes[1]}, []byte("bundle"), 1)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	for _, node := range nodes {
+		assert.Empty(t, node.received)
+		assert.Contains(t, err.Error(), node.name)
+	}
+}
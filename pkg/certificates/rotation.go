@@ -0,0 +1,69 @@
+package certificates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sretry "k8s.io/client-go/util/retry"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/patch"
+	"github.com/openshift/windows-machine-config-operator/pkg/retry"
+)
+
+const (
+	// KubeAPIServerToKubeletSignerSecret is the name of the Secret, in the KubeApiServerOperatorNamespace namespace,
+	// holding the signer of the kube-apiserver client certificate trusted by kubelet
+	KubeAPIServerToKubeletSignerSecret = "kube-apiserver-to-kubelet-signer"
+	// certificateNotAfterAnnotation is the annotation holding the expiry of the signer certificate. The kube-apiserver
+	// operator generates a new signer when it is missing.
+	certificateNotAfterAnnotation = "auth.openshift.io/certificate-not-after"
+)
+
+// SecretGetPatcher gets and patches the Secrets of a namespace, as implemented by the typed client-go Secrets client
+type SecretGetPatcher interface {
+	Get(ctx context.Context, name string, opts meta.GetOptions) (*core.Secret, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts meta.PatchOptions,
+		subresources ...string) (*core.Secret, error)
+}
+
+// ForceKubeAPIServerCertificateRotation makes the kube-apiserver operator rotate the kube-apiserver to kubelet signer,
+// by removing the certificate-not-after annotation from its Secret, which must be reachable through the given client.
+// The Secret is read again before each attempt, and the patch is retried on conflict and on transient API errors.
+// The error of the last attempt is returned as is.
+func ForceKubeAPIServerCertificateRotation(ctx context.Context, secrets SecretGetPatcher) error {
+	return k8sretry.OnError(k8sretry.DefaultBackoff, retry.IsTransientAPIError, func() error {
+		return k8sretry.RetryOnConflict(k8sretry.DefaultBackoff, func() error {
+			secret, err := secrets.Get(ctx, KubeAPIServerToKubeletSignerSecret, meta.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if _, present := secret.GetAnnotations()[certificateNotAfterAnnotation]; !present {
+				// the rotation has already been triggered
+				return nil
+			}
+			patchData, err := generateRotationPatch(secret)
+			if err != nil {
+				return fmt.Errorf("error creating rotation patch: %w", err)
+			}
+			_, err = secrets.Patch(ctx, KubeAPIServerToKubeletSignerSecret, types.JSONPatchType, patchData,
+				meta.PatchOptions{})
+			return err
+		})
+	})
+}
+
+// generateRotationPatch returns the patch removing the certificate-not-after annotation from the given Secret. The
+// patch replaces the resourceVersion of the Secret with its current value, for it to be rejected with a conflict if
+// the Secret has been modified since.
+func generateRotationPatch(secret *core.Secret) ([]byte, error) {
+	return json.Marshal([]*patch.JSONPatch{
+		patch.NewJSONPatch("remove",
+			path.Join("/metadata/annotations", patch.EscapeJSONPointer(certificateNotAfterAnnotation)), nil),
+		patch.NewJSONPatch("replace", "/metadata/resourceVersion", secret.GetResourceVersion()),
+	})
+}
@@ -0,0 +1,134 @@
+package certificates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeSecrets serves a single Secret, failing the Get and Patch calls with the given errors in order
+type fakeSecrets struct {
+	secret    *core.Secret
+	getErrs   []error
+	patchErrs []error
+	// gets and patches are the number of calls made
+	gets    int
+	patches []string
+}
+
+func (f *fakeSecrets) Get(_ context.Context, name string, _ meta.GetOptions) (*core.Secret, error) {
+	f.gets++
+	if len(f.getErrs) > 0 {
+		err := f.getErrs[0]
+		f.getErrs = f.getErrs[1:]
+		return nil, err
+	}
+	return f.secret.DeepCopy(), nil
+}
+
+func (f *fakeSecrets) Patch(_ context.Context, name string, pt types.PatchType, data []byte, _ meta.PatchOptions,
+	_ ...string) (*core.Secret, error) {
+	f.patches = append(f.patches, string(data))
+	if len(f.patchErrs) > 0 {
+		err := f.patchErrs[0]
+		f.patchErrs = f.patchErrs[1:]
+		return nil, err
+	}
+	delete(f.secret.Annotations, certificateNotAfterAnnotation)
+	return f.secret.DeepCopy(), nil
+}
+
+func TestForceKubeAPIServerCertificateRotation(t *testing.T) {
+	resource := schema.GroupResource{Resource: "secrets"}
+	conflict := k8sapierrors.NewConflict(resource, KubeAPIServerToKubeletSignerSecret, errors.New("modified"))
+	testCases := []struct {
+		name            string
+		annotations     map[string]string
+		getErrs         []error
+		patchErrs       []error
+		expectedGets    int
+		expectedPatches int
+		expectedErr     func(error) bool
+	}{
+		{
+			name:            "rotation triggered",
+			annotations:     map[string]string{certificateNotAfterAnnotation: "2026-10-15T00:00:00Z"},
+			expectedGets:    1,
+			expectedPatches: 1,
+		},
+		{
+			name:            "conflict then success",
+			annotations:     map[string]string{certificateNotAfterAnnotation: "2026-10-15T00:00:00Z"},
+			patchErrs:       []error{conflict},
+			expectedGets:    2,
+			expectedPatches: 2,
+		},
+		{
+			name:            "transient error then success",
+			annotations:     map[string]string{certificateNotAfterAnnotation: "2026-10-15T00:00:00Z"},
+			patchErrs:       []error{k8sapierrors.NewInternalError(errors.New("etcd unavailable"))},
+			expectedGets:    2,
+			expectedPatches: 2,
+		},
+		{
+			name:         "rotation already triggered",
+			annotations:  map[string]string{"other": ""},
+			expectedGets: 1,
+		},
+		{
+			name:        "non transient error",
+			annotations: map[string]string{certificateNotAfterAnnotation: "2026-10-15T00:00:00Z"},
+			patchErrs: []error{k8sapierrors.NewForbidden(resource, KubeAPIServerToKubeletSignerSecret,
+				errors.New("denied"))},
+			expectedGets:    1,
+			expectedPatches: 1,
+			expectedErr:     k8sapierrors.IsForbidden,
+		},
+		{
+			name:         "deadline exceeded",
+			getErrs:      []error{context.DeadlineExceeded},
+			expectedGets: 1,
+			expectedErr:  func(err error) bool { return errors.Is(err, context.DeadlineExceeded) },
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			secrets := &fakeSecrets{
+				secret: &core.Secret{ObjectMeta: meta.ObjectMeta{Name: KubeAPIServerToKubeletSignerSecret,
+					Namespace: KubeApiServerOperatorNamespace, Annotations: test.annotations, ResourceVersion: "7"}},
+				getErrs:   test.getErrs,
+				patchErrs: test.patchErrs,
+			}
+			err := ForceKubeAPIServerCertificateRotation(context.Background(), secrets)
+			assert.Equal(t, test.expectedGets, secrets.gets)
+			assert.Len(t, secrets.patches, test.expectedPatches)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				assert.True(t, test.expectedErr(err), "unexpected error %v", err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotContains(t, secrets.secret.Annotations, certificateNotAfterAnnotation)
+		})
+	}
+}
+
+func TestGenerateRotationPatch(t *testing.T) {
+	patchData, err := generateRotationPatch(&core.Secret{ObjectMeta: meta.ObjectMeta{ResourceVersion: "7"}})
+	require.NoError(t, err)
+	var patches []map[string]interface{}
+	require.NoError(t, json.Unmarshal(patchData, &patches))
+	assert.Equal(t, []map[string]interface{}{
+		{"op": "remove", "path": "/metadata/annotations/auth.openshift.io~1certificate-not-after"},
+		{"op": "replace", "path": "/metadata/resourceVersion", "value": "7"},
+	}, patches)
+}
@@ -0,0 +1,53 @@
+package certificates
+
+import (
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+const (
+	// ConfigMapKind is the kind of the CA sources held by ConfigMaps
+	ConfigMapKind = "ConfigMap"
+	// ControllerConfigKind is the kind of the CA sources held by ControllerConfigs
+	ControllerConfigKind = "ControllerConfig"
+)
+
+// CASource is an object holding a CA bundle WMCO copies to Windows nodes
+type CASource struct {
+	// Description is what the CA bundle is trusted for
+	Description string
+	// Kind is the kind of the object holding the CA bundle
+	Kind string
+	// Namespace is the namespace of the object, empty for cluster scoped objects and for objects in the namespace WMCO
+	// is deployed in
+	Namespace string
+	// Name is the name of the object
+	Name string
+	// Key is the data key holding the CA bundle, or the JSON path of the field holding it for other kinds of objects
+	Key string
+	// NodePath is the location the CA bundle is copied to on Windows nodes
+	NodePath string
+	// ProxyOnly is true if the CA bundle is only copied when a cluster-wide proxy is enabled
+	ProxyOnly bool
+}
+
+// RequiredCASources returns the sources of every CA bundle WMCO copies to Windows nodes, copied to the given locations
+// of a node
+func RequiredCASources(paths windows.Paths) []CASource {
+	return []CASource{
+		{
+			Description: "kubelet client CA, trusted by kubelet to authenticate the kube-apiserver",
+			Kind:        ControllerConfigKind,
+			Name:        "machine-config-controller",
+			Key:         "spec.kubeAPIServerServingCAData",
+			NodePath:    paths.KubeletCACertPath,
+		},
+		{
+			Description: "cluster-wide proxy trusted CA, trusted by node components reaching out through the proxy",
+			Kind:        ConfigMapKind,
+			Name:        ProxyCertsConfigMap,
+			Key:         CABundleKey,
+			NodePath:    windows.TrustedCABundlePath,
+			ProxyOnly:   true,
+		},
+	}
+}
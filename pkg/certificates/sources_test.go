@@ -0,0 +1,51 @@
+package certificates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+func TestRequiredCASources(t *testing.T) {
+	sources := RequiredCASources(windows.NodePaths())
+	nodePaths := make(map[string]CASource)
+	for _, source := range sources {
+		assert.NotEmpty(t, source.Description)
+		assert.NotEmpty(t, source.Name)
+		assert.NotEmpty(t, source.Key)
+		_, duplicate := nodePaths[source.NodePath]
+		assert.False(t, duplicate, "multiple sources are copied to %s", source.NodePath)
+		nodePaths[source.NodePath] = source
+	}
+
+	kubeletCA, present := nodePaths[windows.NodePaths().KubeletCACertPath]
+	if assert.True(t, present, "kubelet client CA source missing") {
+		assert.Equal(t, ControllerConfigKind, kubeletCA.Kind)
+		assert.Equal(t, "machine-config-controller", kubeletCA.Name)
+		assert.False(t, kubeletCA.ProxyOnly)
+	}
+	proxyCA, present := nodePaths[windows.TrustedCABundlePath]
+	if assert.True(t, present, "proxy trusted CA source missing") {
+		assert.Equal(t, ConfigMapKind, proxyCA.Kind)
+		assert.Equal(t, ProxyCertsConfigMap, proxyCA.Name)
+		assert.Equal(t, CABundleKey, proxyCA.Key)
+		// the trusted CA ConfigMap is created in the namespace WMCO is deployed in
+		assert.Empty(t, proxyCA.Namespace)
+		assert.True(t, proxyCA.ProxyOnly)
+	}
+}
+
+func TestRequiredCASourcesInstallDir(t *testing.T) {
+	paths := windows.InstancePaths(&instance.Info{InstallDir: "D:\\kubernetes"})
+	var kubeletCAPaths []string
+	for _, source := range RequiredCASources(paths) {
+		if source.Kind == ControllerConfigKind {
+			kubeletCAPaths = append(kubeletCAPaths, source.NodePath)
+		}
+	}
+	// the kubelet client CA is copied within the install directory of the node
+	assert.Equal(t, []string{"D:\\kubernetes\\kubelet-ca.crt"}, kubeletCAPaths)
+}
@@ -201,9 +201,10 @@ func removeServices(svcMgr manager.Manager, services []servicescm.Service) error
 	return nil
 }
 
-// ensureEnvVarsAreRemoved removes all WICD configured ENV variables from this instance
+// ensureEnvVarsAreRemoved removes all WICD configured ENV variables from this instance, leaving the watched variables
+// which were not set by WICD
 func ensureEnvVarsAreRemoved(watchedEnvVars []string) (bool, error) {
-	return envvar.Reconcile(map[string]string{}, watchedEnvVars)
+	return envvar.DeconfigureEnvVars(watchedEnvVars)
 }
 
 // cleanupContainers makes a best effort to stop all processes with the name containerd-shim-runhcs-v1, stopping
@@ -20,42 +20,144 @@ package envvar
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"golang.org/x/sys/windows/registry"
 	"k8s.io/klog/v2"
 )
 
-// systemEnvVarRegistryPath is where system level environment variables are stored in the Windows OS
-const systemEnvVarRegistryPath = `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`
+const (
+	// systemEnvVarRegistryPath is where system level environment variables are stored in the Windows OS
+	systemEnvVarRegistryPath = `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`
+	// stateRegistryPath is where WICD keeps track of the changes it made to the instance
+	stateRegistryPath = `SOFTWARE\OpenShift\WICD`
+	// managedEnvVarsValueName is the name of the registry value listing the system environment variables set by WICD
+	managedEnvVarsValueName = "ManagedEnvironmentVariables"
+)
 
 // Reconcile ensures that the proxy environment variables are set as expected on the instance
 // If there's any changes, it returns true indicating an instance restart is required to ensure all processes
-// pick up the updated values.
+// pick up the updated values. The variables set are recorded as managed by WICD, so that they can be removed by
+// DeconfigureEnvVars.
 func Reconcile(envVars map[string]string, watchedEnvVars []string) (bool, error) {
-	envVarsUpdated := false
+	if err := validateEnvVars(envVars, watchedEnvVars); err != nil {
+		return false, err
+	}
+	registryKey, stateKey, closeKeys, err := openKeys()
+	if err != nil {
+		return false, err
+	}
+	defer closeKeys()
+	return reconcile(registryKey, stateKey, envVars, watchedEnvVars)
+}
+
+// DeconfigureEnvVars removes the given system environment variables which were set by WICD, leaving the ones which were
+// set by other means untouched. If WICD did not record the variables it set, as on instances configured before it
+// started to, all given variables are removed. Returns true if any variable was removed, in which case an instance
+// restart is required to ensure all processes pick up the change.
+func DeconfigureEnvVars(previouslySetKeys []string) (bool, error) {
+	for _, name := range previouslySetKeys {
+		if err := validateEnvVarName(name); err != nil {
+			return false, err
+		}
+	}
+	registryKey, stateKey, closeKeys, err := openKeys()
+	if err != nil {
+		return false, err
+	}
+	defer closeKeys()
+	return deconfigure(registryKey, stateKey, previouslySetKeys)
+}
+
+// openKeys opens the registry key holding the system environment variables and the one holding the state of WICD,
+// creating the latter if needed. The returned function closes both keys.
+func openKeys() (registry.Key, registry.Key, func(), error) {
 	registryKey, err := registry.OpenKey(registry.LOCAL_MACHINE, systemEnvVarRegistryPath, registry.ALL_ACCESS)
 	if err != nil {
-		return false, fmt.Errorf("unable to open Windows system registry key %s: %w",
+		return 0, 0, nil, fmt.Errorf("unable to open Windows system registry key %s: %w",
 			systemEnvVarRegistryPath, err)
 	}
-	defer func() { // always close the registry key, without swallowing any error returned before the defer call
-		closeErr := registryKey.Close()
-		if closeErr != nil {
-			klog.Errorf("could not close key %v: %v", registryKey, closeErr)
-		}
-	}()
+	stateKey, _, err := registry.CreateKey(registry.LOCAL_MACHINE, stateRegistryPath, registry.ALL_ACCESS)
+	if err != nil {
+		closeKey(registryKey)
+		return 0, 0, nil, fmt.Errorf("unable to open Windows registry key %s: %w", stateRegistryPath, err)
+	}
+	return registryKey, stateKey, func() {
+		closeKey(registryKey)
+		closeKey(stateKey)
+	}, nil
+}
 
+// closeKey closes the given registry key, logging any error so that it does not swallow one returned before
+func closeKey(key registry.Key) {
+	if closeErr := key.Close(); closeErr != nil {
+		klog.Errorf("could not close key %v: %v", key, closeErr)
+	}
+}
+
+// reconcile behaves as Reconcile, using the given registry keys to hold the environment variables and WICD's state
+func reconcile(registryKey, stateKey registry.Key, envVars map[string]string, watchedEnvVars []string) (bool, error) {
 	var envVarsToRemove []string
 	for _, watchedEnvVar := range watchedEnvVars {
 		if _, ok := envVars[watchedEnvVar]; !ok {
 			envVarsToRemove = append(envVarsToRemove, watchedEnvVar)
 		}
 	}
+	managed, recorded, err := getManagedEnvVars(stateKey)
+	if err != nil {
+		return false, err
+	}
+	return applyEnvVars(registryKey, stateKey, envVars, envVarsToRemove, managed, recorded)
+}
+
+// ReconcileEnvVars ensures that the system environment variables set by WICD are exactly the given ones, which must all
+// be part of the given watched variables. Variables recorded as set by WICD which are not desired anymore, or desired
+// with an empty value, are removed, without the need to know which variables WICD managed before. Returns true if
+// anything changed, in which case an instance restart is required to ensure all processes pick up the updated values.
+func ReconcileEnvVars(desired map[string]string, watchedEnvVars []string) (bool, error) {
+	if err := validateEnvVars(desired, watchedEnvVars); err != nil {
+		return false, err
+	}
+	registryKey, stateKey, closeKeys, err := openKeys()
+	if err != nil {
+		return false, err
+	}
+	defer closeKeys()
+	return reconcileEnvVars(registryKey, stateKey, desired)
+}
+
+// reconcileEnvVars behaves as ReconcileEnvVars, using the given registry keys to hold the environment variables and
+// WICD's state
+func reconcileEnvVars(registryKey, stateKey registry.Key, desired map[string]string) (bool, error) {
+	managed, recorded, err := getManagedEnvVars(stateKey)
+	if err != nil {
+		return false, err
+	}
+	envVars := make(map[string]string, len(desired))
+	names := make([]string, 0, len(desired))
+	for name, value := range desired {
+		if value != "" {
+			envVars[name] = value
+			names = append(names, name)
+		}
+	}
+	orphaned := withoutEnvVars(managed, names)
+	return applyEnvVars(registryKey, stateKey, envVars, orphaned, managed, recorded)
+}
+
+// applyEnvVars removes the given environment variables then sets the others, and records the variables set by WICD,
+// based on the given managed variables and whether they were recorded at all. Returns true if any variable changed.
+func applyEnvVars(registryKey, stateKey registry.Key, envVars map[string]string, envVarsToRemove, managed []string,
+	recorded bool) (bool, error) {
+	envVarsUpdated := false
+	var err error
 	if len(envVarsToRemove) != 0 {
 		envVarsUpdated, err = EnsureEnvVarsAreRemoved(registryKey, envVarsToRemove)
 		if err != nil {
 			return false, fmt.Errorf("error removing envionment variables %v: %v", envVarsToRemove, err)
 		}
+		managed = withoutEnvVars(managed, envVarsToRemove)
 	}
 
 	for key, expectedVal := range envVars {
@@ -64,6 +166,12 @@ func Reconcile(envVars map[string]string, watchedEnvVars []string) (bool, error)
 			return false, fmt.Errorf("unable to read environment variable %s: %w", key, err)
 		}
 
+		if actualVal == expectedVal && recorded {
+			continue
+		}
+		// if nothing is recorded yet, variables already set as expected were set by a WICD version which did not record
+		// them
+		managed = append(withoutEnvVars(managed, []string{key}), key)
 		if actualVal != expectedVal {
 			klog.Infof("updating environment variable %s", key)
 			// Because we modify env vars are the "system" level rather than the ephemeral "process" level,
@@ -77,9 +185,109 @@ func Reconcile(envVars map[string]string, watchedEnvVars []string) (bool, error)
 			envVarsUpdated = true
 		}
 	}
+	if err = setManagedEnvVars(stateKey, managed); err != nil {
+		return false, err
+	}
 	return envVarsUpdated, nil
 }
 
+// deconfigure behaves as DeconfigureEnvVars, using the given registry keys to hold the environment variables and WICD's
+// state
+func deconfigure(registryKey, stateKey registry.Key, previouslySetKeys []string) (bool, error) {
+	managed, recorded, err := getManagedEnvVars(stateKey)
+	if err != nil {
+		return false, err
+	}
+	envVarsToRemove := previouslySetKeys
+	if recorded {
+		envVarsToRemove = nil
+		for _, name := range previouslySetKeys {
+			if containsEnvVar(managed, name) {
+				envVarsToRemove = append(envVarsToRemove, name)
+			}
+		}
+	}
+	removed, err := EnsureEnvVarsAreRemoved(registryKey, envVarsToRemove)
+	if err != nil {
+		return false, fmt.Errorf("error removing envionment variables %v: %v", envVarsToRemove, err)
+	}
+	if err = setManagedEnvVars(stateKey, withoutEnvVars(managed, envVarsToRemove)); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+// getManagedEnvVars returns the names of the environment variables recorded as set by WICD, and whether WICD recorded
+// them at all
+func getManagedEnvVars(stateKey registry.Key) ([]string, bool, error) {
+	managed, _, err := stateKey.GetStringsValue(managedEnvVarsValueName)
+	if err != nil {
+		if err == registry.ErrNotExist {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("unable to read managed environment variables: %w", err)
+	}
+	return managed, true, nil
+}
+
+// setManagedEnvVars records the given environment variables as the ones set by WICD
+func setManagedEnvVars(stateKey registry.Key, managed []string) error {
+	sorted := append([]string{}, managed...)
+	sort.Strings(sorted)
+	if err := stateKey.SetStringsValue(managedEnvVarsValueName, sorted); err != nil {
+		return fmt.Errorf("unable to record managed environment variables: %w", err)
+	}
+	return nil
+}
+
+// containsEnvVar returns true if the given environment variable is one of the given names. Environment variable names
+// are case-insensitive on Windows.
+func containsEnvVar(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutEnvVars returns the given environment variable names minus the ones to exclude. Environment variable names are
+// case-insensitive on Windows.
+func withoutEnvVars(names, excluded []string) []string {
+	excludedSet := make(map[string]struct{}, len(excluded))
+	for _, name := range excluded {
+		excludedSet[strings.ToUpper(name)] = struct{}{}
+	}
+	var remaining []string
+	for _, name := range names {
+		if _, ok := excludedSet[strings.ToUpper(name)]; !ok {
+			remaining = append(remaining, name)
+		}
+	}
+	return remaining
+}
+
+// GetSystemEnvVars returns the current value of each of the given system environment variables. Variables which are not
+// set are returned with an empty value. The registry is only opened for reading.
+func GetSystemEnvVars(keys []string) (map[string]string, error) {
+	registryKey, err := registry.OpenKey(registry.LOCAL_MACHINE, systemEnvVarRegistryPath, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open Windows system registry key %s: %w",
+			systemEnvVarRegistryPath, err)
+	}
+	defer closeKey(registryKey)
+
+	envVars := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, _, err := registryKey.GetStringValue(key)
+		if err != nil && err != registry.ErrNotExist {
+			return nil, fmt.Errorf("unable to read environment variable %s: %w", key, err)
+		}
+		envVars[key] = value
+	}
+	return envVars, nil
+}
+
 // EnsureEnvVarsAreRemoved ensures that the given environment variables are removed from the instance's Windows registry
 // An instance restart is required after they are removed to ensure all processes pick up the updated values.
 func EnsureEnvVarsAreRemoved(registryKey registry.Key, envVarsToRemove []string) (bool, error) {
@@ -97,3 +305,47 @@ func EnsureEnvVarsAreRemoved(registryKey registry.Key, envVarsToRemove []string)
 	}
 	return envVarsRemoved, nil
 }
+
+// validateEnvVars returns an error if any of the given environment variables cannot be safely written to the registry,
+// or is not one of the watched environment variables, which are the only ones WMCO is permitted to manage. Values are
+// never part of the error returned, as proxy information is sensitive.
+func validateEnvVars(envVars map[string]string, watchedEnvVars []string) error {
+	watched := make(map[string]struct{}, len(watchedEnvVars))
+	for _, name := range watchedEnvVars {
+		if err := validateEnvVarName(name); err != nil {
+			return err
+		}
+		// environment variable names are case-insensitive on Windows
+		watched[strings.ToUpper(name)] = struct{}{}
+	}
+
+	names := make([]string, 0, len(envVars))
+	for name := range envVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := validateEnvVarName(name); err != nil {
+			return err
+		}
+		if strings.ContainsRune(envVars[name], 0) {
+			return fmt.Errorf("invalid value for environment variable %s: must not contain NUL characters", name)
+		}
+		if _, ok := watched[strings.ToUpper(name)]; !ok {
+			return fmt.Errorf("environment variable %s is not watched and cannot be set", name)
+		}
+	}
+	return nil
+}
+
+// validateEnvVarName returns an error if the given name is not a valid environment variable name. An empty name would
+// refer to the default value of the registry key.
+func validateEnvVarName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("environment variable name cannot be empty")
+	}
+	if strings.ContainsAny(name, "=\x00") {
+		return fmt.Errorf("invalid environment variable name %q: must not contain '=' or NUL characters", name)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package hostport
+
+import (
+	"net"
+	"strings"
+)
+
+// Join combines the given host and port into a network address usable with net.Dial. IPv6 hosts are wrapped in
+// brackets, a host which is already wrapped in brackets is not wrapped again.
+func Join(host, port string) string {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	return net.JoinHostPort(host, port)
+}
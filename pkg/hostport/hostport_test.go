@@ -0,0 +1,52 @@
+package hostport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoin(t *testing.T) {
+	testCases := []struct {
+		name     string
+		host     string
+		port     string
+		expected string
+	}{
+		{
+			name:     "ipv4",
+			host:     "10.0.0.1",
+			port:     "22",
+			expected: "10.0.0.1:22",
+		},
+		{
+			name:     "ipv6",
+			host:     "fd00::1",
+			port:     "22",
+			expected: "[fd00::1]:22",
+		},
+		{
+			name:     "ipv6 with zone",
+			host:     "fe80::1%eth0",
+			port:     "5986",
+			expected: "[fe80::1%eth0]:5986",
+		},
+		{
+			name:     "bracketed ipv6",
+			host:     "[fd00::1]",
+			port:     "22",
+			expected: "[fd00::1]:22",
+		},
+		{
+			name:     "hostname",
+			host:     "windows-node.example.com",
+			port:     "22",
+			expected: "windows-node.example.com:22",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Join(test.host, test.port))
+		})
+	}
+}
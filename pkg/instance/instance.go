@@ -1,15 +1,66 @@
 package instance
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strings"
+	"time"
 
 	core "k8s.io/api/core/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/retry"
 	"github.com/openshift/windows-machine-config-operator/version"
 )
 
+// BootstrapState is the state of the configuration of an instance as a node
+type BootstrapState string
+
+const (
+	// BootstrapNotStarted is the state of an instance which has not been configured yet, or whose configuration failed
+	BootstrapNotStarted BootstrapState = "NotStarted"
+	// BootstrapInProgress is the state of an instance which is being configured
+	BootstrapInProgress BootstrapState = "InProgress"
+	// BootstrapConfigured is the state of an instance configured by the current WMCO version
+	BootstrapConfigured BootstrapState = "Configured"
+	// BootstrapStale is the state of an instance configured by another WMCO version
+	BootstrapStale BootstrapState = "Stale"
+)
+
+const (
+	// DefaultInstallDir is the remote directory the Kubernetes components are installed to, unless overridden
+	DefaultInstallDir = "C:\\k"
+	// DefaultLogDir is the remote directory the Kubernetes components write their logs to
+	DefaultLogDir = "C:\\var\\log"
+)
+
+const (
+	// K8sDirKind is the kind of the directory holding the Kubernetes binaries and configuration
+	K8sDirKind = "k8s"
+	// CNIDirKind is the kind of the directory holding the CNI binaries
+	CNIDirKind = "cni"
+	// ContainerdDirKind is the kind of the directory holding the containerd binary and configuration
+	ContainerdDirKind = "containerd"
+	// LogDirKind is the kind of the directory holding the logs of the Kubernetes components
+	LogDirKind = "log"
+)
+
+const (
+	// MaxNetBIOSNameLength is the maximum length of the NetBIOS name of a Windows instance, Windows truncates longer
+	// hostnames to form it
+	MaxNetBIOSNameLength = 15
+	// maxDNSLabelLength is the maximum length of a hostname usable as a DNS label
+	maxDNSLabelLength = 63
+)
+
+// BootstrapTimeout is the time after which an instance whose configuration has not ended is no longer considered
+// in progress, as the configuration was interrupted
+const BootstrapTimeout = 30 * time.Minute
+
 // Info represents a instance that is meant to be joined to the cluster
 type Info struct {
 	// Address is the network address of the instance as specified by the associated ConfigMap entry.
@@ -19,23 +70,114 @@ type Info struct {
 	IPv4Address string
 	// Username is the name of a user that can be ssh'd into.
 	Username string
+	// SSHPort is the port the instance's SSH server listens on. An empty value means the default SSH port is used.
+	SSHPort string
 	// NewHostname being set means that the instance's hostname should be changed. An empty value is a no-op.
 	NewHostname string
 	// SetNodeIP indicates if the instance should have the node-ip arg set when bootstrapping.
 	SetNodeIP bool
 	// Node is an optional pointer to the Node object associated with the instance, if it has one.
 	Node *core.Node
+	// InstallDir is the remote directory the Kubernetes components are installed to. It is given by the instance
+	// ConfigMap entry for BYOH instances, and recorded on the Node once configured. An empty value means
+	// DefaultInstallDir is used.
+	InstallDir string
+	// MachineBacked indicates the instance is the VM of a Machine, provisioned for WMCO, rather than a BYOH instance
+	// managed by the customer
+	MachineBacked bool
 }
 
 // NewInfo returns a new Info. newHostname being set means that the instance's hostname should be
-// changed. An empty value is a no-op.
+// changed. An empty value is a no-op. The new hostname is the name of the Machine backing the instance, which is
+// validated by ValidateMachineHostname. The install directory is taken from the given node, if it records one.
 func NewInfo(address, username, newHostname string, setNodeIP bool, node *core.Node) (*Info, error) {
 	ip, err := net.ResolveIPAddr("ip4", address)
 	if err != nil {
 		return nil, fmt.Errorf("invalid address %s, unable to create instance info: %w", address, err)
 	}
-	return &Info{Address: address, IPv4Address: ip.String(), Username: username, NewHostname: newHostname,
-		SetNodeIP: setNodeIP, Node: node}, nil
+	if newHostname != "" {
+		if err = ValidateMachineHostname(newHostname); err != nil {
+			return nil, fmt.Errorf("unable to create instance info for %s: %w", address, err)
+		}
+	}
+	info := &Info{Address: address, IPv4Address: ip.String(), Username: username, NewHostname: newHostname,
+		SetNodeIP: setNodeIP, Node: node}
+	if node != nil {
+		info.InstallDir = node.GetAnnotations()[metadata.InstallDirAnnotation]
+	}
+	return info, nil
+}
+
+// ValidateHostname returns an error describing why the given hostname cannot be given to a Windows instance, if it
+// cannot. The hostname must be usable both as a DNS label and as a NetBIOS name: at most 15 letters, digits and
+// hyphens, not starting or ending with a hyphen, and not made of digits only.
+func ValidateHostname(hostname string) error {
+	return validateHostname(hostname, MaxNetBIOSNameLength)
+}
+
+// ValidateMachineHostname behaves as ValidateHostname for hostnames taken from the name of a Machine, allowing them to
+// be as long as a DNS label. Nodes must be named after their Machine, so such hostnames cannot be shortened, and
+// Windows truncates the NetBIOS name of the instance instead.
+func ValidateMachineHostname(hostname string) error {
+	return validateHostname(hostname, maxDNSLabelLength)
+}
+
+// validateHostname returns an error describing why the given hostname is not a valid Windows hostname of at most the
+// given length
+func validateHostname(hostname string, maxLength int) error {
+	if hostname == "" {
+		return fmt.Errorf("invalid hostname: must not be empty")
+	}
+	if len(hostname) > maxLength {
+		return fmt.Errorf("invalid hostname %q: must be at most %d characters long, found %d", hostname,
+			maxLength, len(hostname))
+	}
+	onlyDigits := true
+	for _, r := range hostname {
+		switch {
+		case r >= '0' && r <= '9':
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '-':
+			onlyDigits = false
+		default:
+			return fmt.Errorf("invalid hostname %q: character %q is not allowed, only letters, digits and hyphens "+
+				"are", hostname, r)
+		}
+	}
+	if strings.HasPrefix(hostname, "-") || strings.HasSuffix(hostname, "-") {
+		return fmt.Errorf("invalid hostname %q: must not start or end with a hyphen", hostname)
+	}
+	if onlyDigits {
+		return fmt.Errorf("invalid hostname %q: must not be made of digits only", hostname)
+	}
+	return nil
+}
+
+// String returns a description of the instance which is safe to log. Fields are listed explicitly, so that fields
+// holding secret material are not logged if added to Info.
+func (i *Info) String() string {
+	return fmt.Sprintf("address: %s, username: %s, new hostname: %q, node attached: %t", i.Address, i.Username,
+		i.NewHostname, i.Node != nil)
+}
+
+// RemoteDir returns the Windows path of the remote directory of the given kind on the instance, taking the install
+// directory of the instance into account. Returns an empty string if the kind is unknown.
+func (i *Info) RemoteDir(kind string) string {
+	installDir := i.InstallDir
+	if installDir == "" {
+		installDir = DefaultInstallDir
+	}
+	switch kind {
+	case K8sDirKind:
+		return installDir
+	case CNIDirKind:
+		return installDir + "\\cni"
+	case ContainerdDirKind:
+		return installDir + "\\containerd"
+	case LogDirKind:
+		return DefaultLogDir
+	default:
+		return ""
+	}
 }
 
 // UpToDate returns true if the instance was configured by the current WMCO version
@@ -44,7 +186,25 @@ func (i *Info) UpToDate() bool {
 		return false
 	}
 	versionAnnotation, present := i.Node.GetAnnotations()[metadata.VersionAnnotation]
-	return present && versionAnnotation == version.Get()
+	return present && version.Equal(versionAnnotation, version.Get())
+}
+
+// DowngradeDetected returns true if the instance was configured by a WMCO release greater than the current one. Builds
+// of the same release are not downgrades of one another. Returns an error if either version cannot be compared.
+func (i *Info) DowngradeDetected() (bool, error) {
+	if i.Node == nil {
+		return false, nil
+	}
+	versionAnnotation, present := i.Node.GetAnnotations()[metadata.VersionAnnotation]
+	if !present || version.Equal(versionAnnotation, version.Get()) {
+		return false, nil
+	}
+	result, err := version.CompareRelease(versionAnnotation, version.Get())
+	if err != nil {
+		return false, fmt.Errorf("unable to compare version %s of node %s with the operator version: %w",
+			versionAnnotation, i.Node.GetName(), err)
+	}
+	return result > 0, nil
 }
 
 // UpgradeRequired returns true if the instance needs to go through the upgrade process
@@ -70,3 +230,92 @@ func (i *Info) UpgradeRequired() bool {
 	// fully deconfigured before being configured by the current version.
 	return true
 }
+
+// Classify sorts the given instances, in a single pass, into the ones configured by the current WMCO version, the ones
+// which must be configured, the ones which must be upgraded and the ones configured by a greater WMCO version. An
+// instance whose version cannot be compared with the current one is considered to need an upgrade, as is done by
+// UpgradeRequired. Nil instances are ignored.
+func Classify(infos []*Info) (upToDate, needsConfig, needsUpgrade, downgrade []*Info) {
+	for _, info := range infos {
+		if info == nil {
+			continue
+		}
+		switch {
+		case info.UpToDate():
+			upToDate = append(upToDate, info)
+		case !info.UpgradeRequired():
+			needsConfig = append(needsConfig, info)
+		default:
+			if downgradeDetected, err := info.DowngradeDetected(); err == nil && downgradeDetected {
+				downgrade = append(downgrade, info)
+			} else {
+				needsUpgrade = append(needsUpgrade, info)
+			}
+		}
+	}
+	return upToDate, needsConfig, needsUpgrade, downgrade
+}
+
+// BootstrapState returns the state of the configuration of the instance as a node
+func (i *Info) BootstrapState() BootstrapState {
+	return i.bootstrapState(time.Now())
+}
+
+// bootstrapState returns the state of the configuration of the instance as a node at the given time
+func (i *Info) bootstrapState(now time.Time) BootstrapState {
+	if i.Node == nil {
+		return BootstrapNotStarted
+	}
+	if start, present := i.Node.GetAnnotations()[metadata.ConfiguringAnnotation]; present {
+		startTime, err := time.Parse(time.RFC3339, start)
+		// an invalid start time cannot tell whether the configuration was interrupted, so it is not trusted
+		if err == nil && now.Sub(startTime) < BootstrapTimeout {
+			return BootstrapInProgress
+		}
+	}
+	if i.UpToDate() {
+		return BootstrapConfigured
+	}
+	if i.UpgradeRequired() {
+		return BootstrapStale
+	}
+	return BootstrapNotStarted
+}
+
+// WaitUntilUpToDate waits until the Node with the given name is Ready and configured by the current WMCO version,
+// returning the Node. Returns an error with the last observed version annotation if the timeout is reached first.
+func WaitUntilUpToDate(ctx context.Context, c client.Client, nodeName string, timeout time.Duration) (*core.Node, error) {
+	return waitUntilUpToDate(ctx, c, nodeName, retry.Interval, timeout)
+}
+
+// waitUntilUpToDate behaves as WaitUntilUpToDate, getting the Node at the given interval
+func waitUntilUpToDate(ctx context.Context, c client.Client, nodeName string, interval,
+	timeout time.Duration) (*core.Node, error) {
+	node := &core.Node{}
+	// lastErr is the error getting the Node on the last attempt, if any
+	var lastErr error
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		if lastErr = c.Get(ctx, kubeTypes.NamespacedName{Name: nodeName}, node); lastErr != nil {
+			return false, nil
+		}
+		return isReady(node) && (&Info{Node: node}).UpToDate(), nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			return nil, fmt.Errorf("error getting node %s: %w", nodeName, lastErr)
+		}
+		return nil, fmt.Errorf("node %s not Ready with %s %q matching version %s: %w", nodeName,
+			metadata.VersionAnnotation, node.GetAnnotations()[metadata.VersionAnnotation], version.Get(), err)
+	}
+	return node, nil
+}
+
+// isReady returns true if the given Node reports the Ready condition
+func isReady(node *core.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == core.NodeReady {
+			return condition.Status == core.ConditionTrue
+		}
+	}
+	return false
+}
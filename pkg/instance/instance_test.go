@@ -1,11 +1,18 @@
 package instance
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/version"
@@ -105,3 +112,405 @@ func TestUpgradeRequired(t *testing.T) {
 		})
 	}
 }
+
+func TestVersionComparisons(t *testing.T) {
+	originalVersion := version.Version
+	version.Version = "10.16.0-a1b2c3d"
+	defer func() { version.Version = originalVersion }()
+
+	testCases := []struct {
+		name              string
+		annotation        string
+		expectedUpToDate  bool
+		expectedUpgrade   bool
+		expectedDowngrade bool
+		expectedErr       bool
+	}{
+		{
+			name:             "same version",
+			annotation:       "10.16.0-a1b2c3d",
+			expectedUpToDate: true,
+		},
+		{
+			name:             "same version with build metadata",
+			annotation:       "v10.16.0-a1b2c3d+build.5",
+			expectedUpToDate: true,
+		},
+		{
+			name:            "other build of the same release",
+			annotation:      "10.16.0-f9e8d7c",
+			expectedUpgrade: true,
+		},
+		{
+			name:            "dirty build of the same release",
+			annotation:      "10.16.0-a1b2c3d-dirty",
+			expectedUpgrade: true,
+		},
+		{
+			name:            "older version",
+			annotation:      "10.15.0-e4f5a6b",
+			expectedUpgrade: true,
+		},
+		{
+			name:              "newer version",
+			annotation:        "10.17.0-e4f5a6b",
+			expectedUpgrade:   true,
+			expectedDowngrade: true,
+		},
+		{
+			name:            "unparseable version",
+			annotation:      "incorrect",
+			expectedUpgrade: true,
+			expectedErr:     true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			info := Info{Node: &core.Node{
+				ObjectMeta: meta.ObjectMeta{Annotations: map[string]string{metadata.VersionAnnotation: test.annotation}},
+			}}
+			assert.Equal(t, test.expectedUpToDate, info.UpToDate())
+			assert.Equal(t, test.expectedUpgrade, info.UpgradeRequired())
+			downgrade, err := info.DowngradeDetected()
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedDowngrade, downgrade)
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	originalVersion := version.Version
+	version.Version = "10.16.0-a1b2c3d"
+	defer func() { version.Version = originalVersion }()
+
+	// withVersion returns an instance whose Node is annotated with the given version
+	withVersion := func(address, annotation string) *Info {
+		return &Info{Address: address, Node: &core.Node{
+			ObjectMeta: meta.ObjectMeta{Annotations: map[string]string{metadata.VersionAnnotation: annotation}},
+		}}
+	}
+	current := withVersion("10.0.0.1", "10.16.0-a1b2c3d")
+	noNode := &Info{Address: "10.0.0.2"}
+	missingAnnotation := &Info{Address: "10.0.0.3", Node: &core.Node{
+		ObjectMeta: meta.ObjectMeta{Annotations: map[string]string{"other": ""}},
+	}}
+	older := withVersion("10.0.0.4", "10.15.0-e4f5a6b")
+	unparseable := withVersion("10.0.0.5", "incorrect")
+	newer := withVersion("10.0.0.6", "10.17.0-e4f5a6b")
+	// ordered after the current build by semver, but built from the same release
+	otherBuild := withVersion("10.0.0.7", "10.16.0-f9e8d7c")
+
+	testCases := []struct {
+		name                 string
+		infos                []*Info
+		expectedUpToDate     []*Info
+		expectedNeedsConfig  []*Info
+		expectedNeedsUpgrade []*Info
+		expectedDowngrade    []*Info
+	}{
+		{
+			name: "no instances",
+		},
+		{
+			name:                 "mixed instances",
+			infos:                []*Info{newer, current, noNode, older, missingAnnotation, unparseable, otherBuild},
+			expectedUpToDate:     []*Info{current},
+			expectedNeedsConfig:  []*Info{noNode, missingAnnotation},
+			expectedNeedsUpgrade: []*Info{older, unparseable, otherBuild},
+			expectedDowngrade:    []*Info{newer},
+		},
+		{
+			name:                "nil instance",
+			infos:               []*Info{nil, noNode},
+			expectedNeedsConfig: []*Info{noNode},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			upToDate, needsConfig, needsUpgrade, downgrade := Classify(test.infos)
+			assert.Equal(t, test.expectedUpToDate, upToDate)
+			assert.Equal(t, test.expectedNeedsConfig, needsConfig)
+			assert.Equal(t, test.expectedNeedsUpgrade, needsUpgrade)
+			assert.Equal(t, test.expectedDowngrade, downgrade)
+		})
+	}
+}
+
+func TestBootstrapState(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	newNode := func(annotations map[string]string) *core.Node {
+		return &core.Node{ObjectMeta: meta.ObjectMeta{Annotations: annotations}}
+	}
+	started := now.Add(-time.Minute).Format(time.RFC3339)
+	interrupted := now.Add(-BootstrapTimeout).Format(time.RFC3339)
+	testCases := []struct {
+		name     string
+		node     *core.Node
+		expected BootstrapState
+	}{
+		{
+			name:     "no associated node",
+			expected: BootstrapNotStarted,
+		},
+		{
+			name:     "node not configured",
+			node:     newNode(nil),
+			expected: BootstrapNotStarted,
+		},
+		{
+			name:     "configuration started",
+			node:     newNode(map[string]string{metadata.ConfiguringAnnotation: started}),
+			expected: BootstrapInProgress,
+		},
+		{
+			name: "reconfiguration started",
+			node: newNode(map[string]string{metadata.ConfiguringAnnotation: started,
+				metadata.VersionAnnotation: "old"}),
+			expected: BootstrapInProgress,
+		},
+		{
+			name:     "configuration interrupted",
+			node:     newNode(map[string]string{metadata.ConfiguringAnnotation: interrupted}),
+			expected: BootstrapNotStarted,
+		},
+		{
+			name:     "invalid configuration start",
+			node:     newNode(map[string]string{metadata.ConfiguringAnnotation: "invalid"}),
+			expected: BootstrapNotStarted,
+		},
+		{
+			name:     "configured",
+			node:     newNode(map[string]string{metadata.VersionAnnotation: version.Get()}),
+			expected: BootstrapConfigured,
+		},
+		{
+			name:     "configured by another version",
+			node:     newNode(map[string]string{metadata.VersionAnnotation: "old"}),
+			expected: BootstrapStale,
+		},
+		{
+			name: "reconfiguration interrupted",
+			node: newNode(map[string]string{metadata.ConfiguringAnnotation: interrupted,
+				metadata.VersionAnnotation: "old"}),
+			expected: BootstrapStale,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			info := &Info{Node: test.node}
+			assert.Equal(t, test.expected, info.bootstrapState(now))
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node",
+		Annotations: map[string]string{"windowsmachineconfig.openshift.io/pub-key-hash": "hash"}}}
+	info := &Info{Address: "10.0.0.5", IPv4Address: "10.0.0.5", Username: "Administrator", SSHPort: "2222",
+		NewHostname: "win-1", Node: node}
+	assert.Equal(t, `address: 10.0.0.5, username: Administrator, new hostname: "win-1", node attached: true`,
+		info.String())
+	// the Node is not dumped
+	assert.NotContains(t, info.String(), "hash")
+
+	info.Node = nil
+	info.NewHostname = ""
+	assert.Equal(t, `address: 10.0.0.5, username: Administrator, new hostname: "", node attached: false`,
+		info.String())
+}
+
+func TestWaitUntilUpToDate(t *testing.T) {
+	readyCondition := []core.NodeCondition{{Type: core.NodeReady, Status: core.ConditionTrue}}
+	notReadyCondition := []core.NodeCondition{{Type: core.NodeReady, Status: core.ConditionFalse}}
+	testCases := []struct {
+		name       string
+		conditions []core.NodeCondition
+		// upToDateAfter is the number of times the node is read before it is annotated with the current version,
+		// never if 0
+		upToDateAfter    int
+		missing          bool
+		expectedErr      bool
+		expectedInErrMsg string
+	}{
+		{
+			name:          "annotated after a few polls",
+			conditions:    readyCondition,
+			upToDateAfter: 3,
+		},
+		{
+			name:             "never annotated",
+			conditions:       readyCondition,
+			expectedErr:      true,
+			expectedInErrMsg: `"0.0.1"`,
+		},
+		{
+			name:             "annotated but not ready",
+			conditions:       notReadyCondition,
+			upToDateAfter:    1,
+			expectedErr:      true,
+			expectedInErrMsg: "not Ready",
+		},
+		{
+			name:             "no node",
+			missing:          true,
+			expectedErr:      true,
+			expectedInErrMsg: "not found",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			gets := 0
+			builder := clientfake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object,
+					opts ...client.GetOption) error {
+					gets++
+					if gets == test.upToDateAfter {
+						// the node is configured by the current version in between polls
+						node := &core.Node{}
+						require.NoError(t, c.Get(ctx, key, node))
+						node.Annotations[metadata.VersionAnnotation] = version.Get()
+						require.NoError(t, c.Update(ctx, node))
+					}
+					return c.Get(ctx, key, obj, opts...)
+				},
+			})
+			if !test.missing {
+				builder = builder.WithObjects(&core.Node{
+					ObjectMeta: meta.ObjectMeta{Name: "node",
+						Annotations: map[string]string{metadata.VersionAnnotation: "0.0.1"}},
+					Status: core.NodeStatus{Conditions: test.conditions},
+				})
+			}
+
+			node, err := waitUntilUpToDate(context.Background(), builder.Build(), "node", time.Millisecond,
+				100*time.Millisecond)
+			if test.expectedErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedInErrMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.upToDateAfter, gets)
+			assert.Equal(t, version.Get(), node.GetAnnotations()[metadata.VersionAnnotation])
+		})
+	}
+}
+
+func TestRemoteDir(t *testing.T) {
+	testCases := []struct {
+		name       string
+		installDir string
+		kind       string
+		expected   string
+	}{
+		{name: "k8s", kind: K8sDirKind, expected: "C:\\k"},
+		{name: "cni", kind: CNIDirKind, expected: "C:\\k\\cni"},
+		{name: "containerd", kind: ContainerdDirKind, expected: "C:\\k\\containerd"},
+		{name: "log", kind: LogDirKind, expected: "C:\\var\\log"},
+		{name: "k8s with install dir", installDir: "D:\\kubernetes", kind: K8sDirKind, expected: "D:\\kubernetes"},
+		{name: "cni with install dir", installDir: "D:\\kubernetes", kind: CNIDirKind,
+			expected: "D:\\kubernetes\\cni"},
+		{name: "containerd with install dir", installDir: "D:\\kubernetes", kind: ContainerdDirKind,
+			expected: "D:\\kubernetes\\containerd"},
+		{name: "log with install dir", installDir: "D:\\kubernetes", kind: LogDirKind, expected: "C:\\var\\log"},
+		{name: "unknown kind", kind: "temp", expected: ""},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, (&Info{InstallDir: test.installDir}).RemoteDir(test.kind))
+		})
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	testCases := []struct {
+		name        string
+		hostname    string
+		expectedErr bool
+	}{
+		{name: "machine name", hostname: "winworker-7xk2p"},
+		{name: "upper case", hostname: "WIN-2022"},
+		{name: "leading digit", hostname: "2022-worker"},
+		{name: "single character", hostname: "w"},
+		{name: "empty", hostname: "", expectedErr: true},
+		{name: "too long", hostname: "windows-worker-01", expectedErr: true},
+		{name: "dot", hostname: "win.example", expectedErr: true},
+		{name: "underscore", hostname: "win_worker", expectedErr: true},
+		{name: "space", hostname: "win worker", expectedErr: true},
+		{name: "non ASCII", hostname: "wïnworker", expectedErr: true},
+		{name: "leading hyphen", hostname: "-winworker", expectedErr: true},
+		{name: "trailing hyphen", hostname: "winworker-", expectedErr: true},
+		{name: "digits only", hostname: "20220101", expectedErr: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateHostname(test.hostname)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewInfoHostname(t *testing.T) {
+	info, err := NewInfo("127.0.0.1", "Administrator", "", false, nil)
+	require.NoError(t, err, "an empty hostname is a no-op")
+	assert.Empty(t, info.NewHostname)
+
+	info, err = NewInfo("127.0.0.1", "Administrator", "winworker-7xk2p", false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "winworker-7xk2p", info.NewHostname)
+
+	// Machine names longer than a NetBIOS name are kept, Windows truncating the NetBIOS name
+	info, err = NewInfo("127.0.0.1", "Administrator", "ci-ln-4xk2p-windows-worker-a-8zq5v", false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ci-ln-4xk2p-windows-worker-a-8zq5v", info.NewHostname)
+
+	_, err = NewInfo("127.0.0.1", "Administrator", "windows_worker", false, nil)
+	assert.Error(t, err)
+}
+
+func TestNewInfoInstallDir(t *testing.T) {
+	info, err := NewInfo("127.0.0.1", "Administrator", "", false, &core.Node{})
+	require.NoError(t, err)
+	assert.Empty(t, info.InstallDir)
+
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{
+		Annotations: map[string]string{metadata.InstallDirAnnotation: "D:\\kubernetes"}}}
+	info, err = NewInfo("127.0.0.1", "Administrator", "", false, node)
+	require.NoError(t, err)
+	assert.Equal(t, "D:\\kubernetes", info.InstallDir)
+}
+
+func TestValidateMachineHostname(t *testing.T) {
+	testCases := []struct {
+		name        string
+		hostname    string
+		expectedErr bool
+	}{
+		{name: "NetBIOS name", hostname: "winworker-7xk2p"},
+		{name: "longer than a NetBIOS name", hostname: "windows-worker-01"},
+		{name: "DNS label length", hostname: strings.Repeat("w", 63)},
+		{name: "too long", hostname: strings.Repeat("w", 64), expectedErr: true},
+		{name: "empty", hostname: "", expectedErr: true},
+		{name: "dot", hostname: "windows-worker.example", expectedErr: true},
+		{name: "trailing hyphen", hostname: "windows-worker-", expectedErr: true},
+		{name: "digits only", hostname: "2022010100000000", expectedErr: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateMachineHostname(test.hostname)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package labels
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/patch"
+)
+
+// generatePatch creates a patch applying the given operation onto each given label key and value. The operations are
+// sorted by label key, so that the same labels always result in the same patch.
+func generatePatch(op string, labels map[string]string) ([]*patch.JSONPatch, error) {
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("labels empty")
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	patches := make([]*patch.JSONPatch, 0, len(keys))
+	for _, key := range keys {
+		patches = append(patches, patch.NewJSONPatch(op, path.Join("/metadata/labels/",
+			patch.EscapeJSONPointer(key)), labels[key]))
+	}
+	return patches, nil
+}
+
+// GenerateAddPatch creates a comma-separated list of operations to add all given labels to an object.
+// An "add" patch overwrites the existing value if a label already exists.
+func GenerateAddPatch(labels map[string]string) ([]byte, error) {
+	patches, err := generatePatch("add", labels)
+	if err != nil {
+		return []byte{}, err
+	}
+	return json.Marshal(patches)
+}
+
+// GenerateRemovePatch creates a comma-separated list of operations to remove all given labels from an object.
+// A "remove" patch fails transactionally if any of the labels do not exist.
+func GenerateRemovePatch(labels []string) ([]byte, error) {
+	labelMap := make(map[string]string, len(labels))
+	for _, label := range labels {
+		labelMap[label] = ""
+	}
+	patches, err := generatePatch("remove", labelMap)
+	if err != nil {
+		return []byte{}, err
+	}
+	return json.Marshal(patches)
+}
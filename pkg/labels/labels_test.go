@@ -0,0 +1,91 @@
+package labels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAddPatch(t *testing.T) {
+	testCases := []struct {
+		name        string
+		labels      map[string]string
+		expectedOut string
+		expectedErr bool
+	}{
+		{
+			name:        "nil",
+			expectedErr: true,
+		},
+		{
+			name:        "empty",
+			labels:      map[string]string{},
+			expectedErr: true,
+		},
+		{
+			name:        "single label",
+			labels:      map[string]string{"label-1": "true"},
+			expectedOut: `[{"op":"add","path":"/metadata/labels/label-1","value":"true"}]`,
+		},
+		{
+			name:   "multiple labels",
+			labels: map[string]string{"windowsmachineconfig.openshift.io/upgrading": "true", "a~label": "1"},
+			expectedOut: `[{"op":"add","path":"/metadata/labels/a~0label","value":"1"},` +
+				`{"op":"add","path":"/metadata/labels/windowsmachineconfig.openshift.io~1upgrading","value":"true"}]`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := GenerateAddPatch(test.labels)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expectedOut, string(out))
+		})
+	}
+}
+
+func TestGenerateRemovePatch(t *testing.T) {
+	testCases := []struct {
+		name        string
+		labels      []string
+		expectedOut string
+		expectedErr bool
+	}{
+		{
+			name:        "nil",
+			expectedErr: true,
+		},
+		{
+			name:        "empty",
+			labels:      []string{},
+			expectedErr: true,
+		},
+		{
+			name:        "single label",
+			labels:      []string{"windowsmachineconfig.openshift.io/upgrading"},
+			expectedOut: `[{"op":"remove","path":"/metadata/labels/windowsmachineconfig.openshift.io~1upgrading","value":""}]`,
+		},
+		{
+			name:   "duplicated labels",
+			labels: []string{"label-2", "label-1", "label-2"},
+			// removing a label twice would fail the whole patch
+			expectedOut: `[{"op":"remove","path":"/metadata/labels/label-1","value":""},` +
+				`{"op":"remove","path":"/metadata/labels/label-2","value":""}]`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := GenerateRemovePatch(test.labels)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expectedOut, string(out))
+		})
+	}
+}
@@ -5,13 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"path"
-	"strings"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	kubeTypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	k8sretry "k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/labels"
 	"github.com/openshift/windows-machine-config-operator/pkg/patch"
 	"github.com/openshift/windows-machine-config-operator/pkg/retry"
 )
@@ -25,6 +27,18 @@ const (
 	RebootAnnotation = "windowsmachineconfig.openshift.io/reboot-required"
 	// UpgradingLabel indicates the node's underlying instance is performing an upgrade
 	UpgradingLabel = "windowsmachineconfig.openshift.io/upgrading"
+	// ConfigFailuresAnnotation holds the number of consecutive times the configuration of the node's underlying
+	// instance has failed
+	ConfigFailuresAnnotation = "windowsmachineconfig.openshift.io/configuration-failures"
+	// ConfiguringAnnotation indicates the node's underlying instance is being configured, and holds the RFC 3339 time
+	// at which its configuration started
+	ConfiguringAnnotation = "windowsmachineconfig.openshift.io/configuring"
+	// InstallDirAnnotation holds the remote directory the Kubernetes components of the node's underlying instance are
+	// installed to
+	InstallDirAnnotation = "windowsmachineconfig.openshift.io/install-dir"
+	// RetryConfigLabel allows the configuration of the node's underlying instance to be retried regardless of the
+	// number of consecutive failures
+	RetryConfigLabel = "windowsmachineconfig.openshift.io/retry-configuration"
 )
 
 // generatePatch creates a patch applying the given operation onto each given annotation key and value
@@ -53,7 +67,7 @@ func removeLabel(ctx context.Context, c client.Client, node *core.Node, label st
 		// label not present in node, nothing to remove
 		return nil
 	}
-	patchData, err := GenerateRemovePatch([]string{label}, []string{})
+	patchData, err := labels.GenerateRemovePatch([]string{label})
 	if err != nil {
 		return fmt.Errorf("error creating label remove patch: %w", err)
 	}
@@ -74,6 +88,26 @@ func GenerateAddPatch(labels, annotations map[string]string) ([]byte, error) {
 	return json.Marshal(patch)
 }
 
+// GenerateAddIfAbsentPatch creates a comma-separated list of operations to add the given annotations which are not
+// keys of the given existing annotations of an object, so that values set by others are not overwritten. The patch
+// holds no operation if all the given annotations are present.
+func GenerateAddIfAbsentPatch(existing, annotations map[string]string) ([]byte, error) {
+	missing := make(map[string]string)
+	for key, value := range annotations {
+		if _, present := existing[key]; !present {
+			missing[key] = value
+		}
+	}
+	if len(missing) == 0 {
+		return json.Marshal([]*patch.JSONPatch{})
+	}
+	patch, err := generatePatch("add", nil, missing)
+	if err != nil {
+		return []byte{}, err
+	}
+	return json.Marshal(patch)
+}
+
 // GenerateRemovePatch creates a comma-separated list of operations to remove all given labels and annotations from an
 // object. A "remove" patch fails transactionally if any of the annotations do not exist.
 func GenerateRemovePatch(labels, annotations []string) ([]byte, error) {
@@ -95,7 +129,7 @@ func GenerateRemovePatch(labels, annotations []string) ([]byte, error) {
 // escape replaces characters which would cause parsing issues with their escaped equivalent
 func escape(key string) string {
 	// The `/` in the metadata key needs to be escaped in order to not be considered a "directory" in the path
-	return strings.Replace(key, "/", "~1", -1)
+	return patch.EscapeJSONPointer(key)
 }
 
 // ApplyLabelsAndAnnotations applies all the given annotations to the given Node resource
@@ -141,7 +175,7 @@ func RemoveVersionAnnotation(ctx context.Context, c client.Client, node core.Nod
 	return nil
 }
 
-// RemoveVersionAnnotation clears the reboot annotation from the node, indicating the instance no longer needs a restart
+// RemoveRebootAnnotation clears the reboot annotation from the node, indicating the instance no longer needs a restart
 func RemoveRebootAnnotation(ctx context.Context, c client.Client, node core.Node) error {
 	if _, present := node.GetAnnotations()[RebootAnnotation]; present {
 		patchData, err := GenerateRemovePatch([]string{}, []string{RebootAnnotation})
@@ -156,6 +190,101 @@ func RemoveRebootAnnotation(ctx context.Context, c client.Client, node core.Node
 	return nil
 }
 
+// ApplyConfiguringAnnotation applies an annotation to the given Node communicating that its instance is being
+// configured since the given time. The annotation is also added to the given Node reference.
+func ApplyConfiguringAnnotation(ctx context.Context, c client.Client, node *core.Node, start time.Time) error {
+	value := start.UTC().Format(time.RFC3339)
+	if err := ApplyLabelsAndAnnotations(ctx, c, *node, nil, map[string]string{ConfiguringAnnotation: value}); err != nil {
+		return err
+	}
+	annotations := make(map[string]string, len(node.GetAnnotations())+1)
+	for key, existing := range node.GetAnnotations() {
+		annotations[key] = existing
+	}
+	annotations[ConfiguringAnnotation] = value
+	node.SetAnnotations(annotations)
+	return nil
+}
+
+// RemoveConfiguringAnnotation clears the configuring annotation from the node, indicating the configuration of its
+// instance is over
+func RemoveConfiguringAnnotation(ctx context.Context, c client.Client, node core.Node) error {
+	if _, present := node.GetAnnotations()[ConfiguringAnnotation]; present {
+		patchData, err := GenerateRemovePatch([]string{}, []string{ConfiguringAnnotation})
+		if err != nil {
+			return fmt.Errorf("error creating configuring annotation remove request: %w", err)
+		}
+		err = c.Patch(ctx, &node, client.RawPatch(kubeTypes.JSONPatchType, patchData))
+		if err != nil {
+			return fmt.Errorf("error removing configuring annotation from node %s: %w", node.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// PatchNodeAnnotations adds the given annotations to, and removes the given annotations from, the given Node in a
+// single patch. The patch is applied to the latest Node, and fails with a conflict if the Node is modified in between,
+// so that concurrent annotation changes are not lost. It is retried on conflict. The Node reference is updated with
+// the patched Node.
+func PatchNodeAnnotations(ctx context.Context, c client.Client, node *core.Node, adds map[string]string,
+	removes []string) error {
+	return k8sretry.RetryOnConflict(k8sretry.DefaultBackoff, func() error {
+		if err := c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, node); err != nil {
+			return fmt.Errorf("error getting node %s: %w", node.GetName(), err)
+		}
+		patchData, err := generateNodeAnnotationsPatch(node, adds, removes)
+		if err != nil {
+			return fmt.Errorf("error creating annotations patch request: %w", err)
+		}
+		if patchData == nil {
+			return nil
+		}
+		if err = c.Patch(ctx, node, client.RawPatch(kubeTypes.JSONPatchType, patchData)); err != nil {
+			return fmt.Errorf("unable to apply patch data %s on node %s: %w", patchData, node.GetName(), err)
+		}
+		return nil
+	})
+}
+
+// generateNodeAnnotationsPatch returns the patch adding and removing the given annotations from the given Node, nil if
+// the Node needs no change. Only annotations present on the Node are removed, as removing a missing key is an error.
+// The patch replaces the resourceVersion of the Node with its current value, for it to be rejected with a conflict if
+// the Node has been modified since.
+func generateNodeAnnotationsPatch(node *core.Node, adds map[string]string, removes []string) ([]byte, error) {
+	var patches []*patch.JSONPatch
+	toAdd := make(map[string]string)
+	for key, value := range adds {
+		if existing, present := node.GetAnnotations()[key]; !present || existing != value {
+			toAdd[key] = value
+		}
+	}
+	if len(toAdd) > 0 {
+		addPatches, err := generatePatch("add", nil, toAdd)
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, addPatches...)
+	}
+	toRemove := make(map[string]string)
+	for _, key := range removes {
+		if _, present := node.GetAnnotations()[key]; present {
+			toRemove[key] = ""
+		}
+	}
+	if len(toRemove) > 0 {
+		removePatches, err := generatePatch("remove", nil, toRemove)
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, removePatches...)
+	}
+	if len(patches) == 0 {
+		return nil, nil
+	}
+	patches = append(patches, patch.NewJSONPatch("replace", "/metadata/resourceVersion", node.GetResourceVersion()))
+	return json.Marshal(patches)
+}
+
 // WaitForVersionAnnotation checks if the node object has equivalent version and desiredVersion annotations.
 // Waits for retry.Interval seconds and returns an error if the version annotation does not appear in that time frame.
 func WaitForVersionAnnotation(ctx context.Context, c client.Client, nodeName string) error {
@@ -1,10 +1,19 @@
 package metadata
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/patch"
 )
@@ -138,3 +147,172 @@ func TestGeneratePatch(t *testing.T) {
 		})
 	}
 }
+
+func TestRebootAnnotation(t *testing.T) {
+	ctx := context.Background()
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node", Annotations: map[string]string{VersionAnnotation: "1"}}}
+	c := clientfake.NewClientBuilder().WithObjects(node).Build()
+	getNode := func() core.Node {
+		current := core.Node{}
+		require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, &current))
+		return current
+	}
+
+	require.NoError(t, ApplyRebootAnnotation(ctx, c, getNode()))
+	assert.Contains(t, getNode().Annotations, RebootAnnotation)
+	// applying the annotation again overwrites it
+	require.NoError(t, ApplyRebootAnnotation(ctx, c, getNode()))
+
+	require.NoError(t, RemoveRebootAnnotation(ctx, c, getNode()))
+	assert.NotContains(t, getNode().Annotations, RebootAnnotation)
+	assert.Contains(t, getNode().Annotations, VersionAnnotation)
+	// removing the annotation from a node which no longer has it is a no-op, so that concurrent reconciles do not fail
+	require.NoError(t, RemoveRebootAnnotation(ctx, c, getNode()))
+}
+
+func TestConfiguringAnnotation(t *testing.T) {
+	ctx := context.Background()
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node", Annotations: map[string]string{VersionAnnotation: "1"}}}
+	c := clientfake.NewClientBuilder().WithObjects(node).Build()
+	getNode := func() core.Node {
+		current := core.Node{}
+		require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, &current))
+		return current
+	}
+
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	reference := getNode()
+	require.NoError(t, ApplyConfiguringAnnotation(ctx, c, &reference, start))
+	assert.Equal(t, "2024-03-01T10:00:00Z", getNode().Annotations[ConfiguringAnnotation])
+	// the given reference is updated, so that the annotation can be removed through it
+	assert.Equal(t, "2024-03-01T10:00:00Z", reference.Annotations[ConfiguringAnnotation])
+
+	require.NoError(t, RemoveConfiguringAnnotation(ctx, c, reference))
+	assert.NotContains(t, getNode().Annotations, ConfiguringAnnotation)
+	assert.Contains(t, getNode().Annotations, VersionAnnotation)
+	require.NoError(t, RemoveConfiguringAnnotation(ctx, c, getNode()))
+}
+
+func TestGenerateAddIfAbsentPatch(t *testing.T) {
+	testCases := []struct {
+		name        string
+		existing    map[string]string
+		annotations map[string]string
+		expectedOut []*patch.JSONPatch
+	}{
+		{
+			name:        "all present",
+			existing:    map[string]string{"annotation-1": "set-by-other", "escaped/annotation": "17"},
+			annotations: map[string]string{"annotation-1": "3.0", "escaped/annotation": "18"},
+			expectedOut: []*patch.JSONPatch{},
+		},
+		{
+			name:        "none present",
+			existing:    map[string]string{"other": "value"},
+			annotations: map[string]string{"annotation-1": "3.0", "escaped/annotation": "17"},
+			expectedOut: []*patch.JSONPatch{
+				{Op: "add", Path: "/metadata/annotations/annotation-1", Value: "3.0"},
+				{Op: "add", Path: "/metadata/annotations/escaped~1annotation", Value: "17"},
+			},
+		},
+		{
+			name:        "mixed",
+			existing:    map[string]string{"annotation-1": "set-by-other"},
+			annotations: map[string]string{"annotation-1": "3.0", "escaped/annotation": "17"},
+			expectedOut: []*patch.JSONPatch{
+				{Op: "add", Path: "/metadata/annotations/escaped~1annotation", Value: "17"},
+			},
+		},
+		{
+			name:        "present with an empty value",
+			existing:    map[string]string{"annotation-1": ""},
+			annotations: map[string]string{"annotation-1": "3.0"},
+			expectedOut: []*patch.JSONPatch{},
+		},
+		{
+			name:        "no annotations",
+			existing:    map[string]string{"annotation-1": "3.0"},
+			expectedOut: []*patch.JSONPatch{},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := GenerateAddIfAbsentPatch(test.existing, test.annotations)
+			require.NoError(t, err)
+			var patches []*patch.JSONPatch
+			require.NoError(t, json.Unmarshal(out, &patches))
+			assert.ElementsMatch(t, test.expectedOut, patches)
+		})
+	}
+}
+
+func TestPatchNodeAnnotations(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		adds        map[string]string
+		removes     []string
+		// concurrent is an annotation added to the node by someone else before the first patch is applied
+		concurrent          map[string]string
+		expectedAnnotations map[string]string
+		expectedPatches     int
+	}{
+		{
+			name:                "adds and removes",
+			annotations:         map[string]string{"kept": "", "removed/annotation": "1"},
+			adds:                map[string]string{"added/annotation": "2", "kept": "updated"},
+			removes:             []string{"removed/annotation", "missing"},
+			expectedAnnotations: map[string]string{"kept": "updated", "added/annotation": "2"},
+			expectedPatches:     1,
+		},
+		{
+			name:                "no change needed",
+			annotations:         map[string]string{"kept": "1"},
+			adds:                map[string]string{"kept": "1"},
+			removes:             []string{"missing"},
+			expectedAnnotations: map[string]string{"kept": "1"},
+		},
+		{
+			name:                "retried on conflict",
+			annotations:         map[string]string{"kept": "", "removed": "1"},
+			adds:                map[string]string{"added": "2"},
+			removes:             []string{"removed"},
+			concurrent:          map[string]string{"concurrent": "3"},
+			expectedAnnotations: map[string]string{"kept": "", "added": "2", "concurrent": "3"},
+			expectedPatches:     2,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			patches := 0
+			c := clientfake.NewClientBuilder().
+				WithObjects(&core.Node{ObjectMeta: meta.ObjectMeta{Name: "node", Annotations: test.annotations}}).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, p client.Patch,
+						opts ...client.PatchOption) error {
+						patches++
+						if patches == 1 && test.concurrent != nil {
+							// another writer modifies the node after it was read, making the patch conflict
+							concurrent := &core.Node{}
+							require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: obj.GetName()}, concurrent))
+							for key, value := range test.concurrent {
+								concurrent.Annotations[key] = value
+							}
+							require.NoError(t, c.Update(ctx, concurrent))
+						}
+						return c.Patch(ctx, obj, p, opts...)
+					},
+				}).Build()
+
+			node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node"}}
+			require.NoError(t, PatchNodeAnnotations(ctx, c, node, test.adds, test.removes))
+			assert.Equal(t, test.expectedPatches, patches)
+			assert.Equal(t, test.expectedAnnotations, node.GetAnnotations())
+
+			current := &core.Node{}
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: "node"}, current))
+			assert.Equal(t, test.expectedAnnotations, current.GetAnnotations())
+		})
+	}
+}
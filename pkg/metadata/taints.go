@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/patch"
+)
+
+// WindowsTaint keeps workloads which do not tolerate it, such as Linux workloads, from being scheduled on Windows nodes
+var WindowsTaint = core.Taint{Key: "os", Value: "Windows", Effect: core.TaintEffectNoSchedule}
+
+// taintPath returns the JSON patch path to the taint at the given index of a node's taints
+func taintPath(index int) string {
+	return fmt.Sprintf("/spec/taints/%d", index)
+}
+
+// generateEnsureTaintPatch creates a patch adding the given taint to the given taints. A taint with the same key but a
+// different value or effect is replaced by the given taint. Returns nil if the taint is already present.
+func generateEnsureTaintPatch(taints []core.Taint, taint core.Taint) []*patch.JSONPatch {
+	for _, existing := range taints {
+		if existing.MatchTaint(&taint) && existing.Value == taint.Value {
+			return nil
+		}
+	}
+	for i, existing := range taints {
+		if existing.Key == taint.Key {
+			// the test keeps a concurrent change to the taints from causing a different taint to be replaced
+			return []*patch.JSONPatch{
+				patch.NewJSONPatch("test", taintPath(i), existing),
+				patch.NewJSONPatch("replace", taintPath(i), taint),
+			}
+		}
+	}
+	if len(taints) == 0 {
+		return []*patch.JSONPatch{patch.NewJSONPatch("add", "/spec/taints", []core.Taint{taint})}
+	}
+	return []*patch.JSONPatch{patch.NewJSONPatch("add", "/spec/taints/-", taint)}
+}
+
+// generateRemoveTaintPatch creates a patch removing all the taints with the key and value of the given taint from the
+// given taints, regardless of their effect. Returns nil if there are no such taints.
+func generateRemoveTaintPatch(taints []core.Taint, taint core.Taint) []*patch.JSONPatch {
+	var patches []*patch.JSONPatch
+	// taints are removed starting from the last one, so that removing a taint does not shift the ones left to remove
+	for i := len(taints) - 1; i >= 0; i-- {
+		if taints[i].Key != taint.Key || taints[i].Value != taint.Value {
+			continue
+		}
+		patches = append(patches, patch.NewJSONPatch("test", taintPath(i), taints[i]),
+			patch.NewJSONPatch("remove", taintPath(i), nil))
+	}
+	return patches
+}
+
+// patchTaints applies the given taint patches to the given node, doing nothing if there are none
+func patchTaints(ctx context.Context, c client.Client, node *core.Node, patches []*patch.JSONPatch) error {
+	if len(patches) == 0 {
+		return nil
+	}
+	patchData, err := json.Marshal(patches)
+	if err != nil {
+		return fmt.Errorf("error creating taints patch request: %w", err)
+	}
+	if err = c.Patch(ctx, node, client.RawPatch(kubeTypes.JSONPatchType, patchData)); err != nil {
+		return fmt.Errorf("unable to apply patch data %s on node %s: %w", patchData, node.GetName(), err)
+	}
+	return nil
+}
+
+// EnsureWindowsTaint adds the Windows taint to the given node if it is not present. An existing taint with the same
+// key, whose value or effect differs, is replaced by the Windows taint.
+func EnsureWindowsTaint(ctx context.Context, c client.Client, node *core.Node) error {
+	return patchTaints(ctx, c, node, generateEnsureTaintPatch(node.Spec.Taints, WindowsTaint))
+}
+
+// RemoveWindowsTaint removes the Windows taint from the given node, whatever its effect is. Removing the taint from a
+// node which does not have it is a no-op.
+func RemoveWindowsTaint(ctx context.Context, c client.Client, node *core.Node) error {
+	return patchTaints(ctx, c, node, generateRemoveTaintPatch(node.Spec.Taints, WindowsTaint))
+}
@@ -0,0 +1,108 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var otherTaint = core.Taint{Key: "dedicated", Value: "infra", Effect: core.TaintEffectNoExecute}
+
+func TestEnsureWindowsTaint(t *testing.T) {
+	testCases := []struct {
+		name     string
+		taints   []core.Taint
+		expected []core.Taint
+	}{
+		{
+			name:     "no taints",
+			expected: []core.Taint{WindowsTaint},
+		},
+		{
+			name:     "other taints",
+			taints:   []core.Taint{otherTaint},
+			expected: []core.Taint{otherTaint, WindowsTaint},
+		},
+		{
+			name:     "already present",
+			taints:   []core.Taint{WindowsTaint, otherTaint},
+			expected: []core.Taint{WindowsTaint, otherTaint},
+		},
+		{
+			name:     "different effect",
+			taints:   []core.Taint{otherTaint, {Key: "os", Value: "Windows", Effect: core.TaintEffectNoExecute}},
+			expected: []core.Taint{otherTaint, WindowsTaint},
+		},
+		{
+			name:     "different value",
+			taints:   []core.Taint{{Key: "os", Value: "Linux", Effect: core.TaintEffectNoSchedule}},
+			expected: []core.Taint{WindowsTaint},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node"}, Spec: core.NodeSpec{Taints: test.taints}}
+			c := clientfake.NewClientBuilder().WithObjects(node).Build()
+			current := &core.Node{}
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, current))
+
+			require.NoError(t, EnsureWindowsTaint(ctx, c, current))
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, current))
+			assert.Equal(t, test.expected, current.Spec.Taints)
+
+			// ensuring the taint again does not change the node
+			require.NoError(t, EnsureWindowsTaint(ctx, c, current))
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, current))
+			assert.Equal(t, test.expected, current.Spec.Taints)
+		})
+	}
+}
+
+func TestRemoveWindowsTaint(t *testing.T) {
+	testCases := []struct {
+		name     string
+		taints   []core.Taint
+		expected []core.Taint
+	}{
+		{
+			name: "no taints",
+		},
+		{
+			name:     "not present",
+			taints:   []core.Taint{otherTaint},
+			expected: []core.Taint{otherTaint},
+		},
+		{
+			name:     "present",
+			taints:   []core.Taint{WindowsTaint, otherTaint},
+			expected: []core.Taint{otherTaint},
+		},
+		{
+			name: "present with several effects",
+			taints: []core.Taint{{Key: "os", Value: "Windows", Effect: core.TaintEffectNoExecute}, otherTaint,
+				WindowsTaint},
+			expected: []core.Taint{otherTaint},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node"}, Spec: core.NodeSpec{Taints: test.taints}}
+			c := clientfake.NewClientBuilder().WithObjects(node).Build()
+			current := &core.Node{}
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, current))
+
+			require.NoError(t, RemoveWindowsTaint(ctx, c, current))
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, current))
+			// a node left without taints may hold either a nil or an empty list
+			assert.ElementsMatch(t, test.expected, current.Spec.Taints)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/utils/clock"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/certificates"
+)
+
+// certificateExpiryMetric is the name of the gauge reporting the seconds left until a Windows node certificate expires
+const certificateExpiryMetric = "wmco_windows_node_certificate_expiry_seconds"
+
+// nodeCertificates is the collector tracking the certificates present on each Windows node
+var nodeCertificates = newCertificateExpiryCollector(clock.RealClock{})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(nodeCertificates)
+}
+
+// certificateExpiryCollector is a Prometheus collector that reports the time left until each certificate copied to a
+// Windows node expires. The value is computed on each scrape so that it does not go stale between reconciles.
+type certificateExpiryCollector struct {
+	// mu synchronizes access to certs
+	mu sync.Mutex
+	// certs maps a node name to the certificates present on it, keyed by the certificate subject
+	certs map[string]map[string]*x509.Certificate
+	// desc describes the gauge reported by the collector
+	desc *prometheus.Desc
+	// clock gives the current time the expiry is computed against
+	clock clock.PassiveClock
+}
+
+// newCertificateExpiryCollector returns a collector which uses the given clock to get the current time
+func newCertificateExpiryCollector(clock clock.PassiveClock) *certificateExpiryCollector {
+	return &certificateExpiryCollector{
+		certs: make(map[string]map[string]*x509.Certificate),
+		desc: prometheus.NewDesc(certificateExpiryMetric,
+			"Seconds until the certificate present in the Windows node expires", []string{"node", "subject"}, nil),
+		clock: clock,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *certificateExpiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector
+func (c *certificateExpiryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	for node, certs := range c.certs {
+		for subject, cert := range certs {
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, cert.NotAfter.Sub(now).Seconds(),
+				node, subject)
+		}
+	}
+}
+
+// record replaces the certificates tracked for the given node with the ones in the given PEM encoded CA bundle
+func (c *certificateExpiryCollector) record(nodeName string, caBundle []byte) error {
+	certs, err := certificates.ParseCertificates(caBundle)
+	if err != nil {
+		return fmt.Errorf("error parsing CA bundle for node %s: %w", nodeName, err)
+	}
+	bySubject := make(map[string]*x509.Certificate)
+	for _, cert := range certs {
+		subject := cert.Subject.String()
+		// A rotated CA keeps the subject of the CA it replaces. Report the certificate expiring last, as the older one
+		// is expected to expire once the rotation is complete.
+		if existing, ok := bySubject[subject]; ok && existing.NotAfter.After(cert.NotAfter) {
+			continue
+		}
+		bySubject[subject] = cert
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.certs[nodeName] = bySubject
+	return nil
+}
+
+// remove stops tracking the certificates of the given node
+func (c *certificateExpiryCollector) remove(nodeName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.certs, nodeName)
+}
+
+// RecordCertificateExpiry updates the certificate expiry metric of the given node with the certificates present in
+// the given PEM encoded CA bundle, which is expected to match the bundle copied to the node
+func RecordCertificateExpiry(nodeName string, caBundle []byte) error {
+	return nodeCertificates.record(nodeName, caBundle)
+}
+
+// RemoveCertificateExpiry removes the certificate expiry metric of the given node
+func RemoveCertificateExpiry(nodeName string) {
+	nodeCertificates.remove(nodeName)
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// generateCertPEM returns a PEM encoded self-signed CA certificate with the given subject and expiry time
+func generateCertPEM(t *testing.T, subject pkix.Name, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// gatherExpiry returns the value of the certificate expiry gauge for each node and subject label pair
+func gatherExpiry(t *testing.T, c prometheus.Collector) map[[2]string]float64 {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(c))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	values := make(map[[2]string]float64)
+	for _, family := range families {
+		require.Equal(t, certificateExpiryMetric, family.GetName())
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			values[[2]string{labels["node"], labels["subject"]}] = metric.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+func TestCertificateExpiryCollector(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	kubeletCA := pkix.Name{CommonName: "kube-apiserver-to-kubelet-signer", OrganizationalUnit: []string{"openshift"}}
+	proxyCA := pkix.Name{CommonName: "proxy-ca"}
+
+	oldKubeletCA := generateCertPEM(t, kubeletCA, now.Add(time.Hour))
+	newKubeletCA := generateCertPEM(t, kubeletCA, now.Add(48*time.Hour))
+	proxyCert := generateCertPEM(t, proxyCA, now.Add(-time.Hour))
+
+	clock := clocktesting.NewFakePassiveClock(now)
+	c := newCertificateExpiryCollector(clock)
+	require.NoError(t, c.record("node-a", append(append([]byte{}, oldKubeletCA...), proxyCert...)))
+	require.NoError(t, c.record("node-b", append(append([]byte{}, oldKubeletCA...), newKubeletCA...)))
+
+	assert.Equal(t, map[[2]string]float64{
+		{"node-a", kubeletCA.String()}: time.Hour.Seconds(),
+		// an expired certificate is reported with a negative value
+		{"node-a", proxyCA.String()}: -time.Hour.Seconds(),
+		// the certificate expiring last is reported when a rotation leaves two certificates with the same subject
+		{"node-b", kubeletCA.String()}: (48 * time.Hour).Seconds(),
+	}, gatherExpiry(t, c))
+
+	// recording a node again replaces its previous certificates
+	require.NoError(t, c.record("node-a", newKubeletCA))
+	c.remove("node-b")
+	assert.Equal(t, map[[2]string]float64{
+		{"node-a", kubeletCA.String()}: (48 * time.Hour).Seconds(),
+	}, gatherExpiry(t, c))
+
+	// the time left is computed on each scrape
+	clock.SetTime(now.Add(time.Hour))
+	assert.Equal(t, map[[2]string]float64{
+		{"node-a", kubeletCA.String()}: (47 * time.Hour).Seconds(),
+	}, gatherExpiry(t, c))
+
+	assert.Error(t, c.record("node-a", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("bad")})))
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// sshReachableMetric is the name of the gauge reporting whether WMCO could connect to a Windows node over SSH
+	sshReachableMetric = "wmco_windows_node_ssh_reachable"
+	// sshDialDurationMetric is the name of the gauge reporting the time spent connecting to a Windows node over SSH
+	sshDialDurationMetric = "wmco_windows_node_ssh_dial_seconds"
+)
+
+// nodeSSHReachability is the collector tracking the result of the last SSH connection attempt to each Windows node
+var nodeSSHReachability = newSSHReachabilityCollector()
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(nodeSSHReachability)
+}
+
+// sshDial is the result of an attempt to connect to a Windows node over SSH
+type sshDial struct {
+	reachable bool
+	duration  time.Duration
+}
+
+// sshReachabilityCollector is a Prometheus collector that reports whether WMCO could connect to each Windows node over
+// SSH the last time it attempted to, and how long the attempt took. This tells a node which is up but unreachable by
+// WMCO apart from a node which is gone, as a node unreachable by WMCO may still report Ready.
+type sshReachabilityCollector struct {
+	// mu synchronizes access to dials
+	mu sync.Mutex
+	// dials maps a node name to the result of the last attempt to connect to it
+	dials map[string]sshDial
+	// reachableDesc describes the reachability gauge reported by the collector
+	reachableDesc *prometheus.Desc
+	// durationDesc describes the dial duration gauge reported by the collector
+	durationDesc *prometheus.Desc
+}
+
+// newSSHReachabilityCollector returns a collector tracking no node
+func newSSHReachabilityCollector() *sshReachabilityCollector {
+	return &sshReachabilityCollector{
+		dials: make(map[string]sshDial),
+		reachableDesc: prometheus.NewDesc(sshReachableMetric,
+			"Whether WMCO could connect to the Windows node over SSH the last time it attempted to",
+			[]string{"node"}, nil),
+		durationDesc: prometheus.NewDesc(sshDialDurationMetric,
+			"Seconds spent connecting to the Windows node over SSH the last time WMCO attempted to",
+			[]string{"node"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *sshReachabilityCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.reachableDesc
+	ch <- c.durationDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *sshReachabilityCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for node, dial := range c.dials {
+		reachable := 0.0
+		if dial.reachable {
+			reachable = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.reachableDesc, prometheus.GaugeValue, reachable, node)
+		ch <- prometheus.MustNewConstMetric(c.durationDesc, prometheus.GaugeValue, dial.duration.Seconds(), node)
+	}
+}
+
+// record replaces the result of the last attempt to connect to the given node
+func (c *sshReachabilityCollector) record(nodeName string, reachable bool, dialDuration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dials[nodeName] = sshDial{reachable: reachable, duration: dialDuration}
+}
+
+// remove stops tracking the given node
+func (c *sshReachabilityCollector) remove(nodeName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.dials, nodeName)
+}
+
+// RecordSSHReachability updates the SSH reachability metrics of the given node with the result of an attempt to
+// connect to it, which took the given time
+func RecordSSHReachability(nodeName string, reachable bool, dialDuration time.Duration) {
+	nodeSSHReachability.record(nodeName, reachable, dialDuration)
+}
+
+// RemoveSSHReachability removes the SSH reachability metrics of the given node
+func RemoveSSHReachability(nodeName string) {
+	nodeSSHReachability.remove(nodeName)
+}
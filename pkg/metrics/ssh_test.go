@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatherByNode returns the value of each gauge reported by the given collector, keyed by metric name and node label
+func gatherByNode(t *testing.T, c prometheus.Collector) map[[2]string]float64 {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(c))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	values := make(map[[2]string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "node" {
+					values[[2]string{family.GetName(), label.GetValue()}] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestSSHReachabilityCollector(t *testing.T) {
+	c := newSSHReachabilityCollector()
+	c.record("reachable", true, 1500*time.Millisecond)
+	c.record("unreachable", false, time.Minute)
+	assert.Equal(t, map[[2]string]float64{
+		{sshReachableMetric, "reachable"}:      1,
+		{sshDialDurationMetric, "reachable"}:   1.5,
+		{sshReachableMetric, "unreachable"}:    0,
+		{sshDialDurationMetric, "unreachable"}: 60,
+	}, gatherByNode(t, c))
+
+	// recording a node again replaces its previous result
+	c.record("unreachable", true, time.Second)
+	c.remove("reachable")
+	assert.Equal(t, map[[2]string]float64{
+		{sshReachableMetric, "unreachable"}:    1,
+		{sshDialDurationMetric, "unreachable"}: 1,
+	}, gatherByNode(t, c))
+}
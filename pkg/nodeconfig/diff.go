@@ -0,0 +1,280 @@
+package nodeconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	mcfg "github.com/openshift/api/machineconfiguration/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/certificates"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+	"github.com/openshift/windows-machine-config-operator/version"
+)
+
+const (
+	// controllerConfigName is the name of the ControllerConfig holding the current kubelet client CA bundle
+	controllerConfigName = "machine-config-controller"
+	// absent is the value reported for state which is not present on the node
+	absent = "<absent>"
+	// redactedUser replaces the user credentials of any URL included in the values reported
+	redactedUser = "redacted"
+)
+
+// DiffEntry describes a single difference between the desired and actual state of a Windows node
+type DiffEntry struct {
+	// Field identifies the compared property, prefixed by the subsystem it belongs to. i.e. "service/kubelet"
+	Field string
+	// Desired is the value WMCO expects
+	Desired string
+	// Actual is the value found on the node
+	Actual string
+}
+
+// NodeDiff is a report of every difference found between the desired and actual state of a Windows node
+type NodeDiff struct {
+	// Node is the name of the node, or the address of the instance if it has no node
+	Node string
+	// Entries holds the differences found, sorted by field
+	Entries []DiffEntry
+}
+
+// InSync returns true if no differences were found
+func (d NodeDiff) InSync() bool {
+	return len(d.Entries) == 0
+}
+
+// String returns a human-readable report of the differences, one per line
+func (d NodeDiff) String() string {
+	if d.InSync() {
+		return fmt.Sprintf("%s: in sync", d.Node)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %d difference(s)", d.Node, len(d.Entries))
+	for _, entry := range d.Entries {
+		fmt.Fprintf(&sb, "\n  %s: desired %q, actual %q", entry.Field, entry.Desired, entry.Actual)
+	}
+	return sb.String()
+}
+
+// compare records an entry for the given field if the desired and actual values differ
+func (d *NodeDiff) compare(field, desired, actual string) {
+	if desired != actual {
+		d.Entries = append(d.Entries, DiffEntry{Field: field, Desired: desired, Actual: actual})
+	}
+}
+
+// Diff returns a report of every difference between the desired and actual state of the instance: WMCO version,
+// payload files, kubelet configuration, certificates, environment variables, services and firewall rules. The instance
+// and the cluster are only read from, nothing is modified.
+func (nc *nodeConfig) Diff(ctx context.Context) (NodeDiff, error) {
+	diff := NodeDiff{Node: nc.GetIPv4Address()}
+	if nc.node != nil {
+		diff.Node = nc.node.GetName()
+	}
+	diff.diffAnnotations(nc.node, nc.publicKeyHash)
+
+	outdated, err := nc.OutdatedPayloadFiles()
+	if err != nil {
+		return NodeDiff{}, err
+	}
+	for _, path := range outdated {
+		diff.compare("file/"+path, "up to date", "missing or modified")
+	}
+
+	if err := nc.diffKubeletConfig(&diff); err != nil {
+		return NodeDiff{}, err
+	}
+	if err := nc.diffKubeletClientCA(ctx, &diff); err != nil {
+		return NodeDiff{}, err
+	}
+
+	servicesCM := &core.ConfigMap{}
+	if err := nc.client.Get(ctx, types.NamespacedName{Namespace: nc.wmcoNamespace, Name: servicescm.Name},
+		servicesCM); err != nil {
+		return NodeDiff{}, fmt.Errorf("unable to get ConfigMap %s: %w", servicescm.Name, err)
+	}
+	servicesData, err := servicescm.Parse(servicesCM.Data)
+	if err != nil {
+		return NodeDiff{}, fmt.Errorf("unable to parse ConfigMap %s: %w", servicescm.Name, err)
+	}
+	if err := nc.diffEnvVars(servicesData, &diff); err != nil {
+		return NodeDiff{}, err
+	}
+	if err := nc.diffServices(servicesData, &diff); err != nil {
+		return NodeDiff{}, err
+	}
+	if err := nc.diffFirewallRules(&diff); err != nil {
+		return NodeDiff{}, err
+	}
+
+	sort.SliceStable(diff.Entries, func(i, j int) bool {
+		return diff.Entries[i].Field < diff.Entries[j].Field
+	})
+	return diff, nil
+}
+
+// diffAnnotations compares the WMCO annotations of the given node against the expected values
+func (d *NodeDiff) diffAnnotations(node *core.Node, publicKeyHash string) {
+	annotations := map[string]string{}
+	if node != nil {
+		annotations = node.GetAnnotations()
+	}
+	get := func(key string) string {
+		if value, present := annotations[key]; present {
+			return value
+		}
+		return absent
+	}
+	d.compare("annotation/"+metadata.VersionAnnotation, version.Get(), get(metadata.VersionAnnotation))
+	d.compare("annotation/"+metadata.DesiredVersionAnnotation, version.Get(), get(metadata.DesiredVersionAnnotation))
+	d.compare("annotation/"+PubKeyHashAnnotation, publicKeyHash, get(PubKeyHashAnnotation))
+}
+
+// diffKubeletConfig compares the kubelet configuration file on the instance against the one WMCO generates
+func (nc *nodeConfig) diffKubeletConfig(diff *NodeDiff) error {
+	kubeletConf, err := createKubeletConf(nc.clusterServiceCIDR, nc.paths.KubeletCACertPath)
+	if err != nil {
+		return err
+	}
+	// the file is written normalized, so that is the content it is expected to hold
+	upToDate, err := nc.FileExists(nc.paths.KubeletConfigPath,
+		fmt.Sprintf("%x", sha256.Sum256(configFileFormat.Normalize([]byte(kubeletConf)))))
+	if err != nil {
+		return err
+	}
+	if !upToDate {
+		diff.compare("config/"+nc.paths.KubeletConfigPath, "up to date", "missing or modified")
+	}
+	return nil
+}
+
+// diffKubeletClientCA compares the kubelet client CA bundle on the instance against the current bundle in the cluster.
+// Certificates are reported by their fingerprint.
+func (nc *nodeConfig) diffKubeletClientCA(ctx context.Context, diff *NodeDiff) error {
+	cc := &mcfg.ControllerConfig{}
+	if err := nc.client.Get(ctx, types.NamespacedName{Name: controllerConfigName}, cc); err != nil {
+		return fmt.Errorf("unable to get ControllerConfig %s: %w", controllerConfigName, err)
+	}
+	desired, err := certificateFingerprints(cc.Spec.KubeAPIServerServingCAData)
+	if err != nil {
+		return fmt.Errorf("error parsing desired kubelet client CA bundle: %w", err)
+	}
+
+	actual := absent
+	exists, err := nc.FileExists(nc.paths.KubeletCACertPath, "")
+	if err != nil {
+		return err
+	}
+	if exists {
+		out, err := nc.Run("Get-Content -Raw -Path "+windows.QuotePowerShellArg(nc.paths.KubeletCACertPath), true)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %w", nc.paths.KubeletCACertPath, err)
+		}
+		if actual, err = certificateFingerprints([]byte(out)); err != nil {
+			return fmt.Errorf("error parsing kubelet client CA bundle on the instance: %w", err)
+		}
+	}
+	diff.compare("certificate/"+nc.paths.KubeletCACertPath, desired, actual)
+	return nil
+}
+
+// diffEnvVars compares the system environment variables on the instance against the ones WMCO manages
+func (nc *nodeConfig) diffEnvVars(servicesData *servicescm.Data, diff *NodeDiff) error {
+	for _, name := range servicesData.WatchedEnvironmentVars {
+		desired := servicesData.EnvironmentVars[name]
+		if desired == "" {
+			desired = absent
+		}
+		out, err := nc.Run(fmt.Sprintf("[Environment]::GetEnvironmentVariable(%s, 'Machine')",
+			windows.QuotePowerShellArg(name)), true)
+		if err != nil {
+			return fmt.Errorf("unable to get environment variable %s: %w", name, err)
+		}
+		actual := strings.TrimSpace(out)
+		if actual == "" {
+			actual = absent
+		}
+		if desired != actual {
+			// values are compared before being redacted, so that a change in credentials is still reported
+			diff.Entries = append(diff.Entries, DiffEntry{Field: "env/" + name, Desired: redactCredentials(desired),
+				Actual: redactCredentials(actual)})
+		}
+	}
+	return nil
+}
+
+// diffServices checks that every service WMCO configures exists and is running on the instance
+func (nc *nodeConfig) diffServices(servicesData *servicescm.Data, diff *NodeDiff) error {
+	for _, svc := range servicesData.Services {
+		exists, running, err := nc.ServiceStatus(svc.Name)
+		if err != nil {
+			return fmt.Errorf("unable to get status of service %s: %w", svc.Name, err)
+		}
+		diff.compare("service/"+svc.Name, "running", serviceState(exists, running))
+	}
+	return nil
+}
+
+// diffFirewallRules checks that the firewall rules created by the userData are enabled on the instance
+func (nc *nodeConfig) diffFirewallRules(diff *NodeDiff) error {
+	for _, rule := range []string{secrets.ContainerLogsFirewallRule, secrets.WindowsExporterFirewallRule} {
+		out, err := nc.Run(fmt.Sprintf("(Get-NetFirewallRule -DisplayName %s -ErrorAction SilentlyContinue).Enabled",
+			windows.QuotePowerShellArg(rule)), true)
+		if err != nil {
+			return fmt.Errorf("unable to get firewall rule %s: %w", rule, err)
+		}
+		actual := strings.TrimSpace(out)
+		if actual == "" {
+			actual = absent
+		}
+		diff.compare("firewall/"+rule, "True", actual)
+	}
+	return nil
+}
+
+// serviceState returns a human-readable description of a service's state
+func serviceState(exists, running bool) string {
+	switch {
+	case !exists:
+		return absent
+	case running:
+		return "running"
+	default:
+		return "stopped"
+	}
+}
+
+// certificateFingerprints returns the sorted SHA256 fingerprints of the certificates in the given PEM data, so that
+// CA bundles can be compared without reporting their content
+func certificateFingerprints(data []byte) (string, error) {
+	certs, err := certificates.ParseCertificates(data)
+	if err != nil {
+		return "", err
+	}
+	fingerprints := make([]string, 0, len(certs))
+	for _, cert := range certs {
+		fingerprints = append(fingerprints, fmt.Sprintf("%x", sha256.Sum256(cert.Raw)))
+	}
+	sort.Strings(fingerprints)
+	return strings.Join(fingerprints, ","), nil
+}
+
+// redactCredentials returns the given value with any user credentials removed, if it is a URL. Proxy environment
+// variables may hold credentials which must not be part of the report.
+func redactCredentials(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	u.User = url.User(redactedUser)
+	return u.String()
+}
@@ -0,0 +1,123 @@
+package nodeconfig
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// drainInterval is the wait time between attempts to evict the pods left on a node being drained
+	drainInterval = 5 * time.Second
+	// PodNodeNameField is the field pods are listed by when draining a node. Clients reading from a cache must be
+	// given an index on it.
+	PodNodeNameField = "spec.nodeName"
+)
+
+// CordonAndDrain marks the given node as unschedulable and evicts the pods running on it, returning once all of them
+// are gone. DaemonSet and mirror pods are left on the node, as they would be recreated there. Evictions are subject to
+// PodDisruptionBudgets: an eviction refused because of one is attempted again until the given timeout is reached, in
+// which case the error returned lists the pods left on the node. The pods of the node are listed through the
+// PodNodeNameField field selector.
+func CordonAndDrain(ctx context.Context, c client.Client, node *core.Node, timeout time.Duration) error {
+	return cordonAndDrain(ctx, c, node, timeout, drainInterval)
+}
+
+// cordonAndDrain behaves as CordonAndDrain, attempting to evict the pods left on the node every given interval
+func cordonAndDrain(ctx context.Context, c client.Client, node *core.Node, timeout, interval time.Duration) error {
+	if !node.Spec.Unschedulable {
+		cordoned := node.DeepCopy()
+		cordoned.Spec.Unschedulable = true
+		if err := c.Patch(ctx, cordoned, client.MergeFrom(node)); err != nil {
+			return fmt.Errorf("unable to cordon node %s: %w", node.GetName(), err)
+		}
+		node.Spec.Unschedulable = true
+	}
+
+	var remaining []core.Pod
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		var err error
+		remaining, err = podsToEvict(ctx, c, node.GetName())
+		if err != nil {
+			return false, err
+		}
+		for i := range remaining {
+			if err = evict(ctx, c, &remaining[i]); err != nil {
+				return false, err
+			}
+		}
+		return len(remaining) == 0, nil
+	})
+	if err != nil {
+		if wait.Interrupted(err) {
+			return fmt.Errorf("timeout draining node %s, pods left on the node: %s: %w", node.GetName(),
+				podNames(remaining), err)
+		}
+		return fmt.Errorf("unable to drain node %s: %w", node.GetName(), err)
+	}
+	return nil
+}
+
+// podsToEvict returns the pods running on the node with the given name which must be evicted for it to be drained
+func podsToEvict(ctx context.Context, c client.Client, nodeName string) ([]core.Pod, error) {
+	pods := &core.PodList{}
+	if err := c.List(ctx, pods, client.MatchingFields{PodNodeNameField: nodeName}); err != nil {
+		return nil, fmt.Errorf("error listing pods of node %s: %w", nodeName, err)
+	}
+	var toEvict []core.Pod
+	for _, pod := range pods.Items {
+		if !needsEviction(&pod) {
+			continue
+		}
+		toEvict = append(toEvict, pod)
+	}
+	return toEvict, nil
+}
+
+// needsEviction returns true if the given pod must be evicted from its node for the node to be drained
+func needsEviction(pod *core.Pod) bool {
+	if pod.Status.Phase == core.PodSucceeded || pod.Status.Phase == core.PodFailed {
+		return false
+	}
+	if _, isMirror := pod.GetAnnotations()[core.MirrorPodAnnotationKey]; isMirror {
+		return false
+	}
+	if owner := meta.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+	return true
+}
+
+// evict requests the eviction of the given pod. Evictions refused because of a PodDisruptionBudget, and evictions of
+// pods which are already gone, are not treated as errors.
+func evict(ctx context.Context, c client.Client, pod *core.Pod) error {
+	if pod.GetDeletionTimestamp() != nil {
+		// the pod is already terminating, another eviction would not make it go faster
+		return nil
+	}
+	eviction := &policyv1.Eviction{ObjectMeta: meta.ObjectMeta{Name: pod.GetName(), Namespace: pod.GetNamespace()}}
+	err := c.SubResource("eviction").Create(ctx, pod, eviction)
+	if err == nil || apierrors.IsNotFound(err) || apierrors.IsTooManyRequests(err) {
+		return nil
+	}
+	return fmt.Errorf("error evicting pod %s/%s: %w", pod.GetNamespace(), pod.GetName(), err)
+}
+
+// podNames returns the sorted, comma-separated namespaced names of the given pods
+func podNames(pods []core.Pod) string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.GetNamespace()+"/"+pod.GetName())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
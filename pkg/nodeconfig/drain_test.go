@@ -0,0 +1,154 @@
+package nodeconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// newPod returns a running pod with the given name and labels, scheduled on the given node
+func newPod(name, nodeName string, podLabels map[string]string) *core.Pod {
+	return &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "default", Labels: podLabels},
+		Spec:       core.PodSpec{NodeName: nodeName},
+		Status:     core.PodStatus{Phase: core.PodRunning},
+	}
+}
+
+// pdbInterceptor refuses the eviction of pods protected by a PodDisruptionBudget which allows no disruption, as the
+// API server does. Once the given number of evictions have been refused, the budgets are updated to allow disruptions.
+func pdbInterceptor(releaseAfter int) interceptor.Funcs {
+	refused := 0
+	return interceptor.Funcs{
+		SubResourceCreate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object,
+			subResource client.Object, opts ...client.SubResourceCreateOption) error {
+			pdbs := &policyv1.PodDisruptionBudgetList{}
+			if err := c.List(ctx, pdbs, client.InNamespace(obj.GetNamespace())); err != nil {
+				return err
+			}
+			for _, pdb := range pdbs.Items {
+				selector, err := meta.LabelSelectorAsSelector(pdb.Spec.Selector)
+				if err != nil {
+					return err
+				}
+				if !selector.Matches(labels.Set(obj.GetLabels())) || pdb.Status.DisruptionsAllowed > 0 {
+					continue
+				}
+				refused++
+				if refused == releaseAfter {
+					pdb.Status.DisruptionsAllowed = 1
+					if err = c.Status().Update(ctx, &pdb); err != nil {
+						return err
+					}
+				}
+				return apierrors.NewTooManyRequests("cannot evict pod as it would violate the pod's disruption budget",
+					0)
+			}
+			return c.SubResource(subResourceName).Create(ctx, obj, subResource, opts...)
+		},
+	}
+}
+
+func TestCordonAndDrain(t *testing.T) {
+	minAvailable := intstr.FromInt32(1)
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: meta.ObjectMeta{Name: "db", Namespace: "default"},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector:     &meta.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+		},
+	}
+	daemonSetPod := newPod("daemonset", "node", nil)
+	daemonSetPod.OwnerReferences = []meta.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "ds",
+		UID: "ds-uid", Controller: ptr.To(true)}}
+	mirrorPod := newPod("mirror", "node", nil)
+	mirrorPod.Annotations = map[string]string{core.MirrorPodAnnotationKey: "hash"}
+	completedPod := newPod("completed", "node", nil)
+	completedPod.Status.Phase = core.PodSucceeded
+
+	testCases := []struct {
+		name string
+		pods []*core.Pod
+		// releaseAfter is the number of evictions refused before the PodDisruptionBudget allows disruptions, never if 0
+		releaseAfter     int
+		expectedEvicted  []string
+		expectedLeft     []string
+		expectedErr      bool
+		expectedInErrMsg string
+	}{
+		{
+			name: "no pods",
+		},
+		{
+			name: "evicts pods which would not be recreated on the node",
+			pods: []*core.Pod{newPod("web", "node", nil), daemonSetPod, mirrorPod, completedPod,
+				newPod("elsewhere", "other-node", nil)},
+			expectedEvicted: []string{"web"},
+			expectedLeft:    []string{"daemonset", "mirror", "completed", "elsewhere"},
+		},
+		{
+			name:             "blocked by a disruption budget",
+			pods:             []*core.Pod{newPod("web", "node", nil), newPod("db", "node", map[string]string{"app": "db"})},
+			expectedEvicted:  []string{"web"},
+			expectedLeft:     []string{"db"},
+			expectedErr:      true,
+			expectedInErrMsg: "default/db",
+		},
+		{
+			name:            "disruption budget released",
+			pods:            []*core.Pod{newPod("db", "node", map[string]string{"app": "db"})},
+			releaseAfter:    2,
+			expectedEvicted: []string{"db"},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node"}}
+			objects := []client.Object{node, pdb.DeepCopy()}
+			for _, pod := range test.pods {
+				objects = append(objects, pod.DeepCopy())
+			}
+			c := clientfake.NewClientBuilder().WithObjects(objects...).
+				WithIndex(&core.Pod{}, PodNodeNameField, func(obj client.Object) []string {
+					return []string{obj.(*core.Pod).Spec.NodeName}
+				}).
+				WithInterceptorFuncs(pdbInterceptor(test.releaseAfter)).Build()
+			current := &core.Node{}
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, current))
+
+			err := cordonAndDrain(ctx, c, current, 500*time.Millisecond, 10*time.Millisecond)
+			if test.expectedErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedInErrMsg)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: node.GetName()}, current))
+			assert.True(t, current.Spec.Unschedulable)
+			for _, name := range test.expectedEvicted {
+				err = c.Get(ctx, kubeTypes.NamespacedName{Namespace: "default", Name: name}, &core.Pod{})
+				assert.Truef(t, apierrors.IsNotFound(err), "pod %s should have been evicted", name)
+			}
+			for _, name := range test.expectedLeft {
+				err = c.Get(ctx, kubeTypes.NamespacedName{Namespace: "default", Name: name}, &core.Pod{})
+				assert.NoErrorf(t, err, "pod %s should have been left on the node", name)
+			}
+		})
+	}
+}
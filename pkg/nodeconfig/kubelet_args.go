@@ -0,0 +1,113 @@
+package nodeconfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// nodeLabelsFlag is the kubelet flag holding the labels the node registers with
+const nodeLabelsFlag = "--node-labels"
+
+// kubeletArgs is a kubelet command line split into the labels given through --node-labels and every other argument
+type kubeletArgs struct {
+	// args holds the arguments other than --node-labels, in their original order
+	args []string
+	// labelsIndex is the position in args at which --node-labels is serialized, -1 if it was not given
+	labelsIndex int
+	// nodeLabels holds the labels given through every occurrence of --node-labels
+	nodeLabels map[string]string
+}
+
+// RequiredNodeLabels returns the labels WMCO requires kubelet to register Windows nodes with
+func RequiredNodeLabels() map[string]string {
+	key, value, _ := strings.Cut(WindowsOSLabel, "=")
+	return map[string]string{key: value}
+}
+
+// MergeKubeletNodeLabels returns the given kubelet args with --node-labels holding both the labels already given and
+// the given required labels, the required labels taking precedence over existing labels with the same key. Every other
+// argument is kept in place, and labels are serialized sorted by key, so that merging the same labels again gives the
+// same args.
+func MergeKubeletNodeLabels(args string, required map[string]string) (string, error) {
+	parsed, err := parseKubeletArgs(args)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range required {
+		parsed.nodeLabels[key] = value
+	}
+	return parsed.String(), nil
+}
+
+// parseKubeletArgs parses the given whitespace separated kubelet args. --node-labels may be given multiple times, in
+// which case the labels are merged as kubelet does, later occurrences overriding earlier ones.
+func parseKubeletArgs(args string) (*kubeletArgs, error) {
+	parsed := &kubeletArgs{labelsIndex: -1, nodeLabels: make(map[string]string)}
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		var value string
+		switch {
+		case strings.HasPrefix(fields[i], nodeLabelsFlag+"="):
+			value = strings.TrimPrefix(fields[i], nodeLabelsFlag+"=")
+		case fields[i] == nodeLabelsFlag:
+			if i+1 == len(fields) {
+				return nil, fmt.Errorf("missing value for kubelet arg %s", nodeLabelsFlag)
+			}
+			i++
+			value = fields[i]
+		default:
+			parsed.args = append(parsed.args, fields[i])
+			continue
+		}
+		if parsed.labelsIndex == -1 {
+			parsed.labelsIndex = len(parsed.args)
+		}
+		if err := parseNodeLabels(value, parsed.nodeLabels); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+// parseNodeLabels adds the labels held by the given comma separated list of key=value pairs to the given map
+func parseNodeLabels(value string, labels map[string]string) error {
+	for _, pair := range strings.Split(value, ",") {
+		if pair == "" {
+			continue
+		}
+		key, labelValue, found := strings.Cut(pair, "=")
+		if !found || key == "" {
+			return fmt.Errorf("invalid label %q in kubelet arg %s", pair, nodeLabelsFlag)
+		}
+		labels[key] = labelValue
+	}
+	return nil
+}
+
+// String returns the kubelet args as a whitespace separated string, with --node-labels omitted if no labels are held
+func (k *kubeletArgs) String() string {
+	if len(k.nodeLabels) == 0 {
+		return strings.Join(k.args, " ")
+	}
+	keys := make([]string, 0, len(k.nodeLabels))
+	for key := range k.nodeLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+k.nodeLabels[key])
+	}
+	labelsArg := nodeLabelsFlag + "=" + strings.Join(pairs, ",")
+
+	index := k.labelsIndex
+	if index == -1 {
+		index = len(k.args)
+	}
+	args := make([]string, 0, len(k.args)+1)
+	args = append(args, k.args[:index]...)
+	args = append(args, labelsArg)
+	args = append(args, k.args[index:]...)
+	return strings.Join(args, " ")
+}
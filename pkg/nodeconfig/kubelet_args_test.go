@@ -0,0 +1,70 @@
+package nodeconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeKubeletNodeLabels(t *testing.T) {
+	testCases := []struct {
+		name        string
+		args        string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "empty input",
+			args:     "",
+			expected: "--node-labels=node.openshift.io/os_id=Windows",
+		},
+		{
+			name:     "no existing labels",
+			args:     "--config=c:\\k\\kubelet.conf --windows-service",
+			expected: "--config=c:\\k\\kubelet.conf --windows-service --node-labels=node.openshift.io/os_id=Windows",
+		},
+		{
+			name: "existing labels",
+			args: "--config=c:\\k\\kubelet.conf --node-labels=zone=a,team=windows --windows-service",
+			expected: "--config=c:\\k\\kubelet.conf " +
+				"--node-labels=node.openshift.io/os_id=Windows,team=windows,zone=a --windows-service",
+		},
+		{
+			name:     "conflicting label",
+			args:     "--node-labels=node.openshift.io/os_id=Linux,team=windows",
+			expected: "--node-labels=node.openshift.io/os_id=Windows,team=windows",
+		},
+		{
+			name:     "separate value and repeated flag",
+			args:     "--v=2 --node-labels team=windows --windows-service --node-labels=team=linux,empty=",
+			expected: "--v=2 --node-labels=empty=,node.openshift.io/os_id=Windows,team=linux --windows-service",
+		},
+		{
+			name:        "invalid label",
+			args:        "--node-labels=team",
+			expectedErr: true,
+		},
+		{
+			name:        "missing value",
+			args:        "--windows-service --node-labels",
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := MergeKubeletNodeLabels(test.args, RequiredNodeLabels())
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+
+			// merging again must not change the args
+			again, err := MergeKubeletNodeLabels(out, RequiredNodeLabels())
+			require.NoError(t, err)
+			assert.Equal(t, out, again)
+		})
+	}
+}
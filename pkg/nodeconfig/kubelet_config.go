@@ -0,0 +1,71 @@
+package nodeconfig
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	kubeletconfig "k8s.io/kubelet/config/v1beta1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+// FileReceiver reads files from a Windows instance, as implemented by windows.Windows
+type FileReceiver interface {
+	// ReceiveFile returns the contents of the file at the given path on the instance
+	ReceiveFile(string) ([]byte, error)
+}
+
+// VerifyKubeletConfig reads the kubelet config file from the instance reached through the given receiver and compares
+// it against the given expected config. Both configs are parsed, so that formatting and field order are not reported.
+// Returns true if the configs match, and the JSON paths of the fields which differ otherwise.
+func VerifyKubeletConfig(conn FileReceiver, expected []byte) (bool, []string, error) {
+	expectedConfig := kubeletconfig.KubeletConfiguration{}
+	if err := yaml.Unmarshal(expected, &expectedConfig); err != nil {
+		return false, nil, fmt.Errorf("unable to parse expected kubelet config: %w", err)
+	}
+	actual, err := conn.ReceiveFile(windows.KubeletConfigPath)
+	if err != nil {
+		return false, nil, fmt.Errorf("unable to read kubelet config %s: %w", windows.KubeletConfigPath, err)
+	}
+	actualConfig := kubeletconfig.KubeletConfiguration{}
+	if err = yaml.Unmarshal(actual, &actualConfig); err != nil {
+		return false, nil, fmt.Errorf("unable to parse kubelet config %s: %w", windows.KubeletConfigPath, err)
+	}
+	var fields []string
+	diffFields("", reflect.ValueOf(expectedConfig), reflect.ValueOf(actualConfig), &fields)
+	return len(fields) == 0, fields, nil
+}
+
+// diffFields appends to fields the JSON path of each field differing between the given values, which must be of the
+// same type. Structs are compared field by field, every other value is compared as a whole, so that an empty list is
+// not considered equal to a missing one, as kubelet defaults missing lists.
+func diffFields(path string, expected, actual reflect.Value, fields *[]string) {
+	if expected.Kind() == reflect.Ptr && !expected.IsNil() && !actual.IsNil() {
+		diffFields(path, expected.Elem(), actual.Elem(), fields)
+		return
+	}
+	if expected.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(expected.Interface(), actual.Interface()) {
+			*fields = append(*fields, path)
+		}
+		return
+	}
+	for i := 0; i < expected.NumField(); i++ {
+		field := expected.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		fieldPath := path
+		// embedded structs, such as TypeMeta, have their fields inlined
+		if !field.Anonymous {
+			if name == "" {
+				name = field.Name
+			}
+			fieldPath = strings.TrimPrefix(path+"."+name, ".")
+		}
+		diffFields(fieldPath, expected.Field(i), actual.Field(i), fields)
+	}
+}
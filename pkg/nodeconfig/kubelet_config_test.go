@@ -0,0 +1,80 @@
+package nodeconfig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+// fakeReceiver is a FileReceiver serving files from memory
+type fakeReceiver map[string][]byte
+
+func (f fakeReceiver) ReceiveFile(path string) ([]byte, error) {
+	content, found := f[path]
+	if !found {
+		return nil, errors.New("file not found")
+	}
+	return content, nil
+}
+
+func TestVerifyKubeletConfig(t *testing.T) {
+	expected, err := createKubeletConf("10.0.128.8/24", KubeletClientCAPath(nil))
+	require.NoError(t, err)
+	expectedYAML, err := yaml.JSONToYAML([]byte(expected))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		files          fakeReceiver
+		expectedMatch  bool
+		expectedFields []string
+		expectedErr    bool
+	}{
+		{
+			name:          "matching",
+			files:         fakeReceiver{windows.KubeletConfigPath: []byte(expected)},
+			expectedMatch: true,
+		},
+		{
+			name:          "matching in another format",
+			files:         fakeReceiver{windows.KubeletConfigPath: expectedYAML},
+			expectedMatch: true,
+		},
+		{
+			name: "drifted",
+			files: fakeReceiver{windows.KubeletConfigPath: []byte(strings.NewReplacer(
+				`"clusterDNS":["10.0.128.10"]`, `"clusterDNS":["10.0.128.53"]`,
+				`"clientCAFile":"C:\\k\\kubelet-ca.crt"`, `"clientCAFile":"C:\\k\\ca.crt"`,
+				`,"enforceNodeAllocatable":[]`, "").Replace(expected))},
+			expectedFields: []string{"authentication.x509.clientCAFile", "clusterDNS", "enforceNodeAllocatable"},
+		},
+		{
+			name:        "malformed",
+			files:       fakeReceiver{windows.KubeletConfigPath: []byte("{\"kind\": [")},
+			expectedErr: true,
+		},
+		{
+			name:        "missing",
+			files:       fakeReceiver{},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			match, fields, err := VerifyKubeletConfig(test.files, []byte(expected))
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedMatch, match)
+			assert.Equal(t, test.expectedFields, fields)
+		})
+	}
+}
@@ -57,13 +57,17 @@ const (
 	PubKeyHashAnnotation = "windowsmachineconfig.openshift.io/pub-key-hash"
 	// KubeletClientCAFilename is the name of the CA certificate file required by kubelet to interact
 	// with the kube-apiserver client
-	KubeletClientCAFilename = "kubelet-ca.crt"
+	KubeletClientCAFilename = windows.KubeletClientCAFilename
 	// mcoNamespace is the namespace the Machine Config Server is deployed in, which manages the node bootsrapper secret
 	mcoNamespace = "openshift-machine-config-operator"
 	// mcoBootstrapSecret is the resource name that holds the cert and token required to create the bootstrap kubeconfig
 	mcoBootstrapSecret = "node-bootstrapper-token"
 )
 
+// configFileFormat is the format the configuration files written to instances are normalized to, as they are read by
+// kubelet and the other Go components, which do not expect a byte order mark
+var configFileFormat = windows.TextFormat{LineEnding: windows.LF, BOM: windows.StripBOM}
+
 // nodeConfig holds the information to make the given VM a kubernetes node. As of now, it holds the information
 // related to kubeclient and the windowsVM.
 type nodeConfig struct {
@@ -87,6 +91,10 @@ type nodeConfig struct {
 	platformType configv1.PlatformType
 	// wmcoNamespace is the namespace WMCO is deployed to
 	wmcoNamespace string
+	// paths are the locations used on the instance, rooted at its install directory
+	paths windows.Paths
+	// machineBacked indicates the instance is the VM of a Machine rather than a BYOH instance
+	machineBacked bool
 }
 
 // ErrWriter is a wrapper to enable error-level logging inside kubectl drainer implementation
@@ -136,30 +144,63 @@ func NewNodeConfig(c client.Client, clientset *kubernetes.Clientset, clusterServ
 	return &nodeConfig{client: c, k8sclientset: clientset, Windows: win, node: instanceInfo.Node,
 		platformType: platformType, wmcoNamespace: wmcoNamespace, clusterServiceCIDR: clusterServiceCIDR,
 		publicKeyHash: CreatePubKeyHashAnnotation(signer.PublicKey()), log: log, additionalLabels: additionalLabels,
-		additionalAnnotations: additionalAnnotations}, nil
+		additionalAnnotations: additionalAnnotations, paths: windows.InstancePaths(instanceInfo),
+		machineBacked: instanceInfo.MachineBacked}, nil
 }
 
 // Configure configures the Windows VM to make it a Windows worker node
 func (nc *nodeConfig) Configure() error {
 	drainHelper := nc.newDrainHelper()
+	start := time.Now()
+	// Once a Node object exists, it is annotated as being configured until the configuration ends, successfully or not
+	defer func() {
+		if nc.node == nil {
+			return
+		}
+		if err := metadata.RemoveConfiguringAnnotation(context.TODO(), nc.client, *nc.node); err != nil {
+			nc.log.Info("unable to clear configuring annotation", "node", nc.node.GetName(), "error", err)
+		}
+	}()
 	// If a Node object exists already, it implies that we are reconfiguring and we should cordon the node
 	if nc.node != nil {
+		if err := metadata.ApplyConfiguringAnnotation(context.TODO(), nc.client, nc.node, start); err != nil {
+			return fmt.Errorf("error marking node %s as being configured: %w", nc.node.GetName(), err)
+		}
 		// Make a best effort to cordon the node until it is fully configured
 		if err := drain.RunCordonOrUncordon(drainHelper, nc.node, true); err != nil {
 			nc.log.Info("unable to cordon", "node", nc.node.GetName(), "error", err)
 		}
 	}
 
+	// A reboot queued by OS updates can make the installation of services fail, so it is reported before an instance
+	// is configured for the first time rather than letting the installation fail opaquely. The instance is not
+	// rebooted, as it may be owned by the customer, and nodes are not checked, as their reboot would disrupt workloads.
+	if nc.node == nil {
+		rebootRequired, err := nc.Windows.PendingRebootRequired()
+		if err != nil {
+			return err
+		}
+		if rebootRequired {
+			return fmt.Errorf("a reboot queued by OS updates is pending, the instance must be rebooted before it " +
+				"can be configured")
+		}
+	}
+	// hardened images may block the kubelet port, keeping the node from reporting Ready. The firewall of BYOH
+	// instances is left to the customer managing them.
+	if nc.machineBacked {
+		if err := nc.Windows.EnsureFirewallRules([]int{windows.KubeletPort}); err != nil {
+			return err
+		}
+	}
+
 	if err := nc.createBootstrapFiles(); err != nil {
 		return err
 	}
 	if err := nc.createRegistryConfigFiles(); err != nil {
 		return err
 	}
-	if cluster.IsProxyEnabled() {
-		if err := nc.ensureTrustedCABundle(); err != nil {
-			return err
-		}
+	if err := nc.ensureCABundles(); err != nil {
+		return err
 	}
 	wicdKC, err := nc.generateWICDKubeconfig()
 	if err != nil {
@@ -179,6 +220,9 @@ func (nc *nodeConfig) Configure() error {
 			if err := nc.setNode(false); err != nil {
 				return fmt.Errorf("error setting node object: %w", err)
 			}
+			if err := metadata.ApplyConfiguringAnnotation(context.TODO(), nc.client, nc.node, start); err != nil {
+				return fmt.Errorf("error marking node %s as being configured: %w", nc.node.GetName(), err)
+			}
 		}
 
 		// Make a best effort to cordon the node until it is fully configured
@@ -188,7 +232,10 @@ func (nc *nodeConfig) Configure() error {
 
 		// Ensure we are labeling and annotating the node as soon as the Node object is created, so that we can identify
 		// which controller should be watching it
-		annotationsToApply := map[string]string{PubKeyHashAnnotation: nc.publicKeyHash}
+		// the install directory is recorded so that the instance can be reached at the same locations once it is
+		// described by its Node
+		annotationsToApply := map[string]string{PubKeyHashAnnotation: nc.publicKeyHash,
+			metadata.InstallDirAnnotation: nc.paths.K8sDir}
 		for key, value := range nc.additionalAnnotations {
 			annotationsToApply[key] = value
 		}
@@ -356,18 +403,20 @@ func (nc *nodeConfig) createBootstrapFiles() error {
 	if err != nil {
 		return err
 	}
-	filePathsToContents[windows.KubeletConfigPath], err = createKubeletConf(nc.clusterServiceCIDR)
+	filePathsToContents[nc.paths.KubeletConfigPath], err = createKubeletConf(nc.clusterServiceCIDR,
+		nc.paths.KubeletCACertPath)
 	if err != nil {
 		return err
 	}
 	return nc.write(filePathsToContents)
 }
 
-// write outputs the data to the path on the underlying Windows instance for each given pair. Creates files if needed.
+// write outputs the data to the path on the underlying Windows instance for each given pair, normalized to
+// configFileFormat. Creates files if needed.
 func (nc *nodeConfig) write(pathToData map[string]string) error {
 	for path, data := range pathToData {
 		dir, fileName := windows.SplitPath(path)
-		if err := nc.Windows.EnsureFileContent([]byte(data), fileName, dir); err != nil {
+		if err := nc.Windows.EnsureTextFileContent([]byte(data), fileName, dir, configFileFormat); err != nil {
 			return err
 		}
 	}
@@ -398,7 +447,7 @@ func (nc *nodeConfig) createFilesFromIgnition() (map[string]string, error) {
 	// create a map of 'ignition files':'desired path on a Windows instance'
 	filesToTransfer := map[string]string{}
 	if _, ok := kubeletArgs[ignition.CloudConfigOption]; ok {
-		filesToTransfer[ignition.CloudConfigPath] = windows.K8sDir + "\\" + filepath.Base(ignition.CloudConfigPath)
+		filesToTransfer[ignition.CloudConfigPath] = windows.NodePaths().K8sFile(filepath.Base(ignition.CloudConfigPath))
 	}
 	filesToTransfer[ignition.ECRCredentialProviderPath] = windows.CredentialProviderConfig
 
@@ -407,7 +456,7 @@ func (nc *nodeConfig) createFilesFromIgnition() (map[string]string, error) {
 		return nil, fmt.Errorf("error processing ignition files: %w", err)
 	}
 
-	filePathsToContents[windows.K8sDir+"\\"+KubeletClientCAFilename] = string(ign.GetKubeletCAData())
+	filePathsToContents[nc.paths.KubeletCACertPath] = string(ign.GetKubeletCAData())
 	return filePathsToContents, nil
 }
 
@@ -452,13 +501,14 @@ func newKubeconfigFromSecret(saSecret *core.Secret, username string) (string, er
 	return string(kubeconfigData), nil
 }
 
-// createKubeletConf returns contents of the config file for kubelet, with Windows specific configuration
-func createKubeletConf(clusterServiceCIDR string) (string, error) {
+// createKubeletConf returns contents of the config file for kubelet, with Windows specific configuration. kubelet is
+// configured to read its client CA from the given path.
+func createKubeletConf(clusterServiceCIDR, clientCAPath string) (string, error) {
 	clusterDNS, err := cluster.GetDNS(clusterServiceCIDR)
 	if err != nil {
 		return "", err
 	}
-	kubeletConfig := generateKubeletConfiguration(clusterDNS)
+	kubeletConfig := generateKubeletConfiguration(clusterDNS, clientCAPath)
 	kubeletConfigData, err := json.Marshal(kubeletConfig)
 	if err != nil {
 		return "", err
@@ -544,6 +594,11 @@ func (nc *nodeConfig) Deconfigure() error {
 	if err := nc.cleanupWithWICD(); err != nil {
 		return err
 	}
+	// Services left running by the cleanup hold locks on their files, preventing their removal
+	if err := StopManagedServices(nc.Windows.ServiceManager()); err != nil {
+		return fmt.Errorf("error deconfiguring instance: %w", err)
+	}
+	nc.log.Info("stopped managed services", "services", managedServicesStopOrder)
 	if err := nc.Windows.RemoveFilesAndNetworks(); err != nil {
 		return fmt.Errorf("error deconfiguring instance: %w", err)
 	}
@@ -581,21 +636,55 @@ func (nc *nodeConfig) UpdateKubeletClientCA(contents []byte) error {
 		// nothing do to, return
 		return nil
 	}
-	err := nc.Windows.EnsureFileContent(contents, KubeletClientCAFilename, windows.GetK8sDir())
-	if err != nil {
-		return err
+	dir, fileName := windows.SplitPath(nc.paths.KubeletCACertPath)
+	return nc.Windows.EnsureFileContent(contents, fileName, dir)
+}
+
+// KubeletClientCAPath returns the location of the kubelet client CA certificate file on the given Windows instance,
+// within its install directory. This is both where the CA is written and the path kubelet is configured to read it
+// from.
+func KubeletClientCAPath(info *instance.Info) string {
+	return windows.InstancePaths(info).KubeletCACertPath
+}
+
+// ValidateKubeletClientCAPath returns an error if the given kubelet config does not configure kubelet to use the
+// client CA file at the expected path, in which case the CA written there never takes effect. Windows paths are
+// case-insensitive.
+func ValidateKubeletClientCAPath(kubeletConfigData []byte, expectedPath string) error {
+	kubeletConfig := kubeletconfig.KubeletConfiguration{}
+	if err := yaml.Unmarshal(kubeletConfigData, &kubeletConfig); err != nil {
+		return fmt.Errorf("unable to parse kubelet config: %w", err)
+	}
+	actualPath := kubeletConfig.Authentication.X509.ClientCAFile
+	if !strings.EqualFold(strings.TrimSpace(actualPath), expectedPath) {
+		return fmt.Errorf("kubelet is configured to use client CA file '%s' instead of '%s'", actualPath,
+			expectedPath)
 	}
 	return nil
 }
 
-// ensureTrustedCABundle gets the trusted CA ConfigMap and ensures the cert bundle on the instance has up-to-date data
-func (nc *nodeConfig) ensureTrustedCABundle() error {
-	trustedCA := &core.ConfigMap{}
-	if err := nc.client.Get(context.TODO(), types.NamespacedName{Namespace: nc.wmcoNamespace,
-		Name: certificates.ProxyCertsConfigMap}, trustedCA); err != nil {
-		return fmt.Errorf("unable to get ConfigMap %s: %w", certificates.ProxyCertsConfigMap, err)
+// ensureCABundles ensures the CA bundles held by ConfigMaps are up-to-date on the instance. The bundles of CA sources of
+// other kinds are written by their own controllers.
+func (nc *nodeConfig) ensureCABundles() error {
+	for _, source := range certificates.RequiredCASources(nc.paths) {
+		if source.Kind != certificates.ConfigMapKind || (source.ProxyOnly && !cluster.IsProxyEnabled()) {
+			continue
+		}
+		namespace := source.Namespace
+		if namespace == "" {
+			namespace = nc.wmcoNamespace
+		}
+		cm := &core.ConfigMap{}
+		if err := nc.client.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: source.Name},
+			cm); err != nil {
+			return fmt.Errorf("unable to get ConfigMap %s: %w", source.Name, err)
+		}
+		dir, fileName := windows.SplitPath(source.NodePath)
+		if err := nc.Windows.EnsureFileContent([]byte(cm.Data[source.Key]), fileName, dir); err != nil {
+			return fmt.Errorf("unable to copy %s: %w", source.Description, err)
+		}
 	}
-	return nc.UpdateTrustedCABundleFile(trustedCA.Data)
+	return nil
 }
 
 // UpdateTrustedCABundleFile updates the file containing the trusted CA bundle in the Windows node, if needed
@@ -632,8 +721,9 @@ func generateKubeconfig(caCert []byte, token, apiServerURL, username string) cli
 	return kubeconfig
 }
 
-// generateKubeletConfiguration returns the configuration spec for the kubelet Windows service
-func generateKubeletConfiguration(clusterDNS string) kubeletconfig.KubeletConfiguration {
+// generateKubeletConfiguration returns the configuration spec for the kubelet Windows service, reading its client CA
+// from the given path
+func generateKubeletConfiguration(clusterDNS, clientCAPath string) kubeletconfig.KubeletConfiguration {
 	// default numeric values chosen based on the OpenShift kubelet config recommendations for Linux worker nodes
 	falseBool := false
 	trueBool := true
@@ -648,7 +738,7 @@ func generateKubeletConfiguration(clusterDNS string) kubeletconfig.KubeletConfig
 		ServerTLSBootstrap: true,
 		Authentication: kubeletconfig.KubeletAuthentication{
 			X509: kubeletconfig.KubeletX509Authentication{
-				ClientCAFile: windows.K8sDir + "\\" + KubeletClientCAFilename,
+				ClientCAFile: clientCAPath,
 			},
 			Anonymous: kubeletconfig.KubeletAnonymousAuthentication{
 				Enabled: &falseBool,
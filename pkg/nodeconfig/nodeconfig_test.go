@@ -8,6 +8,8 @@ import (
 	core "k8s.io/api/core/v1"
 	config "k8s.io/kubelet/config/v1"
 	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 )
 
 func TestNewKubeConfigFromSecret(t *testing.T) {
@@ -103,7 +105,7 @@ func TestCreateKubeletConf(t *testing.T) {
 
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
-			actualSpec, err := createKubeletConf(test.cidr)
+			actualSpec, err := createKubeletConf(test.cidr, KubeletClientCAPath(&instance.Info{}))
 			if test.expectedErr {
 				assert.Error(t, err)
 				return
@@ -114,6 +116,76 @@ func TestCreateKubeletConf(t *testing.T) {
 	}
 }
 
+func TestKubeletClientCAPath(t *testing.T) {
+	assert.Equal(t, "C:\\k\\kubelet-ca.crt", KubeletClientCAPath(&instance.Info{}))
+	assert.Equal(t, "D:\\kubernetes\\kubelet-ca.crt", KubeletClientCAPath(&instance.Info{InstallDir: "D:\\kubernetes\\"}))
+}
+
+func TestValidateKubeletClientCAPath(t *testing.T) {
+	generatedConfig, err := createKubeletConf("10.0.128.8/24", KubeletClientCAPath(&instance.Info{}))
+	require.NoError(t, err)
+	customInstallDir := &instance.Info{InstallDir: "D:\\kubernetes"}
+	customConfig, err := createKubeletConf("10.0.128.8/24", KubeletClientCAPath(customInstallDir))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		config      string
+		info        *instance.Info
+		expectedErr bool
+	}{
+		{
+			name:        "generated config",
+			config:      generatedConfig,
+			info:        &instance.Info{},
+			expectedErr: false,
+		},
+		{
+			name:        "generated config with a custom install directory",
+			config:      customConfig,
+			info:        customInstallDir,
+			expectedErr: false,
+		},
+		{
+			name:        "default path with a custom install directory",
+			config:      generatedConfig,
+			info:        customInstallDir,
+			expectedErr: true,
+		},
+		{
+			name:        "path differs only in case",
+			config:      "authentication:\n  x509:\n    clientCAFile: C:\\K\\KUBELET-CA.CRT\n",
+			expectedErr: false,
+		},
+		{
+			name:        "different path",
+			config:      "authentication:\n  x509:\n    clientCAFile: C:\\k\\other-ca.crt\n",
+			expectedErr: true,
+		},
+		{
+			name:        "client CA not configured",
+			config:      "authentication:\n  anonymous:\n    enabled: false\n",
+			expectedErr: true,
+		},
+		{
+			name:        "malformed config",
+			config:      "authentication: [",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateKubeletClientCAPath([]byte(test.config), KubeletClientCAPath(test.info))
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
 func TestModifyCredentialProviderConfig(t *testing.T) {
 	input := config.CredentialProviderConfig{
 		Providers: []config.CredentialProvider{
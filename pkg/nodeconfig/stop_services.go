@@ -0,0 +1,110 @@
+package nodeconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+const (
+	// serviceStopInterval is the interval at which the state of a stopping service is checked
+	serviceStopInterval = 2 * time.Second
+	// serviceStopTimeout is the time a service is given to stop gracefully before its process is killed, and the time
+	// it is given to be reported stopped once killed
+	serviceStopTimeout = 30 * time.Second
+)
+
+// managedServicesStopOrder is the order in which the Windows services managed by WMCO are stopped. WICD is stopped
+// first so that it does not restart the services it owns, then each service is stopped before the services it
+// depends on, so that no service is left running against a stopped dependency.
+var managedServicesStopOrder = []string{
+	windows.WicdServiceName,
+	windows.AzureCloudNodeManagerServiceName,
+	windows.WindowsExporterServiceName,
+	windows.KubeProxyServiceName,
+	windows.HybridOverlayServiceName,
+	windows.KubeletServiceName,
+	windows.ContainerdServiceName,
+}
+
+// serviceStopped returns true if the given service is stopped or does not exist
+func serviceStopped(services windows.ServiceManager, name string) (bool, error) {
+	state, err := services.Status(name)
+	if err != nil {
+		return false, err
+	}
+	return state == windows.ServiceNotFound || state == windows.ServiceStopped, nil
+}
+
+// waitServiceStopped waits for the given service to be stopped, checking its state at the given interval until the
+// given timeout elapses
+func waitServiceStopped(services windows.ServiceManager, name string, interval, timeout time.Duration) error {
+	var lastErr error
+	err := wait.PollUntilContextTimeout(context.TODO(), interval, timeout, true,
+		func(context.Context) (bool, error) {
+			stopped, err := serviceStopped(services, name)
+			if err != nil {
+				// the state is checked again, as the instance may be slow to answer while services are stopping
+				lastErr = err
+				return false, nil
+			}
+			return stopped, nil
+		})
+	if err != nil && lastErr != nil {
+		return fmt.Errorf("%w: %w", err, lastErr)
+	}
+	return err
+}
+
+// stopService stops the given service, killing its process if it does not stop within the given timeout. Services
+// which do not exist are considered stopped.
+func stopService(services windows.ServiceManager, name string, interval, timeout time.Duration) error {
+	stopped, err := serviceStopped(services, name)
+	if err == nil && stopped {
+		return nil
+	}
+	// a failure to request the stop is not returned on its own, as the service may be stopping already and is killed
+	// otherwise
+	stopErr := services.Stop(name)
+	if err = waitServiceStopped(services, name, interval, timeout); err == nil {
+		return nil
+	}
+	if err = services.Kill(name); err != nil {
+		return errors.Join(stopErr, err)
+	}
+	if err = waitServiceStopped(services, name, interval, timeout); err != nil {
+		return errors.Join(stopErr, fmt.Errorf("%s service still running after its process was killed: %w", name,
+			err))
+	}
+	return nil
+}
+
+// stopServices stops the given services in order, killing the process of each one which does not stop within the given
+// timeout. Every service is attempted, and the returned error names the services which would not stop.
+func stopServices(services windows.ServiceManager, names []string, interval, timeout time.Duration) error {
+	var failed []string
+	var errs []error
+	for _, name := range names {
+		if err := stopService(services, name, interval, timeout); err != nil {
+			failed = append(failed, name)
+			errs = append(errs, err)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to stop services %s: %w", strings.Join(failed, ", "), errors.Join(errs...))
+	}
+	return nil
+}
+
+// StopManagedServices stops the Windows services managed by WMCO through the given ServiceManager, in dependency
+// order. A service which does not stop gracefully within a timeout has its process killed. This must be done before
+// removing the files of the services, as running services hold locks on them which prevent their deletion.
+func StopManagedServices(services windows.ServiceManager) error {
+	return stopServices(services, managedServicesStopOrder, serviceStopInterval, serviceStopTimeout)
+}
@@ -0,0 +1,165 @@
+package nodeconfig
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+// fakeServiceManager is a windows.ServiceManager tracking the states of services, which are updated when the services
+// are requested to stop or killed
+type fakeServiceManager struct {
+	windows.ServiceManager
+	mu sync.Mutex
+	// states are the states of the services, services missing from it do not exist
+	states map[string]windows.ServiceState
+	// ignoreStop are the services which do not stop when requested to
+	ignoreStop map[string]bool
+	// unkillable are the services which keep running once their process is killed
+	unkillable map[string]bool
+	// stopErr and killErr are returned by Stop and Kill, without changing any state
+	stopErr, killErr error
+	// actions are the Stop and Kill calls made, in order
+	actions []string
+}
+
+func (m *fakeServiceManager) Status(name string) (windows.ServiceState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state, ok := m.states[name]; ok {
+		return state, nil
+	}
+	return windows.ServiceNotFound, nil
+}
+
+func (m *fakeServiceManager) Stop(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.actions = append(m.actions, "stop "+name)
+	if m.stopErr != nil {
+		return m.stopErr
+	}
+	if !m.ignoreStop[name] {
+		m.states[name] = windows.ServiceStopped
+	}
+	return nil
+}
+
+func (m *fakeServiceManager) Kill(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.actions = append(m.actions, "kill "+name)
+	if m.killErr != nil {
+		return m.killErr
+	}
+	if !m.unkillable[name] {
+		m.states[name] = windows.ServiceStopped
+	}
+	return nil
+}
+
+// runningServices returns the states of the managed services, all running
+func runningServices() map[string]windows.ServiceState {
+	states := make(map[string]windows.ServiceState)
+	for _, name := range managedServicesStopOrder {
+		states[name] = windows.ServiceRunning
+	}
+	return states
+}
+
+// stopActions returns the actions stopping the given services
+func stopActions(names ...string) []string {
+	var actions []string
+	for _, name := range names {
+		actions = append(actions, "stop "+name)
+	}
+	return actions
+}
+
+func TestStopServices(t *testing.T) {
+	testCases := []struct {
+		name            string
+		services        *fakeServiceManager
+		expectedActions []string
+		// expectedFailed are the services named by the error
+		expectedFailed []string
+	}{
+		{
+			name: "services stopped or missing",
+			services: &fakeServiceManager{
+				states: map[string]windows.ServiceState{windows.KubeletServiceName: windows.ServiceStopped}},
+		},
+		{
+			name:            "services stopped in dependency order",
+			services:        &fakeServiceManager{states: runningServices()},
+			expectedActions: stopActions(managedServicesStopOrder...),
+		},
+		{
+			name: "service killed after the timeout",
+			services: &fakeServiceManager{states: runningServices(),
+				ignoreStop: map[string]bool{windows.KubeletServiceName: true}},
+			expectedActions: append(stopActions(windows.WicdServiceName, windows.AzureCloudNodeManagerServiceName,
+				windows.WindowsExporterServiceName, windows.KubeProxyServiceName, windows.HybridOverlayServiceName,
+				windows.KubeletServiceName), "kill "+windows.KubeletServiceName, "stop "+windows.ContainerdServiceName),
+		},
+		{
+			name: "service killed after a failure to request its stop",
+			services: &fakeServiceManager{
+				states:  map[string]windows.ServiceState{windows.KubeletServiceName: windows.ServiceRunning},
+				stopErr: errors.New("access is denied")},
+			expectedActions: []string{"stop " + windows.KubeletServiceName, "kill " + windows.KubeletServiceName},
+		},
+		{
+			name: "service still running once killed",
+			services: &fakeServiceManager{states: runningServices(),
+				ignoreStop: map[string]bool{windows.KubeletServiceName: true, windows.HybridOverlayServiceName: true},
+				unkillable: map[string]bool{windows.KubeletServiceName: true, windows.HybridOverlayServiceName: true}},
+			expectedActions: append(stopActions(windows.WicdServiceName, windows.AzureCloudNodeManagerServiceName,
+				windows.WindowsExporterServiceName, windows.KubeProxyServiceName, windows.HybridOverlayServiceName),
+				"kill "+windows.HybridOverlayServiceName, "stop "+windows.KubeletServiceName,
+				"kill "+windows.KubeletServiceName, "stop "+windows.ContainerdServiceName),
+			expectedFailed: []string{windows.HybridOverlayServiceName, windows.KubeletServiceName},
+		},
+		{
+			name: "kill failure",
+			services: &fakeServiceManager{
+				states:     map[string]windows.ServiceState{windows.KubeletServiceName: windows.ServiceRunning},
+				ignoreStop: map[string]bool{windows.KubeletServiceName: true},
+				killErr:    errors.New("access is denied")},
+			expectedActions: []string{"stop " + windows.KubeletServiceName, "kill " + windows.KubeletServiceName},
+			expectedFailed:  []string{windows.KubeletServiceName},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := stopServices(test.services, managedServicesStopOrder, time.Millisecond, 20*time.Millisecond)
+			assert.Equal(t, test.expectedActions, test.services.actions)
+			if len(test.expectedFailed) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "unable to stop services "+strings.Join(test.expectedFailed, ", ")+":")
+		})
+	}
+}
+
+func TestStopServiceTimeout(t *testing.T) {
+	services := &fakeServiceManager{
+		states:     map[string]windows.ServiceState{windows.KubeletServiceName: windows.ServiceRunning},
+		ignoreStop: map[string]bool{windows.KubeletServiceName: true}}
+	timeout := 50 * time.Millisecond
+	start := time.Now()
+	require.NoError(t, stopService(services, windows.KubeletServiceName, time.Millisecond, timeout))
+	// the service is given the whole timeout to stop gracefully before being killed
+	assert.GreaterOrEqual(t, time.Since(start), timeout)
+	assert.Equal(t, []string{"stop " + windows.KubeletServiceName, "kill " + windows.KubeletServiceName},
+		services.actions)
+}
@@ -0,0 +1,66 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+const (
+	// labelsPath is the JSON patch path of an object's labels
+	labelsPath = "/metadata/labels/"
+	// annotationsPath is the JSON patch path of an object's annotations
+	annotationsPath = "/metadata/annotations/"
+)
+
+// Builder accumulates operations on the labels and annotations of an object, so that they can be applied through a
+// single JSON patch. The API server applies a JSON patch atomically: either all of its operations are applied or none.
+// The zero value is an empty Builder ready to use.
+type Builder struct {
+	patches []*JSONPatch
+}
+
+// NewBuilder returns an empty Builder
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// add appends an operation on the given key within the given path. Returns the Builder so that calls can be chained.
+func (b *Builder) add(op, basePath, key string, value interface{}) *Builder {
+	b.patches = append(b.patches, NewJSONPatch(op, path.Join(basePath, EscapeJSONPointer(key)), value))
+	return b
+}
+
+// AddLabel adds the given label, overwriting its value if it already exists
+func (b *Builder) AddLabel(key, value string) *Builder {
+	return b.add("add", labelsPath, key, value)
+}
+
+// RemoveLabel removes the given label. The patch fails if the label does not exist.
+func (b *Builder) RemoveLabel(key string) *Builder {
+	return b.add("remove", labelsPath, key, nil)
+}
+
+// AddAnnotation adds the given annotation, overwriting its value if it already exists
+func (b *Builder) AddAnnotation(key, value string) *Builder {
+	return b.add("add", annotationsPath, key, value)
+}
+
+// RemoveAnnotation removes the given annotation. The patch fails if the annotation does not exist.
+func (b *Builder) RemoveAnnotation(key string) *Builder {
+	return b.add("remove", annotationsPath, key, nil)
+}
+
+// TestAnnotation checks the given annotation has the given value. The patch fails, and none of the operations are
+// applied, if it does not.
+func (b *Builder) TestAnnotation(key, value string) *Builder {
+	return b.add("test", annotationsPath, key, value)
+}
+
+// Build returns the JSON patch applying the operations accumulated so far, in the order they were added
+func (b *Builder) Build() ([]byte, error) {
+	if len(b.patches) == 0 {
+		return nil, fmt.Errorf("no patch operations")
+	}
+	return json.Marshal(b.patches)
+}
@@ -1,5 +1,7 @@
 package patch
 
+import "strings"
+
 // JSONPatch describes a patch operation
 type JSONPatch struct {
 	// op defines patch operation to be performed on the Endpoints object
@@ -18,3 +20,10 @@ func NewJSONPatch(op, path string, value interface{}) *JSONPatch {
 		Value: value,
 	}
 }
+
+// EscapeJSONPointer escapes the given reference token so that it can be used as a single element of a JSON patch path.
+// `~` and `/` are replaced by `~0` and `~1` respectively, as described in https://www.rfc-editor.org/rfc/rfc6901#section-3
+func EscapeJSONPointer(token string) string {
+	// `~` must be escaped first, so that the `~` introduced by escaping `/` is left as is
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
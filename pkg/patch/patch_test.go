@@ -0,0 +1,80 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapeJSONPointer(t *testing.T) {
+	testCases := []struct {
+		token    string
+		expected string
+	}{
+		{token: "", expected: ""},
+		{token: "label", expected: "label"},
+		{token: "windowsmachineconfig.openshift.io/upgrading", expected: "windowsmachineconfig.openshift.io~1upgrading"},
+		{token: "a~b", expected: "a~0b"},
+		// an escaped `/` is not mistaken for an escape sequence
+		{token: "~1/", expected: "~01~1"},
+		{token: "/~/", expected: "~1~0~1"},
+	}
+	for _, test := range testCases {
+		t.Run(test.token, func(t *testing.T) {
+			assert.Equal(t, test.expected, EscapeJSONPointer(test.token))
+		})
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	testCases := []struct {
+		name        string
+		builder     *Builder
+		expectedOut string
+		expectedErr bool
+	}{
+		{
+			name:        "empty",
+			builder:     NewBuilder(),
+			expectedErr: true,
+		},
+		{
+			name:        "zero value",
+			builder:     (&Builder{}).AddLabel("label", "true"),
+			expectedOut: `[{"op":"add","path":"/metadata/labels/label","value":"true"}]`,
+		},
+		{
+			name: "mixed operations",
+			builder: NewBuilder().
+				TestAnnotation("windowsmachineconfig.openshift.io/desired-version", "1.0").
+				AddAnnotation("windowsmachineconfig.openshift.io/version", "1.0").
+				AddLabel("kubernetes.io/os", "windows").
+				RemoveLabel("windowsmachineconfig.openshift.io/upgrading").
+				RemoveAnnotation("a~b"),
+			// the operations are kept in the order they were added, so that the test gates the ones after it
+			expectedOut: `[` +
+				`{"op":"test","path":"/metadata/annotations/windowsmachineconfig.openshift.io~1desired-version","value":"1.0"},` +
+				`{"op":"add","path":"/metadata/annotations/windowsmachineconfig.openshift.io~1version","value":"1.0"},` +
+				`{"op":"add","path":"/metadata/labels/kubernetes.io~1os","value":"windows"},` +
+				`{"op":"remove","path":"/metadata/labels/windowsmachineconfig.openshift.io~1upgrading"},` +
+				`{"op":"remove","path":"/metadata/annotations/a~0b"}]`,
+		},
+		{
+			name:        "empty value",
+			builder:     NewBuilder().AddAnnotation("reboot-required", ""),
+			expectedOut: `[{"op":"add","path":"/metadata/annotations/reboot-required","value":""}]`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := test.builder.Build()
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expectedOut, string(out))
+		})
+	}
+}
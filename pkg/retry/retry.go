@@ -1,6 +1,13 @@
 package retry
 
-import "time"
+import (
+	"errors"
+	"io"
+	"syscall"
+	"time"
+
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+)
 
 const (
 	// Count is the number of times we will retry an API call
@@ -14,3 +21,11 @@ const (
 	// ResourceChangeTimeout is the total time waited for a change (create/update/delete) to take place
 	ResourceChangeTimeout = time.Minute * 2
 )
+
+// IsTransientAPIError returns true if the given API error is expected to resolve itself on retry, either because of the
+// state of the API server or because the connection to it was lost
+func IsTransientAPIError(err error) bool {
+	return k8sapierrors.IsServerTimeout(err) || k8sapierrors.IsTimeout(err) || k8sapierrors.IsTooManyRequests(err) ||
+		k8sapierrors.IsServiceUnavailable(err) || k8sapierrors.IsInternalError(err) ||
+		k8sapierrors.IsUnexpectedServerError(err) || errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNREFUSED)
+}
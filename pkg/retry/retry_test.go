@@ -0,0 +1,63 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestIsTransientAPIError(t *testing.T) {
+	secrets := schema.GroupResource{Resource: "secrets"}
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "server timeout",
+			err:      k8sapierrors.NewServerTimeout(secrets, "get", 1),
+			expected: true,
+		},
+		{
+			name:     "too many requests",
+			err:      k8sapierrors.NewTooManyRequests("throttled", 1),
+			expected: true,
+		},
+		{
+			name:     "internal error",
+			err:      k8sapierrors.NewInternalError(errors.New("etcd unavailable")),
+			expected: true,
+		},
+		{
+			name:     "connection closed",
+			err:      fmt.Errorf("error getting secret: %w", io.EOF),
+			expected: true,
+		},
+		{
+			name:     "connection refused",
+			err:      fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED),
+			expected: true,
+		},
+		{
+			name:     "not found",
+			err:      k8sapierrors.NewNotFound(secrets, "kubelet-signer"),
+			expected: false,
+		},
+		{
+			name:     "conflict",
+			err:      k8sapierrors.NewConflict(secrets, "kubelet-signer", errors.New("object modified")),
+			expected: false,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, IsTransientAPIError(test.err))
+		})
+	}
+}
@@ -21,6 +21,12 @@ const (
 	PrivateKeySecret = "cloud-private-key"
 	// PrivateKeySecretKey is the key within the private key secret which holds the private key
 	PrivateKeySecretKey = "private-key.pem"
+	// ContainerLogsFirewallRule is the display name of the firewall rule created by the userData to allow access to
+	// the kubelet port
+	ContainerLogsFirewallRule = "ContainerLogsPort"
+	// WindowsExporterFirewallRule is the display name of the firewall rule created by the userData to allow access to
+	// the windows_exporter metrics port
+	WindowsExporterFirewallRule = "WindowsExporter"
 )
 
 // GetPrivateKey fetches the specified secret and extracts the private key data
@@ -80,10 +86,10 @@ func generateUserDataWithPubKey(pubKey string) string {
 			}
 
 			Add-WindowsCapability -Online -Name OpenSSH.Server~~~~0.0.1.0
-			$firewallRuleName = "ContainerLogsPort"
+			$firewallRuleName = "` + ContainerLogsFirewallRule + `"
 			$containerLogsPort = "10250"
 			New-NetFirewallRule -DisplayName $firewallRuleName -Direction Inbound -Action Allow -Protocol TCP -LocalPort $containerLogsPort -EdgeTraversalPolicy Allow
-			New-NetFirewallRule -DisplayName "WindowsExporter" -Direction Inbound -Action Allow -Protocol TCP -LocalPort "` + windowsExporterPort + `" -EdgeTraversalPolicy Allow
+			New-NetFirewallRule -DisplayName "` + WindowsExporterFirewallRule + `" -Direction Inbound -Action Allow -Protocol TCP -LocalPort "` + windowsExporterPort + `" -EdgeTraversalPolicy Allow
 			Set-Service -Name sshd -StartupType 'Automatic'
 			Start-Service sshd
 			(Get-Content -path C:\ProgramData\ssh\sshd_config) | ForEach-Object {
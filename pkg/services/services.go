@@ -253,7 +253,7 @@ func generateKubeletArgs(argsFromIgnition map[string]string, debug bool) ([]stri
 	}
 	if cloudConfigValue, ok := argsFromIgnition[ignition.CloudConfigOption]; ok {
 		// cloud config is placed by WMCO in the c:\k directory with the same file name
-		cloudConfigPath := windows.K8sDir + "\\" + filepath.Base(cloudConfigValue)
+		cloudConfigPath := windows.NodePaths().K8sFile(filepath.Base(cloudConfigValue))
 		kubeletArgs = append(kubeletArgs, fmt.Sprintf("--%s=%s", ignition.CloudConfigOption, cloudConfigPath))
 	}
 
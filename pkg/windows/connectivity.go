@@ -2,22 +2,107 @@ package windows
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/apimachinery/pkg/util/wait"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/hostport"
 	"github.com/openshift/windows-machine-config-operator/pkg/retry"
 )
 
-// sshPort is the default SSH port
-const sshPort = "22"
+const (
+	// sshPort is the default SSH port
+	sshPort = "22"
+	// pingTimeout is the time allowed for a ping command to complete
+	pingTimeout = 10 * time.Second
+	// maxReconnects is the maximum number of times a connection found lost is re-established
+	maxReconnects = 3
+	// pingCommand is a no-op command valid in both cmd and PowerShell, so that it can be run regardless of the
+	// default shell
+	pingCommand = "echo ping"
+	// sshReadyInterval is the interval at which the SSH port of a VM is probed while waiting for it to be ready
+	sshReadyInterval = 5 * time.Second
+)
+
+// dialRetry configures how connecting to a VM is retried, as the VM may still be booting or running its user data
+type dialRetry struct {
+	// interval is the time waited between attempts
+	interval time.Duration
+	// timeout is the total time after which no more attempts are made
+	timeout time.Duration
+	// authRetries is the number of authentication failures tolerated before giving up, as the key of the VM may not
+	// be authorized yet while the VM is running its user data. With the default of 0, the first authentication
+	// failure is fatal, so that a wrong key is reported without waiting for the timeout.
+	authRetries int
+}
+
+// defaultDialRetry is the dialRetry used when none is given
+var defaultDialRetry = dialRetry{interval: time.Minute, timeout: retry.Timeout}
+
+const (
+	// sshDialIntervalEnvVar is the environment variable overriding the interval of defaultDialRetry, as a duration
+	sshDialIntervalEnvVar = "SSH_DIAL_INTERVAL"
+	// sshDialTimeoutEnvVar is the environment variable overriding the timeout of defaultDialRetry, as a duration
+	sshDialTimeoutEnvVar = "SSH_DIAL_TIMEOUT"
+)
+
+// dialRetryFromEnv returns defaultDialRetry with the interval and timeout overridden by the environment variables
+// which are set. Returns nil if none is set.
+func dialRetryFromEnv() (*dialRetry, error) {
+	interval, intervalSet := os.LookupEnv(sshDialIntervalEnvVar)
+	timeout, timeoutSet := os.LookupEnv(sshDialTimeoutEnvVar)
+	if !intervalSet && !timeoutSet {
+		return nil, nil
+	}
+	d := defaultDialRetry
+	var err error
+	if intervalSet {
+		if d.interval, err = time.ParseDuration(interval); err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %w", sshDialIntervalEnvVar, interval, err)
+		}
+	}
+	if timeoutSet {
+		if d.timeout, err = time.ParseDuration(timeout); err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %w", sshDialTimeoutEnvVar, timeout, err)
+		}
+	}
+	if err = d.validate(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// validate returns an error if the interval or timeout is not positive, if the interval exceeds the timeout, or if
+// the number of authentication retries is negative
+func (d *dialRetry) validate() error {
+	if d.interval <= 0 || d.timeout <= 0 {
+		return fmt.Errorf("SSH dial interval %s and timeout %s must be positive", d.interval, d.timeout)
+	}
+	if d.authRetries < 0 {
+		return fmt.Errorf("SSH authentication retries %d cannot be negative", d.authRetries)
+	}
+	if d.interval > d.timeout {
+		return fmt.Errorf("SSH dial interval %s cannot exceed the timeout %s", d.interval, d.timeout)
+	}
+	return nil
+}
 
 // AuthErr occurs when our authentication into the VM is rejected
 type AuthErr struct {
@@ -33,17 +118,132 @@ func newAuthErr(err error) *AuthErr {
 	return &AuthErr{err: err.Error()}
 }
 
+// ConnectionErr occurs when no SSH connection can be established with the VM
+type ConnectionErr struct {
+	// address is the address of the VM
+	address string
+	// dialDuration is the time spent trying to connect to the VM
+	dialDuration time.Duration
+	err          error
+}
+
+func (e *ConnectionErr) Error() string {
+	return fmt.Sprintf("unable to setup VM %s sshConnectivity: %v", e.address, e.err)
+}
+
+// Unwrap returns the error which prevented the connection
+func (e *ConnectionErr) Unwrap() error {
+	return e.err
+}
+
+// DialDuration returns the time spent trying to connect to the VM
+func (e *ConnectionErr) DialDuration() time.Duration {
+	return e.dialDuration
+}
+
+var (
+	// ErrRemoteMkdir is wrapped by the errors of transfers which failed to create the remote directory
+	ErrRemoteMkdir = errors.New("error creating remote directory")
+	// ErrRemoteCreate is wrapped by the errors of transfers which failed to create the remote file
+	ErrRemoteCreate = errors.New("error creating remote file")
+	// ErrRemoteCopy is wrapped by the errors of transfers which failed to write the content of the remote file
+	ErrRemoteCopy = errors.New("error copying to remote file")
+	// errRemoteClose is wrapped by the errors of writes which failed to close the remote file, in which case the
+	// server may not have flushed all of its content
+	errRemoteClose = errors.New("error closing remote file")
+)
+
+// RemoteDiskFullErr occurs when a file cannot be written to the VM because its disk is full
+type RemoteDiskFullErr struct {
+	// path is the remote file being written
+	path string
+	// size is the number of bytes being written, -1 if unknown
+	size int64
+	err  error
+}
+
+// Error returns the error message
+func (e *RemoteDiskFullErr) Error() string {
+	size := "unknown size"
+	if e.size >= 0 {
+		size = fmt.Sprintf("%d bytes", e.size)
+	}
+	return fmt.Sprintf("insufficient disk space on the Windows VM to write %s (%s): %s", e.path, size, e.err)
+}
+
+// Unwrap returns the underlying SFTP error
+func (e *RemoteDiskFullErr) Unwrap() error {
+	return e.err
+}
+
+// sshFxNoSpaceOnFilesystem is the SFTP status code for a full disk. It is only defined from version 5 of the protocol,
+// servers implementing version 3 report a generic failure along with a message.
+const sshFxNoSpaceOnFilesystem = 14
+
+// diskFullMessages are the lowercase messages reported by the Windows and POSIX SFTP servers when a disk is full
+var diskFullMessages = []string{"not enough space on the disk", "no space left on device"}
+
+// isDiskFull returns true if the given error, returned by an SFTP operation, indicates that the remote disk is full
+func isDiskFull(err error) bool {
+	var statusErr *sftp.StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == sshFxNoSpaceOnFilesystem {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, diskFull := range diskFullMessages {
+		if strings.Contains(message, diskFull) {
+			return true
+		}
+	}
+	return false
+}
+
 type connectivity interface {
 	// init initialises the connectivity medium
 	init() error
 	// run executes the given command on the remote system
 	run(cmd string) (string, error)
+	// runSeparate executes the given command on the remote system, returning its stdout and stderr separately
+	runSeparate(cmd string) (string, string, error)
 	// createSFTPClient initializes an SFTP client from the existing SSH client. Caller should close the connection.
 	createSFTPClient() (*sftp.Client, error)
 	// transfer reads from reader and creates a file in the remote VM directory, creating the remote directory if needed
 	transfer(*sftp.Client, io.Reader, string, string) error
+	// transferWithProgress behaves as transfer, calling the given function, if not nil, with the number of bytes written
+	// and the total number of bytes to write after each write to the remote file. The total is -1 if it is unknown.
+	transferWithProgress(*sftp.Client, io.Reader, string, string, func(bytesWritten, totalBytes int64)) error
+	// transferAtomic behaves as transfer, writing to a temporary file renamed over the destination file once complete,
+	// so that the destination file is never seen partially written
+	transferAtomic(*sftp.Client, io.Reader, string, string) error
+	// transferWithMode behaves as transfer, setting the mode of the remote file to the given one once written
+	transferWithMode(*sftp.Client, io.Reader, string, string, os.FileMode) error
 	// transferFiles transfers the given files to a given remote directory
 	transferFiles(*sftp.Client, map[string][]byte, string) error
+	// receive returns the contents of the given remote file
+	receive(remotePath string) ([]byte, error)
+	// ping returns an error if a command cannot be run on the remote system within a short time
+	ping() error
+	// remove removes the given remote file or empty directory, a missing path is not an error
+	remove(remotePath string) error
+	// removeAll removes the given remote directory and everything it contains, a missing path is not an error
+	removeAll(remoteDir string) error
+	// close closes the connection to the remote system
+	close() error
+}
+
+// BastionConfig holds the information needed to reach a Windows VM through an SSH bastion host
+type BastionConfig struct {
+	// Address is the address of the bastion host, in the host:port format
+	Address string
+	// Username is the user to connect to the bastion host
+	Username string
+	// Signer is used for authenticating against the bastion host
+	Signer ssh.Signer
+}
+
+// String returns a description of the bastion which is safe to log, omitting the signer
+func (b *BastionConfig) String() string {
+	return fmt.Sprintf("address: %s, username: %s, signer set: %t", b.Address, b.Username, b.Signer != nil)
 }
 
 // sshConnectivity encapsulates the information needed to connect to the Windows VM over ssh
@@ -52,20 +252,152 @@ type sshConnectivity struct {
 	username string
 	// ipAddress is the VM's IP address
 	ipAddress string
+	// port is the port the VM's SSH server listens on
+	port string
 	// signer is used for authenticating against the VM
 	signer ssh.Signer
+	// password is an optional password for the user, used to authenticate against the VM if key authentication fails.
+	// It must never be logged.
+	password string
+	// mu guards sshClient, bastionClient and reconnects, as the connection is shared by concurrent operations, any of
+	// which may find it lost and re-establish it
+	mu sync.Mutex
 	// sshClient is the client used to access the Windows VM via ssh
 	sshClient *ssh.Client
-	log       logr.Logger
+	// bastion is an optional bastion host the connection to the VM is tunneled through
+	bastion *BastionConfig
+	// bastionClient is the client connected to the bastion host, if any
+	bastionClient *ssh.Client
+	// algorithms restricts the ciphers, MACs and key exchange algorithms used for the connections to the VM and the
+	// bastion. The library defaults are used for the algorithms not set.
+	algorithms ssh.Config
+	// dialRetry configures how connecting to the VM is retried
+	dialRetry dialRetry
+	// reconnects is the number of times the connection has been re-established after being lost
+	reconnects int
+	log        logr.Logger
+}
+
+// sshOptions configures the optional aspects of the SSH connection to a VM
+type sshOptions struct {
+	// port is the port the VM's SSH server listens on, the default SSH port is used if empty
+	port string
+	// password is used to authenticate against the VM if key authentication fails. It must never be logged.
+	password string
+	// bastion is the bastion host the connection to the VM is tunneled through, if any
+	bastion *BastionConfig
+	// algorithms restricts the ciphers, MACs and key exchange algorithms used, if set
+	algorithms *ssh.Config
+	// dialRetry configures how connecting to the VM is retried, defaultDialRetry is used if nil
+	dialRetry *dialRetry
 }
 
-// newSshConnectivity returns an instance of sshConnectivity
-func newSshConnectivity(username, ipAddress string, signer ssh.Signer, logger logr.Logger) (connectivity, error) {
+const (
+	// sshPasswordEnvVar is the environment variable holding the password used when key authentication fails. It is
+	// expected to be set from a Secret.
+	sshPasswordEnvVar = "SSH_PASSWORD"
+	// sshBastionAddressEnvVar is the environment variable holding the address of the bastion host, in the host:port
+	// format
+	sshBastionAddressEnvVar = "SSH_BASTION_ADDRESS"
+	// sshBastionUsernameEnvVar is the environment variable holding the user to connect to the bastion host as
+	sshBastionUsernameEnvVar = "SSH_BASTION_USERNAME"
+	// sshCiphersEnvVar is the environment variable restricting the SSH ciphers, as a comma separated list
+	sshCiphersEnvVar = "SSH_CIPHERS"
+	// sshMACsEnvVar is the environment variable restricting the SSH MACs, as a comma separated list
+	sshMACsEnvVar = "SSH_MACS"
+	// sshKeyExchangesEnvVar is the environment variable restricting the SSH key exchange algorithms, as a comma
+	// separated list
+	sshKeyExchangesEnvVar = "SSH_KEY_EXCHANGES"
+)
+
+// sshOptionsFromEnv returns the sshOptions configured by the environment variables of the operator. The bastion host,
+// if any, is authenticated against with the given signer. The port is left to be set from the instance.
+func sshOptionsFromEnv(signer ssh.Signer) (sshOptions, error) {
+	var opts sshOptions
+	var err error
+	if opts.dialRetry, err = dialRetryFromEnv(); err != nil {
+		return sshOptions{}, err
+	}
+	opts.password = os.Getenv(sshPasswordEnvVar)
+
+	address, addressSet := os.LookupEnv(sshBastionAddressEnvVar)
+	username, usernameSet := os.LookupEnv(sshBastionUsernameEnvVar)
+	if addressSet || usernameSet {
+		if address == "" || username == "" {
+			return sshOptions{}, fmt.Errorf("both %s and %s must be set to use a bastion host",
+				sshBastionAddressEnvVar, sshBastionUsernameEnvVar)
+		}
+		opts.bastion = &BastionConfig{Address: address, Username: username, Signer: signer}
+	}
+
+	var algorithms ssh.Config
+	algorithmsSet := false
+	for _, env := range []struct {
+		name   string
+		target *[]string
+	}{
+		{name: sshCiphersEnvVar, target: &algorithms.Ciphers},
+		{name: sshMACsEnvVar, target: &algorithms.MACs},
+		{name: sshKeyExchangesEnvVar, target: &algorithms.KeyExchanges},
+	} {
+		value, ok := os.LookupEnv(env.name)
+		if !ok {
+			continue
+		}
+		algorithmsSet = true
+		// an empty value results in an empty list, which is rejected as no connection could be established with it
+		*env.target = []string{}
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				*env.target = append(*env.target, name)
+			}
+		}
+	}
+	if algorithmsSet {
+		if err = validateAlgorithms(&algorithms); err != nil {
+			return sshOptions{}, err
+		}
+		opts.algorithms = &algorithms
+	}
+	return opts, nil
+}
+
+// newSshConnectivity returns an instance of sshConnectivity. An empty port results in the default SSH port being used.
+// If a password is given, password authentication is attempted after key authentication. If a bastion is given, the
+// connection to the VM is tunneled through it. If algorithms are given, only the ciphers, MACs and key exchange
+// algorithms they set are used. If dialRetry is nil, defaultDialRetry is used, which treats the first authentication
+// failure as fatal.
+func newSshConnectivity(username, ipAddress string, signer ssh.Signer, opts sshOptions,
+	logger logr.Logger) (connectivity, error) {
+	port, err := validateSSHPort(opts.port)
+	if err != nil {
+		return nil, err
+	}
+	var pinned ssh.Config
+	if opts.algorithms != nil {
+		if err := validateAlgorithms(opts.algorithms); err != nil {
+			return nil, err
+		}
+		pinned = ssh.Config{Ciphers: opts.algorithms.Ciphers, MACs: opts.algorithms.MACs,
+			KeyExchanges: opts.algorithms.KeyExchanges}
+	}
+	retryConfig := defaultDialRetry
+	if opts.dialRetry != nil {
+		if err := opts.dialRetry.validate(); err != nil {
+			return nil, err
+		}
+		retryConfig = *opts.dialRetry
+	}
 	c := &sshConnectivity{
-		username:  username,
-		ipAddress: ipAddress,
-		signer:    signer,
-		log:       logger,
+		username:   username,
+		ipAddress:  ipAddress,
+		port:       port,
+		signer:     signer,
+		password:   opts.password,
+		bastion:    opts.bastion,
+		algorithms: pinned,
+		dialRetry:  retryConfig,
+		log:        logger,
 	}
 	if err := c.init(); err != nil {
 		return nil, fmt.Errorf("error instantiating SSH client: %w", err)
@@ -73,69 +405,417 @@ func newSshConnectivity(username, ipAddress string, signer ssh.Signer, logger lo
 	return c, nil
 }
 
+// validateSSHPort returns the given port, or the default SSH port if empty. Returns an error if the port is not a
+// number within the valid port range.
+func validateSSHPort(port string) (string, error) {
+	if port == "" {
+		return sshPort, nil
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil || portNumber < 1 || portNumber > 65535 {
+		return "", fmt.Errorf("invalid SSH port '%s', must be a number between 1 and 65535", port)
+	}
+	return port, nil
+}
+
+// validateAlgorithms returns an error if the given config sets algorithms which are not supported by the SSH library,
+// or sets an empty list of algorithms, as no connection could be established with them
+func validateAlgorithms(algorithms *ssh.Config) error {
+	// SetDefaults drops the algorithms the library does not implement, which leaves the supported ones
+	supported := ssh.Config{Ciphers: algorithms.Ciphers, MACs: algorithms.MACs, KeyExchanges: algorithms.KeyExchanges}
+	supported.SetDefaults()
+	for _, kind := range []struct {
+		name      string
+		given     []string
+		supported []string
+	}{
+		{name: "cipher", given: algorithms.Ciphers, supported: supported.Ciphers},
+		{name: "MAC", given: algorithms.MACs, supported: supported.MACs},
+		{name: "key exchange", given: algorithms.KeyExchanges, supported: supported.KeyExchanges},
+	} {
+		if kind.given == nil {
+			continue
+		}
+		if len(kind.given) == 0 {
+			return fmt.Errorf("at least one SSH %s algorithm must be given", kind.name)
+		}
+		var unsupported []string
+		for _, name := range kind.given {
+			if !slices.Contains(kind.supported, name) {
+				unsupported = append(unsupported, name)
+			}
+		}
+		if len(unsupported) > 0 {
+			return fmt.Errorf("unsupported SSH %s algorithms %q", kind.name, unsupported)
+		}
+	}
+	return nil
+}
+
+// String returns a description of the connection which is safe to log, omitting the signer and password
+func (c *sshConnectivity) String() string {
+	description := fmt.Sprintf("username: %q, address: %q, port: %s, signer set: %t, password set: %t", c.username,
+		c.ipAddress, c.port, c.signer != nil, c.password != "")
+	if c.bastion != nil {
+		description += ", bastion: {" + c.bastion.String() + "}"
+	}
+	return description
+}
+
 // init initialises the key based SSH client
 func (c *sshConnectivity) init() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connect()
+}
+
+// connect creates the SSH client connected to the VM, retrying as configured by dialRetry. c.mu must be held.
+func (c *sshConnectivity) connect() error {
 	if c.username == "" || c.ipAddress == "" || c.signer == nil {
-		return fmt.Errorf("incomplete sshConnectivity information: %v", c)
+		return fmt.Errorf("incomplete sshConnectivity information: %s", c)
+	}
+	if c.bastion != nil && (c.bastion.Address == "" || c.bastion.Username == "" || c.bastion.Signer == nil) {
+		return fmt.Errorf("incomplete bastion information: %s", c.bastion)
 	}
 
+	authMethods := []ssh.AuthMethod{ssh.PublicKeys(c.signer)}
+	if c.password != "" {
+		// methods are attempted in order, so that the password is only sent if the key is rejected
+		authMethods = append(authMethods, ssh.Password(c.password))
+	}
 	config := &ssh.ClientConfig{
-		User: c.username,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(c.signer),
-		},
+		Config:          c.algorithms,
+		User:            c.username,
+		Auth:            authMethods,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
 	var err error
 	var sshClient *ssh.Client
+	// lastAuthErr is the last authentication failure tolerated, reported if no attempt succeeds
+	var lastAuthErr error
+	authFailures := 0
 	// Retry if we are unable to create a client as the VM could still be executing the steps in its user data
-	err = wait.PollImmediate(time.Minute, retry.Timeout, func() (bool, error) {
-		sshClient, err = ssh.Dial("tcp", c.ipAddress+":"+sshPort, config)
+	err = wait.PollImmediate(c.dialRetry.interval, c.dialRetry.timeout, func() (bool, error) {
+		sshClient, err = c.dial(hostport.Join(c.ipAddress, c.port), config)
 		if err == nil {
 			return true, nil
 		}
 		c.log.V(1).Info("SSH dial", "IP Address", c.ipAddress, "error", err)
-		if strings.Contains(err.Error(), "unable to authenticate") {
-			// Authentication failure is a special case that must be handled differently
-			return false, newAuthErr(err)
+		var authErr *AuthErr
+		if errors.As(err, &authErr) {
+			// Authentication failure is a special case that must be handled differently, it is only retried while
+			// the key may still be being authorized
+			authFailures++
+			if authFailures > c.dialRetry.authRetries {
+				return false, err
+			}
+			lastAuthErr = err
+			return false, nil
 		}
+		lastAuthErr = nil
 		return false, nil
 	})
 	if err != nil {
+		if wait.Interrupted(err) && lastAuthErr != nil {
+			err = fmt.Errorf("%w: %w", err, lastAuthErr)
+		}
 		return fmt.Errorf("unable to connect to Windows VM %s: %w", c.ipAddress, err)
 	}
 	c.sshClient = sshClient
 	return nil
 }
 
+// dial creates an SSH client connected to the given address, through the bastion host if one is configured. c.mu must
+// be held.
+func (c *sshConnectivity) dial(address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if c.bastion == nil {
+		return dial(address, config)
+	}
+	if c.bastionClient == nil {
+		bastionClient, err := dial(c.bastion.Address, &ssh.ClientConfig{
+			Config:          c.algorithms,
+			User:            c.bastion.Username,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(c.bastion.Signer)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to bastion %s: %w", c.bastion.Address, err)
+		}
+		c.bastionClient = bastionClient
+	}
+	sshClient, err := dialThrough(c.bastionClient, address, config)
+	if err != nil {
+		var authErr *AuthErr
+		if !errors.As(err, &authErr) {
+			// the bastion connection may have been lost, ensure it is re-established on the next attempt
+			if closeErr := c.closeBastion(); closeErr != nil {
+				c.log.V(1).Error(closeErr, "unable to close bastion connection")
+			}
+		}
+		return nil, fmt.Errorf("unable to connect to %s through bastion %s: %w", address, c.bastion.Address, err)
+	}
+	return sshClient, nil
+}
+
+// dial creates an SSH client connected to the given address, returning an AuthErr if the server rejected the
+// credentials in the given config
+func dial(address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	sshClient, err := ssh.Dial("tcp", address, config)
+	if err != nil {
+		return nil, classifyDialErr(err)
+	}
+	return sshClient, nil
+}
+
+// WaitForSSHReady waits for the SSH port of the VM at the given address to accept TCP connections, probing it until the
+// given timeout elapses or the context is cancelled. No SSH handshake is made, so that a VM whose network or sshd is
+// not up yet can be told apart from a VM rejecting the credentials it is dialed with. The address is either a host, in
+// which case the default SSH port is probed, or a host and port.
+func WaitForSSHReady(ctx context.Context, addr string, timeout time.Duration) error {
+	return waitForSSHReady(ctx, addr, sshReadyInterval, timeout)
+}
+
+// waitForSSHReady waits for the SSH port at the given address to accept TCP connections, probing it at the given
+// interval until the given timeout elapses
+func waitForSSHReady(ctx context.Context, addr string, interval, timeout time.Duration) error {
+	if addr == "" {
+		return fmt.Errorf("address cannot be empty")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = hostport.Join(addr, sshPort)
+	}
+	var lastErr error
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+		// the connection is only used to probe the port, sshd drops it once its handshake times out
+		conn.Close()
+		return true, nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			err = fmt.Errorf("%w: %w", err, lastErr)
+		}
+		return fmt.Errorf("SSH port %s not ready: %w", addr, err)
+	}
+	return nil
+}
+
+// dialThrough creates an SSH client connected to the given address, tunneled through the given SSH client. Returns an
+// AuthErr if the server rejected the credentials in the given config.
+func dialThrough(tunnel *ssh.Client, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := tunnel.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, classifyDialErr(err)
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// classifyDialErr returns an AuthErr if the given SSH dial error was caused by rejected credentials, otherwise the
+// error is returned unchanged
+func classifyDialErr(err error) error {
+	if isAuthFailure(err) {
+		return newAuthErr(err)
+	}
+	return err
+}
+
+// isAuthFailure returns true if the given SSH dial error was caused by the server rejecting all authentication methods.
+// ssh.ServerAuthError is only returned by the server side of a connection: the client reports rejected authentication
+// through an untyped error, so its message is matched instead.
+func isAuthFailure(err error) bool {
+	return strings.Contains(err.Error(), "unable to authenticate")
+}
+
+// close closes the SSH client connected to the VM, and then the connection to the bastion host if any
+func (c *sshConnectivity) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	if c.sshClient != nil {
+		if err := c.sshClient.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, fmt.Errorf("error closing SSH client: %w", err))
+		}
+		c.sshClient = nil
+	}
+	if err := c.closeBastion(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// closeBastion closes the connection to the bastion host, if any. c.mu must be held.
+func (c *sshConnectivity) closeBastion() error {
+	if c.bastionClient == nil {
+		return nil
+	}
+	err := c.bastionClient.Close()
+	c.bastionClient = nil
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("error closing bastion SSH client: %w", err)
+	}
+	return nil
+}
+
 // run instantiates a new SSH session and runs the command on the VM and returns the combined stdout and stderr output
 func (c *sshConnectivity) run(cmd string) (string, error) {
-	if c.sshClient == nil {
-		return "", fmt.Errorf("run cannot be called with nil SSH client")
+	session, err := c.newSession()
+	if err != nil {
+		return "", err
 	}
+	defer c.closeSession(session)
 
-	session, err := c.sshClient.NewSession()
+	out, err := session.CombinedOutput(cmd)
+	return string(out), err
+}
+
+// runSeparate instantiates a new SSH session and runs the command on the VM, returning the stdout and stderr output
+// separately
+func (c *sshConnectivity) runSeparate(cmd string) (string, string, error) {
+	session, err := c.newSession()
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	defer c.closeSession(session)
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	err = session.Run(cmd)
+	return stdout.String(), stderr.String(), err
+}
+
+func (c *sshConnectivity) ping() error {
+	return c.pingWithin(pingTimeout)
+}
+
+// pingWithin runs pingCommand on the VM, returning an error if it fails or does not complete within the given timeout.
+// A lost connection is reported rather than re-established, so that the ping left running once the timeout is reached
+// only uses the client it was given, and cannot change the connection used by the caller. That ping completes once the
+// caller closes the lost connection.
+func (c *sshConnectivity) pingWithin(timeout time.Duration) error {
+	client := c.client()
+	if client == nil {
+		return fmt.Errorf("ping cannot be called with nil SSH client")
 	}
-	defer func() {
-		// io.EOF is returned if you attempt to close a session that is already closed which typically happens given
-		// that Run(), which is called by CombinedOutput(), internally closes the session.
-		if err := session.Close(); err != nil && !errors.Is(err, io.EOF) {
-			c.log.Error(err, "error closing SSH session")
+	// buffered so that the goroutine does not leak if the timeout is reached first
+	done := make(chan error, 1)
+	go func() {
+		session, err := client.NewSession()
+		if err != nil {
+			done <- err
+			return
 		}
+		defer c.closeSession(session)
+		done <- session.Run(pingCommand)
 	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("error pinging %s: %w", c.ipAddress, err)
+		}
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("no response to ping from %s within %s", c.ipAddress, timeout)
+	}
+}
 
-	out, err := session.CombinedOutput(cmd)
-	return string(out), err
+// newSession returns a new session of the SSH client, re-establishing the connection if it has been lost. Caller
+// should close the session with closeSession.
+func (c *sshConnectivity) newSession() (*ssh.Session, error) {
+	client := c.client()
+	if client == nil {
+		return nil, fmt.Errorf("run cannot be called with nil SSH client")
+	}
+	session, err := client.NewSession()
+	if err != nil && connectionLost(client, err) {
+		if client, err = c.reconnect(client, err); err != nil {
+			return nil, err
+		}
+		session, err = client.NewSession()
+	}
+	return session, err
 }
 
-func (c *sshConnectivity) createSFTPClient() (*sftp.Client, error) {
+// client returns the SSH client currently connected to the VM, nil if the connection is closed
+func (c *sshConnectivity) client() *ssh.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sshClient
+}
+
+// connectionLost returns true if the connection of the given client has been closed, given the error returned when
+// opening a channel. The SSH library does not report a closed connection consistently when opening channels, so a
+// keepalive request is sent to tell apart a lost connection from a rejected channel.
+func connectionLost(client *ssh.Client, err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	_, _, requestErr := client.SendRequest("keepalive@openssh.com", true, nil)
+	return requestErr != nil
+}
+
+// reconnect re-establishes the connection to the VM after the given client lost it with the given error, up to
+// maxReconnects times, returning the client connected to the VM. The connection is not re-established again if a
+// concurrent operation already replaced the lost client. Connections are only re-established before a channel is
+// opened, so that no command is run twice. The lost client is kept if the connection cannot be re-established, so that
+// the next operation can attempt it again.
+func (c *sshConnectivity) reconnect(lostClient *ssh.Client, cause error) (*ssh.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.sshClient == nil {
+		return nil, fmt.Errorf("connection to %s closed: %w", c.ipAddress, cause)
+	}
+	if c.sshClient != lostClient {
+		return c.sshClient, nil
+	}
+	if c.reconnects >= maxReconnects {
+		return nil, fmt.Errorf("connection to %s lost after %d reconnections: %w", c.ipAddress, c.reconnects, cause)
+	}
+	c.reconnects++
+	c.log.Info("connection lost, reconnecting", "attempt", c.reconnects, "error", cause.Error())
+	if err := c.connect(); err != nil {
+		// authentication failures are only retried dialRetry.authRetries times, which is none by default, so that a
+		// rejected key is returned without waiting for the dial timeout
+		return nil, fmt.Errorf("error reconnecting after connection loss: %w", err)
+	}
+	if err := lostClient.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		c.log.V(1).Info("error closing lost SSH client", "error", err.Error())
+	}
+	return c.sshClient, nil
+}
+
+// closeSession closes the given SSH session
+func (c *sshConnectivity) closeSession(session *ssh.Session) {
+	// io.EOF is returned if you attempt to close a session that is already closed which typically happens given
+	// that Run(), which is called by CombinedOutput(), internally closes the session.
+	if err := session.Close(); err != nil && !errors.Is(err, io.EOF) {
+		c.log.Error(err, "error closing SSH session")
+	}
+}
+
+func (c *sshConnectivity) createSFTPClient() (*sftp.Client, error) {
+	client := c.client()
+	if client == nil {
 		return nil, fmt.Errorf("cannot be called with nil SSH client")
 	}
 
-	sftpClient, err := sftp.NewClient(c.sshClient)
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil && connectionLost(client, err) {
+		if client, err = c.reconnect(client, err); err != nil {
+			return nil, err
+		}
+		sftpClient, err = sftp.NewClient(client)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -143,34 +823,213 @@ func (c *sshConnectivity) createSFTPClient() (*sftp.Client, error) {
 }
 
 func (c *sshConnectivity) transfer(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string) error {
+	return c.transferWithProgress(sftpClient, reader, filename, remoteDir, nil)
+}
+
+func (c *sshConnectivity) transferWithProgress(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string,
+	progress func(bytesWritten, totalBytes int64)) error {
+	err := c.writeRemoteFile(sftpClient, reader, filename, remoteDir, progress)
+	if errors.Is(err, errRemoteClose) {
+		// files written in place are kept when they cannot be closed, unlike files written by transferAtomic
+		c.log.Error(err, "error closing remote file", "file", remoteDir+"\\"+filename)
+		return nil
+	}
+	return err
+}
+
+// writeRemoteFile creates the given file in the given remote directory with the content of the reader, calling the
+// given function, if not nil, after each write. Returns an error wrapping errRemoteClose if the whole content was written
+// but the file could not be closed.
+func (c *sshConnectivity) writeRemoteFile(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string,
+	progress func(bytesWritten, totalBytes int64)) error {
 	if sftpClient == nil {
 		return fmt.Errorf("transfer cannot be called with nil SFTP client")
 	}
 
 	// Create the destination directory, no-op if it already exists
 	if err := sftpClient.MkdirAll(remoteDir); err != nil {
-		return fmt.Errorf("error creating remote directory %s: %w", remoteDir, err)
+		return fmt.Errorf("%w %s: %w", ErrRemoteMkdir, remoteDir, err)
 	}
 
 	remoteFile := remoteDir + "\\" + filename
+	size := readerSize(reader)
 	dstFile, err := sftpClient.Create(remoteFile)
 	if err != nil {
-		return fmt.Errorf("error initializing %s file on Windows VM: %w", remoteFile, err)
+		if isDiskFull(err) {
+			return fmt.Errorf("%w: %w", ErrRemoteCreate, &RemoteDiskFullErr{path: remoteFile, size: size, err: err})
+		}
+		return fmt.Errorf("%w %s: %w", ErrRemoteCreate, remoteFile, err)
 	}
 
-	_, err = io.Copy(dstFile, reader)
+	// The remote file is only wrapped when progress is tracked, as wrapping it hides the concurrent writes done by
+	// its ReadFrom implementation
+	var dst io.Writer = dstFile
+	src := reader
+	if progress != nil {
+		dst = &progressWriter{w: dstFile, total: size, progress: progress}
+		// hide any WriteTo implementation of the reader, which could write everything at once
+		src = struct{ io.Reader }{reader}
+	}
+	_, err = io.Copy(dst, src)
 	if err != nil {
-		return fmt.Errorf("error copying %s to the Windows VM: %w", filename, err)
+		dstFile.Close()
+		if isDiskFull(err) {
+			return fmt.Errorf("%w: %w", ErrRemoteCopy, &RemoteDiskFullErr{path: remoteFile, size: size, err: err})
+		}
+		return fmt.Errorf("%w %s: %w", ErrRemoteCopy, remoteFile, err)
 	}
 
 	// Forcefully close the file so that we can execute it later in the case of binaries
 	if err := dstFile.Close(); err != nil {
-		//return fmt.Errorf("error closing remote file %s: %w", remoteFile, err)
-		c.log.Error(err, "error closing remote file", "file")
+		// data still buffered by the server is flushed on close, which fails if the disk is full
+		if isDiskFull(err) {
+			return fmt.Errorf("%w: %w", ErrRemoteCopy, &RemoteDiskFullErr{path: remoteFile, size: size, err: err})
+		}
+		return fmt.Errorf("%w %s: %w", errRemoteClose, remoteFile, err)
 	}
 	return nil
 }
 
+// remoteFileHashCmd returns the command printing the SHA256 hash of the given remote file, or nothing if the file does
+// not exist. The command is run through powershell.exe, so that it can be run regardless of the default shell of the
+// instance.
+func remoteFileHashCmd(remotePath string) string {
+	quoted := QuotePowerShellArg(remotePath)
+	return formatRemotePowerShellCommand(fmt.Sprintf(
+		"if (Test-Path -LiteralPath %s -PathType Leaf) { (Get-FileHash -LiteralPath %s -Algorithm SHA256).Hash }",
+		quoted, quoted))
+}
+
+// transferIfChanged behaves as transfer, skipping the copy if the remote file already has the content of the reader.
+// Returns true if the remote file was written. The reader is hashed before being copied, readers which cannot be
+// rewound are buffered in memory, so they should only be used for small files.
+func transferIfChanged(conn connectivity, sftpClient *sftp.Client, reader io.Reader, filename,
+	remoteDir string) (bool, error) {
+	var src io.ReadSeeker
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		src = seeker
+	} else {
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return false, fmt.Errorf("error reading %s content: %w", filename, err)
+		}
+		src = bytes.NewReader(content)
+	}
+	start, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, fmt.Errorf("error reading %s content: %w", filename, err)
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(hash, src); err != nil {
+		return false, fmt.Errorf("error hashing %s content: %w", filename, err)
+	}
+	if _, err = src.Seek(start, io.SeekStart); err != nil {
+		return false, fmt.Errorf("error rewinding %s content: %w", filename, err)
+	}
+
+	remotePath := remoteDir + "\\" + filename
+	out, err := conn.run(remoteFileHashCmd(remotePath))
+	if err != nil {
+		return false, fmt.Errorf("error getting hash of remote file %s, with output %s: %w", remotePath, out, err)
+	}
+	// Get-FileHash prints the hash in upper case, normalize it to match the encoding of the local hash
+	if strings.ToLower(strings.TrimSpace(out)) == hex.EncodeToString(hash.Sum(nil)) {
+		return false, nil
+	}
+	if err = conn.transfer(sftpClient, src, filename, remoteDir); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *sshConnectivity) transferAtomic(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string) error {
+	if sftpClient == nil {
+		return fmt.Errorf("transfer cannot be called with nil SFTP client")
+	}
+	// The temporary file is created in the destination directory, as a rename across volumes would be a copy
+	tempFilename := fmt.Sprintf(".%s.%s.tmp", filename, utilrand.String(5))
+	tempFile := remoteDir + "\\" + tempFilename
+	remoteFile := remoteDir + "\\" + filename
+	// close errors are returned, so that a temporary file which may not be fully flushed never replaces the destination
+	if err := c.writeRemoteFile(sftpClient, reader, tempFilename, remoteDir, nil); err != nil {
+		c.removeTempFile(sftpClient, tempFile)
+		return err
+	}
+	// PosixRename replaces any existing destination file, unlike Rename which fails if it exists
+	if err := sftpClient.PosixRename(tempFile, remoteFile); err != nil {
+		c.log.V(1).Info("falling back to Move-Item", "file", remoteFile, "error", err.Error())
+		// Move-Item -Force replaces the destination file on servers not supporting the posix-rename extension
+		out, moveErr := c.run(formatRemotePowerShellCommand(fmt.Sprintf("Move-Item -Force -LiteralPath %s "+
+			"-Destination %s", QuotePowerShellArg(tempFile), QuotePowerShellArg(remoteFile))))
+		if moveErr != nil {
+			c.removeTempFile(sftpClient, tempFile)
+			return fmt.Errorf("error replacing %s, with output %s: %w", remoteFile, out, moveErr)
+		}
+	}
+	return nil
+}
+
+// transferWithMode behaves as transfer, then sets the mode of the remote file to the given one. Win32-OpenSSH only
+// maps the owner write bit, clearing it setting the read-only attribute of the file, the other bits having no effect:
+// whether a file can be executed depends on its extension and ACLs. Failing to set the mode is logged and not
+// returned, as servers may not support it.
+func (c *sshConnectivity) transferWithMode(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string,
+	mode os.FileMode) error {
+	if err := c.transfer(sftpClient, reader, filename, remoteDir); err != nil {
+		return err
+	}
+	remoteFile := remoteDir + "\\" + filename
+	if err := sftpClient.Chmod(remoteFile, mode); err != nil {
+		c.log.V(1).Info("unable to set mode of remote file", "file", remoteFile, "mode", mode.String(),
+			"error", err.Error())
+	}
+	return nil
+}
+
+// removeTempFile removes the given temporary file left by a failed transfer, logging any error
+func (c *sshConnectivity) removeTempFile(sftpClient *sftp.Client, tempFile string) {
+	if err := sftpClient.Remove(tempFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.log.Error(err, "error removing temporary file", "file", tempFile)
+	}
+}
+
+// progressWriter is an io.Writer reporting the number of bytes written so far after each write
+type progressWriter struct {
+	// w is the writer being wrapped
+	w io.Writer
+	// written is the number of bytes written so far
+	written int64
+	// total is the number of bytes expected to be written, -1 if unknown
+	total int64
+	// progress is called after each write
+	progress func(bytesWritten, totalBytes int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.progress(p.written, p.total)
+	return n, err
+}
+
+// readerSize returns the number of bytes left to read from the given reader, or -1 if it cannot be determined
+func readerSize(reader io.Reader) int64 {
+	switch r := reader.(type) {
+	case interface{ Len() int }:
+		// bytes.Reader, bytes.Buffer and strings.Reader
+		return int64(r.Len())
+	case interface{ Stat() (os.FileInfo, error) }:
+		// os.File
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		return info.Size()
+	default:
+		return -1
+	}
+}
+
 func (c *sshConnectivity) transferFiles(sftpClient *sftp.Client, files map[string][]byte, remoteDir string) error {
 	for workingPath, content := range files {
 		reader := bytes.NewReader(content)
@@ -189,3 +1048,79 @@ func (c *sshConnectivity) transferFiles(sftpClient *sftp.Client, files map[strin
 	}
 	return nil
 }
+
+func (c *sshConnectivity) receive(remotePath string) ([]byte, error) {
+	sftpClient, err := c.createSFTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("error creating SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+	remoteFile, err := sftpClient.Open(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening remote file %s: %w", remotePath, err)
+	}
+	defer remoteFile.Close()
+	content, err := io.ReadAll(remoteFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading remote file %s: %w", remotePath, err)
+	}
+	return content, nil
+}
+
+func (c *sshConnectivity) remove(remotePath string) error {
+	sftpClient, err := c.createSFTPClient()
+	if err != nil {
+		return fmt.Errorf("error creating SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+	// Remove falls back to removing an empty directory if the path is not a file
+	if err := sftpClient.Remove(remotePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing %s: %w", remotePath, err)
+	}
+	return nil
+}
+
+func (c *sshConnectivity) removeAll(remoteDir string) error {
+	sftpClient, err := c.createSFTPClient()
+	if err != nil {
+		return fmt.Errorf("error creating SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+	return removeRecursively(sftpClient, remoteDir)
+}
+
+// removeRecursively removes the given remote path, walking into directories to remove their contents first. Paths
+// removed concurrently are ignored, so that a partially completed removal can be retried.
+func removeRecursively(sftpClient *sftp.Client, remotePath string) error {
+	// Lstat is used so that links are removed without following them
+	info, err := sftpClient.Lstat(remotePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("error getting information of %s: %w", remotePath, err)
+	}
+	if !info.IsDir() {
+		if err := sftpClient.Remove(remotePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing file %s: %w", remotePath, err)
+		}
+		return nil
+	}
+
+	entries, err := sftpClient.ReadDir(remotePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("error listing directory %s: %w", remotePath, err)
+	}
+	for _, entry := range entries {
+		if err := removeRecursively(sftpClient, sftpClient.Join(remotePath, entry.Name())); err != nil {
+			return err
+		}
+	}
+	if err := sftpClient.RemoveDirectory(remotePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing directory %s: %w", remotePath, err)
+	}
+	return nil
+}
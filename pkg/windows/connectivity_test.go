@@ -0,0 +1,1563 @@
+package windows
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// newSigner returns a signer backed by a newly generated key
+func newSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return signer
+}
+
+// startSSHServer starts an SSH server with the given config, returning its address. Channels opened by authenticated
+// clients are passed to the given handler.
+func startSSHServer(t *testing.T, config *ssh.ServerConfig, handleChannel func(ssh.NewChannel)) string {
+	return startSSHServerWithConnHook(t, config, handleChannel, nil)
+}
+
+// startSSHServerWithConnHook behaves as startSSHServer, passing every accepted connection to the given hook, if not nil,
+// before the SSH handshake
+func startSSHServerWithConnHook(t *testing.T, config *ssh.ServerConfig, handleChannel func(ssh.NewChannel),
+	onConn func(net.Conn)) string {
+	config.AddHostKey(newSigner(t))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if onConn != nil {
+				onConn(conn)
+			}
+			go func() {
+				defer conn.Close()
+				serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				defer serverConn.Close()
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					go handleChannel(newChannel)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// startRejectingSSHServer starts an SSH server which rejects every authentication attempt, returning its address
+func startRejectingSSHServer(t *testing.T) string {
+	return startSSHServer(t, &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, fmt.Errorf("key rejected")
+		},
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, fmt.Errorf("password rejected")
+		},
+	}, nil)
+}
+
+// authorizedKeyConfig returns an SSH server config only accepting the given key
+func authorizedKeyConfig(authorized ssh.PublicKey) *ssh.ServerConfig {
+	return &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("key rejected")
+		},
+	}
+}
+
+// startEchoSSHServer starts an SSH server accepting the given key, which replies to each command with the command
+// itself, returning its address. Commands starting with Write-Warning also write a warning to stderr.
+func startEchoSSHServer(t *testing.T, authorized ssh.PublicKey) string {
+	return startEchoSSHServerWithConfig(t, authorizedKeyConfig(authorized))
+}
+
+// startEchoSSHServerWithConfig starts an SSH server with the given config, behaving as described by
+// startEchoSSHServer, returning its address
+func startEchoSSHServerWithConfig(t *testing.T, config *ssh.ServerConfig) string {
+	return startSSHServer(t, config, echoChannel)
+}
+
+// startDroppingEchoSSHServer starts an SSH server behaving as described by startEchoSSHServer, returning its address
+// and a function which drops all the connections accepted so far, as a network failure or sshd restart would
+func startDroppingEchoSSHServer(t *testing.T, authorized ssh.PublicKey) (string, func()) {
+	conns := &droppableConns{}
+	return startSSHServerWithConnHook(t, authorizedKeyConfig(authorized), echoChannel, conns.track), conns.drop
+}
+
+// droppableConns tracks the connections accepted by a server, so that they can be dropped
+type droppableConns struct {
+	mu    sync.Mutex
+	conns []net.Conn
+	// accepted is the number of connections accepted, including dropped ones
+	accepted int
+}
+
+// track records the given accepted connection
+func (d *droppableConns) track(conn net.Conn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conns = append(d.conns, conn)
+	d.accepted++
+}
+
+// drop closes all the connections accepted so far
+func (d *droppableConns) drop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, conn := range d.conns {
+		conn.Close()
+	}
+	d.conns = nil
+}
+
+// count returns the number of connections accepted
+func (d *droppableConns) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.accepted
+}
+
+// echoChannel serves the given channel as described by startEchoSSHServer
+func echoChannel(newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() != "session" {
+		newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+		channel.Write([]byte(payload.Command))
+		if strings.HasPrefix(payload.Command, "Write-Warning") {
+			channel.Stderr().Write([]byte("WARNING"))
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+		return
+	}
+}
+
+// startSFTPServer starts an SSH server accepting the given key, which serves the local filesystem over the SFTP
+// subsystem, returning its address
+func startSFTPServer(t *testing.T, authorized ssh.PublicKey) string {
+	return startSFTPServerWithServe(t, authorized, func(channel ssh.Channel) {
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			return
+		}
+		server.Serve()
+	})
+}
+
+// startSFTPServerWithServe starts an SSH server accepting the given key, which calls serve with the channel of every
+// session requesting the SFTP subsystem, returning its address
+func startSFTPServerWithServe(t *testing.T, authorized ssh.PublicKey, serve func(ssh.Channel)) string {
+	return startSSHServer(t, authorizedKeyConfig(authorized), sftpChannel(serve))
+}
+
+// sftpChannel returns a channel handler calling serve with the channel of every session requesting the SFTP subsystem
+func sftpChannel(serve func(ssh.Channel)) func(ssh.NewChannel) {
+	return func(newChannel ssh.NewChannel) {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			return
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		defer channel.Close()
+		for req := range requests {
+			var payload struct{ Name string }
+			if req.Type != "subsystem" || ssh.Unmarshal(req.Payload, &payload) != nil || payload.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			serve(channel)
+			return
+		}
+	}
+}
+
+// startBastionSSHServer starts an SSH server accepting the given key, which forwards TCP connections requested by
+// clients, returning its address
+func startBastionSSHServer(t *testing.T, authorized ssh.PublicKey) string {
+	return startSSHServer(t, authorizedKeyConfig(authorized), func(newChannel ssh.NewChannel) {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "only forwarding is supported")
+			return
+		}
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			return
+		}
+		conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			return
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			conn.Close()
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			io.Copy(conn, channel)
+			conn.Close()
+		}()
+		io.Copy(channel, conn)
+		channel.Close()
+	})
+}
+
+func TestDial(t *testing.T) {
+	config := &ssh.ClientConfig{
+		User:            "Administrator",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(newSigner(t))},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	t.Run("authentication rejected", func(t *testing.T) {
+		_, err := dial(startRejectingSSHServer(t), config)
+		require.Error(t, err)
+		assert.True(t, errors.As(err, new(*AuthErr)))
+	})
+	t.Run("no server listening", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		address := listener.Addr().String()
+		require.NoError(t, listener.Close())
+
+		_, err = dial(address, config)
+		require.Error(t, err)
+		assert.False(t, errors.As(err, new(*AuthErr)))
+	})
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name: "untyped client error",
+			err: fmt.Errorf("ssh: handshake failed: %w", errors.New("ssh: unable to authenticate, attempted "+
+				"methods [none publickey], no supported methods remain")),
+			expected: true,
+		},
+		{
+			name:     "network error",
+			err:      &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			expected: false,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isAuthFailure(test.err))
+		})
+	}
+}
+
+func TestValidateSSHPort(t *testing.T) {
+	testCases := []struct {
+		port        string
+		expected    string
+		expectedErr bool
+	}{
+		{port: "", expected: sshPort},
+		{port: "22", expected: "22"},
+		{port: "2222", expected: "2222"},
+		{port: "65535", expected: "65535"},
+		{port: "0", expectedErr: true},
+		{port: "65536", expectedErr: true},
+		{port: "-1", expectedErr: true},
+		{port: "ssh", expectedErr: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.port, func(t *testing.T) {
+			port, err := validateSSHPort(test.port)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, port)
+		})
+	}
+}
+
+func TestBastion(t *testing.T) {
+	bastionSigner := newSigner(t)
+	vmSigner := newSigner(t)
+	bastionAddress := startBastionSSHServer(t, bastionSigner.PublicKey())
+	host, port, err := net.SplitHostPort(startEchoSSHServer(t, vmSigner.PublicKey()))
+	require.NoError(t, err)
+
+	t.Run("command run through the bastion", func(t *testing.T) {
+		c, err := newSshConnectivity("Administrator", host, vmSigner, sshOptions{port: port,
+			bastion: &BastionConfig{Address: bastionAddress, Username: "core", Signer: bastionSigner}}, logr.Discard())
+		require.NoError(t, err)
+		out, err := c.run("hostname")
+		require.NoError(t, err)
+		assert.Equal(t, "hostname", out)
+
+		require.NoError(t, c.close())
+		_, err = c.run("hostname")
+		assert.Error(t, err, "connection should be closed")
+	})
+	t.Run("bastion rejects authentication", func(t *testing.T) {
+		_, err := newSshConnectivity("Administrator", host, vmSigner, sshOptions{port: port,
+			bastion: &BastionConfig{Address: bastionAddress, Username: "core", Signer: vmSigner}}, logr.Discard())
+		require.Error(t, err)
+		assert.True(t, errors.As(err, new(*AuthErr)))
+	})
+	t.Run("VM rejects authentication", func(t *testing.T) {
+		_, err := newSshConnectivity("Administrator", host, bastionSigner, sshOptions{port: port,
+			bastion: &BastionConfig{Address: bastionAddress, Username: "core", Signer: bastionSigner}}, logr.Discard())
+		require.Error(t, err)
+		assert.True(t, errors.As(err, new(*AuthErr)))
+	})
+}
+
+func TestRunSeparate(t *testing.T) {
+	signer := newSigner(t)
+	host, port, err := net.SplitHostPort(startEchoSSHServer(t, signer.PublicKey()))
+	require.NoError(t, err)
+	c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+	require.NoError(t, err)
+	defer c.close()
+
+	stdout, stderr, err := c.runSeparate("Write-Warning test")
+	require.NoError(t, err)
+	assert.Equal(t, "Write-Warning test", stdout)
+	assert.Equal(t, "WARNING", stderr)
+
+	combined, err := c.run("Write-Warning test")
+	require.NoError(t, err)
+	assert.Contains(t, combined, "Write-Warning test")
+	assert.Contains(t, combined, "WARNING")
+}
+
+func TestPasswordFallback(t *testing.T) {
+	signer := newSigner(t)
+	// the server only accepts password authentication
+	host, port, err := net.SplitHostPort(startEchoSSHServerWithConfig(t, &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == "correct-password" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected")
+		},
+	}))
+	require.NoError(t, err)
+
+	t.Run("key rejected and password accepted", func(t *testing.T) {
+		c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port, password: "correct-password"},
+			logr.Discard())
+		require.NoError(t, err)
+		defer c.close()
+		out, err := c.run("hostname")
+		require.NoError(t, err)
+		assert.Equal(t, "hostname", out)
+	})
+	t.Run("key and password rejected", func(t *testing.T) {
+		_, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port, password: "wrong-password"},
+			logr.Discard())
+		require.Error(t, err)
+		assert.True(t, errors.As(err, new(*AuthErr)))
+		assert.NotContains(t, err.Error(), "wrong-password")
+	})
+	t.Run("no password", func(t *testing.T) {
+		_, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+		require.Error(t, err)
+		assert.True(t, errors.As(err, new(*AuthErr)))
+	})
+}
+
+func TestRemove(t *testing.T) {
+	signer := newSigner(t)
+	host, port, err := net.SplitHostPort(startSFTPServer(t, signer.PublicKey()))
+	require.NoError(t, err)
+	c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+	require.NoError(t, err)
+	defer c.close()
+
+	root := t.TempDir()
+	nested := filepath.Join(root, "dir", "nested", "deeper")
+	require.NoError(t, os.MkdirAll(nested, 0o755))
+	for _, file := range []string{filepath.Join(root, "file"), filepath.Join(root, "dir", "a"),
+		filepath.Join(nested, "b")} {
+		require.NoError(t, os.WriteFile(file, []byte("content"), 0o644))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "empty"), 0o755))
+
+	t.Run("file", func(t *testing.T) {
+		require.NoError(t, c.remove(filepath.Join(root, "file")))
+		assert.NoFileExists(t, filepath.Join(root, "file"))
+		// removing an absent file must succeed so that deconfiguration can be retried
+		assert.NoError(t, c.remove(filepath.Join(root, "file")))
+	})
+	t.Run("empty directory", func(t *testing.T) {
+		require.NoError(t, c.remove(filepath.Join(root, "empty")))
+		assert.NoDirExists(t, filepath.Join(root, "empty"))
+	})
+	t.Run("non-empty directory", func(t *testing.T) {
+		assert.Error(t, c.remove(filepath.Join(root, "dir")))
+		assert.DirExists(t, filepath.Join(root, "dir"))
+	})
+	t.Run("nested directories", func(t *testing.T) {
+		require.NoError(t, c.removeAll(filepath.Join(root, "dir")))
+		assert.NoDirExists(t, filepath.Join(root, "dir"))
+		assert.DirExists(t, root)
+		assert.NoError(t, c.removeAll(filepath.Join(root, "dir")))
+	})
+	t.Run("absent path", func(t *testing.T) {
+		assert.NoError(t, c.removeAll(filepath.Join(root, "missing", "child")))
+	})
+}
+
+func TestReceive(t *testing.T) {
+	signer := newSigner(t)
+	host, port, err := net.SplitHostPort(startSFTPServer(t, signer.PublicKey()))
+	require.NoError(t, err)
+	c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+	require.NoError(t, err)
+	defer c.close()
+
+	root := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file"), content, 0o644))
+
+	received, err := c.receive(filepath.Join(root, "file"))
+	require.NoError(t, err)
+	assert.Equal(t, content, received)
+
+	_, err = c.receive(filepath.Join(root, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestValidateAlgorithms(t *testing.T) {
+	testCases := []struct {
+		name        string
+		algorithms  *ssh.Config
+		expectedErr bool
+	}{
+		{
+			name:       "library defaults",
+			algorithms: &ssh.Config{},
+		},
+		{
+			name: "supported algorithms",
+			algorithms: &ssh.Config{Ciphers: []string{"aes256-gcm@openssh.com", "aes256-ctr"},
+				MACs: []string{"hmac-sha2-512"}, KeyExchanges: []string{"ecdh-sha2-nistp384"}},
+		},
+		{
+			name:        "misspelled cipher",
+			algorithms:  &ssh.Config{Ciphers: []string{"aes256-ctr", "aes265-ctr"}},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown MAC",
+			algorithms:  &ssh.Config{MACs: []string{"hmac-md5"}},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown key exchange",
+			algorithms:  &ssh.Config{KeyExchanges: []string{"sntrup761x25519-sha512@openssh.com"}},
+			expectedErr: true,
+		},
+		{
+			name:        "empty list",
+			algorithms:  &ssh.Config{Ciphers: []string{}},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateAlgorithms(test.algorithms)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPinnedAlgorithms(t *testing.T) {
+	signer := newSigner(t)
+	// algorithms supported by the library but not offered by default, so that only a pinned client can connect
+	pinned := ssh.Config{Ciphers: []string{"aes128-cbc"}, KeyExchanges: []string{"diffie-hellman-group16-sha512"}}
+	serverConfig := authorizedKeyConfig(signer.PublicKey())
+	serverConfig.Config = pinned
+	address := startSSHServer(t, serverConfig, func(newChannel ssh.NewChannel) {
+		newChannel.Reject(ssh.Prohibited, "no channels are supported")
+	})
+	host, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+
+	_, err = dial(address, &ssh.ClientConfig{User: "Administrator", Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	require.Error(t, err, "the server should not accept the default algorithms")
+
+	c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port, algorithms: &pinned},
+		logr.Discard())
+	require.NoError(t, err)
+	assert.NoError(t, c.close())
+
+	_, err = newSshConnectivity("Administrator", host, signer,
+		sshOptions{port: port, algorithms: &ssh.Config{Ciphers: []string{"aes128-cbcc"}}}, logr.Discard())
+	assert.ErrorContains(t, err, "aes128-cbcc")
+}
+
+func TestDialRetryTimeout(t *testing.T) {
+	// a server which drops every connection before the SSH handshake, as sshd does while the VM is still booting
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	var attempts int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&attempts, 1)
+			conn.Close()
+		}
+	}()
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = newSshConnectivity("Administrator", host, newSigner(t), sshOptions{port: port,
+		dialRetry: &dialRetry{interval: 50 * time.Millisecond, timeout: 300 * time.Millisecond}}, logr.Discard())
+	elapsed := time.Since(start)
+	require.Error(t, err)
+	assert.GreaterOrEqual(t, elapsed, 300*time.Millisecond)
+	assert.Less(t, elapsed, 5*time.Second, "the dial should give up after the configured timeout")
+	assert.Greater(t, atomic.LoadInt32(&attempts), int32(1), "the dial should be retried at the configured interval")
+}
+
+func TestDialAuthRetries(t *testing.T) {
+	signer := newSigner(t)
+	// startServer returns the address of a server rejecting the key of the signer for the first given number of
+	// connections, as is the case while the user data of the VM has not authorized it yet, and the number of
+	// connections rejected so far
+	startServer := func(rejected int32) (string, string, *int32) {
+		var connections int32
+		config := &ssh.ServerConfig{
+			PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+				if atomic.AddInt32(&connections, 1) <= rejected {
+					return nil, fmt.Errorf("key not authorized yet")
+				}
+				if !bytes.Equal(key.Marshal(), signer.PublicKey().Marshal()) {
+					return nil, fmt.Errorf("unknown key")
+				}
+				return nil, nil
+			},
+		}
+		host, port, err := net.SplitHostPort(startEchoSSHServerWithConfig(t, config))
+		require.NoError(t, err)
+		return host, port, &connections
+	}
+	testCases := []struct {
+		name        string
+		authRetries int
+		rejected    int32
+		expectedErr bool
+		// expectedAttempts is the number of connections made
+		expectedAttempts int32
+	}{
+		{
+			name:             "first failure fatal",
+			rejected:         1,
+			expectedErr:      true,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "failures tolerated until the key is authorized",
+			authRetries:      3,
+			rejected:         3,
+			expectedAttempts: 4,
+		},
+		{
+			name:             "more failures than tolerated",
+			authRetries:      2,
+			rejected:         5,
+			expectedErr:      true,
+			expectedAttempts: 3,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			host, port, connections := startServer(test.rejected)
+			c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port,
+				dialRetry: &dialRetry{interval: 10 * time.Millisecond, timeout: 5 * time.Second,
+					authRetries: test.authRetries}}, logr.Discard())
+			assert.Equal(t, test.expectedAttempts, atomic.LoadInt32(connections))
+			if test.expectedErr {
+				var authErr *AuthErr
+				assert.ErrorAs(t, err, &authErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, c.close())
+		})
+	}
+	t.Run("timeout while failures are tolerated", func(t *testing.T) {
+		host, port, _ := startServer(1000)
+		_, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port,
+			dialRetry: &dialRetry{interval: 10 * time.Millisecond, timeout: 100 * time.Millisecond, authRetries: 1000}},
+			logr.Discard())
+		// the authentication failure is reported rather than a bare timeout
+		var authErr *AuthErr
+		assert.ErrorAs(t, err, &authErr)
+	})
+}
+
+func TestWaitForSSHReady(t *testing.T) {
+	t.Run("listener started after a delay", func(t *testing.T) {
+		// reserve a port, then free it until the listener starts, as sshd does once the VM has booted
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := listener.Addr().String()
+		require.NoError(t, listener.Close())
+		delay := 200 * time.Millisecond
+		started := make(chan error, 1)
+		go func() {
+			time.Sleep(delay)
+			listener, err := net.Listen("tcp", addr)
+			if err == nil {
+				t.Cleanup(func() { listener.Close() })
+			}
+			started <- err
+		}()
+
+		start := time.Now()
+		err = waitForSSHReady(context.Background(), addr, 20*time.Millisecond, 5*time.Second)
+		require.NoError(t, <-started)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), delay)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := listener.Addr().String()
+		require.NoError(t, listener.Close())
+
+		err = waitForSSHReady(context.Background(), addr, 20*time.Millisecond, 100*time.Millisecond)
+		assert.ErrorContains(t, err, "SSH port "+addr+" not ready")
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Error(t, WaitForSSHReady(ctx, "127.0.0.1:1", time.Minute))
+	})
+	t.Run("empty address", func(t *testing.T) {
+		assert.Error(t, WaitForSSHReady(context.Background(), "", time.Minute))
+	})
+}
+
+func TestDialRetryValidation(t *testing.T) {
+	testCases := []struct {
+		name        string
+		dialRetry   dialRetry
+		expectedErr bool
+	}{
+		{
+			name:      "default",
+			dialRetry: defaultDialRetry,
+		},
+		{
+			name:      "interval equal to timeout",
+			dialRetry: dialRetry{interval: time.Second, timeout: time.Second},
+		},
+		{
+			name:        "interval exceeding timeout",
+			dialRetry:   dialRetry{interval: time.Minute, timeout: time.Second},
+			expectedErr: true,
+		},
+		{
+			name:        "zero interval",
+			dialRetry:   dialRetry{timeout: time.Second},
+			expectedErr: true,
+		},
+		{
+			name:        "negative timeout",
+			dialRetry:   dialRetry{interval: time.Second, timeout: -time.Second},
+			expectedErr: true,
+		},
+		{
+			name:      "authentication retries",
+			dialRetry: dialRetry{interval: time.Second, timeout: time.Second, authRetries: 3},
+		},
+		{
+			name:        "negative authentication retries",
+			dialRetry:   dialRetry{interval: time.Second, timeout: time.Second, authRetries: -1},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.dialRetry.validate()
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDialRetryFromEnv(t *testing.T) {
+	testCases := []struct {
+		name        string
+		env         map[string]string
+		expected    *dialRetry
+		expectedErr bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:     "interval only",
+			env:      map[string]string{sshDialIntervalEnvVar: "5s"},
+			expected: &dialRetry{interval: 5 * time.Second, timeout: defaultDialRetry.timeout},
+		},
+		{
+			name:     "interval and timeout",
+			env:      map[string]string{sshDialIntervalEnvVar: "1s", sshDialTimeoutEnvVar: "30s"},
+			expected: &dialRetry{interval: time.Second, timeout: 30 * time.Second},
+		},
+		{
+			name:        "timeout shorter than the default interval",
+			env:         map[string]string{sshDialTimeoutEnvVar: "30s"},
+			expectedErr: true,
+		},
+		{
+			name:        "not a duration",
+			env:         map[string]string{sshDialIntervalEnvVar: "10"},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			d, err := dialRetryFromEnv()
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, d)
+		})
+	}
+}
+
+func TestSSHOptionsFromEnv(t *testing.T) {
+	signer := newSigner(t)
+	testCases := []struct {
+		name        string
+		env         map[string]string
+		expected    sshOptions
+		expectedErr bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:     "password",
+			env:      map[string]string{sshPasswordEnvVar: "secret"},
+			expected: sshOptions{password: "secret"},
+		},
+		{
+			name: "bastion",
+			env:  map[string]string{sshBastionAddressEnvVar: "bastion.example.com:22", sshBastionUsernameEnvVar: "core"},
+			expected: sshOptions{
+				bastion: &BastionConfig{Address: "bastion.example.com:22", Username: "core", Signer: signer}},
+		},
+		{
+			name:        "bastion without username",
+			env:         map[string]string{sshBastionAddressEnvVar: "bastion.example.com:22"},
+			expectedErr: true,
+		},
+		{
+			name: "algorithms",
+			env: map[string]string{sshCiphersEnvVar: "aes256-ctr, aes128-ctr",
+				sshKeyExchangesEnvVar: "curve25519-sha256"},
+			expected: sshOptions{algorithms: &ssh.Config{Ciphers: []string{"aes256-ctr", "aes128-ctr"},
+				KeyExchanges: []string{"curve25519-sha256"}}},
+		},
+		{
+			name:        "unsupported algorithm",
+			env:         map[string]string{sshMACsEnvVar: "hmac-md5-96"},
+			expectedErr: true,
+		},
+		{
+			name:        "empty algorithm list",
+			env:         map[string]string{sshCiphersEnvVar: ""},
+			expectedErr: true,
+		},
+		{
+			name:     "dial retry",
+			env:      map[string]string{sshDialIntervalEnvVar: "5s"},
+			expected: sshOptions{dialRetry: &dialRetry{interval: 5 * time.Second, timeout: defaultDialRetry.timeout}},
+		},
+		{
+			name:        "invalid dial retry",
+			env:         map[string]string{sshDialIntervalEnvVar: "10"},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			opts, err := sshOptionsFromEnv(signer)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, opts)
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	signer := newSigner(t)
+	t.Run("connection lost mid-session", func(t *testing.T) {
+		address, drop := startDroppingEchoSSHServer(t, signer.PublicKey())
+		host, port, err := net.SplitHostPort(address)
+		require.NoError(t, err)
+		c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+		require.NoError(t, err)
+		defer c.close()
+
+		require.NoError(t, c.ping())
+		// the lost connection is detected rather than re-established, which is left to the caller
+		drop()
+		assert.Error(t, c.ping())
+		assert.Zero(t, c.(*sshConnectivity).reconnects)
+		// the connection is usable again once re-established
+		require.NoError(t, c.init())
+		assert.NoError(t, c.ping())
+	})
+	t.Run("unresponsive server", func(t *testing.T) {
+		// sessions are accepted, but commands are never answered
+		address := startSSHServer(t, authorizedKeyConfig(signer.PublicKey()), func(newChannel ssh.NewChannel) {
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				return
+			}
+			defer channel.Close()
+			for range requests {
+			}
+		})
+		host, port, err := net.SplitHostPort(address)
+		require.NoError(t, err)
+		conn, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+		require.NoError(t, err)
+		defer conn.close()
+
+		start := time.Now()
+		err = conn.(*sshConnectivity).pingWithin(100 * time.Millisecond)
+		assert.ErrorContains(t, err, "no response")
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+	t.Run("closed client", func(t *testing.T) {
+		assert.Error(t, (&sshConnectivity{}).ping())
+	})
+}
+
+func TestReconnect(t *testing.T) {
+	signer := newSigner(t)
+	fastRetry := &dialRetry{interval: 10 * time.Millisecond, timeout: 100 * time.Millisecond}
+	t.Run("run after connection loss", func(t *testing.T) {
+		conns := &droppableConns{}
+		address := startSSHServerWithConnHook(t, authorizedKeyConfig(signer.PublicKey()), echoChannel, conns.track)
+		host, port, err := net.SplitHostPort(address)
+		require.NoError(t, err)
+		c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port, dialRetry: fastRetry},
+			logr.Discard())
+		require.NoError(t, err)
+		defer c.close()
+
+		for i := 0; i < maxReconnects; i++ {
+			conns.drop()
+			out, err := c.run("Get-Service")
+			require.NoError(t, err, "reconnection %d", i+1)
+			assert.Equal(t, "Get-Service", out)
+		}
+		assert.Equal(t, maxReconnects+1, conns.count())
+
+		// reconnections are bounded
+		conns.drop()
+		_, err = c.run("Get-Service")
+		assert.ErrorContains(t, err, "reconnections")
+		assert.Equal(t, maxReconnects+1, conns.count())
+	})
+	t.Run("concurrent runs after connection loss", func(t *testing.T) {
+		conns := &droppableConns{}
+		address := startSSHServerWithConnHook(t, authorizedKeyConfig(signer.PublicKey()), echoChannel, conns.track)
+		host, port, err := net.SplitHostPort(address)
+		require.NoError(t, err)
+		c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port, dialRetry: fastRetry},
+			logr.Discard())
+		require.NoError(t, err)
+		defer c.close()
+
+		conns.drop()
+		var wg sync.WaitGroup
+		errs := make([]error, 5)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = c.run("Get-Service")
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+		// the operations finding the connection lost share a single reconnection
+		assert.Equal(t, 2, conns.count())
+	})
+	t.Run("transfer after connection loss", func(t *testing.T) {
+		conns := &droppableConns{}
+		address := startSSHServerWithConnHook(t, authorizedKeyConfig(signer.PublicKey()),
+			sftpChannel(func(channel ssh.Channel) {
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					return
+				}
+				server.Serve()
+			}), conns.track)
+		host, port, err := net.SplitHostPort(address)
+		require.NoError(t, err)
+		c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port, dialRetry: fastRetry},
+			logr.Discard())
+		require.NoError(t, err)
+		defer c.close()
+
+		conns.drop()
+		sftpClient, err := c.createSFTPClient()
+		require.NoError(t, err)
+		defer sftpClient.Close()
+		remoteDir := t.TempDir()
+		require.NoError(t, c.transfer(sftpClient, strings.NewReader("content"), "file", remoteDir))
+		// the remote path is joined with a Windows separator, which is part of the file name on Linux
+		content, err := os.ReadFile(remoteDir + "\\file")
+		require.NoError(t, err)
+		assert.Equal(t, "content", string(content))
+		assert.Equal(t, 2, conns.count())
+	})
+	t.Run("authentication failure on reconnection", func(t *testing.T) {
+		// the key is only accepted for the first connection, as if it was removed from the VM in between
+		var authenticated int32
+		config := &ssh.ServerConfig{
+			PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+				if atomic.CompareAndSwapInt32(&authenticated, 0, 1) {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("key rejected")
+			},
+		}
+		conns := &droppableConns{}
+		address := startSSHServerWithConnHook(t, config, echoChannel, conns.track)
+		host, port, err := net.SplitHostPort(address)
+		require.NoError(t, err)
+		c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port, dialRetry: fastRetry},
+			logr.Discard())
+		require.NoError(t, err)
+		defer c.close()
+
+		conns.drop()
+		_, err = c.run("Get-Service")
+		var authErr *AuthErr
+		assert.ErrorAs(t, err, &authErr)
+		// the authentication failure is not retried
+		assert.Equal(t, 2, conns.count())
+	})
+}
+
+// unsizedReader hides the size of the wrapped reader
+type unsizedReader struct {
+	io.Reader
+}
+
+func TestTransferWithProgress(t *testing.T) {
+	signer := newSigner(t)
+	host, port, err := net.SplitHostPort(startSFTPServer(t, signer.PublicKey()))
+	require.NoError(t, err)
+	c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+	require.NoError(t, err)
+	defer c.close()
+	sftpClient, err := c.createSFTPClient()
+	require.NoError(t, err)
+	defer sftpClient.Close()
+
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	testCases := []struct {
+		name          string
+		reader        io.Reader
+		expectedTotal int64
+	}{
+		{
+			name:          "known size",
+			reader:        bytes.NewReader(content),
+			expectedTotal: int64(len(content)),
+		},
+		{
+			name:          "unknown size",
+			reader:        unsizedReader{bytes.NewReader(content)},
+			expectedTotal: -1,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			remoteDir := t.TempDir()
+			var calls int
+			var lastWritten int64
+			err := c.transferWithProgress(sftpClient, test.reader, "file", remoteDir,
+				func(bytesWritten, totalBytes int64) {
+					calls++
+					assert.GreaterOrEqual(t, bytesWritten, lastWritten)
+					assert.Equal(t, test.expectedTotal, totalBytes)
+					lastWritten = bytesWritten
+				})
+			require.NoError(t, err)
+			assert.Greater(t, calls, 1)
+			assert.Equal(t, int64(len(content)), lastWritten)
+			written, err := os.ReadFile(remoteDir + "\\file")
+			require.NoError(t, err)
+			assert.Equal(t, content, written)
+		})
+	}
+
+	t.Run("no callback", func(t *testing.T) {
+		remoteDir := t.TempDir()
+		require.NoError(t, c.transfer(sftpClient, bytes.NewReader(content), "file", remoteDir))
+		written, err := os.ReadFile(remoteDir + "\\file")
+		require.NoError(t, err)
+		assert.Equal(t, content, written)
+	})
+}
+
+// diskFullMessage is the message of the error returned by Windows when its disk is full
+const diskFullMessage = "There is not enough space on the disk."
+
+// diskFullWriter is an sftp.FileWriter simulating a full disk, either when creating files or when writing to them
+type diskFullWriter struct {
+	failCreate bool
+}
+
+func (d diskFullWriter) Filewrite(*sftp.Request) (io.WriterAt, error) {
+	if d.failCreate {
+		return nil, errors.New(diskFullMessage)
+	}
+	return d, nil
+}
+
+func (d diskFullWriter) WriteAt([]byte, int64) (int, error) {
+	return 0, errors.New(diskFullMessage)
+}
+
+func TestTransferDiskFull(t *testing.T) {
+	content := bytes.Repeat([]byte("0"), 1000)
+	for _, failCreate := range []bool{true, false} {
+		t.Run(fmt.Sprintf("failing create %t", failCreate), func(t *testing.T) {
+			signer := newSigner(t)
+			host, port, err := net.SplitHostPort(startSFTPServerWithServe(t, signer.PublicKey(), func(channel ssh.Channel) {
+				handlers := sftp.InMemHandler()
+				handlers.FilePut = diskFullWriter{failCreate: failCreate}
+				sftp.NewRequestServer(channel, handlers).Serve()
+			}))
+			require.NoError(t, err)
+			c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+			require.NoError(t, err)
+			defer c.close()
+			sftpClient, err := c.createSFTPClient()
+			require.NoError(t, err)
+			defer sftpClient.Close()
+
+			err = c.transfer(sftpClient, bytes.NewReader(content), "file", "/dir")
+			require.Error(t, err)
+			var diskFullErr *RemoteDiskFullErr
+			require.ErrorAs(t, err, &diskFullErr)
+			assert.Equal(t, "/dir\\file", diskFullErr.path)
+			assert.Equal(t, int64(len(content)), diskFullErr.size)
+			assert.Contains(t, err.Error(), diskFullMessage)
+		})
+	}
+}
+
+// failingCmder is an sftp.FileCmder failing the commands of the given method, delegating the others
+type failingCmder struct {
+	sftp.FileCmder
+	method string
+}
+
+func (f failingCmder) Filecmd(r *sftp.Request) error {
+	if r.Method == f.method {
+		return errors.New("permission denied")
+	}
+	return f.FileCmder.Filecmd(r)
+}
+
+// failingWriter is an sftp.FileWriter failing either when creating files or when writing to them
+type failingWriter struct {
+	failCreate bool
+}
+
+func (f failingWriter) Filewrite(*sftp.Request) (io.WriterAt, error) {
+	if f.failCreate {
+		return nil, errors.New("permission denied")
+	}
+	return f, nil
+}
+
+func (f failingWriter) WriteAt([]byte, int64) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestTransferErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		handlers    func(handlers *sftp.Handlers)
+		expectedErr error
+	}{
+		{
+			name: "mkdir failure",
+			handlers: func(handlers *sftp.Handlers) {
+				handlers.FileCmd = failingCmder{FileCmder: handlers.FileCmd, method: "Mkdir"}
+			},
+			expectedErr: ErrRemoteMkdir,
+		},
+		{
+			name:        "create failure",
+			handlers:    func(handlers *sftp.Handlers) { handlers.FilePut = failingWriter{failCreate: true} },
+			expectedErr: ErrRemoteCreate,
+		},
+		{
+			name:        "copy failure",
+			handlers:    func(handlers *sftp.Handlers) { handlers.FilePut = failingWriter{} },
+			expectedErr: ErrRemoteCopy,
+		},
+		{
+			name:        "disk full on create",
+			handlers:    func(handlers *sftp.Handlers) { handlers.FilePut = diskFullWriter{failCreate: true} },
+			expectedErr: ErrRemoteCreate,
+		},
+		{
+			name:        "disk full on copy",
+			handlers:    func(handlers *sftp.Handlers) { handlers.FilePut = diskFullWriter{} },
+			expectedErr: ErrRemoteCopy,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			signer := newSigner(t)
+			host, port, err := net.SplitHostPort(startSFTPServerWithServe(t, signer.PublicKey(), func(channel ssh.Channel) {
+				handlers := sftp.InMemHandler()
+				test.handlers(&handlers)
+				sftp.NewRequestServer(channel, handlers).Serve()
+			}))
+			require.NoError(t, err)
+			c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+			require.NoError(t, err)
+			defer c.close()
+			sftpClient, err := c.createSFTPClient()
+			require.NoError(t, err)
+			defer sftpClient.Close()
+
+			err = c.transfer(sftpClient, bytes.NewReader(bytes.Repeat([]byte("0"), 1000)), "file", "/dir")
+			require.Error(t, err)
+			assert.ErrorIs(t, err, test.expectedErr)
+			for _, sentinel := range []error{ErrRemoteMkdir, ErrRemoteCreate, ErrRemoteCopy} {
+				if sentinel != test.expectedErr {
+					assert.NotErrorIs(t, err, sentinel)
+				}
+			}
+		})
+	}
+}
+
+// recordingCmder is an sftp.FileCmder recording the modes set, failing to set them if fail is true
+type recordingCmder struct {
+	sftp.FileCmder
+	mu    *sync.Mutex
+	modes map[string]os.FileMode
+	fail  bool
+}
+
+func (r recordingCmder) Filecmd(req *sftp.Request) error {
+	if req.Method != "Setstat" || !req.AttrFlags().Permissions {
+		return r.FileCmder.Filecmd(req)
+	}
+	if r.fail {
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.modes[req.Filepath] = req.Attributes().FileMode()
+	return nil
+}
+
+func TestTransferWithMode(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		t.Run(fmt.Sprintf("chmod failing %t", fail), func(t *testing.T) {
+			cmder := recordingCmder{mu: &sync.Mutex{}, modes: make(map[string]os.FileMode), fail: fail}
+			signer := newSigner(t)
+			host, port, err := net.SplitHostPort(startSFTPServerWithServe(t, signer.PublicKey(),
+				func(channel ssh.Channel) {
+					handlers := sftp.InMemHandler()
+					cmder.FileCmder = handlers.FileCmd
+					handlers.FileCmd = cmder
+					sftp.NewRequestServer(channel, handlers).Serve()
+				}))
+			require.NoError(t, err)
+			c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+			require.NoError(t, err)
+			defer c.close()
+			sftpClient, err := c.createSFTPClient()
+			require.NoError(t, err)
+			defer sftpClient.Close()
+
+			// an unsupported chmod does not fail the transfer
+			require.NoError(t, c.transferWithMode(sftpClient, strings.NewReader("binary"), "kubelet.exe", "/k", 0555))
+			cmder.mu.Lock()
+			defer cmder.mu.Unlock()
+			if fail {
+				assert.Empty(t, cmder.modes)
+				return
+			}
+			assert.Equal(t, map[string]os.FileMode{"/k\\kubelet.exe": 0555}, cmder.modes)
+		})
+	}
+}
+
+func TestIsDiskFull(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "no space status code",
+			err:      &sftp.StatusError{Code: sshFxNoSpaceOnFilesystem},
+			expected: true,
+		},
+		{
+			name:     "Windows message",
+			err:      fmt.Errorf("sftp: %w", errors.New(diskFullMessage)),
+			expected: true,
+		},
+		{
+			name:     "POSIX message",
+			err:      errors.New("write /dir/file: no space left on device"),
+			expected: true,
+		},
+		{
+			name:     "generic failure",
+			err:      &sftp.StatusError{Code: 4},
+			expected: false,
+		},
+		{
+			name:     "connection lost",
+			err:      io.ErrUnexpectedEOF,
+			expected: false,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isDiskFull(test.err))
+		})
+	}
+}
+
+func TestConnectivityString(t *testing.T) {
+	signer := newSigner(t)
+	bastionSigner := newSigner(t)
+	c := &sshConnectivity{username: "Administrator", ipAddress: "10.0.0.5", port: "22", signer: signer,
+		password: "s3cr3t-p4ssw0rd", bastion: &BastionConfig{Address: "bastion:22", Username: "core",
+			Signer: bastionSigner}}
+	out := c.String()
+	assert.Equal(t, `username: "Administrator", address: "10.0.0.5", port: 22, signer set: true, password set: true, `+
+		"bastion: {address: bastion:22, username: core, signer set: true}", out)
+	assert.NotContains(t, out, c.password)
+	for _, key := range []ssh.PublicKey{signer.PublicKey(), bastionSigner.PublicKey()} {
+		assert.NotContains(t, out, string(ssh.MarshalAuthorizedKey(key)))
+	}
+
+	c.signer = nil
+	err := c.init()
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), c.password)
+	assert.Contains(t, err.Error(), "signer set: false")
+}
+
+func TestTransferIfChanged(t *testing.T) {
+	content := []byte("kind: KubeletConfiguration\n")
+	// SHA256 of content, in upper case as printed by Get-FileHash
+	sum := sha256.Sum256(content)
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	testCases := []struct {
+		name            string
+		reader          io.Reader
+		remoteOut       string
+		remoteErr       error
+		expectedChanged bool
+		expectedErr     bool
+	}{
+		{
+			name:      "unchanged",
+			reader:    bytes.NewReader(content),
+			remoteOut: hash + "\r\n",
+		},
+		{
+			name:            "changed",
+			reader:          bytes.NewReader(content),
+			remoteOut:       strings.Repeat("0", len(hash)) + "\r\n",
+			expectedChanged: true,
+		},
+		{
+			name:            "missing remote file",
+			reader:          bytes.NewReader(content),
+			expectedChanged: true,
+		},
+		{
+			name:            "buffered reader",
+			reader:          io.MultiReader(bytes.NewReader(content)),
+			remoteOut:       "\r\n",
+			expectedChanged: true,
+		},
+		{
+			name:        "hash failure",
+			reader:      bytes.NewReader(content),
+			remoteErr:   errors.New("connection lost"),
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			conn := newFakeConnectivity("").respond("Get-FileHash", test.remoteOut, test.remoteErr)
+			changed, err := transferIfChanged(conn, nil, test.reader, "kubelet.conf", `C:\k`)
+			assert.Equal(t, []string{remoteFileHashCmd(`C:\k\kubelet.conf`)}, conn.issued())
+			if test.expectedErr {
+				assert.Error(t, err)
+				assert.Empty(t, conn.transfers)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedChanged, changed)
+			if !test.expectedChanged {
+				assert.Empty(t, conn.transfers)
+				return
+			}
+			// the whole content must be copied, even though it was read to be hashed
+			assert.Equal(t, []fakeTransfer{{remoteDir: `C:\k`, filename: "kubelet.conf", content: content}},
+				conn.transfers)
+		})
+	}
+}
+
+func TestRemoteFileHashCmd(t *testing.T) {
+	assert.Equal(t, `powershell.exe -NonInteractive -ExecutionPolicy Bypass "`+
+		`if (Test-Path -LiteralPath 'C:\k\it''s.conf' -PathType Leaf) `+
+		`{ (Get-FileHash -LiteralPath 'C:\k\it''s.conf' -Algorithm SHA256).Hash }"`,
+		remoteFileHashCmd(`C:\k\it's.conf`))
+}
+
+// failingReader is an io.Reader returning the given content followed by an error
+type failingReader struct {
+	content []byte
+	read    bool
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.read {
+		return 0, errors.New("read failure")
+	}
+	f.read = true
+	return copy(p, f.content), nil
+}
+
+func TestTransferAtomic(t *testing.T) {
+	signer := newSigner(t)
+	host, port, err := net.SplitHostPort(startSFTPServer(t, signer.PublicKey()))
+	require.NoError(t, err)
+	c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+	require.NoError(t, err)
+	defer c.close()
+	sftpClient, err := c.createSFTPClient()
+	require.NoError(t, err)
+	defer sftpClient.Close()
+
+	// remoteFiles returns the names of the files transferred to the given directory. As the test SFTP server runs on
+	// Linux, the Windows path separator is part of the names of the files created in the parent directory.
+	remoteFiles := func(remoteDir string) []string {
+		entries, err := os.ReadDir(filepath.Dir(remoteDir))
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), filepath.Base(remoteDir)+"\\") {
+				names = append(names, strings.TrimPrefix(entry.Name(), filepath.Base(remoteDir)+"\\"))
+			}
+		}
+		return names
+	}
+
+	t.Run("new file", func(t *testing.T) {
+		remoteDir := filepath.Join(t.TempDir(), "dir")
+		require.NoError(t, c.transferAtomic(sftpClient, strings.NewReader("new"), "file", remoteDir))
+		written, err := os.ReadFile(remoteDir + "\\file")
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(written))
+		assert.Equal(t, []string{"file"}, remoteFiles(remoteDir))
+	})
+
+	t.Run("existing file overwritten", func(t *testing.T) {
+		remoteDir := filepath.Join(t.TempDir(), "dir")
+		require.NoError(t, os.WriteFile(remoteDir+"\\file", []byte("old content"), 0644))
+		require.NoError(t, c.transferAtomic(sftpClient, strings.NewReader("new"), "file", remoteDir))
+		written, err := os.ReadFile(remoteDir + "\\file")
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(written))
+		assert.Equal(t, []string{"file"}, remoteFiles(remoteDir))
+	})
+
+	t.Run("copy failure", func(t *testing.T) {
+		remoteDir := filepath.Join(t.TempDir(), "dir")
+		require.NoError(t, os.WriteFile(remoteDir+"\\file", []byte("old content"), 0644))
+		err := c.transferAtomic(sftpClient, &failingReader{content: []byte("partial")}, "file", remoteDir)
+		require.Error(t, err)
+		// the existing file is untouched and the temporary file is removed
+		written, err := os.ReadFile(remoteDir + "\\file")
+		require.NoError(t, err)
+		assert.Equal(t, "old content", string(written))
+		assert.Equal(t, []string{"file"}, remoteFiles(remoteDir))
+	})
+}
+
+// closeFailingWriter is an sftp.FileWriter writing to the wrapped writer, failing to close the files whose name
+// contains the given string
+type closeFailingWriter struct {
+	sftp.FileWriter
+	failing string
+}
+
+func (f closeFailingWriter) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	w, err := f.FileWriter.Filewrite(r)
+	if err != nil || !strings.Contains(r.Filepath, f.failing) {
+		return w, err
+	}
+	return closeFailingWriterAt{w}, nil
+}
+
+// closeFailingWriterAt is an io.WriterAt failing to be closed, as a server unable to flush a file would
+type closeFailingWriterAt struct {
+	io.WriterAt
+}
+
+func (closeFailingWriterAt) Close() error {
+	return errors.New("failure flushing file")
+}
+
+func TestTransferCloseFailure(t *testing.T) {
+	signer := newSigner(t)
+	host, port, err := net.SplitHostPort(startSFTPServerWithServe(t, signer.PublicKey(), func(channel ssh.Channel) {
+		handlers := sftp.InMemHandler()
+		handlers.FilePut = closeFailingWriter{FileWriter: handlers.FilePut, failing: ".tmp"}
+		sftp.NewRequestServer(channel, handlers).Serve()
+	}))
+	require.NoError(t, err)
+	c, err := newSshConnectivity("Administrator", host, signer, sshOptions{port: port}, logr.Discard())
+	require.NoError(t, err)
+	defer c.close()
+	sftpClient, err := c.createSFTPClient()
+	require.NoError(t, err)
+	defer sftpClient.Close()
+
+	// a file written in place is kept when it cannot be closed
+	require.NoError(t, c.transfer(sftpClient, strings.NewReader("old"), "file.tmp", "/dir"))
+
+	require.NoError(t, c.transfer(sftpClient, strings.NewReader("old"), "file", "/dir"))
+	err = c.transferAtomic(sftpClient, strings.NewReader("new"), "file", "/dir")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errRemoteClose)
+	// the destination file is not replaced and the temporary file is removed
+	remoteFile, err := sftpClient.Open("/dir\\file")
+	require.NoError(t, err)
+	defer remoteFile.Close()
+	content, err := io.ReadAll(remoteFile)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+	entries, err := sftpClient.ReadDir("/")
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"dir", "dir\\file", "dir\\file.tmp"}, names)
+}
@@ -0,0 +1,188 @@
+package windows
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// diagnosticsTimeout is the maximum time given to each command run, or file fetched, when collecting diagnostics
+const diagnosticsTimeout = 2 * time.Minute
+
+// diagnosticsCommand is a PowerShell command whose output is part of a diagnostics bundle
+type diagnosticsCommand struct {
+	// name is the name of the archive entry holding the output of the command
+	name string
+	// cmd is the PowerShell command to run
+	cmd string
+}
+
+// diagnosticsCommands are the commands run to collect diagnostics, in order
+var diagnosticsCommands = []diagnosticsCommand{
+	{name: "os-version.txt",
+		cmd: "Get-CimInstance -ClassName Win32_OperatingSystem | Format-List Caption,Version,BuildNumber | Out-String -Width 4096"},
+	{name: "services.txt",
+		cmd: "Get-Service -Name " + quotedServiceNames() + " -ErrorAction SilentlyContinue | " +
+			"Format-Table -AutoSize Name,Status,StartType | Out-String -Width 4096"},
+	{name: "kubelet-version.txt", cmd: "& " + QuotePowerShellArg(KubeletPath) + " --version"},
+	{name: "kube-proxy-version.txt", cmd: "& " + QuotePowerShellArg(KubeProxyPath) + " --version"},
+	{name: "system-events.txt",
+		cmd: "Get-WinEvent -LogName System -MaxEvents 200 | " +
+			"Format-List TimeCreated,ProviderName,Id,LevelDisplayName,Message | Out-String -Width 4096"},
+}
+
+// commandOutput is the output of a command, split between stdout and stderr
+type commandOutput struct {
+	stdout string
+	stderr string
+}
+
+// quotedServiceNames returns the comma-separated, quoted names of the services installed by WMCO
+func quotedServiceNames() string {
+	quoted := make([]string, 0, len(RequiredServices))
+	for _, name := range RequiredServices {
+		quoted = append(quoted, QuotePowerShellArg(name))
+	}
+	return strings.Join(quoted, ",")
+}
+
+// diagnosticsFiles returns the files collected in a diagnostics bundle from an instance with the given locations, keyed
+// by the name of their archive entry
+func diagnosticsFiles(paths Paths) map[string]string {
+	files := map[string]string{"files/" + KubeletClientCAFilename: paths.KubeletCACertPath}
+	for service, logPath := range serviceLogPaths {
+		files["logs/"+service+".log"] = logPath
+	}
+	return files
+}
+
+// withTimeout returns the result of the given function, or an error if it does not return within the given timeout or
+// before the context is cancelled. The function is left running in the background in that case.
+func withTimeout[T any](ctx context.Context, timeout time.Duration, f func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	// buffered so that the goroutine does not leak if the timeout is reached first
+	done := make(chan result, 1)
+	go func() {
+		value, err := f()
+		done <- result{value: value, err: err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var zero T
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-timer.C:
+		return zero, fmt.Errorf("timed out after %s", timeout)
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// diagnosticsArchive writes the entries of a diagnostics bundle to a gzipped tar archive
+type diagnosticsArchive struct {
+	tw *tar.Writer
+	// errs describes the diagnostics which could not be collected
+	errs []string
+}
+
+// add writes an entry with the given name and contents to the archive
+func (a *diagnosticsArchive) add(name string, contents []byte) error {
+	header := &tar.Header{Name: path.Join("diagnostics", name), Mode: 0o644, Size: int64(len(contents)),
+		ModTime: time.Now()}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing %s archive header: %w", name, err)
+	}
+	if _, err := a.tw.Write(contents); err != nil {
+		return fmt.Errorf("error writing %s to the archive: %w", name, err)
+	}
+	return nil
+}
+
+func (vm *windows) CollectDiagnostics(ctx context.Context, dest io.Writer) error {
+	return vm.collectDiagnostics(ctx, dest, diagnosticsTimeout)
+}
+
+// collectDiagnostics behaves as CollectDiagnostics, giving each command and file fetch the given timeout
+func (vm *windows) collectDiagnostics(ctx context.Context, dest io.Writer, timeout time.Duration) error {
+	gw := gzip.NewWriter(dest)
+	archive := &diagnosticsArchive{tw: tar.NewWriter(gw)}
+	collectErr := vm.collectDiagnosticsInto(ctx, archive, timeout)
+	if len(archive.errs) > 0 {
+		if err := archive.add("errors.txt", []byte(strings.Join(archive.errs, "\n")+"\n")); err != nil {
+			collectErr = errors.Join(collectErr, err)
+		}
+	}
+	// the archive is closed even if the collection was interrupted, so that what was collected can be read
+	if err := archive.tw.Close(); err != nil {
+		return errors.Join(collectErr, fmt.Errorf("error closing diagnostics archive: %w", err))
+	}
+	if err := gw.Close(); err != nil {
+		return errors.Join(collectErr, fmt.Errorf("error closing diagnostics archive: %w", err))
+	}
+	return collectErr
+}
+
+// collectDiagnosticsInto collects the diagnostics of the VM into the given archive. A failure to collect a diagnostic
+// is recorded in the archive rather than returned, only errors writing the archive and context cancellation are.
+func (vm *windows) collectDiagnosticsInto(ctx context.Context, archive *diagnosticsArchive, timeout time.Duration) error {
+	for _, command := range diagnosticsCommands {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cmd := vm.shellCommand(command.cmd, true)
+		out, err := withTimeout(ctx, timeout, func() (commandOutput, error) {
+			stdout, stderr, err := vm.interact.runSeparate(cmd)
+			return commandOutput{stdout: stdout, stderr: stderr}, err
+		})
+		if err != nil {
+			archive.errs = append(archive.errs, fmt.Sprintf("%s: error running %s: %v", command.name, command.cmd, err))
+		}
+		// the output of a failed command may still explain the failure
+		if out.stdout != "" || err == nil {
+			if err := archive.add(command.name, []byte(out.stdout)); err != nil {
+				return err
+			}
+		}
+		if out.stderr != "" {
+			if err := archive.add(strings.TrimSuffix(command.name, ".txt")+".stderr.txt",
+				[]byte(out.stderr)); err != nil {
+				return err
+			}
+		}
+	}
+
+	files := diagnosticsFiles(InstancePaths(vm.instance))
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		remotePath := files[name]
+		contents, err := withTimeout(ctx, timeout, func() ([]byte, error) {
+			return vm.interact.receive(remotePath)
+		})
+		if err != nil {
+			archive.errs = append(archive.errs, fmt.Sprintf("%s: error fetching %s: %v", name, remotePath, err))
+			continue
+		}
+		if err := archive.add(name, contents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package windows
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readDiagnostics returns the contents of the entries of the given diagnostics archive, keyed by name
+func readDiagnostics(t *testing.T, archive []byte) map[string]string {
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	entries := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		contents, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		entries[header.Name] = string(contents)
+	}
+	return entries
+}
+
+func TestCollectDiagnostics(t *testing.T) {
+	conn := newFakeConnectivity("").
+		respond(`Win32_OperatingSystem`, "Caption : Microsoft Windows Server 2022 Datacenter", nil).
+		respond(`^Get-Service`, "kubelet Running Automatic", nil).
+		respond(`kubelet\.exe`, "Kubernetes v1.30.1", nil).
+		respondSeparate(`kube-proxy\.exe`, "", "kube-proxy.exe: command not found", fmt.Errorf("exit status 1")).
+		respondDelayed(`Get-WinEvent`, time.Second, "too late", nil)
+	conn.transfers = []fakeTransfer{
+		{remoteDir: K8sDir, filename: KubeletClientCAFilename, content: []byte("CA bundle")},
+		{remoteDir: KubeletLogDir, filename: "kubelet.log", content: []byte("kubelet log")},
+	}
+	vm := &windows{interact: conn, log: logr.Discard(), defaultShellPowerShell: true}
+
+	var out bytes.Buffer
+	require.NoError(t, vm.collectDiagnostics(context.Background(), &out, 100*time.Millisecond))
+	entries := readDiagnostics(t, out.Bytes())
+
+	assert.Equal(t, "Caption : Microsoft Windows Server 2022 Datacenter", entries["diagnostics/os-version.txt"])
+	assert.Equal(t, "kubelet Running Automatic", entries["diagnostics/services.txt"])
+	assert.Equal(t, "Kubernetes v1.30.1", entries["diagnostics/kubelet-version.txt"])
+	// the stderr output of a failed command is kept, its empty stdout output is not
+	assert.NotContains(t, entries, "diagnostics/kube-proxy-version.txt")
+	assert.Equal(t, "kube-proxy.exe: command not found", entries["diagnostics/kube-proxy-version.stderr.txt"])
+	// the command which did not complete in time did not block the collection of the files
+	assert.NotContains(t, entries, "diagnostics/system-events.txt")
+	assert.Equal(t, "CA bundle", entries["diagnostics/files/kubelet-ca.crt"])
+	assert.Equal(t, "kubelet log", entries["diagnostics/logs/kubelet.log"])
+	assert.NotContains(t, entries, "diagnostics/logs/kube-proxy.log")
+
+	errs := entries["diagnostics/errors.txt"]
+	assert.Contains(t, errs, "kube-proxy-version.txt: error running")
+	assert.Contains(t, errs, "system-events.txt: error running")
+	assert.Contains(t, errs, "timed out after 100ms")
+	assert.Contains(t, errs, `logs/kube-proxy.log: error fetching C:\var\log\kube-proxy\kube-proxy.log`)
+	assert.NotContains(t, errs, "logs/kubelet.log")
+}
+
+func TestCollectDiagnosticsCancelled(t *testing.T) {
+	conn := newFakeConnectivity("output")
+	vm := &windows{interact: conn, log: logr.Discard(), defaultShellPowerShell: true}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out bytes.Buffer
+	err := vm.collectDiagnostics(ctx, &out, time.Minute)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, conn.issued())
+	// the archive is still readable
+	assert.Empty(t, readDiagnostics(t, out.Bytes()))
+}
@@ -0,0 +1,62 @@
+package windows
+
+import (
+	"bytes"
+)
+
+// LineEnding specifies the line ending convention a text file should be written with
+type LineEnding int
+
+const (
+	// PreserveLineEndings leaves the line endings of the content untouched
+	PreserveLineEndings LineEnding = iota
+	// CRLF converts all line endings to the Windows `\r\n` convention
+	CRLF
+	// LF converts all line endings to the Unix `\n` convention
+	LF
+)
+
+// BOMMode specifies whether a text file should be written with a UTF-8 byte order mark
+type BOMMode int
+
+const (
+	// PreserveBOM leaves the byte order mark of the content untouched
+	PreserveBOM BOMMode = iota
+	// AddBOM ensures the content starts with a UTF-8 byte order mark
+	AddBOM
+	// StripBOM ensures the content does not start with a UTF-8 byte order mark
+	StripBOM
+)
+
+// utf8BOM is the UTF-8 encoded byte order mark
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// TextFormat describes the format a text file is expected to be in by the tool consuming it on the Windows instance
+type TextFormat struct {
+	// LineEnding is the line ending convention the file should use
+	LineEnding LineEnding
+	// BOM indicates if a UTF-8 byte order mark should be added to or removed from the file
+	BOM BOMMode
+}
+
+// Normalize returns a copy of the given text content, converted to match the format
+func (f TextFormat) Normalize(contents []byte) []byte {
+	hasBOM := bytes.HasPrefix(contents, utf8BOM)
+	body := bytes.TrimPrefix(contents, utf8BOM)
+
+	switch f.LineEnding {
+	case CRLF:
+		// convert to LF first, so existing CRLF line endings are not doubled
+		body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+		body = bytes.ReplaceAll(body, []byte("\n"), []byte("\r\n"))
+	case LF:
+		body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+	}
+
+	var out bytes.Buffer
+	if f.BOM == AddBOM || (f.BOM == PreserveBOM && hasBOM) {
+		out.Write(utf8BOM)
+	}
+	out.Write(body)
+	return out.Bytes()
+}
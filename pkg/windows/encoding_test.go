@@ -0,0 +1,84 @@
+package windows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextFormatNormalize(t *testing.T) {
+	bom := string(utf8BOM)
+	testCases := []struct {
+		name     string
+		format   TextFormat
+		input    string
+		expected string
+	}{
+		{
+			name:     "preserve all",
+			format:   TextFormat{},
+			input:    bom + "a\r\nb\nc",
+			expected: bom + "a\r\nb\nc",
+		},
+		{
+			name:     "LF to CRLF",
+			format:   TextFormat{LineEnding: CRLF},
+			input:    "a\nb\n",
+			expected: "a\r\nb\r\n",
+		},
+		{
+			name:     "mixed to CRLF does not double existing CRLF",
+			format:   TextFormat{LineEnding: CRLF},
+			input:    "a\r\nb\nc",
+			expected: "a\r\nb\r\nc",
+		},
+		{
+			name:     "CRLF to LF",
+			format:   TextFormat{LineEnding: LF},
+			input:    "a\r\nb\r\n",
+			expected: "a\nb\n",
+		},
+		{
+			name:     "add BOM",
+			format:   TextFormat{BOM: AddBOM},
+			input:    "a\n",
+			expected: bom + "a\n",
+		},
+		{
+			name:     "add BOM is idempotent",
+			format:   TextFormat{BOM: AddBOM},
+			input:    bom + "a\n",
+			expected: bom + "a\n",
+		},
+		{
+			name:     "strip BOM",
+			format:   TextFormat{BOM: StripBOM},
+			input:    bom + "a\n",
+			expected: "a\n",
+		},
+		{
+			name:     "strip BOM and convert to LF",
+			format:   TextFormat{LineEnding: LF, BOM: StripBOM},
+			input:    bom + "a\r\nb",
+			expected: "a\nb",
+		},
+		{
+			name:     "add BOM and convert to CRLF",
+			format:   TextFormat{LineEnding: CRLF, BOM: AddBOM},
+			input:    "a\nb",
+			expected: bom + "a\r\nb",
+		},
+		{
+			name:     "empty input",
+			format:   TextFormat{LineEnding: CRLF, BOM: StripBOM},
+			input:    "",
+			expected: "",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, string(test.format.Normalize([]byte(test.input))))
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package windows
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeResponse is the canned result of the commands matching a pattern
+type fakeResponse struct {
+	pattern *regexp.Regexp
+	out     string
+	err     error
+	// times is the number of commands the response is used for, unlimited if 0
+	times int
+	// stderr is the stderr output of the commands run through runSeparate, out being their stdout output
+	stderr string
+	// delay is the time waited before answering a command
+	delay time.Duration
+}
+
+// fakeTransfer is a file transferred through a fakeConnectivity
+type fakeTransfer struct {
+	remoteDir string
+	filename  string
+	content   []byte
+	// mode is the mode set on the file, if any
+	mode os.FileMode
+}
+
+// fakeConnectivity is a connectivity which records the commands run and the files transferred through it. Commands
+// are answered with the first response whose pattern matches them, or with the default output if none does.
+type fakeConnectivity struct {
+	// mu synchronizes access to all fields
+	mu sync.Mutex
+	// out is the output of commands not matching any response
+	out string
+	// responses are the canned results of commands, checked in order
+	responses []fakeResponse
+	// commands are the commands run, in order
+	commands []string
+	// transfers are the files transferred, in order
+	transfers []fakeTransfer
+	// removed are the paths removed, in order
+	removed []string
+}
+
+// newFakeConnectivity returns a fakeConnectivity answering commands with the given default output
+func newFakeConnectivity(out string) *fakeConnectivity {
+	return &fakeConnectivity{out: out}
+}
+
+// respond makes commands matching the given regular expression return the given output and error. Returns the
+// fakeConnectivity so that calls can be chained.
+func (f *fakeConnectivity) respond(pattern, out string, err error) *fakeConnectivity {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{pattern: regexp.MustCompile(pattern), out: out, err: err})
+	return f
+}
+
+// respondTimes behaves as respond, only using the response for the given number of matching commands
+func (f *fakeConnectivity) respondTimes(pattern string, times int, out string, err error) *fakeConnectivity {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{pattern: regexp.MustCompile(pattern), out: out, err: err,
+		times: times})
+	return f
+}
+
+// respondDelayed behaves as respond, waiting for the given delay before answering matching commands
+func (f *fakeConnectivity) respondDelayed(pattern string, delay time.Duration, out string, err error) *fakeConnectivity {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{pattern: regexp.MustCompile(pattern), out: out, err: err,
+		delay: delay})
+	return f
+}
+
+// respondSeparate behaves as respond, giving the stdout and stderr output of matching commands run through runSeparate.
+// The stderr output is ignored by run.
+func (f *fakeConnectivity) respondSeparate(pattern, stdout, stderr string, err error) *fakeConnectivity {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{pattern: regexp.MustCompile(pattern), out: stdout, stderr: stderr,
+		err: err})
+	return f
+}
+
+// issued returns the commands run so far
+func (f *fakeConnectivity) issued() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.commands...)
+}
+
+func (f *fakeConnectivity) init() error { return nil }
+
+func (f *fakeConnectivity) run(cmd string) (string, error) {
+	response := f.match(cmd)
+	// the delay is waited without holding the lock, so that other commands can be answered meanwhile
+	time.Sleep(response.delay)
+	return response.out, response.err
+}
+
+// match records the given command and returns the response answering it
+func (f *fakeConnectivity) match(cmd string) fakeResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, cmd)
+	for i, response := range f.responses {
+		if !response.pattern.MatchString(cmd) {
+			continue
+		}
+		if response.times > 0 {
+			f.responses[i].times--
+			if f.responses[i].times == 0 {
+				f.responses = append(f.responses[:i], f.responses[i+1:]...)
+			}
+		}
+		return response
+	}
+	return fakeResponse{out: f.out}
+}
+
+func (f *fakeConnectivity) runSeparate(cmd string) (string, string, error) {
+	response := f.match(cmd)
+	time.Sleep(response.delay)
+	return response.out, response.stderr, response.err
+}
+
+func (f *fakeConnectivity) createSFTPClient() (*sftp.Client, error) { return nil, nil }
+
+func (f *fakeConnectivity) transfer(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string) error {
+	return f.transferWithProgress(sftpClient, reader, filename, remoteDir, nil)
+}
+
+func (f *fakeConnectivity) transferWithProgress(_ *sftp.Client, reader io.Reader, filename, remoteDir string,
+	progress func(int64, int64)) error {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(int64(len(content)), int64(len(content)))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.transfers = append(f.transfers, fakeTransfer{remoteDir: remoteDir, filename: filename, content: content})
+	return nil
+}
+
+func (f *fakeConnectivity) transferAtomic(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string) error {
+	return f.transfer(sftpClient, reader, filename, remoteDir)
+}
+
+func (f *fakeConnectivity) transferWithMode(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string,
+	mode os.FileMode) error {
+	if err := f.transfer(sftpClient, reader, filename, remoteDir); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.transfers[len(f.transfers)-1].mode = mode
+	return nil
+}
+
+func (f *fakeConnectivity) transferFiles(_ *sftp.Client, files map[string][]byte, remoteDir string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for filename, content := range files {
+		f.transfers = append(f.transfers, fakeTransfer{remoteDir: remoteDir, filename: filename, content: content})
+	}
+	return nil
+}
+
+func (f *fakeConnectivity) receive(remotePath string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// the most recent transfer of the file wins
+	for i := len(f.transfers) - 1; i >= 0; i-- {
+		if f.transfers[i].remoteDir+"\\"+f.transfers[i].filename == remotePath {
+			return f.transfers[i].content, nil
+		}
+	}
+	return nil, fmt.Errorf("error opening remote file %s: %w", remotePath, os.ErrNotExist)
+}
+
+func (f *fakeConnectivity) ping() error {
+	_, err := f.run(pingCommand)
+	return err
+}
+
+func (f *fakeConnectivity) remove(remotePath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed = append(f.removed, remotePath)
+	return nil
+}
+
+func (f *fakeConnectivity) removeAll(remoteDir string) error {
+	return f.remove(remoteDir)
+}
+
+func (f *fakeConnectivity) close() error { return nil }
+
+func TestServiceStatusCommands(t *testing.T) {
+	testCases := []struct {
+		name             string
+		conn             *fakeConnectivity
+		expectedExists   bool
+		expectedRunning  bool
+		expectedCommands []string
+		expectedErr      bool
+	}{
+		{
+			name: "running service",
+			conn: newFakeConnectivity("").
+				respond(`^cmd /c sc\.exe query kubelet$`, "STATE : 4 RUNNING", nil),
+			expectedExists:   true,
+			expectedRunning:  true,
+			expectedCommands: []string{"cmd /c sc.exe qc kubelet", "cmd /c sc.exe query kubelet"},
+		},
+		{
+			name: "stopped service",
+			conn: newFakeConnectivity("").
+				respond(`sc\.exe query`, "STATE : 1 STOPPED", nil),
+			expectedExists:   true,
+			expectedCommands: []string{"cmd /c sc.exe qc kubelet", "cmd /c sc.exe query kubelet"},
+		},
+		{
+			name: "missing service",
+			conn: newFakeConnectivity("").
+				respond(`sc\.exe qc`, "[SC] OpenService FAILED 1060", fmt.Errorf("exit status 1060")),
+			// the state of a missing service is not queried
+			expectedCommands: []string{"cmd /c sc.exe qc kubelet"},
+		},
+		{
+			name: "query failure",
+			conn: newFakeConnectivity("").
+				respond(`sc\.exe query`, "", fmt.Errorf("connection lost")),
+			expectedExists:   true,
+			expectedCommands: []string{"cmd /c sc.exe qc kubelet", "cmd /c sc.exe query kubelet"},
+			expectedErr:      true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			vm := &windows{interact: test.conn, log: logr.Discard(), defaultShellPowerShell: true}
+			exists, running, err := vm.ServiceStatus("kubelet")
+			assert.Equal(t, test.expectedCommands, test.conn.issued())
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedExists, exists)
+			assert.Equal(t, test.expectedRunning, running)
+		})
+	}
+}
+
+func TestEnsureReachable(t *testing.T) {
+	testCases := []struct {
+		name             string
+		conn             *fakeConnectivity
+		expectedCommands []string
+	}{
+		{
+			name:             "reachable",
+			conn:             newFakeConnectivity(""),
+			expectedCommands: []string{pingCommand},
+		},
+		{
+			name: "connection lost",
+			conn: newFakeConnectivity("").
+				respondTimes(`^echo ping$`, 1, "", fmt.Errorf("EOF")),
+			// the connection is re-established rather than failing on the next command
+			expectedCommands: []string{pingCommand},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			vm := &windows{interact: test.conn, log: logr.Discard(), defaultShellPowerShell: true}
+			require.NoError(t, vm.EnsureReachable())
+			assert.Equal(t, test.expectedCommands, test.conn.issued())
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package windows
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KubeletPort is the port kubelet serves its API on, which must be reachable for the node to report Ready and for
+// container logs to be retrieved
+const KubeletPort = 10250
+
+// firewallRuleName returns the display name of the firewall rule created to allow inbound TCP traffic to the given port
+func firewallRuleName(port int) string {
+	return fmt.Sprintf("OpenShift-TCP-%d", port)
+}
+
+// firewallAllowedPortsCmd returns the command printing the local ports of each enabled firewall rule allowing inbound
+// TCP traffic, regardless of who created it, one per line. The ports are printed as set on the rules: a port, a range
+// of ports or a keyword such as Any.
+func firewallAllowedPortsCmd() string {
+	return formatRemotePowerShellCommand("Get-NetFirewallRule -Direction Inbound -Action Allow -Enabled True " +
+		"-ErrorAction SilentlyContinue | Get-NetFirewallPortFilter | Where-Object Protocol -In 'TCP','Any' | " +
+		"Select-Object -ExpandProperty LocalPort")
+}
+
+// firewallRuleCreateCmd returns the command creating a firewall rule allowing inbound TCP traffic to the given port
+func firewallRuleCreateCmd(port int) string {
+	return formatRemotePowerShellCommand(fmt.Sprintf("New-NetFirewallRule -DisplayName %s -Direction Inbound "+
+		"-Action Allow -Protocol TCP -LocalPort %d -EdgeTraversalPolicy Allow",
+		QuotePowerShellArg(firewallRuleName(port)), port))
+}
+
+// portAllowed returns true if the given port is one of the given firewall rule local ports, which are ports, ranges of
+// ports or Any. The other keywords, such as RPC, designate ports assigned dynamically and never match.
+func portAllowed(port int, localPorts []string) bool {
+	for _, localPort := range localPorts {
+		if strings.EqualFold(localPort, "Any") {
+			return true
+		}
+		low, high, isRange := strings.Cut(localPort, "-")
+		if !isRange {
+			high = low
+		}
+		lowPort, lowErr := strconv.Atoi(low)
+		highPort, highErr := strconv.Atoi(high)
+		if lowErr == nil && highErr == nil && lowPort <= port && port <= highPort {
+			return true
+		}
+	}
+	return false
+}
+
+// EnsureFirewallRules ensures inbound TCP traffic to each of the given ports is allowed by the firewall of the
+// instance reached through the given connection, creating a rule for each port no enabled rule allows yet, whether the
+// rule names the port, a range including it or any port. Returns the display names of the rules created.
+func EnsureFirewallRules(conn connectivity, ports []int) ([]string, error) {
+	out, err := conn.run(firewallAllowedPortsCmd())
+	if err != nil {
+		return nil, fmt.Errorf("error checking firewall rules, with output %s: %w", out, err)
+	}
+	localPorts := strings.Fields(out)
+	var created []string
+	for _, port := range ports {
+		if portAllowed(port, localPorts) {
+			continue
+		}
+		if out, err = conn.run(firewallRuleCreateCmd(port)); err != nil {
+			return created, fmt.Errorf("error creating firewall rule for port %d, with output %s: %w", port, out,
+				err)
+		}
+		created = append(created, firewallRuleName(port))
+	}
+	return created, nil
+}
+
+func (vm *windows) EnsureFirewallRules(ports []int) error {
+	created, err := EnsureFirewallRules(vm.interact, ports)
+	if len(created) > 0 {
+		vm.log.Info("created firewall rules", "rules", created)
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package windows
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirewallRuleCmds(t *testing.T) {
+	assert.Equal(t, `powershell.exe -NonInteractive -ExecutionPolicy Bypass "`+
+		`Get-NetFirewallRule -Direction Inbound -Action Allow -Enabled True -ErrorAction SilentlyContinue | `+
+		`Get-NetFirewallPortFilter | Where-Object Protocol -In 'TCP','Any' | Select-Object -ExpandProperty LocalPort"`,
+		firewallAllowedPortsCmd())
+	assert.NotContains(t, firewallAllowedPortsCmd(), "$", "variables would be expanded by a PowerShell default shell")
+	assert.Equal(t, `powershell.exe -NonInteractive -ExecutionPolicy Bypass "`+
+		`New-NetFirewallRule -DisplayName 'OpenShift-TCP-10250' -Direction Inbound -Action Allow -Protocol TCP `+
+		`-LocalPort 10250 -EdgeTraversalPolicy Allow"`, firewallRuleCreateCmd(KubeletPort))
+}
+
+func TestPortAllowed(t *testing.T) {
+	testCases := []struct {
+		name       string
+		localPorts []string
+		expected   bool
+	}{
+		{
+			name: "no rules",
+		},
+		{
+			name:       "port",
+			localPorts: []string{"22", "10250"},
+			expected:   true,
+		},
+		{
+			name:       "other ports",
+			localPorts: []string{"22", "102500", "1025"},
+		},
+		{
+			name:       "any port",
+			localPorts: []string{"Any"},
+			expected:   true,
+		},
+		{
+			name:       "range including the port",
+			localPorts: []string{"10000-11000"},
+			expected:   true,
+		},
+		{
+			name:       "range bounds",
+			localPorts: []string{"10250-10255"},
+			expected:   true,
+		},
+		{
+			name:       "range excluding the port",
+			localPorts: []string{"9000-10249", "10251-11000"},
+		},
+		{
+			name:       "dynamic ports",
+			localPorts: []string{"RPC", "RPCEPMap", "PlayToDiscovery"},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, portAllowed(KubeletPort, test.localPorts))
+		})
+	}
+}
+
+func TestEnsureFirewallRules(t *testing.T) {
+	testCases := []struct {
+		name             string
+		conn             *fakeConnectivity
+		ports            []int
+		expectedCreated  []string
+		expectedCommands []string
+		expectedErr      bool
+	}{
+		{
+			name:             "rule missing",
+			conn:             newFakeConnectivity(""),
+			ports:            []int{KubeletPort},
+			expectedCreated:  []string{"OpenShift-TCP-10250"},
+			expectedCommands: []string{firewallAllowedPortsCmd(), firewallRuleCreateCmd(KubeletPort)},
+		},
+		{
+			name:             "rule created by the user data",
+			conn:             newFakeConnectivity("").respond("Get-NetFirewallRule", "22\r\n10250\r\n", nil),
+			ports:            []int{KubeletPort},
+			expectedCommands: []string{firewallAllowedPortsCmd()},
+		},
+		{
+			name:             "rule allowing any port",
+			conn:             newFakeConnectivity("").respond("Get-NetFirewallRule", "Any\r\n", nil),
+			ports:            []int{KubeletPort},
+			expectedCommands: []string{firewallAllowedPortsCmd()},
+		},
+		{
+			name:             "rule allowing a range of ports",
+			conn:             newFakeConnectivity("").respond("Get-NetFirewallRule", "RPC\r\n10000-11000\r\n", nil),
+			ports:            []int{KubeletPort},
+			expectedCommands: []string{firewallAllowedPortsCmd()},
+		},
+		{
+			name:            "some rules missing",
+			conn:            newFakeConnectivity("").respond("Get-NetFirewallRule", "9182\r\n", nil),
+			ports:           []int{KubeletPort, 9182, 10256},
+			expectedCreated: []string{"OpenShift-TCP-10250", "OpenShift-TCP-10256"},
+			expectedCommands: []string{firewallAllowedPortsCmd(), firewallRuleCreateCmd(KubeletPort),
+				firewallRuleCreateCmd(10256)},
+		},
+		{
+			name:             "check failure",
+			conn:             newFakeConnectivity("").respond("Get-NetFirewallRule", "", errors.New("lost")),
+			ports:            []int{KubeletPort, 10256},
+			expectedCommands: []string{firewallAllowedPortsCmd()},
+			expectedErr:      true,
+		},
+		{
+			name: "create failure",
+			conn: newFakeConnectivity("").
+				respond("New-NetFirewallRule.*10256", "Access is denied", errors.New("exit status 1")),
+			ports:           []int{KubeletPort, 10256},
+			expectedCreated: []string{"OpenShift-TCP-10250"},
+			expectedCommands: []string{firewallAllowedPortsCmd(), firewallRuleCreateCmd(KubeletPort),
+				firewallRuleCreateCmd(10256)},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			created, err := EnsureFirewallRules(test.conn, test.ports)
+			assert.Equal(t, test.expectedCommands, test.conn.issued())
+			assert.Equal(t, test.expectedCreated, created)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestEnsureFirewallRulesIdempotent(t *testing.T) {
+	conn := newFakeConnectivity("")
+	vm := &windows{interact: conn, log: logr.Discard()}
+	require.NoError(t, vm.EnsureFirewallRules([]int{KubeletPort}))
+	// the rule created is now found by the check, and is not created again
+	conn.respond("Get-NetFirewallRule", "10250\r\n", nil)
+	require.NoError(t, vm.EnsureFirewallRules([]int{KubeletPort}))
+	assert.Equal(t, []string{firewallAllowedPortsCmd(), firewallRuleCreateCmd(KubeletPort),
+		firewallAllowedPortsCmd()}, conn.issued())
+}
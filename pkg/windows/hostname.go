@@ -0,0 +1,85 @@
+package windows
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+// tcpipParametersKey is the registry key holding the hostname the instance takes on its next boot, as its NV Hostname
+// value
+const tcpipParametersKey = `HKLM:\SYSTEM\CurrentControlSet\Services\Tcpip\Parameters`
+
+// RebootRequiredErr is returned when a change made to an instance only takes effect once the instance is rebooted
+type RebootRequiredErr struct {
+	// change describes the change waiting for the reboot
+	change string
+}
+
+// Error returns the error message
+func (e *RebootRequiredErr) Error() string {
+	return fmt.Sprintf("reboot required for the %s to take effect", e.change)
+}
+
+// hostnamesCmd returns the command printing the current hostname of the instance, followed by the hostname the instance
+// takes on its next boot, on separate lines. DNS hostnames are printed rather than computer names, as Windows truncates
+// the computer name, which is the NetBIOS name of the instance, to 15 characters.
+func hostnamesCmd() string {
+	return formatRemotePowerShellCommand(fmt.Sprintf("[System.Net.Dns]::GetHostName(); "+
+		"(Get-ItemProperty -Path %s -Name 'NV Hostname').'NV Hostname'", QuotePowerShellArg(tcpipParametersKey)))
+}
+
+// hostnames returns the current hostname of the instance reached through the given connection, and the hostname it
+// takes on its next boot
+func hostnames(conn connectivity) (string, string, error) {
+	out, err := conn.run(hostnamesCmd())
+	if err != nil {
+		return "", "", fmt.Errorf("error getting hostname, with output %s: %w", out, err)
+	}
+	names := strings.Fields(out)
+	if len(names) != 2 {
+		return "", "", fmt.Errorf("unexpected output getting hostname: %s", out)
+	}
+	return names[0], names[1], nil
+}
+
+// SetHostname renames the instance reached through the given connection to the given hostname, and checks the rename
+// took effect. Renaming an instance already bearing the given hostname is a no-op. As the rename is only applied once
+// the instance is rebooted, a *RebootRequiredErr is returned when the instance takes the given hostname on its next
+// boot, whether it was renamed by this call or by a previous one. Hostnames are compared case-insensitively, as
+// Windows may change their case. The hostname must be valid as described by instance.ValidateHostname.
+func SetHostname(conn connectivity, newName string) error {
+	if err := instance.ValidateHostname(newName); err != nil {
+		return err
+	}
+	return setHostname(conn, newName)
+}
+
+// setHostname behaves as SetHostname, without validating the given hostname, which must be valid as described by
+// instance.ValidateMachineHostname
+func setHostname(conn connectivity, newName string) error {
+	current, pending, err := hostnames(conn)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(current, newName) && strings.EqualFold(pending, newName) {
+		return nil
+	}
+	if !strings.EqualFold(pending, newName) {
+		cmd := formatRemotePowerShellCommand("Rename-Computer -NewName " + QuotePowerShellArg(newName) + " -Force")
+		if out, err := conn.run(cmd); err != nil {
+			return fmt.Errorf("error renaming instance to %s, with output %s: %w", newName, out, err)
+		}
+		if current, pending, err = hostnames(conn); err != nil {
+			return err
+		}
+		if !strings.EqualFold(pending, newName) {
+			return fmt.Errorf("rename to %s did not take effect, instance will be named %s", newName, pending)
+		}
+	}
+	if !strings.EqualFold(current, newName) {
+		return &RebootRequiredErr{change: fmt.Sprintf("hostname change from %s to %s", current, newName)}
+	}
+	return nil
+}
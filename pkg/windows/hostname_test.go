@@ -0,0 +1,114 @@
+package windows
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostnamesCmd(t *testing.T) {
+	assert.Equal(t, `powershell.exe -NonInteractive -ExecutionPolicy Bypass "[System.Net.Dns]::GetHostName(); `+
+		`(Get-ItemProperty -Path 'HKLM:\SYSTEM\CurrentControlSet\Services\Tcpip\Parameters' `+
+		`-Name 'NV Hostname').'NV Hostname'"`, hostnamesCmd())
+	assert.NotContains(t, hostnamesCmd(), "$", "variables would be expanded by a PowerShell default shell")
+}
+
+func TestSetHostname(t *testing.T) {
+	renameCmd := `powershell.exe -NonInteractive -ExecutionPolicy Bypass "Rename-Computer -NewName 'winworker-1' -Force"`
+	testCases := []struct {
+		name             string
+		conn             *fakeConnectivity
+		newName          string
+		expectedCommands []string
+		expectedReboot   bool
+		expectedErr      bool
+	}{
+		{
+			name: "renamed",
+			conn: newFakeConnectivity("").
+				respondTimes("GetHostName", 1, "WIN-3N7Q2\r\nWIN-3N7Q2\r\n", nil).
+				respond("GetHostName", "WIN-3N7Q2\r\nWINWORKER-1\r\n", nil),
+			newName:          "winworker-1",
+			expectedCommands: []string{hostnamesCmd(), renameCmd, hostnamesCmd()},
+			expectedReboot:   true,
+		},
+		{
+			name:             "already named",
+			conn:             newFakeConnectivity("").respond("GetHostName", "WINWORKER-1\r\nWINWORKER-1\r\n", nil),
+			newName:          "winworker-1",
+			expectedCommands: []string{hostnamesCmd()},
+		},
+		{
+			name:             "rename pending reboot",
+			conn:             newFakeConnectivity("").respond("GetHostName", "WIN-3N7Q2\r\nWINWORKER-1\r\n", nil),
+			newName:          "winworker-1",
+			expectedCommands: []string{hostnamesCmd()},
+			expectedReboot:   true,
+		},
+		{
+			name: "rename not applied",
+			conn: newFakeConnectivity("").
+				respond("GetHostName", "WIN-3N7Q2\r\nWIN-3N7Q2\r\n", nil),
+			newName:          "winworker-1",
+			expectedCommands: []string{hostnamesCmd(), renameCmd, hostnamesCmd()},
+			expectedErr:      true,
+		},
+		{
+			name: "rename failure",
+			conn: newFakeConnectivity("").
+				respond("GetHostName", "WIN-3N7Q2\r\nWIN-3N7Q2\r\n", nil).
+				respond("Rename-Computer", "Access is denied", errors.New("exit status 1")),
+			newName:          "winworker-1",
+			expectedCommands: []string{hostnamesCmd(), renameCmd},
+			expectedErr:      true,
+		},
+		{
+			name:             "unexpected output",
+			conn:             newFakeConnectivity("").respond("GetHostName", "WIN-3N7Q2\r\n", nil),
+			newName:          "winworker-1",
+			expectedCommands: []string{hostnamesCmd()},
+			expectedErr:      true,
+		},
+		{
+			name:             "invalid hostname",
+			conn:             newFakeConnectivity(""),
+			newName:          "windows-worker-01",
+			expectedCommands: []string{},
+			expectedErr:      true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := SetHostname(test.conn, test.newName)
+			assert.Equal(t, test.expectedCommands, test.conn.issued())
+			var rebootErr *RebootRequiredErr
+			switch {
+			case test.expectedReboot:
+				assert.ErrorAs(t, err, &rebootErr)
+			case test.expectedErr:
+				require.Error(t, err)
+				assert.False(t, errors.As(err, &rebootErr))
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSetMachineHostname(t *testing.T) {
+	machineName := "windows-worker-a-8zq5v"
+	// the hostnames are compared in full, while the computer name is truncated to WINDOWS-WORKER-
+	conn := newFakeConnectivity("").
+		respondTimes("GetHostName", 1, "WIN-3N7Q2\r\nWIN-3N7Q2\r\n", nil).
+		respond("GetHostName", "WIN-3N7Q2\r\n"+machineName+"\r\n", nil)
+	var rebootErr *RebootRequiredErr
+	assert.ErrorAs(t, setHostname(conn, machineName), &rebootErr)
+	assert.Equal(t, []string{hostnamesCmd(), `powershell.exe -NonInteractive -ExecutionPolicy Bypass "` +
+		`Rename-Computer -NewName 'windows-worker-a-8zq5v' -Force"`, hostnamesCmd()}, conn.issued())
+
+	conn = newFakeConnectivity("").respond("GetHostName", machineName+"\r\n"+machineName+"\r\n", nil)
+	assert.NoError(t, setHostname(conn, machineName))
+	assert.Equal(t, []string{hostnamesCmd()}, conn.issued())
+}
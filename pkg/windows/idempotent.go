@@ -0,0 +1,87 @@
+package windows
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// transientExitCodes are the exit codes of commands which are expected to succeed when run again, keyed to the
+// Windows system error they represent.
+// referenced: https://docs.microsoft.com/en-us/windows/win32/debug/system-error-codes--1000-1299-
+var transientExitCodes = map[int]string{
+	// the service may not be registered yet
+	1060: "ERROR_SERVICE_DOES_NOT_EXIST",
+	// the service may be starting or stopping
+	1061: "ERROR_SERVICE_CANNOT_ACCEPT_CTRL",
+	1053: "ERROR_SERVICE_REQUEST_TIMEOUT",
+}
+
+// nonIdempotentCommands are the prefixes of commands which must never be run again. A transport error may be caused by
+// the command itself, as with a restart dropping the connection, so running them again could repeat their effect.
+var nonIdempotentCommands = []string{"Restart-Computer", "Stop-Computer", "shutdown", "Rename-Computer"}
+
+// exitStatusError is implemented by errors reporting the exit status of a remote command, such as ssh.ExitError
+type exitStatusError interface {
+	error
+	ExitStatus() int
+}
+
+// isIdempotent returns false if the given command is known to not be safe to run again
+func isIdempotent(cmd string) bool {
+	for _, prefix := range nonIdempotentCommands {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(cmd)), strings.ToLower(prefix)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTransientRunErr returns true if the given error returned when running a command is expected to resolve itself when
+// the command is run again: the command could not be run due to a transport error, or it exited with a transient
+// exit code
+func isTransientRunErr(err error) bool {
+	var exitErr exitStatusError
+	if errors.As(err, &exitErr) {
+		_, transient := transientExitCodes[exitErr.ExitStatus()]
+		return transient
+	}
+	return true
+}
+
+// runIdempotent runs the given PowerShell command, running it again up to the given number of attempts, waiting the
+// given interval in between, as long as it fails with a transient error. Commands which are not idempotent are only
+// attempted once.
+func (vm *windows) runIdempotent(cmd string, attempts int, interval time.Duration) (string, error) {
+	if attempts < 1 {
+		return "", fmt.Errorf("invalid number of attempts %d, must be at least 1", attempts)
+	}
+	if !isIdempotent(cmd) {
+		attempts = 1
+	}
+	var out string
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		out, err = vm.Run(cmd, true)
+		if err == nil || !isTransientRunErr(err) {
+			return out, err
+		}
+		if attempt < attempts {
+			vm.log.V(1).Info("retrying command after transient error", "cmd", cmd, "attempt", attempt,
+				"error", err.Error())
+			vm.getClock().Sleep(interval)
+		}
+	}
+	return out, fmt.Errorf("command failed after %d attempts: %w", attempts, err)
+}
+
+// getClock returns the clock used to wait in between retries, defaulting to the real clock
+func (vm *windows) getClock() clock.Clock {
+	if vm.clock == nil {
+		return clock.RealClock{}
+	}
+	return vm.clock
+}
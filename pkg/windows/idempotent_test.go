@@ -0,0 +1,118 @@
+package windows
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// fakeExitError is an exitStatusError with the given exit status
+type fakeExitError int
+
+func (e fakeExitError) Error() string   { return fmt.Sprintf("Process exited with status %d", int(e)) }
+func (e fakeExitError) ExitStatus() int { return int(e) }
+
+func TestRunIdempotent(t *testing.T) {
+	testCases := []struct {
+		name             string
+		cmd              string
+		failures         int
+		err              error
+		attempts         int
+		expectedCommands int
+		expectedErr      bool
+	}{
+		{
+			name:             "success",
+			cmd:              "Get-Service kubelet",
+			attempts:         3,
+			expectedCommands: 1,
+		},
+		{
+			name:             "transport error retried",
+			cmd:              "Get-Service kubelet",
+			failures:         2,
+			err:              fmt.Errorf("connection reset by peer"),
+			attempts:         3,
+			expectedCommands: 3,
+		},
+		{
+			name:             "transient exit code retried",
+			cmd:              "Start-Service kubelet",
+			failures:         1,
+			err:              fakeExitError(1060),
+			attempts:         3,
+			expectedCommands: 2,
+		},
+		{
+			name:             "permanent exit code not retried",
+			cmd:              "Get-Content C:\\k\\missing",
+			failures:         1,
+			err:              fakeExitError(1),
+			attempts:         3,
+			expectedCommands: 1,
+			expectedErr:      true,
+		},
+		{
+			name:             "attempts exhausted",
+			cmd:              "Get-Service kubelet",
+			failures:         3,
+			err:              fmt.Errorf("connection reset by peer"),
+			attempts:         3,
+			expectedCommands: 3,
+			expectedErr:      true,
+		},
+		{
+			name:             "non-idempotent command not retried",
+			cmd:              "Restart-Computer -Force",
+			failures:         1,
+			err:              fmt.Errorf("connection reset by peer"),
+			attempts:         3,
+			expectedCommands: 1,
+			expectedErr:      true,
+		},
+		{
+			name:        "invalid attempts",
+			cmd:         "Get-Service kubelet",
+			attempts:    0,
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			conn := newFakeConnectivity("done")
+			if test.failures > 0 {
+				conn.respondTimes(".*", test.failures, "", test.err)
+			}
+			vm := &windows{interact: conn, log: logr.Discard(), defaultShellPowerShell: true}
+			out, err := vm.runIdempotent(test.cmd, test.attempts, 0)
+			assert.Len(t, conn.issued(), test.expectedCommands)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "done", out)
+		})
+	}
+}
+
+func TestRunIdempotentInterval(t *testing.T) {
+	interval := 10 * time.Second
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	conn := newFakeConnectivity("done")
+	conn.respondTimes(".*", 2, "", fmt.Errorf("connection reset by peer"))
+	fakeClock := clocktesting.NewFakeClock(start)
+	vm := &windows{interact: conn, log: logr.Discard(), defaultShellPowerShell: true, clock: fakeClock}
+
+	_, err := vm.runIdempotent("Get-Service kubelet", 3, interval)
+	require.NoError(t, err)
+	assert.Len(t, conn.issued(), 3)
+	// the interval was waited once in between each of the attempts
+	assert.Equal(t, 2*interval, fakeClock.Since(start))
+}
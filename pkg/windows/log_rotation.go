@@ -0,0 +1,102 @@
+package windows
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// logRotationInterval is the number of minutes between two checks of the size of a rotated log file
+	logRotationInterval = 5
+	// logRotationScript is the PowerShell script rotating a log file once it reaches a size. It is formatted with the
+	// quoted path of the log file, its maximum size in MB and the number of rotated files to keep. Services keep their
+	// log file open, so the file is copied and truncated rather than renamed.
+	logRotationScript = `$path = %s; $maxSizeMB = %d; $maxFiles = %d
+if (-not (Test-Path -Path $path) -or (Get-Item -Path $path).Length -lt $maxSizeMB * 1MB) { exit 0 }
+for ($i = $maxFiles - 1; $i -ge 1; $i--) {
+  if (Test-Path -Path "$path.$i") { Move-Item -Path "$path.$i" -Destination "$path.$($i + 1)" -Force }
+}
+Copy-Item -Path $path -Destination "$path.1" -Force
+Clear-Content -Path $path
+Get-ChildItem -Path "$path.*" | Where-Object { $_.Extension -match '^\.\d+$' -and [int]$_.Extension.Substring(1) -gt $maxFiles } | Remove-Item -Force
+`
+)
+
+// serviceLogPaths are the log files of the services whose logs can be rotated, keyed by service name
+var serviceLogPaths = map[string]string{
+	ContainerdServiceName:    ContainerdLogPath,
+	KubeletServiceName:       KubeletLog,
+	KubeProxyServiceName:     KubeProxyLog,
+	HybridOverlayServiceName: HybridOverlayLogDir + "\\hybrid-overlay.log",
+	"csi-proxy":              CSIProxyLog,
+}
+
+// logRotationTaskName returns the name of the scheduled task rotating the logs of the given service
+func logRotationTaskName(service string) string {
+	return ManagedTag + " " + service + " log rotation"
+}
+
+// logRotationArgs returns the powershell.exe arguments running the rotation script for the given log file. The script
+// is passed encoded, so that the arguments fully describe the rotation and do not need any quoting.
+func logRotationArgs(logPath string, maxSizeMB, maxFiles int) string {
+	script := fmt.Sprintf(logRotationScript, QuotePowerShellArg(logPath), maxSizeMB, maxFiles)
+	return "-NoProfile -NonInteractive -ExecutionPolicy Bypass -EncodedCommand " + encodePowerShellScript(script)
+}
+
+// encodePowerShellScript returns the given script encoded as expected by the -EncodedCommand powershell.exe argument:
+// the base64 encoding of the UTF-16LE encoded script
+func encodePowerShellScript(script string) string {
+	encoded := utf16.Encode([]rune(script))
+	scriptBytes := make([]byte, 2*len(encoded))
+	for i, c := range encoded {
+		binary.LittleEndian.PutUint16(scriptBytes[2*i:], c)
+	}
+	return base64.StdEncoding.EncodeToString(scriptBytes)
+}
+
+// logRotationArgsCmd returns the PowerShell command printing the arguments of the given scheduled task, nothing if the
+// task does not exist
+func logRotationArgsCmd(taskName string) string {
+	return fmt.Sprintf("$t = Get-ScheduledTask -TaskName %s -ErrorAction SilentlyContinue; if ($t) { $t.Actions[0].Arguments }",
+		QuotePowerShellArg(taskName))
+}
+
+// registerLogRotationCmd returns the PowerShell command creating or replacing the given scheduled task, running
+// powershell.exe with the given arguments as SYSTEM every logRotationInterval minutes
+func registerLogRotationCmd(taskName, args string) string {
+	return fmt.Sprintf("Register-ScheduledTask -TaskName %s "+
+		"-Action (New-ScheduledTaskAction -Execute 'powershell.exe' -Argument %s) "+
+		"-Trigger (New-ScheduledTaskTrigger -Once -At (Get-Date) -RepetitionInterval (New-TimeSpan -Minutes %d)) "+
+		"-User 'NT AUTHORITY\\SYSTEM' -RunLevel Highest -Force | Out-Null",
+		QuotePowerShellArg(taskName), QuotePowerShellArg(args), logRotationInterval)
+}
+
+func (vm *windows) EnsureLogRotation(service string, maxSizeMB, maxFiles int) error {
+	logPath, ok := serviceLogPaths[service]
+	if !ok {
+		return fmt.Errorf("log rotation is not supported for the %s service", service)
+	}
+	if maxSizeMB < 1 || maxFiles < 1 {
+		return fmt.Errorf("invalid log rotation for the %s service: maximum size %dMB and number of files %d must be "+
+			"at least 1", service, maxSizeMB, maxFiles)
+	}
+	taskName := logRotationTaskName(service)
+	args := logRotationArgs(logPath, maxSizeMB, maxFiles)
+	out, err := vm.Run(logRotationArgsCmd(taskName), true)
+	if err != nil {
+		return fmt.Errorf("error getting the log rotation task of the %s service: %w", service, err)
+	}
+	if strings.TrimSpace(out) == args {
+		// the rotation is already configured as expected
+		return nil
+	}
+	if out, err = vm.Run(registerLogRotationCmd(taskName, args), true); err != nil {
+		return fmt.Errorf("error registering the log rotation task of the %s service with output %s: %w", service, out,
+			err)
+	}
+	vm.log.Info("configured log rotation", "service", service, "maxSizeMB", maxSizeMB, "maxFiles", maxFiles)
+	return nil
+}
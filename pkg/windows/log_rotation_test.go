@@ -0,0 +1,84 @@
+package windows
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeLogRotationScript returns the script run by the given log rotation task arguments
+func decodeLogRotationScript(t *testing.T, args string) string {
+	encoded := args[strings.LastIndex(args, " ")+1:]
+	scriptBytes, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	require.Zero(t, len(scriptBytes)%2)
+	chars := make([]uint16, len(scriptBytes)/2)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(scriptBytes[2*i:])
+	}
+	return string(utf16.Decode(chars))
+}
+
+func TestEnsureLogRotation(t *testing.T) {
+	queryCmd := `$t = Get-ScheduledTask -TaskName 'OpenShift managed kubelet log rotation' -ErrorAction SilentlyContinue; ` +
+		`if ($t) { $t.Actions[0].Arguments }`
+	args := logRotationArgs(KubeletLog, 100, 5)
+	registerCmd := `Register-ScheduledTask -TaskName 'OpenShift managed kubelet log rotation' ` +
+		`-Action (New-ScheduledTaskAction -Execute 'powershell.exe' -Argument '` + args + `') ` +
+		`-Trigger (New-ScheduledTaskTrigger -Once -At (Get-Date) -RepetitionInterval (New-TimeSpan -Minutes 5)) ` +
+		`-User 'NT AUTHORITY\SYSTEM' -RunLevel Highest -Force | Out-Null`
+
+	conn := newFakeConnectivity("")
+	vm := &windows{interact: conn, log: logr.Discard(), defaultShellPowerShell: true}
+	require.NoError(t, vm.EnsureLogRotation(KubeletServiceName, 100, 5))
+	assert.Equal(t, []string{queryCmd, registerCmd}, conn.issued())
+
+	// the task now exists with the expected configuration, so it is not registered again
+	conn.respond(`^\$t = Get-ScheduledTask`, args+"\r\n", nil)
+	require.NoError(t, vm.EnsureLogRotation(KubeletServiceName, 100, 5))
+	assert.Equal(t, []string{queryCmd, registerCmd, queryCmd}, conn.issued())
+
+	// a different configuration replaces the task
+	require.NoError(t, vm.EnsureLogRotation(KubeletServiceName, 50, 5))
+	issued := conn.issued()
+	require.Len(t, issued, 5)
+	assert.Equal(t, queryCmd, issued[3])
+	assert.Contains(t, issued[4], "-Argument '"+logRotationArgs(KubeletLog, 50, 5)+"'")
+}
+
+func TestEnsureLogRotationValidation(t *testing.T) {
+	testCases := []struct {
+		name      string
+		service   string
+		maxSizeMB int
+		maxFiles  int
+	}{
+		{name: "unknown service", service: WicdServiceName, maxSizeMB: 100, maxFiles: 5},
+		{name: "no size", service: KubeletServiceName, maxSizeMB: 0, maxFiles: 5},
+		{name: "no files", service: KubeletServiceName, maxSizeMB: 100, maxFiles: 0},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			conn := newFakeConnectivity("")
+			vm := &windows{interact: conn, log: logr.Discard(), defaultShellPowerShell: true}
+			assert.Error(t, vm.EnsureLogRotation(test.service, test.maxSizeMB, test.maxFiles))
+			assert.Empty(t, conn.issued())
+		})
+	}
+}
+
+func TestLogRotationArgs(t *testing.T) {
+	args := logRotationArgs(KubeProxyLog, 100, 3)
+	assert.True(t, strings.HasPrefix(args, "-NoProfile -NonInteractive -ExecutionPolicy Bypass -EncodedCommand "))
+	// the arguments are single-quoted as a whole in the task registration, so they must not hold any quote
+	assert.NotContains(t, args, "'")
+	script := decodeLogRotationScript(t, args)
+	assert.True(t, strings.HasPrefix(script, `$path = 'C:\var\log\kube-proxy\kube-proxy.log'; $maxSizeMB = 100; `+
+		`$maxFiles = 3`+"\n"))
+}
@@ -0,0 +1,79 @@
+package windows
+
+import (
+	"strings"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+// KubeletClientCAFilename is the name of the CA certificate file required by kubelet to interact with the
+// kube-apiserver client
+const KubeletClientCAFilename = "kubelet-ca.crt"
+
+// Paths holds well-known locations on a Windows instance
+type Paths struct {
+	// K8sDir is the directory holding the kubernetes executables and configuration files
+	K8sDir string
+	// KubeletCACertPath is the location of the kubelet client CA certificate bundle
+	KubeletCACertPath string
+	// KubeletConfigPath is the location of the kubelet configuration file. Kubelet is started with the same arguments
+	// on every instance, so the file is not moved with the install directory.
+	KubeletConfigPath string
+	// CNIDir is the directory holding the CNI binaries
+	CNIDir string
+	// LogDir is the directory holding the logs of the services managed by WMCO
+	LogDir string
+}
+
+// NodePaths returns the locations used on the Windows instances configured by WMCO
+func NodePaths() Paths {
+	return newPaths(K8sDir, logDir)
+}
+
+// InstancePaths returns the locations used on the given Windows instance, rooted at its install directory. The
+// locations of NodePaths are returned for a nil instance.
+func InstancePaths(info *instance.Info) Paths {
+	if info == nil {
+		return NodePaths()
+	}
+	return newPaths(info.RemoteDir(instance.K8sDirKind), info.RemoteDir(instance.LogDirKind))
+}
+
+// newPaths returns the locations rooted at the given kubernetes and log directories
+func newPaths(k8sDir, logDir string) Paths {
+	return Paths{
+		K8sDir:            joinWindowsPath(k8sDir),
+		KubeletCACertPath: joinWindowsPath(k8sDir, KubeletClientCAFilename),
+		KubeletConfigPath: KubeletConfigPath,
+		CNIDir:            joinWindowsPath(k8sDir, "cni"),
+		LogDir:            joinWindowsPath(logDir),
+	}
+}
+
+// K8sFile returns the location of the file with the given name within K8sDir
+func (p Paths) K8sFile(name string) string {
+	return joinWindowsPath(p.K8sDir, name)
+}
+
+// joinWindowsPath joins the given path elements with backslashes, regardless of the OS the operator runs on. Forward
+// slashes are converted to backslashes, empty elements are ignored, and the separators around each element are
+// collapsed so that a single separator is left between them. The root of a drive, such as `C:\`, is preserved.
+func joinWindowsPath(elem ...string) string {
+	var parts []string
+	for _, e := range elem {
+		e = strings.ReplaceAll(e, "/", "\\")
+		if len(parts) > 0 {
+			e = strings.TrimLeft(e, "\\")
+		}
+		e = strings.TrimRight(e, "\\")
+		if e != "" {
+			parts = append(parts, e)
+		}
+	}
+	joined := strings.Join(parts, "\\")
+	// a bare drive letter refers to the current directory of the drive rather than its root
+	if len(joined) == 2 && joined[1] == ':' {
+		joined += "\\"
+	}
+	return joined
+}
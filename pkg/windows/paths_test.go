@@ -0,0 +1,99 @@
+package windows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+func TestJoinWindowsPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		elem     []string
+		expected string
+	}{
+		{
+			name:     "single element",
+			elem:     []string{"C:\\k"},
+			expected: "C:\\k",
+		},
+		{
+			name:     "directory and file",
+			elem:     []string{"C:\\k", "kubelet-ca.crt"},
+			expected: "C:\\k\\kubelet-ca.crt",
+		},
+		{
+			name:     "trailing separators",
+			elem:     []string{"C:\\k\\", "cni\\\\", "config"},
+			expected: "C:\\k\\cni\\config",
+		},
+		{
+			name:     "leading separators",
+			elem:     []string{"C:\\k", "\\cni"},
+			expected: "C:\\k\\cni",
+		},
+		{
+			name:     "forward slashes",
+			elem:     []string{"C:/var/log/", "kubelet/kubelet.log"},
+			expected: "C:\\var\\log\\kubelet\\kubelet.log",
+		},
+		{
+			name:     "empty elements",
+			elem:     []string{"", "C:\\k", "", "kubelet.exe"},
+			expected: "C:\\k\\kubelet.exe",
+		},
+		{
+			name:     "drive root",
+			elem:     []string{"C:\\"},
+			expected: "C:\\",
+		},
+		{
+			name:     "drive root and directory",
+			elem:     []string{"C:\\", "k"},
+			expected: "C:\\k",
+		},
+		{
+			name:     "nothing to join",
+			elem:     []string{},
+			expected: "",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, joinWindowsPath(test.elem...))
+		})
+	}
+}
+
+func TestNodePaths(t *testing.T) {
+	paths := NodePaths()
+	assert.Equal(t, "C:\\k", paths.K8sDir)
+	assert.Equal(t, "C:\\k\\kubelet-ca.crt", paths.KubeletCACertPath)
+	assert.Equal(t, "C:\\k\\cni", paths.CNIDir)
+	assert.Equal(t, "C:\\var\\log", paths.LogDir)
+	assert.Equal(t, "C:\\k\\cloud.conf", paths.K8sFile("cloud.conf"))
+	// the layout matches the constants used when configuring instances
+	assert.Equal(t, cniDir, paths.CNIDir)
+	assert.Equal(t, KubeletConfigPath, paths.K8sFile("kubelet.conf"))
+	assert.Equal(t, KubeletConfigPath, paths.KubeletConfigPath)
+
+	trailing := newPaths("D:\\kubernetes\\", "D:\\logs\\")
+	assert.Equal(t, "D:\\kubernetes", trailing.K8sDir)
+	assert.Equal(t, "D:\\kubernetes\\kubelet-ca.crt", trailing.KubeletCACertPath)
+	assert.Equal(t, "D:\\logs", trailing.LogDir)
+}
+
+func TestInstancePaths(t *testing.T) {
+	assert.Equal(t, NodePaths(), InstancePaths(nil))
+	assert.Equal(t, NodePaths(), InstancePaths(&instance.Info{}))
+
+	paths := InstancePaths(&instance.Info{InstallDir: "D:\\kubernetes"})
+	assert.Equal(t, "D:\\kubernetes", paths.K8sDir)
+	assert.Equal(t, "D:\\kubernetes\\kubelet-ca.crt", paths.KubeletCACertPath)
+	assert.Equal(t, "D:\\kubernetes\\cni", paths.CNIDir)
+	assert.Equal(t, "C:\\var\\log", paths.LogDir)
+	// kubelet is started with the same config argument on every instance
+	assert.Equal(t, KubeletConfigPath, paths.KubeletConfigPath)
+}
@@ -0,0 +1,66 @@
+package windows
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pendingRebootIndicators are the registry keys Windows uses to queue a reboot, keyed by the name printed by
+// pendingRebootCmd when they exist. The PendingFileRenameOperations value is not an indicator, as antivirus software
+// and installers routinely set it without the instance needing a reboot.
+var pendingRebootIndicators = map[string]string{
+	// set by the component based servicing stack while an update waits for a reboot to complete
+	"RebootPending": `HKLM:\SOFTWARE\Microsoft\Windows\CurrentVersion\Component Based Servicing\RebootPending`,
+	// set by Windows Update once an update has been installed
+	"RebootRequired": `HKLM:\SOFTWARE\Microsoft\Windows\CurrentVersion\WindowsUpdate\Auto Update\RebootRequired`,
+}
+
+// pendingRebootCmd returns the command printing the name of each set pending reboot indicator, one per line. The
+// command is run through powershell.exe, so that it can be run regardless of the default shell of the instance.
+func pendingRebootCmd() string {
+	return formatRemotePowerShellCommand(fmt.Sprintf(
+		"if (Test-Path -Path %s) { 'RebootPending' }; if (Test-Path -Path %s) { 'RebootRequired' }",
+		QuotePowerShellArg(pendingRebootIndicators["RebootPending"]),
+		QuotePowerShellArg(pendingRebootIndicators["RebootRequired"])))
+}
+
+// pendingRebootReasons returns the pending reboot indicators set on the instance reached through the given connection
+func pendingRebootReasons(conn connectivity) ([]string, error) {
+	out, err := conn.run(pendingRebootCmd())
+	if err != nil {
+		return nil, fmt.Errorf("error checking for a pending reboot, with output %s: %w", out, err)
+	}
+	var reasons []string
+	for _, line := range strings.Split(out, "\n") {
+		reason := strings.TrimSpace(line)
+		if reason == "" {
+			continue
+		}
+		if _, known := pendingRebootIndicators[reason]; !known {
+			return nil, fmt.Errorf("unexpected output checking for a pending reboot: %s", out)
+		}
+		reasons = append(reasons, reason)
+	}
+	return reasons, nil
+}
+
+// PendingRebootRequired returns true if a reboot is queued on the instance reached through the given connection, as is
+// the case after some OS updates. Services may fail to be installed until the instance is rebooted.
+func PendingRebootRequired(conn connectivity) (bool, error) {
+	reasons, err := pendingRebootReasons(conn)
+	if err != nil {
+		return false, err
+	}
+	return len(reasons) > 0, nil
+}
+
+func (vm *windows) PendingRebootRequired() (bool, error) {
+	reasons, err := pendingRebootReasons(vm.interact)
+	if err != nil {
+		return false, err
+	}
+	if len(reasons) > 0 {
+		vm.log.Info("reboot pending", "reasons", reasons)
+	}
+	return len(reasons) > 0, nil
+}
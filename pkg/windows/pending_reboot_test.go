@@ -0,0 +1,90 @@
+package windows
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingRebootCmd(t *testing.T) {
+	assert.Equal(t, `powershell.exe -NonInteractive -ExecutionPolicy Bypass "`+
+		`if (Test-Path -Path 'HKLM:\SOFTWARE\Microsoft\Windows\CurrentVersion\Component Based Servicing\RebootPending') `+
+		`{ 'RebootPending' }; `+
+		`if (Test-Path -Path 'HKLM:\SOFTWARE\Microsoft\Windows\CurrentVersion\WindowsUpdate\Auto Update\RebootRequired') `+
+		`{ 'RebootRequired' }"`, pendingRebootCmd())
+	assert.NotContains(t, pendingRebootCmd(), "$", "variables would be expanded by a PowerShell default shell")
+}
+
+func TestPendingRebootRequired(t *testing.T) {
+	testCases := []struct {
+		name            string
+		out             string
+		err             error
+		expected        bool
+		expectedReasons []string
+		expectedErr     bool
+	}{
+		{
+			name: "no reboot pending",
+			out:  "\r\n",
+		},
+		{
+			name:            "component based servicing reboot pending",
+			out:             "RebootPending\r\n",
+			expected:        true,
+			expectedReasons: []string{"RebootPending"},
+		},
+		{
+			name:            "windows update reboot required",
+			out:             "RebootRequired\r\n",
+			expected:        true,
+			expectedReasons: []string{"RebootRequired"},
+		},
+		{
+			name:            "all indicators set",
+			out:             "RebootPending\r\nRebootRequired\r\n",
+			expected:        true,
+			expectedReasons: []string{"RebootPending", "RebootRequired"},
+		},
+		{
+			name:        "pending file rename operations are not an indicator",
+			out:         "PendingFileRenameOperations\r\n",
+			expectedErr: true,
+		},
+		{
+			name:        "unexpected output",
+			out:         "Test-Path : Access is denied\r\n",
+			expectedErr: true,
+		},
+		{
+			name:        "command failure",
+			err:         errors.New("connection lost"),
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			conn := newFakeConnectivity("").respond("RebootRequired", test.out, test.err)
+			required, err := PendingRebootRequired(conn)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, required)
+			assert.Equal(t, []string{pendingRebootCmd()}, conn.issued())
+
+			reasons, err := pendingRebootReasons(conn)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedReasons, reasons)
+
+			vm := &windows{interact: conn, log: logr.Discard()}
+			required, err = vm.PendingRebootRequired()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, required)
+		})
+	}
+}
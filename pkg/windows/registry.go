@@ -0,0 +1,230 @@
+package windows
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RegistryHive is a root key of the Windows registry, as named by the PowerShell registry drives
+type RegistryHive string
+
+const (
+	// HKLM is the HKEY_LOCAL_MACHINE hive
+	HKLM RegistryHive = "HKLM"
+	// HKCU is the HKEY_CURRENT_USER hive, of the user connected to the instance
+	HKCU RegistryHive = "HKCU"
+)
+
+// RegistryValueKind is the type of a registry value, as named by PowerShell
+type RegistryValueKind string
+
+const (
+	// RegistryString is a string value
+	RegistryString RegistryValueKind = "String"
+	// RegistryExpandString is a string value holding unexpanded references to environment variables
+	RegistryExpandString RegistryValueKind = "ExpandString"
+	// RegistryDWord is a 32-bit number value
+	RegistryDWord RegistryValueKind = "DWord"
+	// RegistryQWord is a 64-bit number value
+	RegistryQWord RegistryValueKind = "QWord"
+	// RegistryMultiString is a list of strings value
+	RegistryMultiString RegistryValueKind = "MultiString"
+)
+
+// redactedRegistryValue replaces the values of sensitive registry values in logs
+const redactedRegistryValue = "<redacted>"
+
+// sensitiveRegistryPatterns match the paths and names of registry values which must not be logged
+var sensitiveRegistryPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)passw(or)?d`),
+	regexp.MustCompile(`(?i)secret`),
+	regexp.MustCompile(`(?i)token`),
+	regexp.MustCompile(`(?i)credential`),
+	// proxy settings may hold user credentials
+	regexp.MustCompile(`(?i)proxy`),
+}
+
+const (
+	// getRegistryValueScript is the PowerShell script printing the kind and the data of a registry value as JSON, or
+	// nothing if the value does not exist. It is formatted with the quoted path of the key and the quoted value name.
+	// Environment variables referenced by ExpandString values are not expanded.
+	getRegistryValueScript = `$key = Get-Item -LiteralPath %[1]s -ErrorAction SilentlyContinue
+if (-not $key -or $key.GetValueNames() -notcontains %[2]s) { exit 0 }
+ConvertTo-Json -Compress -InputObject @{Kind = $key.GetValueKind(%[2]s).ToString(); Value = $key.GetValue(%[2]s, $null, 'DoNotExpandEnvironmentNames')}
+`
+	// setRegistryValueScript is the PowerShell script creating or replacing a registry value, creating its key if
+	// needed. It is formatted with the quoted path of the key, the quoted value name, the value and its kind.
+	setRegistryValueScript = `if (-not (Test-Path -LiteralPath %[1]s)) { New-Item -Path %[1]s -Force | Out-Null }
+New-ItemProperty -LiteralPath %[1]s -Name %[2]s -Value %[3]s -PropertyType %[4]s -Force | Out-Null
+`
+)
+
+// RegistryValue is the typed data of a registry value
+type RegistryValue struct {
+	// Kind is the type of the value, telling which of the other fields holds its data
+	Kind RegistryValueKind
+	// String is the data of String and ExpandString values
+	String string
+	// Number is the data of DWord and QWord values
+	Number uint64
+	// Strings is the data of MultiString values
+	Strings []string
+}
+
+// data returns the data of the value formatted as a string
+func (v *RegistryValue) data() string {
+	switch v.Kind {
+	case RegistryDWord, RegistryQWord:
+		return strconv.FormatUint(v.Number, 10)
+	case RegistryMultiString:
+		return strings.Join(v.Strings, ",")
+	default:
+		return v.String
+	}
+}
+
+// powerShellLiteral returns the value as a PowerShell literal of the type expected for its kind
+func (v *RegistryValue) powerShellLiteral() (string, error) {
+	switch v.Kind {
+	case RegistryString, RegistryExpandString:
+		return QuotePowerShellArg(v.String), nil
+	case RegistryDWord:
+		if v.Number > 0xFFFFFFFF {
+			return "", fmt.Errorf("value %d does not fit in a %s", v.Number, v.Kind)
+		}
+		// hexadecimal literals are signed, so that values over the maximum int32 are converted to a DWord as is
+		return fmt.Sprintf("0x%08X", v.Number), nil
+	case RegistryQWord:
+		return fmt.Sprintf("0x%016X", v.Number), nil
+	case RegistryMultiString:
+		quoted := make([]string, 0, len(v.Strings))
+		for _, s := range v.Strings {
+			quoted = append(quoted, QuotePowerShellArg(s))
+		}
+		return "([string[]]@(" + strings.Join(quoted, ",") + "))", nil
+	default:
+		return "", fmt.Errorf("unsupported registry value kind %q", v.Kind)
+	}
+}
+
+// registryKeyPath returns the PowerShell path of the given registry key
+func registryKeyPath(hive RegistryHive, path string) (string, error) {
+	if hive != HKLM && hive != HKCU {
+		return "", fmt.Errorf("unsupported registry hive %q", hive)
+	}
+	return string(hive) + `:\` + strings.Trim(path, `\`), nil
+}
+
+// registryValueCmd returns the command running the given registry script through powershell.exe. The script is passed
+// encoded, so that it can be run regardless of the default shell of the instance without any quoting.
+func registryValueCmd(script string) string {
+	return "powershell.exe -NoProfile -NonInteractive -ExecutionPolicy Bypass -EncodedCommand " +
+		encodePowerShellScript(script)
+}
+
+// GetRegistryValue returns the value with the given name of the given registry key, on the instance reached through
+// the given connection. Returns an error wrapping os.ErrNotExist if the key or the value does not exist.
+func GetRegistryValue(conn connectivity, hive RegistryHive, path, name string) (*RegistryValue, error) {
+	keyPath, err := registryKeyPath(hive, path)
+	if err != nil {
+		return nil, err
+	}
+	out, err := conn.run(registryValueCmd(fmt.Sprintf(getRegistryValueScript, QuotePowerShellArg(keyPath),
+		QuotePowerShellArg(name))))
+	if err != nil {
+		// the output is not included in the error, as it may hold the value
+		return nil, fmt.Errorf("error getting registry value %s of %s: %w", name, keyPath, err)
+	}
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return nil, fmt.Errorf("registry value %s of %s not found: %w", name, keyPath, os.ErrNotExist)
+	}
+	return parseRegistryValue(out)
+}
+
+// parseRegistryValue parses the JSON output of the script getting a registry value
+func parseRegistryValue(out string) (*RegistryValue, error) {
+	var raw struct {
+		Kind  RegistryValueKind `json:"Kind"`
+		Value json.RawMessage   `json:"Value"`
+	}
+	if err := json.Unmarshal([]byte(out), &raw); err != nil {
+		return nil, fmt.Errorf("unexpected output getting registry value: %w", err)
+	}
+	value := &RegistryValue{Kind: raw.Kind}
+	var err error
+	switch raw.Kind {
+	case RegistryString, RegistryExpandString:
+		err = json.Unmarshal(raw.Value, &value.String)
+	case RegistryDWord, RegistryQWord:
+		// PowerShell returns the numbers as signed integers
+		var number int64
+		if err = json.Unmarshal(raw.Value, &number); err == nil {
+			value.Number = uint64(number)
+			if raw.Kind == RegistryDWord {
+				value.Number = uint64(uint32(number))
+			}
+		}
+	case RegistryMultiString:
+		err = json.Unmarshal(raw.Value, &value.Strings)
+	default:
+		return nil, fmt.Errorf("unsupported registry value kind %q", raw.Kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %s registry value: %w", raw.Kind, err)
+	}
+	return value, nil
+}
+
+// SetRegistryValue creates or replaces the value with the given name of the given registry key, on the instance
+// reached through the given connection. The key is created if it does not exist.
+func SetRegistryValue(conn connectivity, hive RegistryHive, path, name string, value RegistryValue) error {
+	keyPath, err := registryKeyPath(hive, path)
+	if err != nil {
+		return err
+	}
+	literal, err := value.powerShellLiteral()
+	if err != nil {
+		return fmt.Errorf("invalid registry value %s of %s: %w", name, keyPath, err)
+	}
+	out, err := conn.run(registryValueCmd(fmt.Sprintf(setRegistryValueScript, QuotePowerShellArg(keyPath),
+		QuotePowerShellArg(name), literal, value.Kind)))
+	if err != nil {
+		return fmt.Errorf("error setting registry value %s of %s, with output %s: %w", name, keyPath, out, err)
+	}
+	return nil
+}
+
+// redactRegistryValue returns the data of the given registry value as a string, unless the path or name of the value
+// matches a sensitive pattern
+func redactRegistryValue(path, name string, value *RegistryValue) string {
+	for _, pattern := range sensitiveRegistryPatterns {
+		if pattern.MatchString(path) || pattern.MatchString(name) {
+			return redactedRegistryValue
+		}
+	}
+	return value.data()
+}
+
+func (vm *windows) GetRegistryValue(hive RegistryHive, path, name string) (*RegistryValue, error) {
+	value, err := GetRegistryValue(vm.interact, hive, path, name)
+	if err != nil {
+		return nil, err
+	}
+	vm.log.V(1).Info("got registry value", "hive", hive, "path", path, "name", name, "kind", value.Kind,
+		"value", redactRegistryValue(path, name, value))
+	return value, nil
+}
+
+func (vm *windows) SetRegistryValue(hive RegistryHive, path, name string, value RegistryValue) error {
+	if err := SetRegistryValue(vm.interact, hive, path, name, value); err != nil {
+		return err
+	}
+	vm.log.V(1).Info("set registry value", "hive", hive, "path", path, "name", name, "kind", value.Kind,
+		"value", redactRegistryValue(path, name, &value))
+	return nil
+}
@@ -0,0 +1,195 @@
+package windows
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ServiceState is the state of a Windows service, as reported by Get-Service
+type ServiceState string
+
+const (
+	// ServiceNotFound is the state of a service which does not exist
+	ServiceNotFound ServiceState = "NotFound"
+	// ServiceStopped is the state of a service which is not running
+	ServiceStopped ServiceState = "Stopped"
+	// ServiceStartPending is the state of a service which is starting
+	ServiceStartPending ServiceState = "StartPending"
+	// ServiceStopPending is the state of a service which is stopping
+	ServiceStopPending ServiceState = "StopPending"
+	// ServiceRunning is the state of a service which is running
+	ServiceRunning ServiceState = "Running"
+	// ServiceContinuePending is the state of a paused service which is resuming
+	ServiceContinuePending ServiceState = "ContinuePending"
+	// ServicePausePending is the state of a service which is pausing
+	ServicePausePending ServiceState = "PausePending"
+	// ServicePaused is the state of a paused service
+	ServicePaused ServiceState = "Paused"
+)
+
+// serviceStates are the states a service can be reported in
+var serviceStates = []ServiceState{ServiceNotFound, ServiceStopped, ServiceStartPending, ServiceStopPending,
+	ServiceRunning, ServiceContinuePending, ServicePausePending, ServicePaused}
+
+// ServiceManager manages the Windows services of an instance through PowerShell commands
+type ServiceManager interface {
+	// Ensure ensures the service with the given name exists, running the given binary with the given arguments and
+	// depending on the given services. An existing service whose binary path differs is updated. The dependencies of an
+	// existing service are not changed.
+	Ensure(name, binPath, args string, dependencies []string) error
+	// Start starts the given service. Starting a running service is a no-op.
+	Start(name string) error
+	// Stop requests the given service, and the services depending on it, to stop without waiting for them to be
+	// stopped. Stopping a stopped service is a no-op.
+	Stop(name string) error
+	// Kill force-kills the process of the given service
+	Kill(name string) error
+	// Status returns the state of the given service, ServiceNotFound if it does not exist
+	Status(name string) (ServiceState, error)
+	// Remove stops and deletes the given service. Removing a service which does not exist is a no-op.
+	Remove(name string) error
+}
+
+// serviceManager implements ServiceManager, running commands through the connection of a windows instance
+type serviceManager struct {
+	vm *windows
+}
+
+// ServiceManager returns a ServiceManager for the services of the Windows VM
+func (vm *windows) ServiceManager() ServiceManager {
+	return &serviceManager{vm: vm}
+}
+
+// serviceBinaryPath returns the binary path of a service running the given binary with the given arguments
+func serviceBinaryPath(binPath, args string) string {
+	return strings.TrimSpace(binPath + " " + args)
+}
+
+// newServiceCmd returns the PowerShell command creating the given service, started automatically on boot
+func newServiceCmd(name, binaryPath string, dependencies []string) string {
+	cmd := fmt.Sprintf("New-Service -Name %s -BinaryPathName %s -StartupType Automatic -Description %s",
+		QuotePowerShellArg(name), QuotePowerShellArg(binaryPath), QuotePowerShellArg(ManagedTag+" "+name))
+	if len(dependencies) > 0 {
+		quoted := make([]string, 0, len(dependencies))
+		for _, dependency := range dependencies {
+			quoted = append(quoted, QuotePowerShellArg(dependency))
+		}
+		cmd += " -DependsOn " + strings.Join(quoted, ",")
+	}
+	return cmd
+}
+
+// serviceBinaryPathCmd returns the PowerShell command printing the binary path of the given service
+func serviceBinaryPathCmd(name string) string {
+	return fmt.Sprintf("(Get-CimInstance -ClassName Win32_Service -Filter %s).PathName",
+		QuotePowerShellArg("Name='"+name+"'"))
+}
+
+// setServiceBinaryPathCmd returns the PowerShell command changing the binary path of the given service. sc.exe is used
+// as Set-Service cannot change the binary path of a service in Windows PowerShell.
+func setServiceBinaryPathCmd(name, binaryPath string) string {
+	return fmt.Sprintf("sc.exe config %s binPath= %s", QuotePowerShellArg(name), QuotePowerShellArg(binaryPath))
+}
+
+// serviceStatusCmd returns the PowerShell command printing the state of the given service, or ServiceNotFound
+func serviceStatusCmd(name string) string {
+	return fmt.Sprintf("$s = Get-Service -Name %s -ErrorAction SilentlyContinue; if ($s) { $s.Status } else { '%s' }",
+		QuotePowerShellArg(name), ServiceNotFound)
+}
+
+// serviceKillCmd returns the PowerShell command force-killing the process of the given service
+func serviceKillCmd(name string) string {
+	return fmt.Sprintf("Stop-Process -Force -Id (Get-CimInstance -ClassName Win32_Service -Filter %s).ProcessId",
+		QuotePowerShellArg("Name='"+name+"'"))
+}
+
+// parseServiceState returns the ServiceState printed by a service status command
+func parseServiceState(out string) (ServiceState, error) {
+	state := ServiceState(strings.TrimSpace(out))
+	for _, known := range serviceStates {
+		if state == known {
+			return state, nil
+		}
+	}
+	return "", fmt.Errorf("unknown service state %q", out)
+}
+
+func (m *serviceManager) Ensure(name, binPath, args string, dependencies []string) error {
+	if name == "" || binPath == "" {
+		return fmt.Errorf("service name and binary path cannot be empty")
+	}
+	state, err := m.Status(name)
+	if err != nil {
+		return err
+	}
+	binaryPath := serviceBinaryPath(binPath, args)
+	if state == ServiceNotFound {
+		if out, err := m.vm.Run(newServiceCmd(name, binaryPath, dependencies), true); err != nil {
+			return fmt.Errorf("error creating %s service with output %s: %w", name, out, err)
+		}
+		return nil
+	}
+	out, err := m.vm.Run(serviceBinaryPathCmd(name), true)
+	if err != nil {
+		return fmt.Errorf("error getting the binary path of the %s service: %w", name, err)
+	}
+	if strings.TrimSpace(out) == binaryPath {
+		return nil
+	}
+	m.vm.log.Info("updating binary path", "service", name, "current", strings.TrimSpace(out), "expected", binaryPath)
+	if out, err = m.vm.Run(setServiceBinaryPathCmd(name, binaryPath), true); err != nil {
+		return fmt.Errorf("error updating the binary path of the %s service with output %s: %w", name, out, err)
+	}
+	return nil
+}
+
+func (m *serviceManager) Start(name string) error {
+	if out, err := m.vm.Run("Start-Service -Name "+QuotePowerShellArg(name), true); err != nil {
+		return fmt.Errorf("error starting %s service with output %s: %w", name, out, err)
+	}
+	return nil
+}
+
+func (m *serviceManager) Stop(name string) error {
+	if out, err := m.vm.Run("Stop-Service -Name "+QuotePowerShellArg(name)+" -Force -NoWait", true); err != nil {
+		return fmt.Errorf("error stopping %s service with output %s: %w", name, out, err)
+	}
+	return nil
+}
+
+func (m *serviceManager) Kill(name string) error {
+	if out, err := m.vm.Run(serviceKillCmd(name), true); err != nil {
+		return fmt.Errorf("error killing the process of the %s service with output %s: %w", name, out, err)
+	}
+	return nil
+}
+
+func (m *serviceManager) Status(name string) (ServiceState, error) {
+	out, err := m.vm.Run(serviceStatusCmd(name), true)
+	if err != nil {
+		return "", fmt.Errorf("error getting the status of the %s service: %w", name, err)
+	}
+	state, err := parseServiceState(out)
+	if err != nil {
+		return "", fmt.Errorf("error getting the status of the %s service: %w", name, err)
+	}
+	return state, nil
+}
+
+func (m *serviceManager) Remove(name string) error {
+	state, err := m.Status(name)
+	if err != nil {
+		return err
+	}
+	if state == ServiceNotFound {
+		return nil
+	}
+	if err = m.Stop(name); err != nil {
+		return err
+	}
+	// Remove-Service is not available in Windows PowerShell
+	if out, err := m.vm.Run("sc.exe delete "+QuotePowerShellArg(name), true); err != nil {
+		return fmt.Errorf("error deleting %s service with output %s: %w", name, out, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package windows
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	kubeletStatusCmd = `$s = Get-Service -Name 'kubelet' -ErrorAction SilentlyContinue; if ($s) { $s.Status } else { 'NotFound' }`
+	kubeletPathCmd   = `(Get-CimInstance -ClassName Win32_Service -Filter 'Name=''kubelet''').PathName`
+)
+
+func TestServiceManagerEnsure(t *testing.T) {
+	testCases := []struct {
+		name             string
+		conn             *fakeConnectivity
+		dependencies     []string
+		expectedCommands []string
+		expectedErr      bool
+	}{
+		{
+			name:         "missing service",
+			conn:         newFakeConnectivity("").respond(`Get-Service`, "NotFound\r\n", nil),
+			dependencies: []string{"containerd", "hybrid-overlay-node"},
+			expectedCommands: []string{kubeletStatusCmd,
+				`New-Service -Name 'kubelet' -BinaryPathName 'C:\k\kubelet.exe --v=2' -StartupType Automatic ` +
+					`-Description 'OpenShift managed kubelet' -DependsOn 'containerd','hybrid-overlay-node'`},
+		},
+		{
+			name: "up to date service",
+			conn: newFakeConnectivity("").
+				respond(`Get-Service`, "Running\r\n", nil).
+				respond(`Get-CimInstance`, "C:\\k\\kubelet.exe --v=2\r\n", nil),
+			expectedCommands: []string{kubeletStatusCmd, kubeletPathCmd},
+		},
+		{
+			name: "binary path drifted",
+			conn: newFakeConnectivity("").
+				respond(`Get-Service`, "Stopped", nil).
+				respond(`Get-CimInstance`, "C:\\k\\kubelet.exe --v=4", nil),
+			expectedCommands: []string{kubeletStatusCmd, kubeletPathCmd,
+				`sc.exe config 'kubelet' binPath= 'C:\k\kubelet.exe --v=2'`},
+		},
+		{
+			name:             "unknown state",
+			conn:             newFakeConnectivity("").respond(`Get-Service`, "Get-Service : access denied", nil),
+			expectedCommands: []string{kubeletStatusCmd},
+			expectedErr:      true,
+		},
+		{
+			name: "creation failure",
+			conn: newFakeConnectivity("").
+				respond(`Get-Service`, "NotFound", nil).
+				respond(`New-Service`, "", fmt.Errorf("exit status 1")),
+			expectedCommands: []string{kubeletStatusCmd,
+				`New-Service -Name 'kubelet' -BinaryPathName 'C:\k\kubelet.exe --v=2' -StartupType Automatic ` +
+					`-Description 'OpenShift managed kubelet'`},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			vm := &windows{interact: test.conn, log: logr.Discard(), defaultShellPowerShell: true}
+			err := vm.ServiceManager().Ensure("kubelet", "C:\\k\\kubelet.exe", "--v=2", test.dependencies)
+			assert.Equal(t, test.expectedCommands, test.conn.issued())
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestServiceManagerStatus(t *testing.T) {
+	testCases := []struct {
+		out           string
+		expectedState ServiceState
+		expectedErr   bool
+	}{
+		{out: "Running\r\n", expectedState: ServiceRunning},
+		{out: "Stopped", expectedState: ServiceStopped},
+		{out: "StopPending\n", expectedState: ServiceStopPending},
+		{out: "NotFound", expectedState: ServiceNotFound},
+		{out: "", expectedErr: true},
+		{out: "running", expectedErr: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.out, func(t *testing.T) {
+			conn := newFakeConnectivity(test.out)
+			vm := &windows{interact: conn, log: logr.Discard(), defaultShellPowerShell: true}
+			state, err := vm.ServiceManager().Status("kubelet")
+			assert.Equal(t, []string{kubeletStatusCmd}, conn.issued())
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedState, state)
+		})
+	}
+}
+
+func TestServiceManagerRemove(t *testing.T) {
+	testCases := []struct {
+		name             string
+		state            string
+		expectedCommands []string
+	}{
+		{
+			name:             "missing service",
+			state:            "NotFound",
+			expectedCommands: []string{kubeletStatusCmd},
+		},
+		{
+			name:  "running service",
+			state: "Running",
+			expectedCommands: []string{kubeletStatusCmd, `Stop-Service -Name 'kubelet' -Force -NoWait`,
+				`sc.exe delete 'kubelet'`},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			conn := newFakeConnectivity("").respond(`Get-Service`, test.state, nil)
+			vm := &windows{interact: conn, log: logr.Discard(), defaultShellPowerShell: true}
+			require.NoError(t, vm.ServiceManager().Remove("kubelet"))
+			assert.Equal(t, test.expectedCommands, conn.issued())
+		})
+	}
+}
+
+func TestServiceManagerCommandsFromCmd(t *testing.T) {
+	// commands are wrapped to be run through PowerShell when it is not the default shell
+	conn := newFakeConnectivity("")
+	vm := &windows{interact: conn, log: logr.Discard()}
+	require.NoError(t, vm.ServiceManager().Start("kube-proxy"))
+	assert.Equal(t, []string{`powershell.exe -NonInteractive -ExecutionPolicy Bypass "Start-Service -Name 'kube-proxy'"`},
+		conn.issued())
+}
+
+func TestServiceManagerKill(t *testing.T) {
+	conn := newFakeConnectivity("")
+	vm := &windows{interact: conn, log: logr.Discard(), defaultShellPowerShell: true}
+	require.NoError(t, vm.ServiceManager().Kill("kubelet"))
+	assert.Equal(t, []string{`Stop-Process -Force -Id ` +
+		`(Get-CimInstance -ClassName Win32_Service -Filter 'Name=''kubelet''').ProcessId`}, conn.issued())
+}
@@ -0,0 +1,156 @@
+package windows
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/crypto/ssh"
+	"k8s.io/utils/clock"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/hostport"
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+)
+
+const (
+	// winRMPort is the port of the WinRM HTTPS listener
+	winRMPort = "5986"
+	// probeTimeout is the time allowed to open a TCP connection to a port when probing it, much shorter than the SSH
+	// dial timeout so that a firewalled port is detected quickly
+	probeTimeout = 5 * time.Second
+	// transportTTL is the time the transport selected for a host is remembered
+	transportTTL = 10 * time.Minute
+)
+
+// transport is a medium used to interact with a Windows instance
+type transport string
+
+const (
+	// transportSSH interacts with the instance over SSH and SFTP
+	transportSSH transport = "SSH"
+	// transportWinRM interacts with the instance over WinRM
+	transportWinRM transport = "WinRM"
+)
+
+// transportSelector picks the transport used to reach each host, remembering hosts reachable over SSH for transportTTL
+// so that they are not probed on every connection
+type transportSelector struct {
+	// mu synchronizes access to decisions and inFlight. It is not held while probing, so that probing a host does not
+	// delay the connections to other hosts.
+	mu sync.Mutex
+	// decisions maps the SSH address of a host to the transport it was found reachable with. Only SSH decisions are
+	// stored, see selectTransport.
+	decisions map[string]transportDecision
+	// inFlight maps the SSH address of a host to the probe of the host in progress, if any
+	inFlight map[string]*probeCall
+	// probe returns an error if a TCP connection cannot be opened to the given address within the given timeout
+	probe func(address string, timeout time.Duration) error
+	clock clock.PassiveClock
+}
+
+// transportDecision is the transport a host was found reachable with
+type transportDecision struct {
+	transport transport
+	// decidedAt is the time the host was probed
+	decidedAt time.Time
+}
+
+// probeCall is a probe of a host in progress, whose result is shared by all the callers selecting the transport of the
+// host meanwhile
+type probeCall struct {
+	// done is closed once the probe is complete
+	done      chan struct{}
+	transport transport
+	err       error
+}
+
+// defaultTransportSelector is the transportSelector shared by all instances
+var defaultTransportSelector = newTransportSelector(probeTCP, clock.RealClock{})
+
+// newTransportSelector returns a transportSelector which uses the given function to probe ports, and the given clock
+// to expire its decisions
+func newTransportSelector(probe func(string, time.Duration) error, clock clock.PassiveClock) *transportSelector {
+	return &transportSelector{decisions: make(map[string]transportDecision), inFlight: make(map[string]*probeCall),
+		probe: probe, clock: clock}
+}
+
+// probeTCP returns an error if a TCP connection cannot be opened to the given address within the given timeout
+func probeTCP(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// selectTransport returns the transport to use for the given host, probing the given SSH port first and then the
+// WinRM port. Only hosts found reachable over SSH are remembered: WinRM often answers before sshd is started on a
+// booting instance, so such an instance is probed again. Decisions are forgotten after transportTTL, as the address of
+// a deleted instance may be reused by another one. Concurrent selections for the same host share a single probe.
+func (s *transportSelector) selectTransport(host, port string) (transport, error) {
+	sshPort, err := validateSSHPort(port)
+	if err != nil {
+		return "", err
+	}
+	sshAddress := hostport.Join(host, sshPort)
+
+	s.mu.Lock()
+	if decision, ok := s.decisions[sshAddress]; ok && s.clock.Since(decision.decidedAt) < transportTTL {
+		s.mu.Unlock()
+		return decision.transport, nil
+	}
+	if call, ok := s.inFlight[sshAddress]; ok {
+		s.mu.Unlock()
+		<-call.done
+		return call.transport, call.err
+	}
+	call := &probeCall{done: make(chan struct{})}
+	s.inFlight[sshAddress] = call
+	s.mu.Unlock()
+
+	call.transport, call.err = s.probeHost(host, sshPort)
+
+	s.mu.Lock()
+	delete(s.inFlight, sshAddress)
+	if call.err == nil && call.transport == transportSSH {
+		s.decisions[sshAddress] = transportDecision{transport: call.transport, decidedAt: s.clock.Now()}
+	}
+	s.mu.Unlock()
+	close(call.done)
+	return call.transport, call.err
+}
+
+// probeHost returns the first transport reachable on the given host, probing the given SSH port and then the WinRM
+// port. Returns an error listing both failed probes if none is reachable.
+func (s *transportSelector) probeHost(host, sshPort string) (transport, error) {
+	sshErr := s.probe(hostport.Join(host, sshPort), probeTimeout)
+	if sshErr == nil {
+		return transportSSH, nil
+	}
+	winRMErr := s.probe(hostport.Join(host, winRMPort), probeTimeout)
+	if winRMErr == nil {
+		return transportWinRM, nil
+	}
+	return "", fmt.Errorf("no transport reachable on %s: %s port %s: %v, %s port %s: %v", host, transportSSH, sshPort,
+		sshErr, transportWinRM, winRMPort, winRMErr)
+}
+
+// newConnectivity returns the SSH connectivity for the given instance, configured with the given options and the SSH
+// port of the instance. SSH is dialed with the retry configuration of the options when it is not reachable yet,
+// including when only WinRM is, as the instance may still be booting and WinRM is not supported to interact with
+// instances. No transport is probed when a bastion is used, as the instance is only reachable through it.
+func newConnectivity(instanceInfo *instance.Info, signer ssh.Signer, opts sshOptions,
+	log logr.Logger) (connectivity, error) {
+	opts.port = instanceInfo.SSHPort
+	if opts.bastion == nil {
+		t, err := defaultTransportSelector.selectTransport(instanceInfo.Address, instanceInfo.SSHPort)
+		if err != nil {
+			log.V(1).Info("no transport reachable yet, dialing SSH", "error", err.Error())
+		} else if t != transportSSH {
+			log.V(1).Info("SSH not reachable yet, dialing SSH", "reachable", t)
+		}
+	}
+	return newSshConnectivity(instanceInfo.Username, instanceInfo.Address, signer, opts, log)
+}
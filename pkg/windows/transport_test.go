@@ -0,0 +1,189 @@
+package windows
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/clock"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestSelectTransport(t *testing.T) {
+	testCases := []struct {
+		name      string
+		port      string
+		reachable map[string]bool
+		expected  transport
+		// notCached is set if the decision is not remembered
+		notCached bool
+		expectErr bool
+	}{
+		{
+			name:      "SSH reachable",
+			reachable: map[string]bool{"10.0.0.1:22": true, "10.0.0.1:5986": true},
+			expected:  transportSSH,
+		},
+		{
+			name:      "SSH reachable on custom port",
+			port:      "2222",
+			reachable: map[string]bool{"10.0.0.1:2222": true},
+			expected:  transportSSH,
+		},
+		{
+			name:      "only WinRM reachable",
+			reachable: map[string]bool{"10.0.0.1:5986": true},
+			expected:  transportWinRM,
+			notCached: true,
+		},
+		{
+			name:      "nothing reachable",
+			reachable: map[string]bool{},
+			expectErr: true,
+		},
+		{
+			name:      "invalid port",
+			port:      "ssh",
+			expectErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var probed []string
+			selector := newTransportSelector(func(address string, timeout time.Duration) error {
+				assert.Equal(t, probeTimeout, timeout)
+				probed = append(probed, address)
+				if test.reachable[address] {
+					return nil
+				}
+				return fmt.Errorf("connection refused")
+			}, clock.RealClock{})
+			selected, err := selector.selectTransport("10.0.0.1", test.port)
+			if test.expectErr {
+				require.Error(t, err)
+				if test.reachable != nil {
+					// both failed probes are reported
+					assert.Contains(t, err.Error(), "port 22")
+					assert.Contains(t, err.Error(), "port 5986")
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, selected)
+
+			probes := len(probed)
+			selected, err = selector.selectTransport("10.0.0.1", test.port)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, selected)
+			if test.notCached {
+				// WinRM may answer before SSH is up, the host is probed again
+				assert.Len(t, probed, 2*probes)
+				return
+			}
+			// the decision is cached, the host is not probed again
+			assert.Len(t, probed, probes)
+		})
+	}
+}
+
+func TestSelectTransportRetriesFailedProbes(t *testing.T) {
+	reachable := false
+	probes := 0
+	selector := newTransportSelector(func(string, time.Duration) error {
+		probes++
+		if reachable {
+			return nil
+		}
+		return fmt.Errorf("connection refused")
+	}, clock.RealClock{})
+	_, err := selector.selectTransport("10.0.0.1", "")
+	require.Error(t, err)
+	assert.Equal(t, 2, probes)
+
+	// an instance which was not reachable is probed again
+	reachable = true
+	selected, err := selector.selectTransport("10.0.0.1", "")
+	require.NoError(t, err)
+	assert.Equal(t, transportSSH, selected)
+	assert.Equal(t, 3, probes)
+}
+
+func TestSelectTransportExpiry(t *testing.T) {
+	fakeClock := clocktesting.NewFakePassiveClock(time.Now())
+	sshReachable := true
+	var probed []string
+	selector := newTransportSelector(func(address string, _ time.Duration) error {
+		probed = append(probed, address)
+		if sshReachable || address == "10.0.0.1:5986" {
+			return nil
+		}
+		return fmt.Errorf("connection refused")
+	}, fakeClock)
+	selected, err := selector.selectTransport("10.0.0.1", "")
+	require.NoError(t, err)
+	assert.Equal(t, transportSSH, selected)
+
+	// the address is reused by an instance only reachable over WinRM
+	sshReachable = false
+	fakeClock.SetTime(fakeClock.Now().Add(transportTTL - time.Second))
+	selected, err = selector.selectTransport("10.0.0.1", "")
+	require.NoError(t, err)
+	assert.Equal(t, transportSSH, selected, "the decision is remembered until it expires")
+	fakeClock.SetTime(fakeClock.Now().Add(time.Second))
+	selected, err = selector.selectTransport("10.0.0.1", "")
+	require.NoError(t, err)
+	assert.Equal(t, transportWinRM, selected)
+	assert.Equal(t, []string{"10.0.0.1:22", "10.0.0.1:22", "10.0.0.1:5986"}, probed)
+
+	// sshd is started on the instance, which is only found reachable over WinRM until then
+	sshReachable = true
+	selected, err = selector.selectTransport("10.0.0.1", "")
+	require.NoError(t, err)
+	assert.Equal(t, transportSSH, selected)
+}
+
+func TestSelectTransportConcurrent(t *testing.T) {
+	// probes of 10.0.0.1 block until released
+	release := make(chan struct{})
+	probing := make(chan struct{})
+	var probes int32
+	selector := newTransportSelector(func(address string, _ time.Duration) error {
+		if address == "10.0.0.1:22" && atomic.AddInt32(&probes, 1) == 1 {
+			close(probing)
+			<-release
+		}
+		return nil
+	}, clock.RealClock{})
+
+	var wg sync.WaitGroup
+	selections := make([]transport, 5)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		selections[0], _ = selector.selectTransport("10.0.0.1", "")
+	}()
+	<-probing
+	for i := 1; i < len(selections); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			selections[i], _ = selector.selectTransport("10.0.0.1", "")
+		}(i)
+	}
+
+	// other hosts are not delayed by the probe in progress
+	selected, err := selector.selectTransport("10.0.0.2", "")
+	require.NoError(t, err)
+	assert.Equal(t, transportSSH, selected)
+
+	close(release)
+	wg.Wait()
+	for _, selected := range selections {
+		assert.Equal(t, transportSSH, selected)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&probes), "the selections share a single probe")
+}
@@ -0,0 +1,49 @@
+package windows
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ServerVersion is a release of Windows Server
+type ServerVersion string
+
+const (
+	// Server2019 represents Windows Server 2019
+	Server2019 ServerVersion = "2019"
+	// Server2022 represents Windows Server 2022
+	Server2022 ServerVersion = "2022"
+	// ServerVersionUnknown represents a Windows Server release without a known build number
+	ServerVersionUnknown ServerVersion = "unknown"
+)
+
+// getBuildNumberCommand is the PowerShell command which returns the build number of the running OS
+const getBuildNumberCommand = "(Get-ItemProperty 'HKLM:\\SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion')." +
+	"CurrentBuildNumber"
+
+// serverVersionByBuild maps the OS build number of each Windows Server release as defined by Microsoft
+var serverVersionByBuild = map[string]ServerVersion{
+	"17763": Server2019,
+	"20348": Server2022,
+}
+
+// parseServerVersion returns the Windows Server release of the given build number, which can either be the build
+// number alone or prefixed by the major and minor versions, i.e. "10.0.20348"
+func parseServerVersion(build string) ServerVersion {
+	build = strings.TrimSpace(build)
+	if fields := strings.Split(build, "."); len(fields) == 3 {
+		build = fields[2]
+	}
+	if version, ok := serverVersionByBuild[build]; ok {
+		return version
+	}
+	return ServerVersionUnknown
+}
+
+func (vm *windows) GetServerVersion() (ServerVersion, error) {
+	out, err := vm.Run(getBuildNumberCommand, true)
+	if err != nil {
+		return ServerVersionUnknown, fmt.Errorf("error getting the OS build number, with output %s: %w", out, err)
+	}
+	return parseServerVersion(out), nil
+}
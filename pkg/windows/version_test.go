@@ -0,0 +1,27 @@
+package windows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	testCases := []struct {
+		build    string
+		expected ServerVersion
+	}{
+		{build: "17763", expected: Server2019},
+		{build: "20348\r\n", expected: Server2022},
+		{build: "10.0.20348", expected: Server2022},
+		{build: "10.0.17763", expected: Server2019},
+		{build: "26100", expected: ServerVersionUnknown},
+		{build: "", expected: ServerVersionUnknown},
+		{build: "not a build", expected: ServerVersionUnknown},
+	}
+	for _, test := range testCases {
+		t.Run(test.build, func(t *testing.T) {
+			assert.Equal(t, test.expected, parseServerVersion(test.build))
+		})
+	}
+}
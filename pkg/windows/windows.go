@@ -4,15 +4,20 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	config "github.com/openshift/api/config/v1"
 	"golang.org/x/crypto/ssh"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
@@ -22,6 +27,8 @@ import (
 )
 
 const (
+	// maxLoggedOutputBytes is the maximum amount of command output included in debug logs
+	maxLoggedOutputBytes = 4096
 	// remoteDir is the remote temporary directory created on the Windows VM
 	remoteDir = "C:\\Temp"
 	// GcpGetHostnameScriptRemotePath is the remote location of the PowerShell script that resolves the hostname
@@ -33,13 +40,13 @@ const (
 	// HNSPSModule is the remote location of the hns.psm1 module
 	HNSPSModule = remoteDir + "\\hns.psm1"
 	// K8sDir is the remote kubernetes executable directory
-	K8sDir = "C:\\k"
+	K8sDir = instance.DefaultInstallDir
 	// CredentialProviderConfig is the config file for the credential provider
 	CredentialProviderConfig = K8sDir + "\\credential-provider-config.yaml"
 	// KubeconfigPath is the remote location of the kubelet's kubeconfig
 	KubeconfigPath = K8sDir + "\\kubeconfig"
 	// logDir is the remote kubernetes log directory
-	logDir = "C:\\var\\log"
+	logDir = instance.DefaultLogDir
 	// KubeletLogDir is the remote kubelet log directory
 	KubeletLogDir = logDir + "\\kubelet"
 	// KubeProxyLogDir is the remote kube-proxy log directory
@@ -238,6 +245,9 @@ type Windows interface {
 	GetIPv4Address() string
 	// GetHostname returns the FQDN of the associated instance including the domain name, if any
 	GetHostname() (string, error)
+	// GetServerVersion returns the Windows Server release running on the instance. ServerVersionUnknown is returned if
+	// the OS build is not a known Windows Server release.
+	GetServerVersion() (ServerVersion, error)
 	// EnsureFile ensures the given file exists within the specified directory on the Windows VM. The file will be copied
 	// to the Windows VM if it is not present or if it has the incorrect contents. The remote directory is created if it
 	// does not exist.
@@ -246,9 +256,29 @@ type Windows interface {
 	// The content will be copied to the Windows VM if the file is not present or has incorrect contents. The remote
 	// directory is created if it does not exist.
 	EnsureFileContent([]byte, string, string) error
+	// EnsureTextFileContent behaves like EnsureFileContent, but first normalizes the given text content to the given
+	// format, so that the file on the Windows VM has the line endings and byte order mark its consumer expects.
+	EnsureTextFileContent([]byte, string, string, TextFormat) error
 	// FileExists returns true if a specific file exists at the given path and checksum on the Windows VM. Set an
 	// empty checksum (checksum == "") to disable checksum check.
 	FileExists(string, string) (bool, error)
+	// ReceiveFile returns the contents of the file at the given path on the Windows VM
+	ReceiveFile(string) ([]byte, error)
+	// OutdatedPayloadFiles returns the sorted remote paths of the payload files which are missing from the Windows VM or
+	// which have contents differing from the payload. No files are transferred.
+	OutdatedPayloadFiles() ([]string, error)
+	// ServiceStatus returns true for the first value if the given service exists on the Windows VM, and true for the
+	// second value if the service is running
+	ServiceStatus(string) (bool, bool, error)
+	// ServiceManager returns a ServiceManager for the Windows services of the VM
+	ServiceManager() ServiceManager
+	// EnsureLogRotation ensures the log file of the given service is rotated once it reaches the given size in MB,
+	// keeping the given number of rotated files
+	EnsureLogRotation(string, int, int) error
+	// CollectDiagnostics writes a gzipped tar archive to the given writer, holding the output of commands describing
+	// the state of the VM and the contents of the logs of the services installed by WMCO. Diagnostics which cannot be
+	// collected are listed in the archive rather than failing the collection.
+	CollectDiagnostics(context.Context, io.Writer) error
 	// ReplaceDir transfers the given files to their given paths within the remote directory the Windows instance.
 	// The destination dir will only contain the given files after this function is called, clearing existing content.
 	ReplaceDir(map[string][]byte, string) error
@@ -259,6 +289,19 @@ type Windows interface {
 	Run(string, bool) (string, error)
 	// RebootAndReinitialize reboots the instance and re-initializes the Windows SSH client
 	RebootAndReinitialize() error
+	// PendingRebootRequired returns true if a reboot is queued on the Windows VM, as is the case after some OS updates
+	PendingRebootRequired() (bool, error)
+	// EnsureFirewallRules ensures the firewall of the Windows VM allows inbound TCP traffic to the given ports
+	EnsureFirewallRules(ports []int) error
+	// GetRegistryValue returns the value with the given name of the given registry key on the Windows VM
+	GetRegistryValue(hive RegistryHive, path, name string) (*RegistryValue, error)
+	// SetRegistryValue creates or replaces the value with the given name of the given registry key on the Windows VM
+	SetRegistryValue(hive RegistryHive, path, name string, value RegistryValue) error
+	// EnsureReachable ensures commands can be run on the instance, re-initializing the Windows SSH client if the
+	// connection is no longer usable
+	EnsureReachable() error
+	// SSHDialDuration returns the time it took to establish the SSH connection to the instance
+	SSHDialDuration() time.Duration
 	// Bootstrap prepares the Windows instance and runs the WICD bootstrap command
 	Bootstrap(string, string, string) error
 	// ConfigureWICD ensures that the Windows Instance Config Daemon is running on the node
@@ -288,16 +331,26 @@ type windows struct {
 	defaultShellPowerShell bool
 	// filesToTransfer is the map of files needed for the windows VM
 	filesToTransfer map[*payload.FileInfo]string
+	// sshDialDuration is the time it took to establish the SSH connection to the VM
+	sshDialDuration time.Duration
+	// clock is used to wait in between retries, the real clock is used if nil
+	clock clock.Clock
 }
 
 // New returns a new Windows instance constructed from the given WindowsVM
 func New(clusterDNS string, instanceInfo *instance.Info, signer ssh.Signer, platform *config.PlatformType) (Windows, error) {
 	log := ctrl.Log.WithName(fmt.Sprintf("wc %s", instanceInfo.Address))
+	opts, err := sshOptionsFromEnv(signer)
+	if err != nil {
+		return nil, err
+	}
 	log.V(1).Info("initializing SSH connection")
-	conn, err := newSshConnectivity(instanceInfo.Username, instanceInfo.Address, signer, log)
+	dialStart := time.Now()
+	conn, err := newConnectivity(instanceInfo, signer, opts, log)
 	if err != nil {
-		return nil, fmt.Errorf("unable to setup VM %s sshConnectivity: %w", instanceInfo.Address, err)
+		return nil, &ConnectionErr{address: instanceInfo.Address, dialDuration: time.Since(dialStart), err: err}
 	}
+	sshDialDuration := time.Since(dialStart)
 
 	files, err := createPayload(platform)
 	if err != nil {
@@ -311,6 +364,8 @@ func New(clusterDNS string, instanceInfo *instance.Info, signer ssh.Signer, plat
 			log:                    log,
 			defaultShellPowerShell: defaultShellPowershell(conn),
 			filesToTransfer:        files,
+			sshDialDuration:        sshDialDuration,
+			clock:                  clock.RealClock{},
 		},
 		nil
 }
@@ -368,12 +423,17 @@ func (vm *windows) EnsureFileContent(contents []byte, filename string, remoteDir
 		}
 	}()
 
-	if err := vm.interact.transfer(c, bytes.NewReader(contents), filename, remoteDir); err != nil {
+	// the file is replaced atomically, as services may read it while it is being written
+	if err := vm.interact.transferAtomic(c, bytes.NewReader(contents), filename, remoteDir); err != nil {
 		return fmt.Errorf("unable to copy %s content to remote dir %s: %w", filename, remoteDir, err)
 	}
 	return nil
 }
 
+func (vm *windows) EnsureTextFileContent(contents []byte, filename string, remoteDir string, format TextFormat) error {
+	return vm.EnsureFileContent(format.Normalize(contents), filename, remoteDir)
+}
+
 func (vm *windows) EnsureFile(file *payload.FileInfo, remoteDir string) error {
 	// Only copy the file to the Windows VM if it does not already exist wth the desired content
 	remotePath := remoteDir + "\\" + filepath.Base(file.Path)
@@ -413,7 +473,7 @@ func (vm *windows) EnsureFile(file *payload.FileInfo, remoteDir string) error {
 }
 
 func (vm *windows) FileExists(path, checksum string) (bool, error) {
-	out, err := vm.Run("Test-Path "+path, true)
+	out, err := vm.Run("Test-Path -Path "+QuotePowerShellArg(path), true)
 	if err != nil {
 		return false, fmt.Errorf("error checking if file %s exists: %w", path, err)
 	}
@@ -435,6 +495,38 @@ func (vm *windows) FileExists(path, checksum string) (bool, error) {
 	return false, nil
 }
 
+func (vm *windows) ReceiveFile(path string) ([]byte, error) {
+	return vm.interact.receive(path)
+}
+
+func (vm *windows) OutdatedPayloadFiles() ([]string, error) {
+	var outdated []string
+	for src, dest := range vm.filesToTransfer {
+		remotePath := dest + "\\" + filepath.Base(src.Path)
+		upToDate, err := vm.FileExists(remotePath, src.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("error checking if file '%s' exists on the Windows VM: %w", remotePath, err)
+		}
+		if !upToDate {
+			outdated = append(outdated, remotePath)
+		}
+	}
+	sort.Strings(outdated)
+	return outdated, nil
+}
+
+func (vm *windows) ServiceStatus(serviceName string) (bool, bool, error) {
+	exists, err := vm.serviceExists(serviceName)
+	if err != nil || !exists {
+		return false, false, err
+	}
+	running, err := vm.isRunning(serviceName)
+	if err != nil {
+		return true, false, err
+	}
+	return true, running, nil
+}
+
 func (vm *windows) ReplaceDir(files map[string][]byte, remoteDir string) error {
 	vm.log.V(1).Info("overwriting", "remote destination dir", remoteDir, "number of files", len(files))
 
@@ -462,21 +554,36 @@ func (vm *windows) ReplaceDir(files map[string][]byte, remoteDir string) error {
 }
 
 func (vm *windows) Run(cmd string, psCmd bool) (string, error) {
+	cmd = vm.shellCommand(cmd, psCmd)
+	out, err := vm.interact.run(cmd)
+	if err != nil {
+		return out, fmt.Errorf("error running %s: %w", cmd, err)
+	}
+	vm.log.V(1).Info("run", "cmd", cmd, "out", truncateForLog(out))
+	return out, nil
+}
+
+// shellCommand returns the given command formatted to be run by the default SSH shell of the VM. If psCmd is set, the
+// command is a PowerShell command, otherwise it is a cmd.exe command.
+func (vm *windows) shellCommand(cmd string, psCmd bool) string {
 	if psCmd && !vm.defaultShellPowerShell {
-		cmd = formatRemotePowerShellCommand(cmd)
-	} else if !psCmd && vm.defaultShellPowerShell {
+		return formatRemotePowerShellCommand(cmd)
+	}
+	if !psCmd && vm.defaultShellPowerShell {
 		// When running cmd through powershell, double quotes can cause parsing issues, so replace with single quotes
 		// CMD doesn't treat ' as quotes when processing commands, so the quotes must be changed on a case by case basis
-		cmd = strings.ReplaceAll(cmd, "\"", "'")
-		cmd = "cmd /c " + cmd
+		return "cmd /c " + strings.ReplaceAll(cmd, "\"", "'")
 	}
+	return cmd
+}
 
-	out, err := vm.interact.run(cmd)
-	if err != nil {
-		return out, fmt.Errorf("error running %s: %w", cmd, err)
+// truncateForLog returns the given command output cut off at maxLoggedOutputBytes, so that large outputs do not flood
+// the logs. The number of bytes omitted is appended to truncated output.
+func truncateForLog(out string) string {
+	if len(out) <= maxLoggedOutputBytes {
+		return out
 	}
-	vm.log.V(1).Info("run", "cmd", cmd, "out", out)
-	return out, nil
+	return fmt.Sprintf("%s...[%d bytes omitted]", out[:maxLoggedOutputBytes], len(out)-maxLoggedOutputBytes)
 }
 
 // RebootAndReinitialize restarts the Windows instance and re-initializes the SSH connection for further configuration
@@ -649,15 +756,17 @@ func (vm *windows) ensureHostNameAndContainersFeature() error {
 	rebootNeeded := false
 	// Set the hostName of the Windows VM if needed
 	if vm.instance.NewHostname != "" {
-		hostNameChangedNeeded, err := vm.isHostNameChangeNeeded()
-		if err != nil {
-			return err
+		// the hostname is the name of a Machine, which may be longer than the NetBIOS name of the instance
+		if len(vm.instance.NewHostname) > instance.MaxNetBIOSNameLength {
+			vm.log.Info("hostname longer than a NetBIOS name, the NetBIOS name of the instance will be truncated",
+				"hostname", vm.instance.NewHostname, "maxLength", instance.MaxNetBIOSNameLength)
 		}
-		if hostNameChangedNeeded {
-			if err := vm.changeHostName(); err != nil {
-				return err
-			}
+		err := setHostname(vm.interact, vm.instance.NewHostname)
+		var rebootErr *RebootRequiredErr
+		if errors.As(err, &rebootErr) {
 			rebootNeeded = true
+		} else if err != nil {
+			return fmt.Errorf("changing host name failed: %w", err)
 		}
 	}
 	isContainersFeatureEnabled, err := vm.isContainersFeatureEnabled()
@@ -681,26 +790,6 @@ func (vm *windows) ensureHostNameAndContainersFeature() error {
 	return nil
 }
 
-// isHostNameChangeNeeded tells if we need to update the host name of the Windows VM
-func (vm *windows) isHostNameChangeNeeded() (bool, error) {
-	hostName, err := vm.GetHostname()
-	if err != nil {
-		return false, err
-	}
-	return !strings.Contains(hostName, vm.instance.NewHostname), nil
-}
-
-// changeHostName changes the hostName of the Windows VM to match the expected value
-func (vm *windows) changeHostName() error {
-	changeHostNameCommand := "Rename-Computer -NewName " + vm.instance.NewHostname + " -Force"
-	out, err := vm.Run(changeHostNameCommand, true)
-	if err != nil {
-		vm.log.Info("changing host name failed", "command", changeHostNameCommand, "output", out)
-		return fmt.Errorf("changing host name failed: %w", err)
-	}
-	return nil
-}
-
 // createDirectories creates directories required for configuring the Windows node on the VM
 func (vm *windows) createDirectories() error {
 	for _, dir := range RequiredDirectories {
@@ -973,7 +1062,7 @@ func (vm *windows) startService(svc *service) error {
 // newFileInfo returns a pointer to a FileInfo object created from the specified file on the Windows VM
 func (vm *windows) newFileInfo(path string) (*payload.FileInfo, error) {
 	// Get-FileHash returns an object with multiple properties, we are interested in the `Hash` property
-	command := "$out = Get-FileHash " + path + " -Algorithm SHA256; $out.Hash"
+	command := "$out = Get-FileHash -Path " + QuotePowerShellArg(path) + " -Algorithm SHA256; $out.Hash"
 	out, err := vm.Run(command, true)
 	if err != nil {
 		return nil, fmt.Errorf("error getting file hash: %w", err)
@@ -1057,6 +1146,23 @@ func (vm *windows) waitUntilUnreachable() error {
 		})
 }
 
+func (vm *windows) EnsureReachable() error {
+	err := vm.interact.ping()
+	if err == nil {
+		return nil
+	}
+	vm.log.Info("connection lost, reinitializing", "error", err.Error())
+	// the lost client is closed so that its resources are released before dialing the instance again
+	if err := vm.interact.close(); err != nil {
+		vm.log.V(1).Info("error closing lost connection", "error", err.Error())
+	}
+	return vm.reinitialize()
+}
+
+func (vm *windows) SSHDialDuration() time.Duration {
+	return vm.sshDialDuration
+}
+
 func (vm *windows) reinitialize() error {
 	if err := vm.interact.init(); err != nil {
 		return fmt.Errorf("failed to reinitialize ssh client: %v", err)
@@ -1081,12 +1187,21 @@ func (vm *windows) deconfigureWICD() error {
 // Generic helper methods
 
 // formatRemotePowerShellCommand returns a formatted string, prepended with the required PowerShell prefix and
-// surrounding quotes needed to execute the given command on a remote Windows VM
+// surrounding quotes needed to execute the given command on a remote Windows VM. The command must not hold variables:
+// when the default shell of the VM is PowerShell, it expands them within the double quotes before powershell.exe is
+// run. Commands which need variables are run through Run instead, which only wraps them for a cmd.exe default shell.
 func formatRemotePowerShellCommand(command string) string {
 	remotePowerShellCmdPrefix := "powershell.exe -NonInteractive -ExecutionPolicy Bypass"
 	return fmt.Sprintf("%s \"%s\"", remotePowerShellCmdPrefix, command)
 }
 
+// QuotePowerShellArg returns the given value as a single-quoted PowerShell string, for use as a command argument.
+// Single-quoted strings are taken verbatim by PowerShell, so spaces, backticks and variables are not interpreted, and
+// embedded single quotes are escaped by doubling them.
+func QuotePowerShellArg(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+}
+
 // mkdirCmd returns the Windows command to create a directory if it does not exists
 func mkdirCmd(dirName string) string {
 	// trailing space required due to directories ending in `\` causing issues on VMs with PowerShell as the shell.
@@ -1095,7 +1210,8 @@ func mkdirCmd(dirName string) string {
 
 // rmDirCmd returns the PowerShell command to recursively remove a directory if it exists
 func rmDirCmd(dirName string) string {
-	return fmt.Sprintf("if(Test-Path %s) {Remove-Item -Recurse -Force %s}", dirName, dirName)
+	quoted := QuotePowerShellArg(dirName)
+	return fmt.Sprintf("if(Test-Path %s) {Remove-Item -Recurse -Force %s}", quoted, quoted)
 }
 
 // rmK8sFilesCmd() returns the PowerShell command to remove the k8sDir files excluding WICD files
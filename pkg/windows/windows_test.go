@@ -1,10 +1,13 @@
 package windows
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/go-logr/logr"
 	config "github.com/openshift/api/config/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig/payload"
 )
@@ -89,3 +92,109 @@ func TestSplitPath(t *testing.T) {
 		})
 	}
 }
+
+// recordingLogSink is a logr.LogSink which records the key value pairs of every info log line
+type recordingLogSink struct {
+	lines [][]interface{}
+}
+
+func (r *recordingLogSink) Init(logr.RuntimeInfo)                  {}
+func (r *recordingLogSink) Enabled(int) bool                       { return true }
+func (r *recordingLogSink) Error(error, string, ...interface{})    {}
+func (r *recordingLogSink) WithValues(...interface{}) logr.LogSink { return r }
+func (r *recordingLogSink) WithName(string) logr.LogSink           { return r }
+func (r *recordingLogSink) Info(_ int, _ string, keysAndValues ...interface{}) {
+	r.lines = append(r.lines, keysAndValues)
+}
+
+func TestRunLogTruncation(t *testing.T) {
+	testCases := []struct {
+		name        string
+		out         string
+		expectedLog string
+	}{
+		{
+			name:        "small output logged in full",
+			out:         "Running",
+			expectedLog: "Running",
+		},
+		{
+			name:        "large output truncated",
+			out:         strings.Repeat("a", maxLoggedOutputBytes+100),
+			expectedLog: strings.Repeat("a", maxLoggedOutputBytes) + "...[100 bytes omitted]",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &recordingLogSink{}
+			vm := &windows{interact: newFakeConnectivity(test.out), log: logr.New(sink),
+				defaultShellPowerShell: true}
+			out, err := vm.Run("Get-Content -Raw -Path C:\\k\\kubelet.log", true)
+			require.NoError(t, err)
+			// the caller always receives the full output
+			assert.Equal(t, test.out, out)
+
+			require.Len(t, sink.lines, 1)
+			logged := map[string]interface{}{}
+			for i := 0; i+1 < len(sink.lines[0]); i += 2 {
+				logged[sink.lines[0][i].(string)] = sink.lines[0][i+1]
+			}
+			assert.Equal(t, test.expectedLog, logged["out"])
+			// the output logged is bounded, leaving room for the omitted bytes suffix
+			assert.Less(t, len(logged["out"].(string)), maxLoggedOutputBytes+64)
+		})
+	}
+}
+
+func TestQuotePowerShellArg(t *testing.T) {
+	testCases := []struct {
+		name     string
+		arg      string
+		expected string
+	}{
+		{
+			name:     "plain path",
+			arg:      `C:\k\kubelet.exe`,
+			expected: `'C:\k\kubelet.exe'`,
+		},
+		{
+			name:     "path with spaces",
+			arg:      `C:\Program Files\OpenSSH\sshd.exe`,
+			expected: `'C:\Program Files\OpenSSH\sshd.exe'`,
+		},
+		{
+			name:     "path with single quotes",
+			arg:      `C:\k\it's here\'quoted'`,
+			expected: `'C:\k\it''s here\''quoted'''`,
+		},
+		{
+			name:     "path with backticks and variables",
+			arg:      "C:\\k\\`n$env:TEMP",
+			expected: "'C:\\k\\`n$env:TEMP'",
+		},
+		{
+			name:     "empty",
+			arg:      "",
+			expected: "''",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, QuotePowerShellArg(test.arg))
+		})
+	}
+}
+
+func TestFileExistsQuotesPath(t *testing.T) {
+	conn := newFakeConnectivity("").
+		respond(`^Test-Path`, "True", nil).
+		respond(`Get-FileHash`, "ABC", nil)
+	vm := &windows{interact: conn, log: logr.Discard(), defaultShellPowerShell: true}
+	exists, err := vm.FileExists(`C:\Program Files\it's`, "abc")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, []string{
+		`Test-Path -Path 'C:\Program Files\it''s'`,
+		`$out = Get-FileHash -Path 'C:\Program Files\it''s' -Algorithm SHA256; $out.Hash`,
+	}, conn.issued())
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"unicode"
 
 	core "k8s.io/api/core/v1"
 	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -18,6 +19,9 @@ import (
 // InstanceConfigMap is the name of the ConfigMap where VMs to be configured should be described.
 const InstanceConfigMap = "windows-instances"
 
+// driveLetters are the letters Windows drives are named with
+const driveLetters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
 // GetInstances returns a list of Windows instances by parsing the Windows instance configMap.
 func GetInstances(c client.Client, namespace string) ([]*instance.Info, error) {
 	configMap := &core.ConfigMap{}
@@ -50,11 +54,11 @@ func Parse(instancesData map[string]string, nodes *core.NodeList) ([]*instance.I
 	}
 	instances := make([]*instance.Info, 0)
 	// Get information about the instances from each entry. The expected key/value format for each entry is:
-	// <address>: username=<username>
+	// <address>: username=<username>[;installDir=<directory>]
 	for address, data := range instancesData {
-		username, err := extractUsername(data)
+		username, installDir, err := parseEntry(data)
 		if err != nil {
-			return instances, fmt.Errorf("unable to get username for %s: %w", address, err)
+			return instances, fmt.Errorf("unable to parse entry for %s: %w", address, err)
 		}
 
 		// Node is only guaranteed to be found when looking for its IP address
@@ -69,6 +73,10 @@ func Parse(instancesData map[string]string, nodes *core.NodeList) ([]*instance.I
 		if err != nil {
 			return nil, err
 		}
+		// the entry takes precedence over the install directory recorded on the node, as it may have been changed
+		if installDir != "" {
+			instanceInfo.InstallDir = installDir
+		}
 		instances = append(instances, instanceInfo)
 	}
 	return instances, nil
@@ -88,11 +96,41 @@ func GetNodeUsername(instancesData map[string]string, node *core.Node) (string,
 	return "", fmt.Errorf("unable to find instance associated with node %s", node.GetName())
 }
 
-// extractUsername returns the username string from data in the form username=<username>
+// extractUsername returns the username string from data in the form username=<username>[;installDir=<directory>]
 func extractUsername(value string) (string, error) {
-	splitData := strings.SplitN(value, "=", 2)
-	if len(splitData) == 0 || splitData[0] != "username" {
-		return "", fmt.Errorf("data has an incorrect format")
+	username, _, err := parseEntry(value)
+	return username, err
+}
+
+// parseEntry returns the username and the optional install directory from data in the form
+// username=<username>[;installDir=<directory>]. Semicolons cannot be part of Windows usernames, so they separate the
+// fields.
+func parseEntry(value string) (string, string, error) {
+	fields := strings.Split(value, ";")
+	splitData := strings.SplitN(fields[0], "=", 2)
+	if len(splitData) != 2 || splitData[0] != "username" {
+		return "", "", fmt.Errorf("data has an incorrect format")
+	}
+	username := splitData[1]
+	installDir := ""
+	for _, field := range fields[1:] {
+		key, fieldValue, found := strings.Cut(field, "=")
+		if !found || key != "installDir" || fieldValue == "" || installDir != "" {
+			return "", "", fmt.Errorf("data has an incorrect format, unexpected field %q", field)
+		}
+		if err := validateInstallDir(fieldValue); err != nil {
+			return "", "", err
+		}
+		installDir = fieldValue
+	}
+	return username, installDir, nil
+}
+
+// validateInstallDir returns an error if the given install directory is not an absolute Windows path, such as D:\k
+func validateInstallDir(installDir string) error {
+	if len(installDir) < 3 || !strings.ContainsRune(driveLetters, unicode.ToUpper(rune(installDir[0]))) ||
+		installDir[1] != ':' || installDir[2] != '\\' {
+		return fmt.Errorf("install directory %q must be an absolute Windows path", installDir)
 	}
-	return splitData[1], nil
+	return nil
 }
@@ -9,6 +9,7 @@ import (
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 )
 
 func TestParse(t *testing.T) {
@@ -62,6 +63,40 @@ func TestParse(t *testing.T) {
 			expectedOut: []*instance.Info{{Address: "127.0.0.1", IPv4Address: "127.0.0.1", Username: "core"}},
 			expectedErr: false,
 		},
+		{
+			name:     "install directory",
+			input:    map[string]string{"127.0.0.1": "username=core;installDir=D:\\kubernetes"},
+			nodeList: &core.NodeList{},
+			expectedOut: []*instance.Info{{Address: "127.0.0.1", IPv4Address: "127.0.0.1", Username: "core",
+				InstallDir: "D:\\kubernetes"}},
+		},
+		{
+			name:        "relative install directory",
+			input:       map[string]string{"127.0.0.1": "username=core;installDir=kubernetes"},
+			nodeList:    &core.NodeList{},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown field",
+			input:       map[string]string{"127.0.0.1": "username=core;port=2222"},
+			nodeList:    &core.NodeList{},
+			expectedErr: true,
+		},
+		{
+			name:  "install directory recorded on the node",
+			input: map[string]string{"127.0.0.1": "username=core"},
+			nodeList: &core.NodeList{Items: []core.Node{{
+				ObjectMeta: meta.ObjectMeta{Name: "node",
+					Annotations: map[string]string{metadata.InstallDirAnnotation: "E:\\k"}},
+				Status: core.NodeStatus{Addresses: []core.NodeAddress{{Address: "127.0.0.1",
+					Type: core.NodeInternalIP}}},
+			}}},
+			expectedOut: []*instance.Info{{Address: "127.0.0.1", IPv4Address: "127.0.0.1", Username: "core",
+				InstallDir: "E:\\k", Node: &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node",
+					Annotations: map[string]string{metadata.InstallDirAnnotation: "E:\\k"}},
+					Status: core.NodeStatus{Addresses: []core.NodeAddress{{Address: "127.0.0.1",
+						Type: core.NodeInternalIP}}}}}},
+		},
 		{
 			name:     "valid dns and ip addresses with no nodes",
 			input:    map[string]string{"localhost": "username=core", "127.0.0.1": "username=Admin"},
@@ -211,6 +246,12 @@ func TestGetNodeUsername(t *testing.T) {
 			expectedOut: "core",
 			expectedErr: false,
 		},
+		{
+			name:        "entry with an install directory",
+			data:        map[string]string{"111.1.1.1": "username=core;installDir=D:\\k"},
+			node:        testNode,
+			expectedOut: "core",
+		},
 		{
 			name:        "multiple entries in map data",
 			data:        map[string]string{"localhost": "username=core", "111.1.1.1": "username=Admin"},
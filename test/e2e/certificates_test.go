@@ -2,6 +2,7 @@ package e2e
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -11,16 +12,20 @@ import (
 	"github.com/stretchr/testify/require"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/openshift/windows-machine-config-operator/controllers"
 	"github.com/openshift/windows-machine-config-operator/pkg/certificates"
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/retry"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 )
 
+// maxCABundleSize is the maximum size of the kubelet CA bundle read from a Windows node, well above the size of a
+// bundle holding the few certificates present during a rotation
+const maxCABundleSize = 1024 * 1024
+
 // testCertificates tests the CA certificates for Windows nodes
 // The initial kubelet CA certificate is valid for 1 year, from the date of the cluster installation.
 // Usually, the first rotation of the kubelet CA certificate is generated by the [API Server Operator](https://github.com/openshift/cluster-kube-apiserver-operator)
@@ -47,43 +52,25 @@ func (tc *testContext) testKubeletCARotation(t *testing.T) {
 		t.Run("node/"+winNode.Name, func(t *testing.T) {
 			err := tc.waitForKubeletCACertificateInNode(&winNode)
 			assert.NoErrorf(t, err, "kubelet CA certificate should be present in node %S", winNode.Name)
+			// the CA bundle only takes effect if kubelet reads it from where it is written
+			err = tc.validateKubeletClientCAPath(&winNode)
+			assert.NoErrorf(t, err, "kubelet should use the CA bundle written to node %s", winNode.Name)
 		})
 	}
 }
 
-// forceKubeApiServerCertificateRotation forces the certificate rotation by setting the `certificate-not-after`
-// annotation to nil in the `kube-apiserver-to-kubelet-signer` secret
+// forceKubeApiServerCertificateRotation forces the certificate rotation by removing the `certificate-not-after`
+// annotation from the `kube-apiserver-to-kubelet-signer` secret
 func (tc *testContext) forceKubeApiServerCertificateRotation() error {
-	// note that the slash had to be encoded as ~1 because it's a reference: https://www.rfc-editor.org/rfc/rfc6901#section-3
-	patchData := fmt.Sprint(`[{"op":"replace","path":"/metadata/annotations/auth.openshift.io~1certificate-not-after","value": null }]`)
-	// invoke request
-	_, err := tc.client.K8s.CoreV1().Secrets("openshift-kube-apiserver-operator").Patch(context.TODO(),
-		"kube-apiserver-to-kubelet-signer", types.JSONPatchType, []byte(patchData), meta.PatchOptions{})
-	return err
+	return certificates.ForceKubeAPIServerCertificateRotation(context.TODO(),
+		tc.client.K8s.CoreV1().Secrets(certificates.KubeApiServerOperatorNamespace))
 }
 
 // waitForKubeletCACertificateInNode waits for the kubelet CA certificate to be present in the CA bundle file for the
 // given Windows node. After retry.Interval runs an SSH job to fetch the CA bundle, if the job fails or
 // kubelet CA is not present in the node, retries every retry.Interval until retry.Timeout is reached.
 func (tc *testContext) waitForKubeletCACertificateInNode(node *core.Node) error {
-	addr, err := controllers.GetAddress(node.Status.Addresses)
-	if err != nil {
-		return err
-	}
-	// CA bundle location in Windows node. i.e. "C:\k\kubelet-ca.crt"
-	caBundlePath := windows.GetK8sDir() + "\\" + nodeconfig.KubeletClientCAFilename
-	// PowerShell command to fetch content in the file
-	command := fmt.Sprintf("Get-Content -Raw -Path %s", caBundlePath)
-	// wait retry.Interval and verify the CA bundle content, try if needed
-	return wait.Poll(retry.Interval, retry.Timeout, func() (bool, error) {
-		// invoke command
-		bundleContent, err := tc.runPowerShellSSHJob("kubelet-ca-bundle-content", command, addr)
-		if err != nil {
-			// retry
-			log.Printf("error fetching CA bundle in node %s with address %s, retrying in %s. %v",
-				node.Name, addr, retry.Interval, err)
-			return false, nil
-		}
+	return tc.pollKubeletCABundleInNode(node, func(bundleContent string) (bool, error) {
 		// get the ConfigMap that contains the kubelet client CA
 		cm, err := tc.client.K8s.CoreV1().ConfigMaps(certificates.KubeApiServerOperatorNamespace).Get(context.TODO(),
 			certificates.KubeAPIServerServingCAConfigMapName, meta.GetOptions{})
@@ -98,10 +85,67 @@ func (tc *testContext) waitForKubeletCACertificateInNode(node *core.Node) error
 		kubeletCAString := strings.TrimSpace(string(kubeletCABytes))
 		found := strings.Contains(bundleContent, kubeletCAString)
 		if !found {
-			log.Printf("kubelet CA certificate not found in node %s with address %s, retrying in %s...",
-				node.Name, addr, retry.Interval)
+			log.Printf("kubelet CA certificate not found in node %s, retrying in %s...", node.Name, retry.Interval)
 		}
 		// return if CA bundle contains the given certificate content, otherwise retry
 		return found, nil
 	})
 }
+
+// validateKubeletClientCAPath returns an error if the kubelet of the given Windows node is not configured to read its
+// client CA from the file WMCO writes the kubelet CA bundle to
+func (tc *testContext) validateKubeletClientCAPath(node *core.Node) error {
+	instanceInfo, err := nodeInstanceInfo(node)
+	if err != nil {
+		return err
+	}
+	paths := windows.InstancePaths(instanceInfo)
+	command := fmt.Sprintf("Get-Content -Raw -Path %s", windows.QuotePowerShellArg(paths.KubeletConfigPath))
+	kubeletConfig, err := tc.runPowerShellSSHJob("kubelet-config-content", command, instanceInfo.Address)
+	if err != nil {
+		return fmt.Errorf("error fetching kubelet config in node %s with address %s: %w", node.Name,
+			instanceInfo.Address, err)
+	}
+	return nodeconfig.ValidateKubeletClientCAPath([]byte(kubeletConfig), paths.KubeletCACertPath)
+}
+
+// nodeInstanceInfo returns the instance underlying the given Windows node, with the install directory recorded on it
+func nodeInstanceInfo(node *core.Node) (*instance.Info, error) {
+	addr, err := controllers.GetAddress(node.Status.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	return instance.NewInfo(addr, "", "", false, node)
+}
+
+// pollKubeletCABundleInNode fetches the content of the kubelet CA bundle file of the given Windows node every
+// retry.Interval, until the given condition returns true or an error, or retry.Timeout is reached. Failures to fetch
+// the bundle are retried.
+func (tc *testContext) pollKubeletCABundleInNode(node *core.Node, condition func(string) (bool, error)) error {
+	instanceInfo, err := nodeInstanceInfo(node)
+	if err != nil {
+		return err
+	}
+	addr := instanceInfo.Address
+	// CA bundle location in Windows node, within its install directory. i.e. "C:\k\kubelet-ca.crt"
+	caBundlePath := windows.InstancePaths(instanceInfo).KubeletCACertPath
+	// PowerShell command to fetch content in the file
+	command := fmt.Sprintf("Get-Content -Raw -Path %s", windows.QuotePowerShellArg(caBundlePath))
+	// wait retry.Interval and verify the CA bundle content, try if needed
+	return wait.Poll(retry.Interval, retry.Timeout, func() (bool, error) {
+		// invoke command
+		bundleContent, err := tc.runPowerShellSSHJobWithLimits("kubelet-ca-bundle-content", command, addr,
+			jobLimits{timeout: retry.ResourceChangeTimeout, maxOutputBytes: maxCABundleSize})
+		if errors.Is(err, errJobOutputTruncated) {
+			// a partial bundle cannot be compared, and retrying will not reduce its size
+			return false, fmt.Errorf("error fetching CA bundle in node %s with address %s: %w", node.Name, addr, err)
+		}
+		if err != nil {
+			// retry
+			log.Printf("error fetching CA bundle in node %s with address %s, retrying in %s. %v",
+				node.Name, addr, retry.Interval, err)
+			return false, nil
+		}
+		return condition(bundleContent)
+	})
+}
@@ -162,7 +162,7 @@ func (tc *testContext) testMachineConfiguration(t *testing.T) {
 	if gc.numberOfMachineNodes == 0 {
 		t.Skip("Machine Controller testing disabled")
 	}
-	_, err := tc.createWindowsMachineSet(gc.numberOfMachineNodes, false)
+	_, err := tc.createWindowsMachineSet(context.TODO(), gc.numberOfMachineNodes, false)
 	require.NoError(t, err, "failed to create Windows MachineSet")
 
 	t.Run("Machine configuration while private key change", tc.testMachineConfigurationWhilePrivateKeyChange)
@@ -289,7 +289,7 @@ func (tc *testContext) byohLogCollection() {
 // The Cluster Machine Approver must be disabled to test BYOH CSR approval feature, so that BYOH instances CSR's are
 // not approved by Cluster Machine Approver
 func (tc *testContext) provisionBYOHConfigMapWithMachineSet() error {
-	_, err := tc.createWindowsMachineSet(gc.numberOfBYOHNodes, true)
+	_, err := tc.createWindowsMachineSet(context.TODO(), gc.numberOfBYOHNodes, true)
 	if err != nil {
 		return fmt.Errorf("failed to create Windows MachineSet: %w", err)
 	}
@@ -386,12 +386,13 @@ func (tc *testContext) uninstallWindowsDefender(machine *mapi.Machine) error {
 }
 
 // createWindowsMachineSet creates given number of Windows Machines.
-func (tc *testContext) createWindowsMachineSet(replicas int32, ignoreLabel bool) (*mapi.MachineSet, error) {
-	machineSet, err := tc.CloudProvider.GenerateMachineSet(ignoreLabel, replicas, tc.windowsServerVersion)
+func (tc *testContext) createWindowsMachineSet(ctx context.Context, replicas int32,
+	ignoreLabel bool) (*mapi.MachineSet, error) {
+	machineSet, err := tc.CloudProvider.GenerateMachineSet(ctx, ignoreLabel, replicas, tc.windowsServerVersion)
 	if err != nil {
 		return nil, err
 	}
-	return tc.client.Machine.MachineSets(clusterinfo.MachineAPINamespace).Create(context.TODO(), machineSet, metav1.CreateOptions{})
+	return tc.client.Machine.MachineSets(clusterinfo.MachineAPINamespace).Create(ctx, machineSet, metav1.CreateOptions{})
 }
 
 // deleteMachineSet deletes the MachineSet passed to it
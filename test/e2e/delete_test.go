@@ -24,6 +24,7 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
 	"github.com/openshift/windows-machine-config-operator/test/e2e/clusterinfo"
+	"github.com/openshift/windows-machine-config-operator/test/e2e/providers/machineset"
 )
 
 // remotePowerShellCmdPrefix holds the PowerShell prefix that needs to be prefixed  for every remote PowerShell
@@ -235,7 +236,7 @@ func (tc *testContext) testWindowsNodeDeletion(t *testing.T) {
 	require.NoError(t, err, "error listing MachineSets")
 	var machineControllerMachineSet *mapi.MachineSet
 	for _, machineSet := range e2eMachineSets.Items {
-		if machineSet.Spec.Selector.MatchLabels[controllers.IgnoreLabel] != "true" {
+		if !machineset.HasIgnoreLabel(&machineSet) {
 			machineControllerMachineSet = &machineSet
 			break
 		}
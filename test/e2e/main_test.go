@@ -8,7 +8,6 @@ import (
 	"testing"
 	"time"
 
-	config "github.com/openshift/api/config/v1"
 	imageClient "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
 	"github.com/openshift/library-go/pkg/image/imageutil"
 	core "k8s.io/api/core/v1"
@@ -118,12 +117,7 @@ func NewTestContext() (*testContext, error) {
 
 // vmUsername returns the name of the user which can be used to log into each Windows instance
 func (tc *testContext) vmUsername() string {
-	// username will be Administrator on all cloud providers, except Azure where it is "capi"
-	if tc.CloudProvider.GetType() == config.AzurePlatformType {
-		return "capi"
-	} else {
-		return "Administrator"
-	}
+	return tc.CloudProvider.DefaultAdminUsername()
 }
 
 // getOpenShiftToolsImage returns a pullable image from the openshift/tools imagestream
@@ -240,36 +240,48 @@ func (tc *testContext) collectDeploymentLogs(deployment *appsv1.Deployment) {
 	tc.writePodLogs(labelSelector)
 }
 
-// getLogs uses a label selector and returns the logs associated with each pod
-func (tc *testContext) getLogs(podLabelSelector string) (string, error) {
+// getLogsWithLimit uses a label selector and returns the logs associated with each pod. If limitBytes is greater than
+// zero, the logs of each pod are cut off at that size and true is returned to indicate the logs were truncated.
+func (tc *testContext) getLogsWithLimit(podLabelSelector string, limitBytes int64) (string, bool, error) {
 	if podLabelSelector == "" {
-		return "", fmt.Errorf("pod label selector is empty")
+		return "", false, fmt.Errorf("pod label selector is empty")
 	}
 	pods, err := tc.client.K8s.CoreV1().Pods(tc.workloadNamespace).List(context.TODO(), metav1.ListOptions{
 		LabelSelector: podLabelSelector})
 	if err != nil {
-		return "", fmt.Errorf("error getting pod list: %w", err)
+		return "", false, fmt.Errorf("error getting pod list: %w", err)
 	}
 	if len(pods.Items) == 0 {
-		return "", fmt.Errorf("expected at least 1 pod and found 0")
+		return "", false, fmt.Errorf("expected at least 1 pod and found 0")
+	}
+	logOptions := &v1.PodLogOptions{}
+	if limitBytes > 0 {
+		// request an extra byte to be able to tell if the logs exceed the limit
+		requestedBytes := limitBytes + 1
+		logOptions.LimitBytes = &requestedBytes
 	}
 	var logs string
+	truncated := false
 	for _, pod := range pods.Items {
 		logStream, err := tc.client.K8s.CoreV1().Pods(tc.workloadNamespace).GetLogs(pod.Name,
-			&v1.PodLogOptions{}).Stream(context.TODO())
+			logOptions).Stream(context.TODO())
 		if err != nil {
-			return "", fmt.Errorf("error getting pod logs: %w", err)
+			return "", false, fmt.Errorf("error getting pod logs: %w", err)
 		}
 		podLogs, err := ioutil.ReadAll(logStream)
 		if err != nil {
 			logStream.Close()
-			return "", fmt.Errorf("error reading pod logs: %w", err)
+			return "", false, fmt.Errorf("error reading pod logs: %w", err)
+		}
+		if limitBytes > 0 && int64(len(podLogs)) > limitBytes {
+			podLogs = append(podLogs[:limitBytes], outputTruncatedMarker...)
+			truncated = true
 		}
 		// appending the pod logs onto the existing logs
 		logs += fmt.Sprintf("%s: %s\n", pod.Name, podLogs)
 		logStream.Close()
 	}
-	return logs, nil
+	return logs, truncated, nil
 }
 
 // testNorthSouthNetworking deploys a Windows Server pod, and tests that we can network with it from outside the cluster
@@ -829,6 +841,12 @@ func (tc *testContext) deleteJob(name string) error {
 
 // waitUntilJobSucceeds will return an error if the job fails or reaches a timeout
 func (tc *testContext) waitUntilJobSucceeds(name string) error {
+	return tc.waitUntilJobSucceedsWithLogLimit(name, 0)
+}
+
+// waitUntilJobSucceedsWithLogLimit behaves as waitUntilJobSucceeds, writing at most the given number of bytes of logs
+// of each pod of the job to the Artifacts dir if the limit is greater than zero
+func (tc *testContext) waitUntilJobSucceedsWithLogLimit(name string, limitBytes int64) error {
 	var job *batchv1.Job
 	var err error
 	var labelSelector string
@@ -839,24 +857,30 @@ func (tc *testContext) waitUntilJobSucceeds(name string) error {
 		}
 		labelSelector = "job-name=" + job.Name
 		if job.Status.Succeeded > 0 {
-			tc.writePodLogs(labelSelector)
+			tc.writePodLogsWithLimit(labelSelector, limitBytes)
 			return nil
 		}
 		if job.Status.Failed > 0 {
-			tc.writePodLogs(labelSelector)
+			tc.writePodLogsWithLimit(labelSelector, limitBytes)
 			events, _ := tc.getPodEvents(name)
 			return fmt.Errorf("job %v failed: %v", job, events)
 		}
 		time.Sleep(retryInterval)
 	}
-	tc.writePodLogs(labelSelector)
+	tc.writePodLogsWithLimit(labelSelector, limitBytes)
 	events, _ := tc.getPodEvents(name)
 	return fmt.Errorf("job %v timed out: %v", job, events)
 }
 
 // writePodLogs writes the logs associated with the label selector of a given pod job or deployment to the Artifacts dir
 func (tc *testContext) writePodLogs(labelSelector string) {
-	logs, err := tc.getLogs(labelSelector)
+	tc.writePodLogsWithLimit(labelSelector, 0)
+}
+
+// writePodLogsWithLimit behaves as writePodLogs, cutting off the logs of each pod at the given size if it is greater
+// than zero
+func (tc *testContext) writePodLogsWithLimit(labelSelector string, limitBytes int64) {
+	logs, _, err := tc.getLogsWithLimit(labelSelector, limitBytes)
 	if err != nil {
 		log.Printf("Unable to get logs associated with pod: %s", labelSelector)
 		return
@@ -107,9 +107,13 @@ func getLatestWindowsAMI(region string, windowsServerVersion windows.ServerVersi
 }
 
 // GenerateMachineSet generates a Windows MachineSet which is AWS provider specific
-func (a *Provider) GenerateMachineSet(withIgnoreLabel bool, replicas int32, windowsServerVersion windows.ServerVersion) (*mapi.MachineSet, error) {
+func (a *Provider) GenerateMachineSet(ctx context.Context, withIgnoreLabel bool, replicas int32,
+	windowsServerVersion windows.ServerVersion) (*mapi.MachineSet, error) {
+	if err := windows.CheckVersion(a.GetType(), a.SupportedWindowsVersions(), windowsServerVersion); err != nil {
+		return nil, err
+	}
 	listOptions := meta.ListOptions{LabelSelector: "machine.openshift.io/cluster-api-machine-role=worker"}
-	machines, err := a.oc.Machine.Machines(clusterinfo.MachineAPINamespace).List(context.TODO(), listOptions)
+	machines, err := a.oc.Machine.Machines(clusterinfo.MachineAPINamespace).List(ctx, listOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -148,10 +152,20 @@ func (a *Provider) GetType() config.PlatformType {
 	return config.AWSPlatformType
 }
 
+// SupportedWindowsVersions returns the Windows Server versions MachineSets can be generated for
+func (a *Provider) SupportedWindowsVersions() []windows.ServerVersion {
+	return []windows.ServerVersion{windows.Server2019, windows.Server2022}
+}
+
+// DefaultAdminUsername returns the local administrator of the Windows images used in CI
+func (a *Provider) DefaultAdminUsername() string {
+	return windows.DefaultAdminUsername
+}
+
 func (a *Provider) StorageSupport() bool {
 	return false
 }
 
-func (a *Provider) CreatePVC(_ client.Interface, _ string, _ *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
+func (a *Provider) CreatePVC(_ context.Context, _ client.Interface, _ string, _ *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
 	return nil, fmt.Errorf("storage not supported on AWS")
 }
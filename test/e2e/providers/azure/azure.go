@@ -91,9 +91,13 @@ func (p *Provider) newAzureMachineProviderSpec(location string, zone string, win
 }
 
 // GenerateMachineSet generates the machineset object which is aws provider specific
-func (p *Provider) GenerateMachineSet(withIgnoreLabel bool, replicas int32, windowsServerVersion windows.ServerVersion) (*mapi.MachineSet, error) {
+func (p *Provider) GenerateMachineSet(ctx context.Context, withIgnoreLabel bool, replicas int32,
+	windowsServerVersion windows.ServerVersion) (*mapi.MachineSet, error) {
+	if err := windows.CheckVersion(p.GetType(), p.SupportedWindowsVersions(), windowsServerVersion); err != nil {
+		return nil, err
+	}
 	// Inspect master-0 to get Azure Location and Zone
-	machines, err := p.oc.Machine.Machines(clusterinfo.MachineAPINamespace).Get(context.TODO(),
+	machines, err := p.oc.Machine.Machines(clusterinfo.MachineAPINamespace).Get(ctx,
 		p.InfrastructureName+"-master-0", meta.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get master-0 machine resource: %v", err)
@@ -123,12 +127,22 @@ func (p *Provider) GetType() config.PlatformType {
 	return config.AzurePlatformType
 }
 
+// SupportedWindowsVersions returns the Windows Server versions MachineSets can be generated for
+func (p *Provider) SupportedWindowsVersions() []windows.ServerVersion {
+	return []windows.ServerVersion{windows.Server2019, windows.Server2022}
+}
+
+// DefaultAdminUsername returns "capi", the local administrator created on Azure Windows VMs in place of Administrator
+func (p *Provider) DefaultAdminUsername() string {
+	return "capi"
+}
+
 func (p *Provider) StorageSupport() bool {
 	return true
 }
 
-func (p *Provider) CreatePVC(c client.Interface, namespace string, _ *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
-	if err := p.ensureWindowsCSIDaemonSet(c); err != nil {
+func (p *Provider) CreatePVC(ctx context.Context, c client.Interface, namespace string, _ *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
+	if err := p.ensureWindowsCSIDaemonSet(ctx, c); err != nil {
 		return nil, err
 	}
 	storageClassName := "azurefile-csi"
@@ -144,11 +158,11 @@ func (p *Provider) CreatePVC(c client.Interface, namespace string, _ *core.Persi
 			StorageClassName: &storageClassName,
 		},
 	}
-	return c.CoreV1().PersistentVolumeClaims(namespace).Create(context.TODO(), &pvcSpec, meta.CreateOptions{})
+	return c.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, &pvcSpec, meta.CreateOptions{})
 }
 
 // ensureWindowsCSIDaemonSet deploys the Windows CSI driver DaemonSet if it doesn't already exist
-func (p *Provider) ensureWindowsCSIDaemonSet(client client.Interface) error {
+func (p *Provider) ensureWindowsCSIDaemonSet(ctx context.Context, client client.Interface) error {
 	dsName := "azure-file-csi-driver-node-windows"
 	directoryType := core.HostPathDirectory
 	directoryOrCreate := core.HostPathDirectoryOrCreate
@@ -314,7 +328,7 @@ func (p *Provider) ensureWindowsCSIDaemonSet(client client.Interface) error {
 		},
 	}
 	// See if the DaemonSet already exists in the state we expect it to be in.
-	existingDS, err := client.AppsV1().DaemonSets(csiNamespace).Get(context.TODO(), dsName, meta.GetOptions{})
+	existingDS, err := client.AppsV1().DaemonSets(csiNamespace).Get(ctx, dsName, meta.GetOptions{})
 	if err != nil {
 		if !k8sapierrors.IsNotFound(err) {
 			return fmt.Errorf("error getting existing Windows CSI DaemonSet: %w", err)
@@ -325,13 +339,13 @@ func (p *Provider) ensureWindowsCSIDaemonSet(client client.Interface) error {
 			return nil
 		}
 		// Delete the DaemonSet as it has the wrong spec.
-		err = client.AppsV1().DaemonSets(csiNamespace).Delete(context.TODO(), dsName, meta.DeleteOptions{})
+		err = client.AppsV1().DaemonSets(csiNamespace).Delete(ctx, dsName, meta.DeleteOptions{})
 		if err != nil {
 			return fmt.Errorf("error deleting existing Windows CSI DaemonSet: %w", err)
 
 		}
 	}
-	_, err = client.AppsV1().DaemonSets(csiNamespace).Create(context.TODO(), &ds, meta.CreateOptions{})
+	_, err = client.AppsV1().DaemonSets(csiNamespace).Create(ctx, &ds, meta.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("error creating Windows CSI DaemonSet: %w", err)
 	}
@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 
 	config "github.com/openshift/api/config/v1"
@@ -18,21 +19,38 @@ import (
 	"github.com/openshift/windows-machine-config-operator/test/e2e/windows"
 )
 
+// CloudProvider is implemented by each platform's e2e provider
 type CloudProvider interface {
 	// GenerateMachineSet generates provider specific Windows Server version MachineSet with the given replicas and
 	// the ignore label if the boolean is set
-	GenerateMachineSet(bool, int32, windows.ServerVersion) (*mapi.MachineSet, error)
+	GenerateMachineSet(context.Context, bool, int32, windows.ServerVersion) (*mapi.MachineSet, error)
 	// GetType returns the cloud provider type ex: AWS, Azure etc
 	GetType() config.PlatformType
+	// SupportedWindowsVersions returns the Windows Server versions supported on the platform. GenerateMachineSet
+	// returns windows.ErrUnsupportedVersion for any other version.
+	SupportedWindowsVersions() []windows.ServerVersion
+	// DefaultAdminUsername returns the name of the local administrator which can be used to log into the Windows
+	// instances of the platform
+	DefaultAdminUsername() string
 	// StorageSupport indicates if we support Windows storage on this provider
 	StorageSupport() bool
 	// CreatePVC creates a new PersistentVolumeClaim that can be used by a workload. The PVC will be created with
 	// the given client, in the given namespace. If a PV is provided, the PVC will be provisioned from the PVC. Else,
 	// it will be dynamically provisioned via a StorageClass.
-	CreatePVC(client.Interface, string, *core.PersistentVolume) (*core.PersistentVolumeClaim, error)
+	CreatePVC(context.Context, client.Interface, string, *core.PersistentVolume) (*core.PersistentVolumeClaim, error)
 }
 
-// NewCloudProvider returns a CloudProvider interface or an error
+// compile time checks that every platform's provider implements CloudProvider
+var (
+	_ CloudProvider = &awsProvider.Provider{}
+	_ CloudProvider = &azureProvider.Provider{}
+	_ CloudProvider = &gcpProvider.Provider{}
+	_ CloudProvider = &vSphereProvider.Provider{}
+	_ CloudProvider = &nutanixProvider.Provider{}
+	_ CloudProvider = &noneProvider.Provider{}
+)
+
+// NewCloudProvider returns the CloudProvider for the platform of the cluster under test, or an error
 func NewCloudProvider() (CloudProvider, error) {
 	openshift, err := oc.GetOpenShift()
 	if err != nil {
@@ -42,20 +60,26 @@ func NewCloudProvider() (CloudProvider, error) {
 	if err != nil {
 		return nil, fmt.Errorf("getting cloud provider type: %w", err)
 	}
-	switch provider := infra.Status.PlatformStatus.Type; provider {
+	return NewForPlatform(infra.Status.PlatformStatus.Type, openshift, &infra.Status)
+}
+
+// NewForPlatform returns the CloudProvider for the given platform type, or an error if the platform is not supported
+func NewForPlatform(platformType config.PlatformType, openshift *oc.OpenShift,
+	infraStatus *config.InfrastructureStatus) (CloudProvider, error) {
+	switch platformType {
 	case config.AWSPlatformType:
-		return awsProvider.New(openshift, &infra.Status)
+		return awsProvider.New(openshift, infraStatus)
 	case config.AzurePlatformType:
-		return azureProvider.New(openshift, &infra.Status), nil
+		return azureProvider.New(openshift, infraStatus), nil
 	case config.GCPPlatformType:
-		return gcpProvider.New(openshift, &infra.Status), nil
+		return gcpProvider.New(openshift, infraStatus), nil
 	case config.VSpherePlatformType:
-		return vSphereProvider.New(openshift, &infra.Status)
+		return vSphereProvider.New(openshift, infraStatus)
 	case config.NutanixPlatformType:
-		return nutanixProvider.New(openshift, &infra.Status)
+		return nutanixProvider.New(openshift, infraStatus)
 	case config.NonePlatformType:
 		return noneProvider.New(openshift)
 	default:
-		return nil, fmt.Errorf("the '%v' cloud provider is not supported", provider)
+		return nil, fmt.Errorf("the '%v' cloud provider is not supported", platformType)
 	}
 }
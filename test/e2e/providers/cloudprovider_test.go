@@ -0,0 +1,132 @@
+package providers
+
+import (
+	"context"
+	"testing"
+
+	config "github.com/openshift/api/config/v1"
+	"github.com/stretchr/testify/assert"
+
+	awsProvider "github.com/openshift/windows-machine-config-operator/test/e2e/providers/aws"
+	azureProvider "github.com/openshift/windows-machine-config-operator/test/e2e/providers/azure"
+	gcpProvider "github.com/openshift/windows-machine-config-operator/test/e2e/providers/gcp"
+	noneProvider "github.com/openshift/windows-machine-config-operator/test/e2e/providers/none"
+	nutanixProvider "github.com/openshift/windows-machine-config-operator/test/e2e/providers/nutanix"
+	vSphereProvider "github.com/openshift/windows-machine-config-operator/test/e2e/providers/vsphere"
+	"github.com/openshift/windows-machine-config-operator/test/e2e/windows"
+)
+
+func TestSupportedWindowsVersions(t *testing.T) {
+	testCases := []struct {
+		provider CloudProvider
+		expected []windows.ServerVersion
+	}{
+		{
+			provider: &awsProvider.Provider{},
+			expected: []windows.ServerVersion{windows.Server2019, windows.Server2022},
+		},
+		{
+			provider: &azureProvider.Provider{},
+			expected: []windows.ServerVersion{windows.Server2019, windows.Server2022},
+		},
+		{
+			provider: &gcpProvider.Provider{},
+			expected: []windows.ServerVersion{windows.Server2019, windows.Server2022},
+		},
+		{
+			provider: &vSphereProvider.Provider{},
+			expected: []windows.ServerVersion{windows.Server2022},
+		},
+		{
+			provider: &nutanixProvider.Provider{},
+			expected: []windows.ServerVersion{windows.Server2022},
+		},
+		{
+			provider: &noneProvider.Provider{},
+			expected: []windows.ServerVersion{windows.Server2019, windows.Server2022},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(string(test.provider.GetType()), func(t *testing.T) {
+			supported := test.provider.SupportedWindowsVersions()
+			assert.Equal(t, test.expected, supported)
+			// the default version must be usable on every platform
+			assert.NoError(t, windows.CheckVersion(test.provider.GetType(), supported, ""))
+			for _, version := range supported {
+				assert.True(t, windows.IsSupported(version), "version %s is not supported by the e2e test", version)
+			}
+		})
+	}
+}
+
+func TestGenerateMachineSetRejectsUnsupportedVersions(t *testing.T) {
+	// the version is validated before the cluster is queried, so providers without clients can be used
+	for _, provider := range []CloudProvider{&vSphereProvider.Provider{}, &nutanixProvider.Provider{}} {
+		t.Run(string(provider.GetType()), func(t *testing.T) {
+			_, err := provider.GenerateMachineSet(context.Background(), false, 1, windows.Server2019)
+			assert.ErrorIs(t, err, windows.ErrUnsupportedVersion)
+		})
+	}
+	t.Run("unknown version", func(t *testing.T) {
+		_, err := (&awsProvider.Provider{}).GenerateMachineSet(context.Background(), false, 1, "2016")
+		assert.ErrorIs(t, err, windows.ErrUnsupportedVersion)
+	})
+}
+
+func TestCheckVersion(t *testing.T) {
+	supported := []windows.ServerVersion{windows.Server2022}
+	assert.NoError(t, windows.CheckVersion(config.VSpherePlatformType, supported, windows.Server2022))
+	assert.NoError(t, windows.CheckVersion(config.VSpherePlatformType, supported, ""))
+	err := windows.CheckVersion(config.VSpherePlatformType, supported, windows.Server2019)
+	assert.ErrorIs(t, err, windows.ErrUnsupportedVersion)
+	assert.ErrorContains(t, err, "VSphere")
+}
+
+func TestDefaultAdminUsername(t *testing.T) {
+	testCases := []struct {
+		provider CloudProvider
+		expected string
+	}{
+		{
+			provider: &awsProvider.Provider{},
+			expected: "Administrator",
+		},
+		{
+			provider: &azureProvider.Provider{},
+			expected: "capi",
+		},
+		{
+			provider: &gcpProvider.Provider{},
+			expected: "Administrator",
+		},
+		{
+			provider: &vSphereProvider.Provider{},
+			expected: "Administrator",
+		},
+		{
+			provider: &nutanixProvider.Provider{},
+			expected: "Administrator",
+		},
+		{
+			provider: &noneProvider.Provider{},
+			expected: "Administrator",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(string(test.provider.GetType()), func(t *testing.T) {
+			// the vSphere override must not leak into the defaults
+			t.Setenv("VM_ADMIN_USERNAME", "")
+			assert.Equal(t, test.expected, test.provider.DefaultAdminUsername())
+		})
+	}
+}
+
+func TestEnsurePVCIfSupportedUnsupportedStorage(t *testing.T) {
+	for _, provider := range []CloudProvider{&awsProvider.Provider{}, &gcpProvider.Provider{},
+		&nutanixProvider.Provider{}} {
+		t.Run(string(provider.GetType()), func(t *testing.T) {
+			_, err := EnsurePVCIfSupported(context.Background(), provider, nil, "default", nil)
+			assert.ErrorIs(t, err, ErrStorageUnsupported)
+		})
+	}
+}
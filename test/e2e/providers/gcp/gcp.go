@@ -31,8 +31,12 @@ func New(clientset *clusterinfo.OpenShift, infraStatus *config.InfrastructureSta
 }
 
 // GenerateMachineSet generates a MachineSet object which is GCP provider specific
-func (p *Provider) GenerateMachineSet(withIgnoreLabel bool, replicas int32, windowsServerVersion windows.ServerVersion) (*mapi.MachineSet, error) {
-	gcpSpec, err := p.newGCPProviderSpec(windowsServerVersion)
+func (p *Provider) GenerateMachineSet(ctx context.Context, withIgnoreLabel bool, replicas int32,
+	windowsServerVersion windows.ServerVersion) (*mapi.MachineSet, error) {
+	if err := windows.CheckVersion(p.GetType(), p.SupportedWindowsVersions(), windowsServerVersion); err != nil {
+		return nil, err
+	}
+	gcpSpec, err := p.newGCPProviderSpec(ctx, windowsServerVersion)
 	if err != nil {
 		return nil, err
 	}
@@ -44,9 +48,10 @@ func (p *Provider) GenerateMachineSet(withIgnoreLabel bool, replicas int32, wind
 }
 
 // newGCPProviderSpec returns a GCPMachineProviderSpec which describes a Windows server 2022 VM
-func (p *Provider) newGCPProviderSpec(windowsServerVersion windows.ServerVersion) (*mapi.GCPMachineProviderSpec, error) {
+func (p *Provider) newGCPProviderSpec(ctx context.Context,
+	windowsServerVersion windows.ServerVersion) (*mapi.GCPMachineProviderSpec, error) {
 	listOptions := meta.ListOptions{LabelSelector: "machine.openshift.io/cluster-api-machine-role=worker"}
-	machines, err := p.oc.Machine.Machines(clusterinfo.MachineAPINamespace).List(context.TODO(), listOptions)
+	machines, err := p.oc.Machine.Machines(clusterinfo.MachineAPINamespace).List(ctx, listOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -95,11 +100,21 @@ func (p *Provider) GetType() config.PlatformType {
 	return config.GCPPlatformType
 }
 
+// SupportedWindowsVersions returns the Windows Server versions MachineSets can be generated for
+func (p *Provider) SupportedWindowsVersions() []windows.ServerVersion {
+	return []windows.ServerVersion{windows.Server2019, windows.Server2022}
+}
+
+// DefaultAdminUsername returns the local administrator of the Windows images used in CI
+func (p *Provider) DefaultAdminUsername() string {
+	return windows.DefaultAdminUsername
+}
+
 func (p *Provider) StorageSupport() bool {
 	return false
 }
 
-func (p *Provider) CreatePVC(_ client.Interface, _ string, _ *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
+func (p *Provider) CreatePVC(_ context.Context, _ client.Interface, _ string, _ *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
 	return nil, fmt.Errorf("storage not supported on gcp")
 }
 
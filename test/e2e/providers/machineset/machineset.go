@@ -1,16 +1,52 @@
 package machineset
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
 	mapi "github.com/openshift/api/machine/v1beta1"
+	mapiClient "github.com/openshift/client-go/machine/clientset/versioned/typed/machine/v1beta1"
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreClient "k8s.io/client-go/kubernetes/typed/core/v1"
+	k8sretry "k8s.io/client-go/util/retry"
 
 	"github.com/openshift/windows-machine-config-operator/controllers"
+	"github.com/openshift/windows-machine-config-operator/pkg/retry"
 	"github.com/openshift/windows-machine-config-operator/test/e2e/clusterinfo"
 )
 
-// New returns a new MachineSet for use with the e2e test suite
+// runningPhase is the phase of a Machine whose instance is running
+const runningPhase = "Running"
+
+var (
+	// ErrNoMachineSets is returned when no existing MachineSet matches the given criteria
+	ErrNoMachineSets = errors.New("no matching machinesets found")
+	// ErrNoProviderSpec is returned when a MachineSet does not hold a provider spec
+	ErrNoProviderSpec = errors.New("no provider spec found")
+)
+
+// New returns a new MachineSet for use with the e2e test suite. If withIgnoreLabel is set, the Machines of the MachineSet
+// are labeled to be ignored by the Windows Machine controller, see HasIgnoreLabel. withPrefix is prepended to the name
+// of the MachineSet, so that it can be told apart from the MachineSets of other clusters sharing the same account, an
+// empty prefix is valid.
 func New(rawProvider []byte, infrastructureName string, replicas int32, withIgnoreLabel bool, withPrefix string) *mapi.MachineSet {
+	return NewWithSpec(rawProvider, infrastructureName, replicas, withIgnoreLabel, withPrefix, nil, nil)
+}
+
+// NewWithSpec returns a new MachineSet for use with the e2e test suite, whose Machines result in Nodes with the given
+// labels and taints in addition to the default ones
+func NewWithSpec(rawProvider []byte, infrastructureName string, replicas int32, withIgnoreLabel bool, withPrefix string,
+	nodeLabels map[string]string, nodeTaints []core.Taint) *mapi.MachineSet {
 	machineSetName := machineSetName(withIgnoreLabel, withPrefix)
 	matchLabels := map[string]string{
 		mapi.MachineClusterIDLabel:   infrastructureName,
@@ -18,7 +54,7 @@ func New(rawProvider []byte, infrastructureName string, replicas int32, withIgno
 		clusterinfo.MachineOSIDLabel: "Windows",
 	}
 	if withIgnoreLabel {
-		matchLabels[controllers.IgnoreLabel] = "true"
+		matchLabels[controllers.IgnoreLabel] = controllers.IgnoreLabelValue
 	}
 	matchLabels[clusterinfo.MachineSetLabel] = machineSetName
 
@@ -31,6 +67,13 @@ func New(rawProvider []byte, infrastructureName string, replicas int32, withIgno
 		machineLabels[k] = v
 	}
 
+	allNodeLabels := map[string]string{
+		"node-role.kubernetes.io/worker": "",
+	}
+	for k, v := range nodeLabels {
+		allNodeLabels[k] = v
+	}
+
 	// Set up the test machineSet
 	return &mapi.MachineSet{
 		ObjectMeta: meta.ObjectMeta{
@@ -50,10 +93,9 @@ func New(rawProvider []byte, infrastructureName string, replicas int32, withIgno
 				ObjectMeta: mapi.ObjectMeta{Labels: machineLabels},
 				Spec: mapi.MachineSpec{
 					ObjectMeta: mapi.ObjectMeta{
-						Labels: map[string]string{
-							"node-role.kubernetes.io/worker": "",
-						},
+						Labels: allNodeLabels,
 					},
+					Taints: nodeTaints,
 					ProviderSpec: mapi.ProviderSpec{
 						Value: &runtime.RawExtension{Raw: rawProvider},
 					},
@@ -63,6 +105,95 @@ func New(rawProvider []byte, infrastructureName string, replicas int32, withIgno
 	}
 }
 
+// Selector picks the existing MachineSet a provider spec is taken from, such as the MachineSet of a given zone in a
+// multi-zone cluster. The zero value selects the first MachineSet listed.
+type Selector struct {
+	// Name is the name of the MachineSet to select. Any name matches if empty.
+	Name string
+	// MatchLabels are the labels the MachineSet to select must have
+	MatchLabels map[string]string
+}
+
+// GetExistingProviderSpec unmarshals the provider spec of the first MachineSet of the cluster with the given
+// infrastructure name into out, which must be a pointer to the provider spec type of the platform. Listing the
+// MachineSets is retried while none are found or the API returns a transient error, as the MachineSets may still be
+// being reconciled right after installation. Returns an error wrapping ErrNoMachineSets if none are found in time, and
+// ErrNoProviderSpec if the MachineSet holds no provider spec.
+func GetExistingProviderSpec(ctx context.Context, c mapiClient.MachineV1beta1Interface, infraName string,
+	out interface{}) error {
+	return getExistingProviderSpec(ctx, c, infraName, Selector{}, out, retry.Interval, retry.Timeout)
+}
+
+// GetSelectedProviderSpec behaves as GetExistingProviderSpec, taking the provider spec from the first MachineSet
+// matching the given selector
+func GetSelectedProviderSpec(ctx context.Context, c mapiClient.MachineV1beta1Interface, infraName string,
+	selector Selector, out interface{}) error {
+	return getExistingProviderSpec(ctx, c, infraName, selector, out, retry.Interval, retry.Timeout)
+}
+
+// getExistingProviderSpec behaves as GetSelectedProviderSpec, listing the MachineSets at the given interval
+func getExistingProviderSpec(ctx context.Context, c mapiClient.MachineV1beta1Interface, infraName string,
+	selector Selector, out interface{}, interval, timeout time.Duration) error {
+	matchLabels := labels.Set{mapi.MachineClusterIDLabel: infraName}
+	for key, value := range selector.MatchLabels {
+		matchLabels[key] = value
+	}
+	listOptions := meta.ListOptions{LabelSelector: labels.SelectorFromSet(matchLabels).String()}
+	// matching is the first listed MachineSet matching the selector
+	var matching *mapi.MachineSet
+	// lastErr is the transient error of the last attempt, if any
+	var lastErr error
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		machineSets, err := c.MachineSets(clusterinfo.MachineAPINamespace).List(ctx, listOptions)
+		if err != nil {
+			if retry.IsTransientAPIError(err) {
+				log.Printf("error listing machinesets with label selector %s, retrying: %v", listOptions.LabelSelector,
+					err)
+				lastErr = err
+				return false, nil
+			}
+			return false, fmt.Errorf("unable to get machinesets: %w", err)
+		}
+		lastErr = nil
+		for i := range machineSets.Items {
+			if selector.Name == "" || machineSets.Items[i].GetName() == selector.Name {
+				matching = &machineSets.Items[i]
+				return true, nil
+			}
+		}
+		log.Printf("no matching machinesets found with label selector %s and name %q, retrying",
+			listOptions.LabelSelector, selector.Name)
+		return false, nil
+	})
+	if err != nil {
+		// a cancellation of the given context is reported as is, rather than as the poll timing out
+		if wait.Interrupted(err) && ctx.Err() == nil {
+			if lastErr != nil {
+				return fmt.Errorf("unable to get machinesets with label selector %s: %w", listOptions.LabelSelector,
+					lastErr)
+			}
+			return fmt.Errorf("%w with label selector %s and name %q", ErrNoMachineSets, listOptions.LabelSelector,
+				selector.Name)
+		}
+		return err
+	}
+
+	providerSpecRaw := matching.Spec.Template.Spec.ProviderSpec.Value
+	if providerSpecRaw == nil || providerSpecRaw.Raw == nil {
+		return fmt.Errorf("%w in MachineSet %s", ErrNoProviderSpec, matching.GetName())
+	}
+	if err = json.Unmarshal(providerSpecRaw.Raw, out); err != nil {
+		return fmt.Errorf("unable to unmarshal providerSpec of MachineSet %s: %w", matching.GetName(), err)
+	}
+	return nil
+}
+
+// HasIgnoreLabel returns true if the Machines created by the given MachineSet are labeled to be ignored by the Windows
+// Machine controller
+func HasIgnoreLabel(ms *mapi.MachineSet) bool {
+	return ms.Spec.Template.ObjectMeta.Labels[controllers.IgnoreLabel] == controllers.IgnoreLabelValue
+}
+
 // machineSetName returns the name of the Windows MachineSet with the specified prefix created in the e2e tests
 // depending on if the ignore label is set or not
 func machineSetName(isIgnoreLabelSet bool, prefix string) string {
@@ -72,3 +203,163 @@ func machineSetName(isIgnoreLabelSet bool, prefix string) string {
 	// Designate MachineSets that will be configured by the Windows Machine controller "e2e-wm"
 	return prefix + "e2e-wm"
 }
+
+// WaitForMachineCount waits until the given number of Machines belonging to the MachineSet with the given name and
+// namespace report the Running phase. Returns an error listing the phases observed if the timeout is reached first.
+func WaitForMachineCount(ctx context.Context, c mapiClient.MachineV1beta1Interface, name, namespace string,
+	expected int, timeout time.Duration) error {
+	machineSet, err := c.MachineSets(namespace).Get(ctx, name, meta.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get MachineSet %s/%s: %w", namespace, name, err)
+	}
+	selector, err := meta.LabelSelectorAsSelector(&machineSet.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector for MachineSet %s/%s: %w", namespace, name, err)
+	}
+	listOptions := meta.ListOptions{LabelSelector: selector.String()}
+
+	var phases map[string]int
+	err = wait.PollUntilContextTimeout(ctx, retry.Interval, timeout, true, func(ctx context.Context) (bool, error) {
+		machines, err := c.Machines(namespace).List(ctx, listOptions)
+		if err != nil {
+			log.Printf("error listing Machines with label selector %s, retrying: %v", listOptions.LabelSelector, err)
+			return false, nil
+		}
+		phases = machinePhases(machines.Items)
+		if phases[runningPhase] != expected {
+			log.Printf("waiting for %d Running Machines in MachineSet %s, found phases %v", expected, name, phases)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("%d Machines of MachineSet %s/%s did not reach phase %s, observed phases %v: %w",
+			expected, namespace, name, runningPhase, phases, err)
+	}
+	return nil
+}
+
+// machinePhases returns the number of the given Machines in each phase. Machines without a phase are counted under an
+// empty phase.
+func machinePhases(machines []mapi.Machine) map[string]int {
+	phases := make(map[string]int)
+	for _, machine := range machines {
+		phase := ""
+		if machine.Status.Phase != nil {
+			phase = *machine.Status.Phase
+		}
+		phases[phase]++
+	}
+	return phases
+}
+
+// DeleteAndWait scales the MachineSet with the given name and namespace down to zero, deletes it, and waits until its
+// Machines and their Nodes are gone, so that no Windows VM outlives the test which created it. Returns an error listing
+// the remaining Machines and Nodes if the timeout is reached first. Deleting a MachineSet which does not exist is a
+// no-op.
+func DeleteAndWait(ctx context.Context, c mapiClient.MachineV1beta1Interface, nodes coreClient.NodeInterface, name,
+	namespace string, timeout time.Duration) error {
+	return deleteAndWait(ctx, c, nodes, name, namespace, retry.Interval, timeout)
+}
+
+// deleteAndWait behaves as DeleteAndWait, checking for the remaining Machines and Nodes at the given interval
+func deleteAndWait(ctx context.Context, c mapiClient.MachineV1beta1Interface, nodes coreClient.NodeInterface, name,
+	namespace string, interval, timeout time.Duration) error {
+	machineSet, err := c.MachineSets(namespace).Get(ctx, name, meta.GetOptions{})
+	if err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get MachineSet %s/%s: %w", namespace, name, err)
+	}
+	selector, err := meta.LabelSelectorAsSelector(&machineSet.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector for MachineSet %s/%s: %w", namespace, name, err)
+	}
+	listOptions := meta.ListOptions{LabelSelector: selector.String()}
+
+	// nodeNames are the Nodes of the Machines of the MachineSet, tracked until they are gone
+	nodeNames := make(map[string]struct{})
+	machines, err := c.Machines(namespace).List(ctx, listOptions)
+	if err != nil {
+		return fmt.Errorf("unable to list Machines of MachineSet %s/%s: %w", namespace, name, err)
+	}
+	addNodeNames(nodeNames, machines.Items)
+
+	if err = scaleToZero(ctx, c, name, namespace); err != nil {
+		return err
+	}
+	err = c.MachineSets(namespace).Delete(ctx, name, meta.DeleteOptions{})
+	if err != nil && !k8sapierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete MachineSet %s/%s: %w", namespace, name, err)
+	}
+
+	var remainingMachines, remainingNodes []string
+	err = wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		machines, err := c.Machines(namespace).List(ctx, listOptions)
+		if err != nil {
+			log.Printf("error listing Machines with label selector %s, retrying: %v", listOptions.LabelSelector, err)
+			return false, nil
+		}
+		// a Machine may have been associated with its Node since it was last listed
+		addNodeNames(nodeNames, machines.Items)
+		remainingMachines = remainingMachines[:0]
+		for _, machine := range machines.Items {
+			remainingMachines = append(remainingMachines, machine.GetName())
+		}
+		remainingNodes = remainingNodes[:0]
+		for nodeName := range nodeNames {
+			_, err = nodes.Get(ctx, nodeName, meta.GetOptions{})
+			if err == nil {
+				remainingNodes = append(remainingNodes, nodeName)
+			} else if k8sapierrors.IsNotFound(err) {
+				delete(nodeNames, nodeName)
+			} else {
+				log.Printf("error getting Node %s, retrying: %v", nodeName, err)
+				remainingNodes = append(remainingNodes, nodeName)
+			}
+		}
+		if len(remainingMachines) > 0 || len(remainingNodes) > 0 {
+			log.Printf("waiting for the deletion of MachineSet %s, remaining Machines %v and Nodes %v", name,
+				remainingMachines, remainingNodes)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		sort.Strings(remainingNodes)
+		return fmt.Errorf("MachineSet %s/%s not fully deleted, remaining Machines %v and Nodes %v: %w", namespace,
+			name, remainingMachines, remainingNodes, err)
+	}
+	return nil
+}
+
+// scaleToZero sets the replicas of the MachineSet with the given name and namespace to zero, retrying on conflict
+func scaleToZero(ctx context.Context, c mapiClient.MachineV1beta1Interface, name, namespace string) error {
+	err := k8sretry.RetryOnConflict(k8sretry.DefaultBackoff, func() error {
+		machineSet, err := c.MachineSets(namespace).Get(ctx, name, meta.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if machineSet.Spec.Replicas != nil && *machineSet.Spec.Replicas == 0 {
+			return nil
+		}
+		replicas := int32(0)
+		machineSet.Spec.Replicas = &replicas
+		_, err = c.MachineSets(namespace).Update(ctx, machineSet, meta.UpdateOptions{})
+		return err
+	})
+	if err != nil && !k8sapierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to scale MachineSet %s/%s to zero: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// addNodeNames adds the names of the Nodes of the given Machines to the given set
+func addNodeNames(nodeNames map[string]struct{}, machines []mapi.Machine) {
+	for _, machine := range machines {
+		if machine.Status.NodeRef != nil && machine.Status.NodeRef.Name != "" {
+			nodeNames[machine.Status.NodeRef.Name] = struct{}{}
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package machineset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	mapi "github.com/openshift/api/machine/v1beta1"
+	mapiClient "github.com/openshift/client-go/machine/clientset/versioned/typed/machine/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	coreClient "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/openshift/windows-machine-config-operator/controllers"
+	"github.com/openshift/windows-machine-config-operator/test/e2e/clusterinfo"
+)
+
+func TestNewWithSpec(t *testing.T) {
+	taints := []core.Taint{{Key: "os", Value: "Windows", Effect: core.TaintEffectNoSchedule}}
+	testCases := []struct {
+		name            string
+		withIgnoreLabel bool
+		labels          map[string]string
+		taints          []core.Taint
+		expectedLabels  map[string]string
+	}{
+		{
+			name:           "defaults",
+			expectedLabels: map[string]string{"node-role.kubernetes.io/worker": ""},
+		},
+		{
+			name:            "custom labels and taints with ignore label",
+			withIgnoreLabel: true,
+			labels:          map[string]string{"app": "windows-workload"},
+			taints:          taints,
+			expectedLabels:  map[string]string{"node-role.kubernetes.io/worker": "", "app": "windows-workload"},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ms := NewWithSpec([]byte("{}"), "infra", 1, test.withIgnoreLabel, "", test.labels, test.taints)
+			assert.Equal(t, test.expectedLabels, ms.Spec.Template.Spec.ObjectMeta.Labels)
+			assert.Equal(t, test.taints, ms.Spec.Template.Spec.Taints)
+			_, ignored := ms.Spec.Selector.MatchLabels[controllers.IgnoreLabel]
+			assert.Equal(t, test.withIgnoreLabel, ignored)
+			assert.Equal(t, test.withIgnoreLabel, HasIgnoreLabel(ms))
+			assert.Equal(t, ms.Spec.Selector.MatchLabels, filterLabels(ms.Spec.Template.ObjectMeta.Labels,
+				ms.Spec.Selector.MatchLabels))
+		})
+	}
+}
+
+func TestHasIgnoreLabel(t *testing.T) {
+	for _, withIgnoreLabel := range []bool{true, false} {
+		ms := New([]byte("{}"), "infra", 1, withIgnoreLabel, "infra-")
+		assert.Equal(t, withIgnoreLabel, HasIgnoreLabel(ms), "withIgnoreLabel %t", withIgnoreLabel)
+	}
+	// a label with any other value does not cause the Machines to be ignored
+	ms := New([]byte("{}"), "infra", 1, false, "")
+	ms.Spec.Template.ObjectMeta.Labels[controllers.IgnoreLabel] = "false"
+	assert.False(t, HasIgnoreLabel(ms))
+}
+
+// filterLabels returns the labels which have a key present in the given selector
+func filterLabels(labels, selector map[string]string) map[string]string {
+	filtered := make(map[string]string)
+	for k := range selector {
+		if v, ok := labels[k]; ok {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+func TestMachinePhases(t *testing.T) {
+	phase := func(p string) *string { return &p }
+	machines := []mapi.Machine{
+		{Status: mapi.MachineStatus{Phase: phase("Running")}},
+		{Status: mapi.MachineStatus{Phase: phase("Provisioned")}},
+		{Status: mapi.MachineStatus{Phase: phase("Running")}},
+		{Status: mapi.MachineStatus{}},
+	}
+	assert.Equal(t, map[string]int{"Running": 2, "Provisioned": 1, "": 1}, machinePhases(machines))
+	assert.Empty(t, machinePhases(nil))
+}
+
+// fakeCluster holds the MachineSets, Machines and Nodes of a cluster, deleting the Machines of a MachineSet scaled to
+// zero one at a time, along with their Nodes, as the Machine API would
+type fakeCluster struct {
+	machineSets map[string]*mapi.MachineSet
+	machines    map[string]*mapi.Machine
+	nodes       map[string]*core.Node
+	// stuck are the Machines which are never deleted, as if blocked by a finalizer
+	stuck map[string]bool
+	// calls are the MachineSet changes made, in order
+	calls []string
+}
+
+// fakeMachineClient implements the subset of mapiClient.MachineV1beta1Interface used by DeleteAndWait
+type fakeMachineClient struct {
+	mapiClient.MachineV1beta1Interface
+	cluster *fakeCluster
+}
+
+func (f *fakeMachineClient) MachineSets(string) mapiClient.MachineSetInterface {
+	return &fakeMachineSets{cluster: f.cluster}
+}
+
+func (f *fakeMachineClient) Machines(string) mapiClient.MachineInterface {
+	return &fakeMachines{cluster: f.cluster}
+}
+
+type fakeMachineSets struct {
+	mapiClient.MachineSetInterface
+	cluster *fakeCluster
+}
+
+func (f *fakeMachineSets) Get(_ context.Context, name string, _ meta.GetOptions) (*mapi.MachineSet, error) {
+	machineSet, ok := f.cluster.machineSets[name]
+	if !ok {
+		return nil, k8sapierrors.NewNotFound(mapi.Resource("machinesets"), name)
+	}
+	return machineSet.DeepCopy(), nil
+}
+
+func (f *fakeMachineSets) Update(_ context.Context, machineSet *mapi.MachineSet,
+	_ meta.UpdateOptions) (*mapi.MachineSet, error) {
+	f.cluster.calls = append(f.cluster.calls, fmt.Sprintf("scale to %d", *machineSet.Spec.Replicas))
+	f.cluster.machineSets[machineSet.GetName()] = machineSet.DeepCopy()
+	return machineSet, nil
+}
+
+func (f *fakeMachineSets) Delete(_ context.Context, name string, _ meta.DeleteOptions) error {
+	f.cluster.calls = append(f.cluster.calls, "delete")
+	delete(f.cluster.machineSets, name)
+	return nil
+}
+
+type fakeMachines struct {
+	mapiClient.MachineInterface
+	cluster *fakeCluster
+}
+
+func (f *fakeMachines) List(_ context.Context, opts meta.ListOptions) (*mapi.MachineList, error) {
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, machine := range f.cluster.machines {
+		if selector.Matches(labels.Set(machine.GetLabels())) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	list := &mapi.MachineList{}
+	deletedOne := false
+	for _, name := range names {
+		machine := f.cluster.machines[name]
+		machineSet, ok := f.cluster.machineSets[machine.GetLabels()[clusterinfo.MachineSetLabel]]
+		scaledDown := !ok || *machineSet.Spec.Replicas == 0
+		if scaledDown && !deletedOne && !f.cluster.stuck[name] {
+			delete(f.cluster.machines, name)
+			delete(f.cluster.nodes, machine.Status.NodeRef.Name)
+			deletedOne = true
+			continue
+		}
+		list.Items = append(list.Items, *machine.DeepCopy())
+	}
+	return list, nil
+}
+
+type fakeNodes struct {
+	coreClient.NodeInterface
+	cluster *fakeCluster
+}
+
+func (f *fakeNodes) Get(_ context.Context, name string, _ meta.GetOptions) (*core.Node, error) {
+	node, ok := f.cluster.nodes[name]
+	if !ok {
+		return nil, k8sapierrors.NewNotFound(core.Resource("nodes"), name)
+	}
+	return node.DeepCopy(), nil
+}
+
+// newFakeCluster returns a cluster holding a MachineSet of each given name, with the given number of Machines and
+// Nodes each
+func newFakeCluster(machineSets []string, replicas int32) *fakeCluster {
+	cluster := &fakeCluster{machineSets: make(map[string]*mapi.MachineSet), machines: make(map[string]*mapi.Machine),
+		nodes: make(map[string]*core.Node), stuck: make(map[string]bool)}
+	for _, name := range machineSets {
+		machineSet := New(nil, "cluster", replicas, true, name+"-")
+		cluster.machineSets[machineSet.GetName()] = machineSet
+		for i := int32(0); i < replicas; i++ {
+			machineName := fmt.Sprintf("%s-%d", machineSet.GetName(), i)
+			cluster.machines[machineName] = &mapi.Machine{
+				ObjectMeta: meta.ObjectMeta{Name: machineName, Labels: machineSet.Spec.Template.ObjectMeta.Labels},
+				Status:     mapi.MachineStatus{NodeRef: &core.ObjectReference{Name: machineName + "-node"}},
+			}
+			cluster.nodes[machineName+"-node"] = &core.Node{ObjectMeta: meta.ObjectMeta{Name: machineName + "-node"}}
+		}
+	}
+	return cluster
+}
+
+func TestDeleteAndWait(t *testing.T) {
+	testCases := []struct {
+		name             string
+		machineSet       string
+		stuck            []string
+		expectedCalls    []string
+		expectedErr      bool
+		expectedInErrMsg []string
+	}{
+		{
+			name:          "deleted",
+			machineSet:    "zone-a-e2e",
+			expectedCalls: []string{"scale to 0", "delete"},
+		},
+		{
+			name:             "machine stuck",
+			machineSet:       "zone-a-e2e",
+			stuck:            []string{"zone-a-e2e-1"},
+			expectedCalls:    []string{"scale to 0", "delete"},
+			expectedErr:      true,
+			expectedInErrMsg: []string{"Machines [zone-a-e2e-1]", "Nodes [zone-a-e2e-1-node]"},
+		},
+		{
+			name:       "missing",
+			machineSet: "zone-c-e2e",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			cluster := newFakeCluster([]string{"zone-a", "zone-b"}, 3)
+			for _, name := range test.stuck {
+				cluster.stuck[name] = true
+			}
+			err := deleteAndWait(context.Background(), &fakeMachineClient{cluster: cluster},
+				&fakeNodes{cluster: cluster}, test.machineSet, clusterinfo.MachineAPINamespace, time.Millisecond,
+				100*time.Millisecond)
+			if test.expectedErr {
+				require.Error(t, err)
+				for _, msg := range test.expectedInErrMsg {
+					assert.Contains(t, err.Error(), msg)
+				}
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedCalls, cluster.calls)
+			assert.NotContains(t, cluster.machineSets, test.machineSet)
+			// the other MachineSet is left untouched
+			assert.Contains(t, cluster.machineSets, "zone-b-e2e")
+			for i := 0; i < 3; i++ {
+				assert.Contains(t, cluster.machines, fmt.Sprintf("zone-b-e2e-%d", i))
+				assert.Contains(t, cluster.nodes, fmt.Sprintf("zone-b-e2e-%d-node", i))
+			}
+			for name := range cluster.machines {
+				if strings.HasPrefix(name, test.machineSet) {
+					assert.Contains(t, test.stuck, name)
+				}
+			}
+		})
+	}
+}
+
+// fakeMachineSetLister answers MachineSet List calls with the given results in order, the last one being repeated.
+// The MachineSets of the results are filtered by the label selector listed with.
+type fakeMachineSetLister struct {
+	mapiClient.MachineSetInterface
+	lists []*mapi.MachineSetList
+	errs  []error
+	// selectors are the label selectors listed with, in order
+	selectors []string
+}
+
+func (f *fakeMachineSetLister) List(_ context.Context, opts meta.ListOptions) (*mapi.MachineSetList, error) {
+	f.selectors = append(f.selectors, opts.LabelSelector)
+	i := len(f.selectors) - 1
+	if i >= len(f.lists) {
+		i = len(f.lists) - 1
+	}
+	if f.lists[i] == nil {
+		return nil, f.errs[i]
+	}
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	list := &mapi.MachineSetList{}
+	for _, machineSet := range f.lists[i].Items {
+		if selector.Matches(labels.Set(machineSet.GetLabels())) {
+			list.Items = append(list.Items, machineSet)
+		}
+	}
+	return list, f.errs[i]
+}
+
+// fakeListClient implements the subset of mapiClient.MachineV1beta1Interface used by GetExistingProviderSpec
+type fakeListClient struct {
+	mapiClient.MachineV1beta1Interface
+	machineSets *fakeMachineSetLister
+}
+
+func (f *fakeListClient) MachineSets(string) mapiClient.MachineSetInterface {
+	return f.machineSets
+}
+
+func TestGetExistingProviderSpec(t *testing.T) {
+	machineSetWithSpec := func(name string, spec *mapi.VSphereMachineProviderSpec) mapi.MachineSet {
+		var raw []byte
+		if spec != nil {
+			var err error
+			raw, err = json.Marshal(spec)
+			require.NoError(t, err)
+		}
+		ms := New(raw, "infra", 1, false, name+"-")
+		return *ms
+	}
+	first := &mapi.VSphereMachineProviderSpec{Template: "first-template",
+		Network: mapi.NetworkSpec{Devices: []mapi.NetworkDeviceSpec{{NetworkName: "first-network"}}}}
+	second := &mapi.VSphereMachineProviderSpec{Template: "second-template"}
+	empty := &mapi.MachineSetList{}
+	both := &mapi.MachineSetList{Items: []mapi.MachineSet{machineSetWithSpec("first", first),
+		machineSetWithSpec("second", second)}}
+	unavailable := k8sapierrors.NewServiceUnavailable("starting")
+
+	testCases := []struct {
+		name          string
+		lists         []*mapi.MachineSetList
+		errs          []error
+		expectedCalls int
+		expectedErr   bool
+		// expectedSentinel is the error expected to be wrapped by the error returned, if any
+		expectedSentinel error
+	}{
+		{
+			name:          "first machineset chosen",
+			lists:         []*mapi.MachineSetList{both},
+			errs:          []error{nil},
+			expectedCalls: 1,
+		},
+		{
+			name:          "machinesets found after retrying",
+			lists:         []*mapi.MachineSetList{empty, nil, both},
+			errs:          []error{nil, unavailable, nil},
+			expectedCalls: 3,
+		},
+		{
+			name:             "no machinesets",
+			lists:            []*mapi.MachineSetList{empty},
+			errs:             []error{nil},
+			expectedErr:      true,
+			expectedSentinel: ErrNoMachineSets,
+		},
+		{
+			name: "no provider spec",
+			lists: []*mapi.MachineSetList{{Items: []mapi.MachineSet{machineSetWithSpec("first", nil),
+				machineSetWithSpec("second", second)}}},
+			errs:             []error{nil},
+			expectedCalls:    1,
+			expectedErr:      true,
+			expectedSentinel: ErrNoProviderSpec,
+		},
+		{
+			name:          "non transient error",
+			lists:         []*mapi.MachineSetList{nil},
+			errs:          []error{k8sapierrors.NewForbidden(mapi.Resource("machinesets"), "", fmt.Errorf("denied"))},
+			expectedCalls: 1,
+			expectedErr:   true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			lister := &fakeMachineSetLister{lists: test.lists, errs: test.errs}
+			var spec mapi.VSphereMachineProviderSpec
+			err := getExistingProviderSpec(context.Background(), &fakeListClient{machineSets: lister}, "infra",
+				Selector{}, &spec, time.Millisecond, 50*time.Millisecond)
+			assert.Contains(t, lister.selectors, "machine.openshift.io/cluster-api-cluster=infra")
+			if test.expectedCalls > 0 {
+				assert.Len(t, lister.selectors, test.expectedCalls)
+			}
+			if test.expectedErr {
+				require.Error(t, err)
+				if test.expectedSentinel != nil {
+					assert.ErrorIs(t, err, test.expectedSentinel)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, *first, spec)
+		})
+	}
+}
+
+func TestGetSelectedProviderSpec(t *testing.T) {
+	// zoneLabel is the label telling apart the MachineSets of each zone in the test
+	zoneLabel := "machine.openshift.io/zone"
+	var machineSets []mapi.MachineSet
+	for _, zone := range []string{"us-east-1a", "us-east-1b", "us-east-1c"} {
+		raw, err := json.Marshal(&mapi.VSphereMachineProviderSpec{Template: zone + "-template"})
+		require.NoError(t, err)
+		ms := New(raw, "infra", 1, false, zone+"-")
+		ms.Labels[zoneLabel] = zone
+		machineSets = append(machineSets, *ms)
+	}
+	// a MachineSet of another cluster, which must never be selected
+	other := New([]byte(`{"template":"other-template"}`), "other-infra", 1, false, "us-east-1b-other-")
+	other.Labels[zoneLabel] = "us-east-1b"
+	machineSets = append([]mapi.MachineSet{*other}, machineSets...)
+
+	testCases := []struct {
+		name             string
+		selector         Selector
+		expectedTemplate string
+		expectedErr      bool
+	}{
+		{
+			name:             "no selector",
+			expectedTemplate: "us-east-1a-template",
+		},
+		{
+			name:             "by name",
+			selector:         Selector{Name: "us-east-1c-e2e-wm"},
+			expectedTemplate: "us-east-1c-template",
+		},
+		{
+			name:             "by label",
+			selector:         Selector{MatchLabels: map[string]string{zoneLabel: "us-east-1b"}},
+			expectedTemplate: "us-east-1b-template",
+		},
+		{
+			name:        "name and label not matching the same machineset",
+			selector:    Selector{Name: "us-east-1c-e2e-wm", MatchLabels: map[string]string{zoneLabel: "us-east-1b"}},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown zone",
+			selector:    Selector{MatchLabels: map[string]string{zoneLabel: "us-west-2a"}},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			lister := &fakeMachineSetLister{lists: []*mapi.MachineSetList{{Items: machineSets}}, errs: []error{nil}}
+			var spec mapi.VSphereMachineProviderSpec
+			err := getExistingProviderSpec(context.Background(), &fakeListClient{machineSets: lister}, "infra",
+				test.selector, &spec, time.Millisecond, 20*time.Millisecond)
+			if test.expectedErr {
+				assert.ErrorIs(t, err, ErrNoMachineSets)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedTemplate, spec.Template)
+		})
+	}
+}
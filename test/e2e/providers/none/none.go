@@ -2,6 +2,7 @@ package none
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	config "github.com/openshift/api/config/v1"
@@ -11,6 +12,8 @@ import (
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	client "k8s.io/client-go/kubernetes"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
 	"github.com/openshift/windows-machine-config-operator/test/e2e/clusterinfo"
 	"github.com/openshift/windows-machine-config-operator/test/e2e/windows"
 )
@@ -27,9 +30,37 @@ func New(clientset *clusterinfo.OpenShift) (*Provider, error) {
 	}, nil
 }
 
-// GenerateMachineSet is not supported for platform=none and throws an exception
-func (p *Provider) GenerateMachineSet(_ bool, replicas int32, version windows.ServerVersion) (*mapi.MachineSet, error) {
-	return nil, fmt.Errorf("MachineSet generation not supported for platform=none")
+// ErrNoMachineAPI is returned when generating a MachineSet on a platform without the Machine API
+var ErrNoMachineAPI = errors.New("MachineSet generation not supported for platform=none")
+
+// GenerateMachineSet is not supported for platform=none and returns ErrNoMachineAPI
+func (p *Provider) GenerateMachineSet(_ context.Context, _ bool, replicas int32, version windows.ServerVersion) (*mapi.MachineSet, error) {
+	return nil, ErrNoMachineAPI
+}
+
+// GenerateInstanceConfigMap returns the windows-instances ConfigMap describing the given BYOH instances, which WMCO
+// configures as nodes in place of Machines
+func (p *Provider) GenerateInstanceConfigMap(instances []*instance.Info) (*core.ConfigMap, error) {
+	cm := &core.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{
+			Name: wiparser.InstanceConfigMap,
+		},
+		Data: make(map[string]string),
+	}
+	for _, instanceInfo := range instances {
+		if instanceInfo.Address == "" || instanceInfo.Username == "" {
+			return nil, fmt.Errorf("instance address and username must be set, got address '%s' and username '%s'",
+				instanceInfo.Address, instanceInfo.Username)
+		}
+		if _, present := cm.Data[instanceInfo.Address]; present {
+			return nil, fmt.Errorf("instance %s described more than once", instanceInfo.Address)
+		}
+		cm.Data[instanceInfo.Address] = "username=" + instanceInfo.Username
+		if instanceInfo.InstallDir != "" {
+			cm.Data[instanceInfo.Address] += ";installDir=" + instanceInfo.InstallDir
+		}
+	}
+	return cm, nil
 }
 
 // GetType returns the platform type for platform=none
@@ -37,11 +68,22 @@ func (p *Provider) GetType() config.PlatformType {
 	return config.NonePlatformType
 }
 
+// SupportedWindowsVersions returns the Windows Server versions of the BYOH instances which can be configured. No
+// MachineSets can be generated for platform=none.
+func (p *Provider) SupportedWindowsVersions() []windows.ServerVersion {
+	return []windows.ServerVersion{windows.Server2019, windows.Server2022}
+}
+
+// DefaultAdminUsername returns the local administrator of the BYOH instances used in CI
+func (p *Provider) DefaultAdminUsername() string {
+	return windows.DefaultAdminUsername
+}
+
 func (p *Provider) StorageSupport() bool {
 	return true
 }
 
-func (p *Provider) CreatePVC(c client.Interface, namespace string, pv *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
+func (p *Provider) CreatePVC(ctx context.Context, c client.Interface, namespace string, pv *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
 	if pv == nil {
 		return nil, fmt.Errorf("a PV must be provided for platform none")
 	}
@@ -57,5 +99,5 @@ func (p *Provider) CreatePVC(c client.Interface, namespace string, pv *core.Pers
 			StorageClassName: &pv.Spec.StorageClassName,
 		},
 	}
-	return c.CoreV1().PersistentVolumeClaims(namespace).Create(context.TODO(), &pvcSpec, meta.CreateOptions{})
+	return c.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, &pvcSpec, meta.CreateOptions{})
 }
@@ -0,0 +1,83 @@
+package none
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
+	"github.com/openshift/windows-machine-config-operator/test/e2e/windows"
+)
+
+func TestGenerateMachineSet(t *testing.T) {
+	p := &Provider{}
+	_, err := p.GenerateMachineSet(context.Background(), false, 1, windows.Server2022)
+	assert.True(t, errors.Is(err, ErrNoMachineAPI))
+}
+
+func TestGenerateInstanceConfigMap(t *testing.T) {
+	testCases := []struct {
+		name         string
+		instances    []*instance.Info
+		expectedData map[string]string
+		expectedErr  bool
+	}{
+		{
+			name:         "no instances",
+			instances:    nil,
+			expectedData: map[string]string{},
+		},
+		{
+			name: "multiple instances",
+			instances: []*instance.Info{
+				{Address: "10.0.0.1", Username: "Administrator"},
+				{Address: "10.0.0.2", Username: "capi"},
+			},
+			expectedData: map[string]string{
+				"10.0.0.1": "username=Administrator",
+				"10.0.0.2": "username=capi",
+			},
+		},
+		{
+			name:         "install directory",
+			instances:    []*instance.Info{{Address: "10.0.0.1", Username: "Administrator", InstallDir: "D:\\k"}},
+			expectedData: map[string]string{"10.0.0.1": "username=Administrator;installDir=D:\\k"},
+		},
+		{
+			name:        "missing username",
+			instances:   []*instance.Info{{Address: "10.0.0.1"}},
+			expectedErr: true,
+		},
+		{
+			name: "duplicate address",
+			instances: []*instance.Info{
+				{Address: "10.0.0.1", Username: "Administrator"},
+				{Address: "10.0.0.1", Username: "capi"},
+			},
+			expectedErr: true,
+		},
+	}
+	p := &Provider{}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			cm, err := p.GenerateInstanceConfigMap(test.instances)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, wiparser.InstanceConfigMap, cm.GetName())
+			assert.Equal(t, test.expectedData, cm.Data)
+
+			// the ConfigMap must be understood by WMCO
+			parsed, err := wiparser.Parse(cm.Data, &core.NodeList{})
+			require.NoError(t, err)
+			assert.Len(t, parsed, len(test.instances))
+		})
+	}
+}
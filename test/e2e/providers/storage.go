@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	client "k8s.io/client-go/kubernetes"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/retry"
+)
+
+// ErrStorageUnsupported is returned when a PVC is requested on a platform without Windows storage support
+var ErrStorageUnsupported = errors.New("storage is not supported on this platform")
+
+// EnsurePVCIfSupported creates a PVC through the given provider, as described by CloudProvider.CreatePVC. Returns
+// ErrStorageUnsupported if the provider does not support Windows storage.
+func EnsurePVCIfSupported(ctx context.Context, p CloudProvider, c client.Interface, namespace string,
+	pv *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
+	if !p.StorageSupport() {
+		return nil, fmt.Errorf("unable to create PVC on %s: %w", p.GetType(), ErrStorageUnsupported)
+	}
+	return p.CreatePVC(ctx, c, namespace, pv)
+}
+
+// DeletePVC deletes the given PVC, created through CloudProvider.CreatePVC, and waits for its volume to be reclaimed
+// as per the volume's reclaim policy. Returns the name of the volume if it is retained, as it is not deleted along with
+// the PVC and must be cleaned up by the caller. A missing PVC is not an error.
+func DeletePVC(ctx context.Context, c client.Interface, namespace, name string) (string, error) {
+	return deletePVC(ctx, c, namespace, name, retry.Interval, retry.ResourceChangeTimeout)
+}
+
+// deletePVC behaves as DeletePVC, checking the state of the PVC and its volume at the given interval until the given
+// timeout is reached
+func deletePVC(ctx context.Context, c client.Interface, namespace, name string, interval,
+	timeout time.Duration) (string, error) {
+	pvcs := c.CoreV1().PersistentVolumeClaims(namespace)
+	pvc, err := pvcs.Get(ctx, name, meta.GetOptions{})
+	if err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error getting PVC %s/%s: %w", namespace, name, err)
+	}
+	if err = pvcs.Delete(ctx, name, meta.DeleteOptions{}); err != nil && !k8sapierrors.IsNotFound(err) {
+		return "", fmt.Errorf("error deleting PVC %s/%s: %w", namespace, name, err)
+	}
+	err = wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := pvcs.Get(ctx, name, meta.GetOptions{})
+		if k8sapierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("error waiting for PVC %s/%s to be deleted: %w", namespace, name, err)
+	}
+
+	// the PVC may have been deleted before being bound to a volume
+	pvName := pvc.Spec.VolumeName
+	if pvName == "" {
+		return "", nil
+	}
+	var policy core.PersistentVolumeReclaimPolicy
+	err = wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		pv, err := c.CoreV1().PersistentVolumes().Get(ctx, pvName, meta.GetOptions{})
+		if err != nil {
+			if k8sapierrors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, err
+		}
+		policy = pv.Spec.PersistentVolumeReclaimPolicy
+		switch policy {
+		case core.PersistentVolumeReclaimRetain:
+			return pv.Status.Phase == core.VolumeReleased, nil
+		case core.PersistentVolumeReclaimDelete:
+			return false, nil
+		default:
+			// recycled volumes are made available again to new claims
+			return pv.Status.Phase == core.VolumeAvailable, nil
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("error waiting for PV %s to be reclaimed: %w", pvName, err)
+	}
+	if policy == core.PersistentVolumeReclaimRetain {
+		return pvName, nil
+	}
+	return "", nil
+}
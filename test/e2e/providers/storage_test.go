@@ -0,0 +1,150 @@
+package providers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	client "k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeClientset is a client.Interface only serving the PVCs and PVs of the wrapped fakes
+type fakeClientset struct {
+	client.Interface
+	core *fakeCoreV1
+}
+
+func (f *fakeClientset) CoreV1() corev1.CoreV1Interface { return f.core }
+
+type fakeCoreV1 struct {
+	corev1.CoreV1Interface
+	pvcs *fakePVCs
+	pvs  *fakePVs
+}
+
+func (f *fakeCoreV1) PersistentVolumeClaims(string) corev1.PersistentVolumeClaimInterface {
+	return f.pvcs
+}
+func (f *fakeCoreV1) PersistentVolumes() corev1.PersistentVolumeInterface { return f.pvs }
+
+// fakePVCs serves a single PVC, until it is deleted
+type fakePVCs struct {
+	corev1.PersistentVolumeClaimInterface
+	pvc *core.PersistentVolumeClaim
+}
+
+func (f *fakePVCs) Get(_ context.Context, name string, _ meta.GetOptions) (*core.PersistentVolumeClaim, error) {
+	if f.pvc == nil || f.pvc.Name != name {
+		return nil, k8sapierrors.NewNotFound(schema.GroupResource{Resource: "persistentvolumeclaims"}, name)
+	}
+	return f.pvc.DeepCopy(), nil
+}
+
+func (f *fakePVCs) Delete(_ context.Context, name string, _ meta.DeleteOptions) error {
+	if f.pvc == nil || f.pvc.Name != name {
+		return k8sapierrors.NewNotFound(schema.GroupResource{Resource: "persistentvolumeclaims"}, name)
+	}
+	f.pvc = nil
+	return nil
+}
+
+// fakePVs serves a single PV, which is reclaimed as per its policy after reclaimAfter gets following the deletion of
+// its claim
+type fakePVs struct {
+	corev1.PersistentVolumeInterface
+	pv           *core.PersistentVolume
+	pvcs         *fakePVCs
+	reclaimAfter int
+	gets         int
+}
+
+func (f *fakePVs) Get(_ context.Context, name string, _ meta.GetOptions) (*core.PersistentVolume, error) {
+	f.gets++
+	if f.pvc() == nil && f.pv != nil && f.gets > f.reclaimAfter {
+		switch f.pv.Spec.PersistentVolumeReclaimPolicy {
+		case core.PersistentVolumeReclaimDelete:
+			f.pv = nil
+		case core.PersistentVolumeReclaimRetain:
+			f.pv.Status.Phase = core.VolumeReleased
+		}
+	}
+	if f.pv == nil || f.pv.Name != name {
+		return nil, k8sapierrors.NewNotFound(schema.GroupResource{Resource: "persistentvolumes"}, name)
+	}
+	return f.pv.DeepCopy(), nil
+}
+
+func (f *fakePVs) pvc() *core.PersistentVolumeClaim { return f.pvcs.pvc }
+
+func TestDeletePVC(t *testing.T) {
+	testCases := []struct {
+		name         string
+		pvc          *core.PersistentVolumeClaim
+		policy       core.PersistentVolumeReclaimPolicy
+		expectedPV   string
+		expectedGets int
+	}{
+		{
+			name:         "missing PVC",
+			pvc:          nil,
+			expectedGets: 0,
+		},
+		{
+			name:         "unbound PVC",
+			pvc:          &core.PersistentVolumeClaim{ObjectMeta: meta.ObjectMeta{Name: "pvc"}},
+			expectedGets: 0,
+		},
+		{
+			name: "deleted volume",
+			pvc: &core.PersistentVolumeClaim{ObjectMeta: meta.ObjectMeta{Name: "pvc"},
+				Spec: core.PersistentVolumeClaimSpec{VolumeName: "pv"}},
+			policy:       core.PersistentVolumeReclaimDelete,
+			expectedGets: 3,
+		},
+		{
+			name: "retained volume",
+			pvc: &core.PersistentVolumeClaim{ObjectMeta: meta.ObjectMeta{Name: "pvc"},
+				Spec: core.PersistentVolumeClaimSpec{VolumeName: "pv"}},
+			policy:       core.PersistentVolumeReclaimRetain,
+			expectedPV:   "pv",
+			expectedGets: 3,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			pvcs := &fakePVCs{pvc: test.pvc}
+			pvs := &fakePVs{pvcs: pvcs, reclaimAfter: 2, pv: &core.PersistentVolume{
+				ObjectMeta: meta.ObjectMeta{Name: "pv"},
+				Spec:       core.PersistentVolumeSpec{PersistentVolumeReclaimPolicy: test.policy},
+				Status:     core.PersistentVolumeStatus{Phase: core.VolumeBound},
+			}}
+			c := &fakeClientset{core: &fakeCoreV1{pvcs: pvcs, pvs: pvs}}
+
+			pvName, err := deletePVC(context.Background(), c, "namespace", "pvc", time.Millisecond, time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedPV, pvName)
+			assert.Nil(t, pvcs.pvc)
+			// the volume is polled until it is reclaimed
+			assert.Equal(t, test.expectedGets, pvs.gets)
+		})
+	}
+
+	t.Run("volume not reclaimed", func(t *testing.T) {
+		pvcs := &fakePVCs{pvc: &core.PersistentVolumeClaim{ObjectMeta: meta.ObjectMeta{Name: "pvc"},
+			Spec: core.PersistentVolumeClaimSpec{VolumeName: "pv"}}}
+		pvs := &fakePVs{pvcs: pvcs, reclaimAfter: 1000, pv: &core.PersistentVolume{
+			ObjectMeta: meta.ObjectMeta{Name: "pv"},
+			Spec:       core.PersistentVolumeSpec{PersistentVolumeReclaimPolicy: core.PersistentVolumeReclaimDelete},
+		}}
+		c := &fakeClientset{core: &fakeCoreV1{pvcs: pvcs, pvs: pvs}}
+		_, err := deletePVC(context.Background(), c, "namespace", "pvc", time.Millisecond, 20*time.Millisecond)
+		assert.Error(t, err)
+	})
+}
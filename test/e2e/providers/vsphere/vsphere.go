@@ -7,6 +7,9 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 
 	config "github.com/openshift/api/config/v1"
 	mapi "github.com/openshift/api/machine/v1beta1"
@@ -28,8 +31,42 @@ const (
 	storageClassName             = "ntfs"
 	windowsFSSName               = "win-internal-feature-states.csi.vsphere.vmware.com"
 	csiNamespace                 = "openshift-cluster-csi-drivers"
+	// csiDriverName is the name of the vSphere CSI driver, provisioning the volumes of the storage class
+	csiDriverName = "csi.vsphere.vmware.com"
+	// inTreeProvisionerName is the provisioner of the in-tree vSphere volume plugin, used on clusters where the CSI
+	// driver is not installed
+	inTreeProvisionerName = "kubernetes.io/vsphere-volume"
+	// csiFSTypeParameter is the storage class parameter setting the filesystem of volumes provisioned by the CSI driver.
+	// It replaces the deprecated inTreeFSTypeParameter.
+	csiFSTypeParameter = "csi.storage.k8s.io/fstype"
+	// inTreeFSTypeParameter is the storage class parameter setting the filesystem of volumes provisioned by the in-tree
+	// vSphere volume plugin
+	inTreeFSTypeParameter = "fstype"
+	// vmTemplateEnvVar is the environment variable overriding the VM template Windows VMs are created from
+	vmTemplateEnvVar = "VM_TEMPLATE"
+	// vmAdminUsernameEnvVar is the environment variable overriding the local administrator of the VM template
+	vmAdminUsernameEnvVar = "VM_ADMIN_USERNAME"
+	// vmResourcePoolEnvVar is the environment variable overriding the resource pool Windows VMs are created in
+	vmResourcePoolEnvVar = "VM_RESOURCE_POOL"
+	// vmFolderEnvVar is the environment variable overriding the folder Windows VMs are created in
+	vmFolderEnvVar = "VM_FOLDER"
+	// vmDatastoreEnvVar is the environment variable overriding the datastore Windows VMs are stored in
+	vmDatastoreEnvVar = "VM_DATASTORE"
+	// vmOwnerTagEnvVar is the environment variable holding the ID of the vSphere tag identifying the owner of the
+	// Windows VMs
+	vmOwnerTagEnvVar = "VM_OWNER_TAG"
+	// vmJobIDEnvVar is the environment variable holding the ID of the vSphere tag identifying the CI job the Windows
+	// VMs are created by
+	vmJobIDEnvVar = "VM_JOB_ID"
+	// userDataKey is the key of user data secrets holding the user data
+	userDataKey = "userData"
 )
 
+// defaultTemplates are the VM templates Windows VMs are created from in CI, by Windows Server version
+var defaultTemplates = map[windows.ServerVersion]string{
+	windows.Server2022: "windows-golden-images/windows-server-2022-template-ipv6-disabled",
+}
+
 // Provider is a provider struct for testing vSphere
 type Provider struct {
 	oc *clusterinfo.OpenShift
@@ -44,23 +81,111 @@ func New(clientset *clusterinfo.OpenShift, infraStatus *config.InfrastructureSta
 	}, nil
 }
 
-// newVSphereMachineProviderSpec returns a vSphereMachineProviderSpec generated from the inputs, or an error
-func (p *Provider) newVSphereMachineProviderSpec() (*mapi.VSphereMachineProviderSpec, error) {
-	existingProviderSpec, err := p.getProviderSpecFromExistingMachineSet()
+// resolveTemplate returns the VM template to create Windows Server VMs of the given version from. The template is an
+// image which has been properly sysprepped. The template can be overridden through the vmTemplateEnvVar environment
+// variable defined in the job spec, otherwise the default template of the version is used.
+func resolveTemplate(version windows.ServerVersion) (string, error) {
+	if version == "" {
+		version = windows.DefaultVersion
+	}
+	if vmTemplate := os.Getenv(vmTemplateEnvVar); vmTemplate != "" {
+		if strings.TrimSpace(vmTemplate) != vmTemplate {
+			return "", fmt.Errorf("invalid %s value %q: leading or trailing whitespace", vmTemplateEnvVar, vmTemplate)
+		}
+		return vmTemplate, nil
+	}
+	vmTemplate, ok := defaultTemplates[version]
+	if !ok {
+		return "", fmt.Errorf("no default vSphere template for Windows Server %s, %s must be set", version,
+			vmTemplateEnvVar)
+	}
+	return vmTemplate, nil
+}
+
+// resolveWorkspace returns a copy of the given workspace, cloned from an existing MachineSet, with the resource pool,
+// folder and datastore overridden by the vmResourcePoolEnvVar, vmFolderEnvVar and vmDatastoreEnvVar environment
+// variables when set. This allows CI to create Windows VMs in a dedicated folder, easing their cleanup.
+func resolveWorkspace(existing *mapi.Workspace) (*mapi.Workspace, error) {
+	workspace := &mapi.Workspace{}
+	if existing != nil {
+		*workspace = *existing
+	}
+	for envVar, field := range map[string]*string{
+		vmResourcePoolEnvVar: &workspace.ResourcePool,
+		vmFolderEnvVar:       &workspace.Folder,
+		vmDatastoreEnvVar:    &workspace.Datastore,
+	} {
+		value, ok := os.LookupEnv(envVar)
+		if !ok {
+			continue
+		}
+		if strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("invalid %s value %q: cannot be empty when set", envVar, value)
+		}
+		if strings.TrimSpace(value) != value {
+			return nil, fmt.Errorf("invalid %s value %q: leading or trailing whitespace", envVar, value)
+		}
+		*field = value
+	}
+	return workspace, nil
+}
+
+// tagIDPattern matches the URN of a vSphere tag, the only form of tag accepted by the Machine API
+var tagIDPattern = regexp.MustCompile(`^urn:vmomi:InventoryServiceTag:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-` +
+	`[0-9a-fA-F]{4}-[0-9a-fA-F]{12}:[^:\s]+$`)
+
+// resolveTagIDs returns the IDs of the vSphere tags attached to the Windows VMs, read from the vmOwnerTagEnvVar and
+// vmJobIDEnvVar environment variables, so that VMs left behind can be attributed. The tags must already exist in
+// vCenter. Returns nil if neither variable is set, in which case the VMs are not tagged.
+func resolveTagIDs() ([]string, error) {
+	var tagIDs []string
+	for _, envVar := range []string{vmOwnerTagEnvVar, vmJobIDEnvVar} {
+		value, ok := os.LookupEnv(envVar)
+		if !ok {
+			continue
+		}
+		if strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("invalid %s value %q: cannot be empty when set", envVar, value)
+		}
+		if !tagIDPattern.MatchString(value) {
+			return nil, fmt.Errorf("invalid %s value %q: must be a tag ID of the form "+
+				"urn:vmomi:InventoryServiceTag:<uuid>:GLOBAL", envVar, value)
+		}
+		if !slices.Contains(tagIDs, value) {
+			tagIDs = append(tagIDs, value)
+		}
+	}
+	return tagIDs, nil
+}
+
+// newVSphereMachineProviderSpec returns a vSphereMachineProviderSpec for VMs of the given Windows Server version
+// generated from the inputs, or an error
+func (p *Provider) newVSphereMachineProviderSpec(ctx context.Context, version windows.ServerVersion) (*mapi.VSphereMachineProviderSpec,
+	error) {
+	vmTemplate, err := resolveTemplate(version)
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("creating machineset provider spec which targets %s with network %s\n",
-		existingProviderSpec.Workspace.Server, existingProviderSpec.Network)
-
-	// The template is an image which has been properly sysprepped.  The image is derived from an environment variable
-	// defined in the job spec.
-	vmTemplate := os.Getenv("VM_TEMPLATE")
-	if vmTemplate == "" {
-		vmTemplate = "windows-golden-images/windows-server-2022-template-ipv6-disabled"
+	existingProviderSpec, err := p.getProviderSpecFromExistingMachineSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	workspace, err := resolveWorkspace(existingProviderSpec.Workspace)
+	if err != nil {
+		return nil, err
 	}
+	tagIDs, err := resolveTagIDs()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("creating machineset provider spec which targets %s with network %s\n", workspace.Server,
+		existingProviderSpec.Network)
+	log.Printf("creating machineset in resource pool %s and folder %s\n", workspace.ResourcePool, workspace.Folder)
 
 	log.Printf("creating machineset based on template %s\n", vmTemplate)
+	if len(tagIDs) > 0 {
+		log.Printf("creating machineset with tags %v\n", tagIDs)
+	}
 
 	return &mapi.VSphereMachineProviderSpec{
 		TypeMeta: meta.TypeMeta{
@@ -75,125 +200,413 @@ func (p *Provider) newVSphereMachineProviderSpec() (*mapi.VSphereMachineProvider
 		Network:           existingProviderSpec.Network,
 		NumCPUs:           int32(4),
 		NumCoresPerSocket: int32(1),
+		TagIDs:            tagIDs,
 		Template:          vmTemplate,
-		Workspace:         existingProviderSpec.Workspace,
+		Workspace:         workspace,
 	}, nil
 }
 
-// getProviderSpecFromExistingMachineSet returns the providerSpec of an existing machineset provisioned during installation
-func (p *Provider) getProviderSpecFromExistingMachineSet() (*mapi.VSphereMachineProviderSpec, error) {
-	listOptions := meta.ListOptions{LabelSelector: "machine.openshift.io/cluster-api-cluster=" +
-		p.InfrastructureName}
-	machineSets, err := p.oc.Machine.MachineSets(clusterinfo.MachineAPINamespace).List(context.TODO(), listOptions)
-	if err != nil {
-		return nil, fmt.Errorf("unable to get machinesets: %w", err)
+// getProviderSpecFromExistingMachineSet returns the providerSpec of an existing machineset provisioned during
+// installation
+func (p *Provider) getProviderSpecFromExistingMachineSet(ctx context.Context) (*mapi.VSphereMachineProviderSpec, error) {
+	var providerSpec mapi.VSphereMachineProviderSpec
+	if err := machineset.GetExistingProviderSpec(ctx, p.oc.Machine, p.InfrastructureName, &providerSpec); err != nil {
+		return nil, err
+	}
+	return &providerSpec, nil
+}
+
+// RenderProviderSpec returns the provider spec embedded in the MachineSets generated for the given Windows Server
+// version, along with its marshaled form
+func (p *Provider) RenderProviderSpec(ctx context.Context, windowsServerVersion windows.ServerVersion) (*mapi.VSphereMachineProviderSpec,
+	[]byte, error) {
+	if err := windows.CheckVersion(p.GetType(), p.SupportedWindowsVersions(), windowsServerVersion); err != nil {
+		return nil, nil, err
 	}
 
-	if len(machineSets.Items) == 0 {
-		return nil, fmt.Errorf("no matching machinesets found")
+	// create new machine provider spec for deploying Windows node
+	providerSpec, err := p.newVSphereMachineProviderSpec(ctx, windowsServerVersion)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create new vSphere machine provider spec: %w", err)
 	}
 
-	machineSet := machineSets.Items[0]
-	providerSpecRaw := machineSet.Spec.Template.Spec.ProviderSpec.Value
-	if providerSpecRaw == nil || providerSpecRaw.Raw == nil {
-		return nil, fmt.Errorf("no provider spec found")
+	if err = validateProviderSpec(providerSpec); err != nil {
+		return nil, nil, err
 	}
-	var providerSpec mapi.VSphereMachineProviderSpec
-	err = json.Unmarshal(providerSpecRaw.Raw, &providerSpec)
+	rawProviderSpec, err := json.Marshal(providerSpec)
 	if err != nil {
-		return nil, fmt.Errorf("unable to unmarshal providerSpec: %w", err)
+		return nil, nil, fmt.Errorf("failed to marshal vSphere machine provider spec: %w", err)
 	}
+	return providerSpec, rawProviderSpec, nil
+}
 
-	return &providerSpec, nil
+// validateProviderSpec returns an error listing the problems of the given provider spec which would make the
+// MachineSet embedding it invalid, so that they are reported before the MachineSet is created
+func validateProviderSpec(spec *mapi.VSphereMachineProviderSpec) error {
+	var problems []string
+	if spec.Template == "" {
+		problems = append(problems, "template is empty")
+	}
+	if len(spec.Network.Devices) == 0 {
+		problems = append(problems, "network has no device")
+	}
+	for i, device := range spec.Network.Devices {
+		if device.NetworkName == "" {
+			problems = append(problems, fmt.Sprintf("network device %d has no network name", i))
+		}
+	}
+	if spec.Workspace == nil {
+		problems = append(problems, "workspace is missing")
+	} else {
+		if spec.Workspace.Server == "" {
+			problems = append(problems, "workspace server is empty")
+		}
+		if spec.Workspace.Datacenter == "" {
+			problems = append(problems, "workspace datacenter is empty")
+		}
+		if spec.Workspace.Datastore == "" {
+			problems = append(problems, "workspace datastore is empty")
+		}
+	}
+	if spec.DiskGiB <= 0 {
+		problems = append(problems, fmt.Sprintf("disk size %dGiB is not positive", spec.DiskGiB))
+	}
+	if spec.MemoryMiB <= 0 {
+		problems = append(problems, fmt.Sprintf("memory %dMiB is not positive", spec.MemoryMiB))
+	}
+	if spec.NumCPUs <= 0 {
+		problems = append(problems, fmt.Sprintf("number of CPUs %d is not positive", spec.NumCPUs))
+	}
+	if spec.NumCoresPerSocket <= 0 {
+		problems = append(problems, fmt.Sprintf("number of cores per socket %d is not positive",
+			spec.NumCoresPerSocket))
+	} else if spec.NumCPUs > 0 && spec.NumCPUs%spec.NumCoresPerSocket != 0 {
+		problems = append(problems, fmt.Sprintf("number of cores per socket %d does not divide the number of CPUs %d",
+			spec.NumCoresPerSocket, spec.NumCPUs))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid vSphere machine provider spec: %s", strings.Join(problems, ", "))
+	}
+	return nil
 }
 
 // GenerateMachineSet generates the MachineSet object which is vSphere provider specific
-func (p *Provider) GenerateMachineSet(withIgnoreLabel bool, replicas int32, windowsServerVersion windows.ServerVersion) (*mapi.MachineSet, error) {
-	if windowsServerVersion != windows.Server2022 {
-		return nil, fmt.Errorf("vSphere does not support Windows Server %s", windowsServerVersion)
+func (p *Provider) GenerateMachineSet(ctx context.Context, withIgnoreLabel bool, replicas int32,
+	windowsServerVersion windows.ServerVersion) (*mapi.MachineSet, error) {
+	_, rawProviderSpec, err := p.RenderProviderSpec(ctx, windowsServerVersion)
+	if err != nil {
+		return nil, err
 	}
+	return machineset.New(rawProviderSpec, p.InfrastructureName, replicas, withIgnoreLabel, ""), nil
+}
 
-	// create new machine provider spec for deploying Windows node
-	providerSpec, err := p.newVSphereMachineProviderSpec()
+// GenerateMachineSetInZone generates a MachineSet object whose Machines are created in the vSphere failure domain
+// with the given name, as defined in the cluster's Infrastructure. The name of the failure domain prefixes the name of
+// the MachineSet, so that the MachineSets of different zones can coexist.
+func (p *Provider) GenerateMachineSetInZone(ctx context.Context, zone string, withIgnoreLabel bool, replicas int32,
+	windowsServerVersion windows.ServerVersion) (*mapi.MachineSet, error) {
+	infra, err := p.oc.GetInfrastructure()
+	if err != nil {
+		return nil, fmt.Errorf("error getting infrastructure: %w", err)
+	}
+	failureDomain, err := findFailureDomain(&infra.Spec, zone)
+	if err != nil {
+		return nil, err
+	}
+	providerSpec, _, err := p.RenderProviderSpec(ctx, windowsServerVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err = applyFailureDomain(providerSpec, failureDomain); err != nil {
+		return nil, err
+	}
+	if err = validateProviderSpec(providerSpec); err != nil {
+		return nil, fmt.Errorf("vSphere failure domain %s: %w", zone, err)
+	}
+	rawProviderSpec, err := json.Marshal(providerSpec)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new vSphere machine provider spec: %w", err)
+		return nil, fmt.Errorf("failed to marshal vSphere machine provider spec: %w", err)
 	}
+	return machineset.New(rawProviderSpec, p.InfrastructureName, replicas, withIgnoreLabel, zone+"-"), nil
+}
 
+// GenerateMachineSetWithUserData behaves as GenerateMachineSet, the Machines additionally running the given PowerShell
+// script when their VM is provisioned, after the WMCO user data. This allows debugging the provisioning of VMs, i.e. by
+// enabling verbose sshd logging. The user data is held by the returned Secret, which must be created along with the
+// MachineSet.
+func (p *Provider) GenerateMachineSetWithUserData(ctx context.Context, withIgnoreLabel bool, replicas int32,
+	windowsServerVersion windows.ServerVersion, extraUserData string) (*mapi.MachineSet, *core.Secret, error) {
+	providerSpec, rawProviderSpec, err := p.RenderProviderSpec(ctx, windowsServerVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	wmcoUserData, err := p.oc.K8s.CoreV1().Secrets(clusterinfo.MachineAPINamespace).Get(ctx,
+		clusterinfo.UserDataSecretName, meta.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting secret %s: %w", clusterinfo.UserDataSecretName, err)
+	}
+	userData, err := mergeUserData(string(wmcoUserData.Data[userDataKey]), extraUserData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ms := machineset.New(rawProviderSpec, p.InfrastructureName, replicas, withIgnoreLabel, "")
+	secret, err := applyUserData(ms, providerSpec, userData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ms, secret, nil
+}
+
+// applyUserData makes the Machines of the given MachineSet, generated from the given provider spec, use the given user
+// data. Returns the Secret holding the user data, named after the MachineSet so that the user data of different
+// MachineSets do not collide.
+func applyUserData(ms *mapi.MachineSet, providerSpec *mapi.VSphereMachineProviderSpec,
+	userData string) (*core.Secret, error) {
+	secret := &core.Secret{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      ms.GetName() + "-user-data",
+			Namespace: clusterinfo.MachineAPINamespace,
+		},
+		Data: map[string][]byte{userDataKey: []byte(userData)},
+	}
+	providerSpec.UserDataSecret = &core.LocalObjectReference{Name: secret.GetName()}
 	rawProviderSpec, err := json.Marshal(providerSpec)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal vSphere machine provider spec: %w", err)
 	}
+	ms.Spec.Template.Spec.ProviderSpec.Value.Raw = rawProviderSpec
+	return secret, nil
+}
 
-	return machineset.New(rawProviderSpec, p.InfrastructureName, replicas, withIgnoreLabel, ""), nil
+// mergeUserData returns the given Windows user data, as generated by WMCO, with the given PowerShell script appended
+// to its script. The script must not hold any user data tag, as it would make the resulting user data malformed.
+func mergeUserData(userData, script string) (string, error) {
+	if strings.TrimSpace(script) == "" {
+		return "", fmt.Errorf("extra user data cannot be empty")
+	}
+	for _, tag := range []string{"<powershell>", "</powershell>", "<persist>", "</persist>"} {
+		if strings.Contains(script, tag) {
+			return "", fmt.Errorf("extra user data cannot hold the %s tag, it must be a PowerShell script", tag)
+		}
+	}
+	if userData == "" {
+		return "<powershell>" + script + "</powershell>\n<persist>true</persist>\n", nil
+	}
+	if strings.Count(userData, "</powershell>") != 1 {
+		return "", fmt.Errorf("user data must hold a single PowerShell script")
+	}
+	return strings.Replace(userData, "</powershell>", "\n"+script+"</powershell>", 1), nil
+}
+
+// findFailureDomain returns the vSphere failure domain with the given name, or an error listing the failure domains
+// defined in the given Infrastructure spec if none matches
+func findFailureDomain(infraSpec *config.InfrastructureSpec,
+	name string) (*config.VSpherePlatformFailureDomainSpec, error) {
+	var names []string
+	if infraSpec.PlatformSpec.VSphere != nil {
+		for i, failureDomain := range infraSpec.PlatformSpec.VSphere.FailureDomains {
+			if failureDomain.Name == name {
+				return &infraSpec.PlatformSpec.VSphere.FailureDomains[i], nil
+			}
+			names = append(names, failureDomain.Name)
+		}
+	}
+	return nil, fmt.Errorf("vSphere failure domain %q not found in the infrastructure, available: %v", name, names)
+}
+
+// applyFailureDomain sets the workspace and network of the given provider spec to the ones of the given failure domain.
+// The resource pool, folder and datastore overrides read by resolveWorkspace take precedence over the failure domain,
+// as they do over the workspace of the existing MachineSet.
+func applyFailureDomain(providerSpec *mapi.VSphereMachineProviderSpec,
+	failureDomain *config.VSpherePlatformFailureDomainSpec) error {
+	topology := failureDomain.Topology
+	if providerSpec.Workspace == nil {
+		providerSpec.Workspace = &mapi.Workspace{}
+	}
+	providerSpec.Workspace.Server = failureDomain.Server
+	providerSpec.Workspace.Datacenter = topology.Datacenter
+	providerSpec.Workspace.Datastore = topology.Datastore
+	// the resource pool of a compute cluster is used when the failure domain does not define one
+	providerSpec.Workspace.ResourcePool = topology.ResourcePool
+	if providerSpec.Workspace.ResourcePool == "" {
+		providerSpec.Workspace.ResourcePool = topology.ComputeCluster + "/Resources"
+	}
+	if topology.Folder != "" {
+		providerSpec.Workspace.Folder = topology.Folder
+	}
+	if len(topology.Networks) > 0 {
+		providerSpec.Network = mapi.NetworkSpec{Devices: []mapi.NetworkDeviceSpec{{NetworkName: topology.Networks[0]}}}
+	}
+	workspace, err := resolveWorkspace(providerSpec.Workspace)
+	if err != nil {
+		return err
+	}
+	providerSpec.Workspace = workspace
+	return nil
 }
 
 func (p *Provider) GetType() config.PlatformType {
 	return config.VSpherePlatformType
 }
 
+// SupportedWindowsVersions returns the Windows Server versions MachineSets can be generated for
+func (p *Provider) SupportedWindowsVersions() []windows.ServerVersion {
+	return []windows.ServerVersion{windows.Server2022}
+}
+
+// DefaultAdminUsername returns the local administrator of the VM template Windows VMs are created from. It can be
+// overridden through the vmAdminUsernameEnvVar environment variable, for templates using a different administrator.
+func (p *Provider) DefaultAdminUsername() string {
+	if username := strings.TrimSpace(os.Getenv(vmAdminUsernameEnvVar)); username != "" {
+		return username
+	}
+	return windows.DefaultAdminUsername
+}
+
 func (p *Provider) StorageSupport() bool {
 	return true
 }
 
-// CreatePVC creates a PVC for a dynamically provisioned volume
-func (p *Provider) CreatePVC(client client.Interface, namespace string, _ *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
-	if err := p.ensureWindowsCSIDrivers(client); err != nil {
+// pvcAccessModes are the access modes of the PVCs created for Windows workloads
+var pvcAccessModes = []core.PersistentVolumeAccessMode{core.ReadWriteOnce}
+
+// supportedAccessModes are the access modes supported by the volumes of each vSphere provisioner. Both only provision
+// block volumes for Windows nodes, which can only be attached to a single node, as vSphere file volumes are not
+// supported on Windows.
+var supportedAccessModes = map[string][]core.PersistentVolumeAccessMode{
+	inTreeProvisionerName: {core.ReadWriteOnce},
+	csiDriverName:         {core.ReadWriteOnce, core.ReadWriteOncePod},
+}
+
+// validateAccessModes returns an error if the volumes provisioned through the given storage class do not support all
+// the given access modes, as a PVC requesting them would never be bound
+func validateAccessModes(sc *storage.StorageClass, modes []core.PersistentVolumeAccessMode) error {
+	supported, known := supportedAccessModes[sc.Provisioner]
+	if !known {
+		return fmt.Errorf("storage class %s uses unsupported provisioner %s", sc.Name, sc.Provisioner)
+	}
+	for _, mode := range modes {
+		if !slices.Contains(supported, mode) {
+			return fmt.Errorf("access mode %s not supported by the %s provisioner of storage class %s, supported "+
+				"modes are %v", mode, sc.Provisioner, sc.Name, supported)
+		}
+	}
+	return nil
+}
+
+// CreatePVC creates a PVC for a dynamically provisioned volume. Volumes are provisioned by the vSphere CSI driver if it
+// is installed in the cluster, and by the in-tree vSphere volume plugin otherwise.
+func (p *Provider) CreatePVC(ctx context.Context, client client.Interface, namespace string, _ *core.PersistentVolume) (*core.PersistentVolumeClaim, error) {
+	csiInstalled, err := isCSIDriverInstalled(ctx, client)
+	if err != nil {
 		return nil, err
 	}
 	// Use a StorageClass to allow for dynamic volume provisioning
 	// https://docs.openshift.com/container-platform/4.12/storage/dynamic-provisioning.html#about_dynamic-provisioning
-	sc, err := p.ensureStorageClass(client)
+	var sc *storage.StorageClass
+	if csiInstalled {
+		if err = p.ensureWindowsCSIDrivers(ctx, client); err != nil {
+			return nil, err
+		}
+		sc, err = p.ensureCSIStorageClass(ctx, client)
+	} else {
+		sc, err = p.ensureInTreeStorageClass(ctx, client)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("unable to ensure a usable StorageClass is created: %w", err)
 	}
+	if err = validateAccessModes(sc, pvcAccessModes); err != nil {
+		return nil, err
+	}
 	pvcSpec := core.PersistentVolumeClaim{
 		ObjectMeta: meta.ObjectMeta{
 			GenerateName: storageClassName + "-",
 		},
 		Spec: core.PersistentVolumeClaimSpec{
-			AccessModes: []core.PersistentVolumeAccessMode{core.ReadWriteOnce},
+			AccessModes: pvcAccessModes,
 			Resources: core.VolumeResourceRequirements{
 				Requests: core.ResourceList{core.ResourceStorage: resource.MustParse("2Gi")},
 			},
 			StorageClassName: &sc.Name,
 		},
 	}
-	return client.CoreV1().PersistentVolumeClaims(namespace).Create(context.TODO(), &pvcSpec, meta.CreateOptions{})
+	return client.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, &pvcSpec, meta.CreateOptions{})
 }
 
-// ensureStorageClass ensures a usable vSphere NTFS storage class exists
-func (p *Provider) ensureStorageClass(client client.Interface) (*storage.StorageClass, error) {
-	sc, err := client.StorageV1().StorageClasses().Get(context.TODO(), storageClassName, meta.GetOptions{})
+// isCSIDriverInstalled returns true if the vSphere CSI driver is registered in the cluster
+func isCSIDriverInstalled(ctx context.Context, client client.Interface) (bool, error) {
+	_, err := client.StorageV1().CSIDrivers().Get(ctx, csiDriverName, meta.GetOptions{})
 	if err == nil {
-		return sc, nil
-	} else if !k8sapierrors.IsNotFound(err) {
-		return nil, fmt.Errorf("error getting storage class '%s': %w", storageClassName, err)
+		return true, nil
+	} else if k8sapierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("error getting CSI driver %s: %w", csiDriverName, err)
+}
+
+// newStorageClass returns the NTFS storage class provisioned by the given vSphere provisioner
+func newStorageClass(provisioner string) *storage.StorageClass {
+	fsTypeParameter := csiFSTypeParameter
+	if provisioner == inTreeProvisionerName {
+		fsTypeParameter = inTreeFSTypeParameter
 	}
 	volumeBinding := storage.VolumeBindingImmediate
 	reclaimPolicy := core.PersistentVolumeReclaimDelete
-	sc = &storage.StorageClass{
+	return &storage.StorageClass{
 		ObjectMeta: meta.ObjectMeta{
 			Name: storageClassName,
 		},
-		Provisioner:       "csi.vsphere.vmware.com",
-		Parameters:        map[string]string{"fstype": "ntfs"},
+		Provisioner:       provisioner,
+		Parameters:        map[string]string{fsTypeParameter: "ntfs"},
 		ReclaimPolicy:     &reclaimPolicy,
 		VolumeBindingMode: &volumeBinding,
 	}
-	return client.StorageV1().StorageClasses().Create(context.TODO(), sc, meta.CreateOptions{})
+}
+
+// ensureCSIStorageClass ensures a usable NTFS storage class provisioned by the vSphere CSI driver exists
+func (p *Provider) ensureCSIStorageClass(ctx context.Context, client client.Interface) (*storage.StorageClass, error) {
+	return ensureStorageClass(ctx, client, newStorageClass(csiDriverName))
+}
+
+// ensureInTreeStorageClass ensures a usable NTFS storage class provisioned by the in-tree vSphere volume plugin exists
+func (p *Provider) ensureInTreeStorageClass(ctx context.Context,
+	client client.Interface) (*storage.StorageClass, error) {
+	return ensureStorageClass(ctx, client, newStorageClass(inTreeProvisionerName))
+}
+
+// ensureStorageClass ensures the given storage class exists. An existing class with the same name is replaced if it
+// uses another provisioner, as the provisioner of a storage class cannot be changed.
+func ensureStorageClass(ctx context.Context, client client.Interface,
+	expected *storage.StorageClass) (*storage.StorageClass, error) {
+	storageClasses := client.StorageV1().StorageClasses()
+	sc, err := storageClasses.Get(ctx, expected.GetName(), meta.GetOptions{})
+	if err == nil {
+		if sc.Provisioner == expected.Provisioner {
+			return sc, nil
+		}
+		if err = storageClasses.Delete(ctx, sc.GetName(), meta.DeleteOptions{}); err != nil &&
+			!k8sapierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("error deleting storage class '%s' provisioned by %s: %w", sc.GetName(),
+				sc.Provisioner, err)
+		}
+	} else if !k8sapierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("error getting storage class '%s': %w", expected.GetName(), err)
+	}
+	return storageClasses.Create(ctx, expected, meta.CreateOptions{})
 }
 
 // ensureWindowsCSIDrivers ensures that the vSphere CSI drivers are deployed across Windows nodes
-func (p *Provider) ensureWindowsCSIDrivers(client client.Interface) error {
-	if err := p.ensureFSSConfigMap(client); err != nil {
+func (p *Provider) ensureWindowsCSIDrivers(ctx context.Context, client client.Interface) error {
+	if err := p.ensureFSSConfigMap(ctx, client); err != nil {
 		return err
 	}
-	return p.ensureWindowsCSIDaemonSet(client)
+	return p.ensureWindowsCSIDaemonSet(ctx, client)
 }
 
 // ensureFSSConfigMap creates a feature state switch ConfigMap for Windows Nodes. The FSS used by Linux nodes is
 // unusable as it does not set csi-windows-support to true
-func (p *Provider) ensureFSSConfigMap(client client.Interface) error {
+func (p *Provider) ensureFSSConfigMap(ctx context.Context, client client.Interface) error {
 	fssCM := core.ConfigMap{
 		ObjectMeta: meta.ObjectMeta{
 			Name: windowsFSSName,
@@ -214,7 +627,7 @@ func (p *Provider) ensureFSSConfigMap(client client.Interface) error {
 	}
 
 	// See if the ConfigMap already exists in the state we expect it to be in.
-	existingCM, err := client.CoreV1().ConfigMaps(csiNamespace).Get(context.TODO(), windowsFSSName, meta.GetOptions{})
+	existingCM, err := client.CoreV1().ConfigMaps(csiNamespace).Get(ctx, windowsFSSName, meta.GetOptions{})
 	if err != nil {
 		if !k8sapierrors.IsNotFound(err) {
 			return fmt.Errorf("error getting existing FSS ConfigMap: %w", err)
@@ -225,12 +638,12 @@ func (p *Provider) ensureFSSConfigMap(client client.Interface) error {
 			return nil
 		}
 		// Delete the ConfigMap as it has the wrong data.
-		err = client.CoreV1().ConfigMaps(csiNamespace).Delete(context.TODO(), windowsFSSName, meta.DeleteOptions{})
+		err = client.CoreV1().ConfigMaps(csiNamespace).Delete(ctx, windowsFSSName, meta.DeleteOptions{})
 		if err != nil {
 			return fmt.Errorf("error deleting existing FSS ConfigMap: %w", err)
 		}
 	}
-	_, err = client.CoreV1().ConfigMaps(csiNamespace).Create(context.TODO(), &fssCM, meta.CreateOptions{})
+	_, err = client.CoreV1().ConfigMaps(csiNamespace).Create(ctx, &fssCM, meta.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("could not create FSS ConfigMap: %w", err)
 	}
@@ -238,7 +651,7 @@ func (p *Provider) ensureFSSConfigMap(client client.Interface) error {
 }
 
 // ensureWindowsCSIDaemonSet deploys the Windows CSI driver DaemonSet if it doesn't already exist
-func (p *Provider) ensureWindowsCSIDaemonSet(client client.Interface) error {
+func (p *Provider) ensureWindowsCSIDaemonSet(ctx context.Context, client client.Interface) error {
 	dsName := "vmware-vsphere-csi-driver-node-windows"
 	directoryType := core.HostPathDirectory
 	directoryOrCreate := core.HostPathDirectoryOrCreate
@@ -428,7 +841,7 @@ func (p *Provider) ensureWindowsCSIDaemonSet(client client.Interface) error {
 		},
 	}
 	// See if the DaemonSet already exists in the state we expect it to be in.
-	existingDS, err := client.AppsV1().DaemonSets(csiNamespace).Get(context.TODO(), dsName, meta.GetOptions{})
+	existingDS, err := client.AppsV1().DaemonSets(csiNamespace).Get(ctx, dsName, meta.GetOptions{})
 	if err != nil {
 		if !k8sapierrors.IsNotFound(err) {
 			return fmt.Errorf("error getting existing Windows CSI DaemonSet: %w", err)
@@ -439,13 +852,13 @@ func (p *Provider) ensureWindowsCSIDaemonSet(client client.Interface) error {
 			return nil
 		}
 		// Delete the DaemonSet as it has the wrong spec.
-		err = client.AppsV1().DaemonSets(csiNamespace).Delete(context.TODO(), dsName, meta.DeleteOptions{})
+		err = client.AppsV1().DaemonSets(csiNamespace).Delete(ctx, dsName, meta.DeleteOptions{})
 		if err != nil {
 			return fmt.Errorf("error deleting existing Windows CSI DaemonSet: %w", err)
 
 		}
 	}
-	_, err = client.AppsV1().DaemonSets(csiNamespace).Create(context.TODO(), &ds, meta.CreateOptions{})
+	_, err = client.AppsV1().DaemonSets(csiNamespace).Create(ctx, &ds, meta.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("error creating Windows CSI DaemonSet: %w", err)
 	}
@@ -0,0 +1,654 @@
+package vsphere
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	config "github.com/openshift/api/config/v1"
+	mapi "github.com/openshift/api/machine/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	mapiClient "github.com/openshift/client-go/machine/clientset/versioned/typed/machine/v1beta1"
+
+	"github.com/openshift/windows-machine-config-operator/test/e2e/clusterinfo"
+	"github.com/openshift/windows-machine-config-operator/test/e2e/providers/machineset"
+	"github.com/openshift/windows-machine-config-operator/test/e2e/windows"
+)
+
+func TestResolveTemplate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		envValue    string
+		version     windows.ServerVersion
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "default template",
+			version:  windows.Server2022,
+			expected: "windows-golden-images/windows-server-2022-template-ipv6-disabled",
+		},
+		{
+			name:     "default version",
+			expected: "windows-golden-images/windows-server-2022-template-ipv6-disabled",
+		},
+		{
+			name:        "version without a default template",
+			version:     windows.Server2019,
+			expectedErr: true,
+		},
+		{
+			name:     "override",
+			envValue: "windows-golden-images/custom-template",
+			version:  windows.Server2022,
+			expected: "windows-golden-images/custom-template",
+		},
+		{
+			name:     "override for a version without a default template",
+			envValue: "windows-golden-images/windows-server-2019-template",
+			version:  windows.Server2019,
+			expected: "windows-golden-images/windows-server-2019-template",
+		},
+		{
+			name:        "whitespace override",
+			envValue:    "   ",
+			version:     windows.Server2022,
+			expectedErr: true,
+		},
+		{
+			name:        "override with trailing whitespace",
+			envValue:    "windows-golden-images/custom-template\n",
+			version:     windows.Server2022,
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			// an empty value behaves as if the variable was not set
+			t.Setenv(vmTemplateEnvVar, test.envValue)
+			template, err := resolveTemplate(test.version)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, template)
+		})
+	}
+}
+
+func TestDefaultAdminUsername(t *testing.T) {
+	testCases := []struct {
+		name     string
+		envValue string
+		expected string
+	}{
+		{
+			name:     "default",
+			expected: windows.DefaultAdminUsername,
+		},
+		{
+			name:     "override",
+			envValue: "vsphere-admin",
+			expected: "vsphere-admin",
+		},
+		{
+			name:     "whitespace override",
+			envValue: "   ",
+			expected: windows.DefaultAdminUsername,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			// an empty value behaves as if the variable was not set
+			t.Setenv(vmAdminUsernameEnvVar, test.envValue)
+			assert.Equal(t, test.expected, (&Provider{}).DefaultAdminUsername())
+		})
+	}
+}
+
+func TestResolveWorkspace(t *testing.T) {
+	existing := &mapi.Workspace{Server: "vcenter.example.com", Datacenter: "dc", Datastore: "/dc/datastore/ds",
+		Folder: "/dc/vm/infra", ResourcePool: "/dc/host/cluster/Resources"}
+	testCases := []struct {
+		name string
+		// envValues are the values of the set override environment variables
+		envValues         map[string]string
+		expectedWorkspace *mapi.Workspace
+		expectedErr       bool
+	}{
+		{
+			name:              "no override",
+			expectedWorkspace: existing,
+		},
+		{
+			name: "overrides",
+			envValues: map[string]string{vmResourcePoolEnvVar: "/dc/host/cluster/Resources/windows",
+				vmFolderEnvVar: "/dc/vm/windows-e2e", vmDatastoreEnvVar: "/dc/datastore/windows"},
+			expectedWorkspace: &mapi.Workspace{Server: "vcenter.example.com", Datacenter: "dc",
+				Datastore: "/dc/datastore/windows", Folder: "/dc/vm/windows-e2e",
+				ResourcePool: "/dc/host/cluster/Resources/windows"},
+		},
+		{
+			name:      "folder override",
+			envValues: map[string]string{vmFolderEnvVar: "/dc/vm/windows-e2e"},
+			expectedWorkspace: &mapi.Workspace{Server: "vcenter.example.com", Datacenter: "dc",
+				Datastore: "/dc/datastore/ds", Folder: "/dc/vm/windows-e2e", ResourcePool: "/dc/host/cluster/Resources"},
+		},
+		{
+			name:        "empty override",
+			envValues:   map[string]string{vmResourcePoolEnvVar: ""},
+			expectedErr: true,
+		},
+		{
+			name:        "whitespace override",
+			envValues:   map[string]string{vmDatastoreEnvVar: " "},
+			expectedErr: true,
+		},
+		{
+			name:        "override with trailing whitespace",
+			envValues:   map[string]string{vmFolderEnvVar: "/dc/vm/windows-e2e\n"},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			for _, envVar := range []string{vmResourcePoolEnvVar, vmFolderEnvVar, vmDatastoreEnvVar} {
+				value, ok := test.envValues[envVar]
+				// t.Setenv restores the variable once the test is done, including when it is unset below
+				t.Setenv(envVar, value)
+				if !ok {
+					require.NoError(t, os.Unsetenv(envVar))
+				}
+			}
+			workspace, err := resolveWorkspace(existing)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedWorkspace, workspace)
+			// the workspace of the existing MachineSet is left untouched
+			assert.Equal(t, "/dc/vm/infra", existing.Folder)
+		})
+	}
+}
+
+func TestFindFailureDomain(t *testing.T) {
+	infraSpec := &config.InfrastructureSpec{PlatformSpec: config.PlatformSpec{VSphere: &config.VSpherePlatformSpec{
+		FailureDomains: []config.VSpherePlatformFailureDomainSpec{{Name: "us-east-1a"}, {Name: "us-east-1b"}},
+	}}}
+	failureDomain, err := findFailureDomain(infraSpec, "us-east-1b")
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-1b", failureDomain.Name)
+
+	_, err = findFailureDomain(infraSpec, "us-west-1a")
+	assert.ErrorContains(t, err, "us-east-1a")
+
+	_, err = findFailureDomain(&config.InfrastructureSpec{}, "us-east-1a")
+	assert.Error(t, err)
+}
+
+func TestApplyFailureDomain(t *testing.T) {
+	failureDomain := &config.VSpherePlatformFailureDomainSpec{
+		Name:   "us-east-1a",
+		Server: "vcenter-2.example.com",
+		Topology: config.VSpherePlatformTopology{
+			Datacenter:     "dc2",
+			ComputeCluster: "/dc2/host/cluster2",
+			Networks:       []string{"zone-network", "other-network"},
+			Datastore:      "/dc2/datastore/ds2",
+			Folder:         "/dc2/vm/windows",
+		},
+	}
+	testCases := []struct {
+		name              string
+		resourcePool      string
+		env               map[string]string
+		expectedWorkspace *mapi.Workspace
+	}{
+		{
+			name: "resource pool of the compute cluster",
+			expectedWorkspace: &mapi.Workspace{Server: "vcenter-2.example.com", Datacenter: "dc2",
+				Folder: "/dc2/vm/windows", Datastore: "/dc2/datastore/ds2", ResourcePool: "/dc2/host/cluster2/Resources"},
+		},
+		{
+			name:         "resource pool of the failure domain",
+			resourcePool: "/dc2/host/cluster2/Resources/windows",
+			expectedWorkspace: &mapi.Workspace{Server: "vcenter-2.example.com", Datacenter: "dc2",
+				Folder: "/dc2/vm/windows", Datastore: "/dc2/datastore/ds2",
+				ResourcePool: "/dc2/host/cluster2/Resources/windows"},
+		},
+		{
+			name:         "environment overrides",
+			resourcePool: "/dc2/host/cluster2/Resources/windows",
+			env: map[string]string{vmResourcePoolEnvVar: "/dc2/host/cluster2/Resources/ci",
+				vmFolderEnvVar: "/dc2/vm/ci", vmDatastoreEnvVar: "/dc2/datastore/ci"},
+			expectedWorkspace: &mapi.Workspace{Server: "vcenter-2.example.com", Datacenter: "dc2",
+				Folder: "/dc2/vm/ci", Datastore: "/dc2/datastore/ci", ResourcePool: "/dc2/host/cluster2/Resources/ci"},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			failureDomain := *failureDomain
+			failureDomain.Topology.ResourcePool = test.resourcePool
+			providerSpec := &mapi.VSphereMachineProviderSpec{
+				Workspace: &mapi.Workspace{Server: "vcenter-1.example.com", Datacenter: "dc1", Folder: "/dc1/vm/infra"},
+				Network:   mapi.NetworkSpec{Devices: []mapi.NetworkDeviceSpec{{NetworkName: "default-network"}}},
+				Template:  "windows-golden-images/windows-server-2022-template-ipv6-disabled",
+			}
+			setEnv(t, []string{vmResourcePoolEnvVar, vmFolderEnvVar, vmDatastoreEnvVar}, test.env)
+			require.NoError(t, applyFailureDomain(providerSpec, &failureDomain))
+			assert.Equal(t, test.expectedWorkspace, providerSpec.Workspace)
+			assert.Equal(t, []mapi.NetworkDeviceSpec{{NetworkName: "zone-network"}}, providerSpec.Network.Devices)
+			// the Windows template is not replaced by the template of the failure domain
+			assert.Equal(t, "windows-golden-images/windows-server-2022-template-ipv6-disabled", providerSpec.Template)
+		})
+	}
+}
+
+func TestValidateProviderSpec(t *testing.T) {
+	validSpec := func() *mapi.VSphereMachineProviderSpec {
+		return &mapi.VSphereMachineProviderSpec{
+			Template:          "windows-golden-images/windows-server-2022-template-ipv6-disabled",
+			Network:           mapi.NetworkSpec{Devices: []mapi.NetworkDeviceSpec{{NetworkName: "ci-network"}}},
+			Workspace:         &mapi.Workspace{Server: "vcenter.example.com", Datacenter: "dc", Datastore: "ds"},
+			DiskGiB:           128,
+			MemoryMiB:         16384,
+			NumCPUs:           4,
+			NumCoresPerSocket: 2,
+		}
+	}
+	testCases := []struct {
+		name             string
+		mutate           func(spec *mapi.VSphereMachineProviderSpec)
+		expectedInErrMsg string
+	}{
+		{
+			name:   "valid",
+			mutate: func(spec *mapi.VSphereMachineProviderSpec) {},
+		},
+		{
+			name:             "empty template",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.Template = "" },
+			expectedInErrMsg: "template is empty",
+		},
+		{
+			name:             "no network device",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.Network = mapi.NetworkSpec{} },
+			expectedInErrMsg: "network has no device",
+		},
+		{
+			name:             "empty network name",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.Network.Devices[0].NetworkName = "" },
+			expectedInErrMsg: "network device 0 has no network name",
+		},
+		{
+			name:             "missing workspace",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.Workspace = nil },
+			expectedInErrMsg: "workspace is missing",
+		},
+		{
+			name:             "empty workspace server",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.Workspace.Server = "" },
+			expectedInErrMsg: "workspace server is empty",
+		},
+		{
+			name:             "empty workspace datacenter",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.Workspace.Datacenter = "" },
+			expectedInErrMsg: "workspace datacenter is empty",
+		},
+		{
+			name:             "empty workspace datastore",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.Workspace.Datastore = "" },
+			expectedInErrMsg: "workspace datastore is empty",
+		},
+		{
+			name:             "no disk",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.DiskGiB = 0 },
+			expectedInErrMsg: "disk size 0GiB is not positive",
+		},
+		{
+			name:             "negative memory",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.MemoryMiB = -1 },
+			expectedInErrMsg: "memory -1MiB is not positive",
+		},
+		{
+			name:             "no CPU",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.NumCPUs = 0 },
+			expectedInErrMsg: "number of CPUs 0 is not positive",
+		},
+		{
+			name:             "no cores per socket",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.NumCoresPerSocket = 0 },
+			expectedInErrMsg: "number of cores per socket 0 is not positive",
+		},
+		{
+			name:             "cores per socket not dividing CPUs",
+			mutate:           func(spec *mapi.VSphereMachineProviderSpec) { spec.NumCoresPerSocket = 3 },
+			expectedInErrMsg: "number of cores per socket 3 does not divide the number of CPUs 4",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			spec := validSpec()
+			test.mutate(spec)
+			err := validateProviderSpec(spec)
+			if test.expectedInErrMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectedInErrMsg)
+		})
+	}
+
+	// all problems are reported at once
+	err := validateProviderSpec(&mapi.VSphereMachineProviderSpec{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "template is empty")
+	assert.Contains(t, err.Error(), "workspace is missing")
+}
+
+func TestMergeUserData(t *testing.T) {
+	wmcoUserData := "<powershell>Start-Service sshd</powershell>\n<persist>true</persist>\n"
+	testCases := []struct {
+		name        string
+		userData    string
+		script      string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "appended to the WMCO script",
+			userData: wmcoUserData,
+			script:   "Set-Content C:\\debug.txt verbose",
+			expected: "<powershell>Start-Service sshd\nSet-Content C:\\debug.txt verbose</powershell>\n" +
+				"<persist>true</persist>\n",
+		},
+		{
+			name:     "no WMCO user data",
+			script:   "Set-Content C:\\debug.txt verbose",
+			expected: "<powershell>Set-Content C:\\debug.txt verbose</powershell>\n<persist>true</persist>\n",
+		},
+		{
+			name:        "empty script",
+			userData:    wmcoUserData,
+			script:      " \n",
+			expectedErr: true,
+		},
+		{
+			name:        "script holding a tag",
+			userData:    wmcoUserData,
+			script:      "<powershell>Set-Content C:\\debug.txt verbose</powershell>",
+			expectedErr: true,
+		},
+		{
+			name:        "user data with multiple scripts",
+			userData:    wmcoUserData + wmcoUserData,
+			script:      "Set-Content C:\\debug.txt verbose",
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			userData, err := mergeUserData(test.userData, test.script)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, userData)
+		})
+	}
+}
+
+func TestApplyUserData(t *testing.T) {
+	providerSpec := &mapi.VSphereMachineProviderSpec{
+		Template: "windows-golden-images/windows-server-2022-template-ipv6-disabled",
+	}
+	rawProviderSpec, err := json.Marshal(providerSpec)
+	require.NoError(t, err)
+	ms := machineset.New(rawProviderSpec, "cluster", 1, false, "")
+	// the default MachineSet references no user data
+	var rendered mapi.VSphereMachineProviderSpec
+	require.NoError(t, json.Unmarshal(ms.Spec.Template.Spec.ProviderSpec.Value.Raw, &rendered))
+	assert.Nil(t, rendered.UserDataSecret)
+
+	userData := "<powershell>Start-Service sshd\nSet-Content C:\\debug.txt verbose</powershell>\n"
+	secret, err := applyUserData(ms, providerSpec, userData)
+	require.NoError(t, err)
+	assert.Equal(t, ms.GetName()+"-user-data", secret.GetName())
+	assert.Equal(t, clusterinfo.MachineAPINamespace, secret.GetNamespace())
+	assert.Equal(t, userData, string(secret.Data[userDataKey]))
+	require.NoError(t, json.Unmarshal(ms.Spec.Template.Spec.ProviderSpec.Value.Raw, &rendered))
+	require.NotNil(t, rendered.UserDataSecret)
+	assert.Equal(t, secret.GetName(), rendered.UserDataSecret.Name)
+	assert.Equal(t, providerSpec.Template, rendered.Template)
+}
+
+func TestValidateAccessModes(t *testing.T) {
+	storageClass := func(provisioner string) *storage.StorageClass {
+		return &storage.StorageClass{ObjectMeta: meta.ObjectMeta{Name: storageClassName}, Provisioner: provisioner}
+	}
+	testCases := []struct {
+		name        string
+		sc          *storage.StorageClass
+		modes       []core.PersistentVolumeAccessMode
+		expectedErr bool
+	}{
+		{
+			name:  "CSI read write once",
+			sc:    storageClass(csiDriverName),
+			modes: pvcAccessModes,
+		},
+		{
+			name:  "CSI read write once pod",
+			sc:    storageClass(csiDriverName),
+			modes: []core.PersistentVolumeAccessMode{core.ReadWriteOncePod},
+		},
+		{
+			name:        "CSI read write many",
+			sc:          storageClass(csiDriverName),
+			modes:       []core.PersistentVolumeAccessMode{core.ReadWriteOnce, core.ReadWriteMany},
+			expectedErr: true,
+		},
+		{
+			name:        "CSI read only many",
+			sc:          storageClass(csiDriverName),
+			modes:       []core.PersistentVolumeAccessMode{core.ReadOnlyMany},
+			expectedErr: true,
+		},
+		{
+			name:  "in-tree read write once",
+			sc:    storageClass(inTreeProvisionerName),
+			modes: []core.PersistentVolumeAccessMode{core.ReadWriteOnce},
+		},
+		{
+			name:        "in-tree read write once pod",
+			sc:          storageClass(inTreeProvisionerName),
+			modes:       []core.PersistentVolumeAccessMode{core.ReadWriteOncePod},
+			expectedErr: true,
+		},
+		{
+			name:        "in-tree read write many",
+			sc:          storageClass(inTreeProvisionerName),
+			modes:       []core.PersistentVolumeAccessMode{core.ReadWriteMany},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown provisioner",
+			sc:          storageClass("file.csi.azure.com"),
+			modes:       []core.PersistentVolumeAccessMode{core.ReadWriteOnce},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateAccessModes(test.sc, test.modes)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// setEnv sets the given environment variables for the duration of the test, unsetting the other given variables
+func setEnv(t *testing.T, envVars []string, values map[string]string) {
+	for _, envVar := range envVars {
+		value, ok := values[envVar]
+		// t.Setenv restores the variable once the test is done, including when it is unset below
+		t.Setenv(envVar, value)
+		if !ok {
+			require.NoError(t, os.Unsetenv(envVar))
+		}
+	}
+}
+
+const (
+	ownerTagID = "urn:vmomi:InventoryServiceTag:5736bf56-49f5-4667-b38c-b97e09dc9578:GLOBAL"
+	jobTagID   = "urn:vmomi:InventoryServiceTag:0a1b2c3d-4e5f-6789-abcd-ef0123456789:GLOBAL"
+)
+
+func TestResolveTagIDs(t *testing.T) {
+	testCases := []struct {
+		name           string
+		envValues      map[string]string
+		expectedTagIDs []string
+		expectedErr    bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:           "owner and job",
+			envValues:      map[string]string{vmOwnerTagEnvVar: ownerTagID, vmJobIDEnvVar: jobTagID},
+			expectedTagIDs: []string{ownerTagID, jobTagID},
+		},
+		{
+			name:           "job only",
+			envValues:      map[string]string{vmJobIDEnvVar: jobTagID},
+			expectedTagIDs: []string{jobTagID},
+		},
+		{
+			name:           "same tag",
+			envValues:      map[string]string{vmOwnerTagEnvVar: ownerTagID, vmJobIDEnvVar: ownerTagID},
+			expectedTagIDs: []string{ownerTagID},
+		},
+		{
+			name:        "empty",
+			envValues:   map[string]string{vmOwnerTagEnvVar: ""},
+			expectedErr: true,
+		},
+		{
+			name:        "whitespace",
+			envValues:   map[string]string{vmJobIDEnvVar: " "},
+			expectedErr: true,
+		},
+		{
+			name:        "tag name rather than ID",
+			envValues:   map[string]string{vmJobIDEnvVar: "windows-e2e-1234"},
+			expectedErr: true,
+		},
+		{
+			name:        "trailing whitespace",
+			envValues:   map[string]string{vmOwnerTagEnvVar: ownerTagID + "\n"},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, []string{vmOwnerTagEnvVar, vmJobIDEnvVar}, test.envValues)
+			tagIDs, err := resolveTagIDs()
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedTagIDs, tagIDs)
+		})
+	}
+}
+
+// fakeMachineClient is a Machine API client listing a single MachineSet
+type fakeMachineClient struct {
+	mapiClient.MachineV1beta1Interface
+	machineSets *fakeMachineSets
+}
+
+func (f *fakeMachineClient) MachineSets(string) mapiClient.MachineSetInterface {
+	return f.machineSets
+}
+
+type fakeMachineSets struct {
+	mapiClient.MachineSetInterface
+	machineSet mapi.MachineSet
+}
+
+func (f *fakeMachineSets) List(context.Context, meta.ListOptions) (*mapi.MachineSetList, error) {
+	return &mapi.MachineSetList{Items: []mapi.MachineSet{f.machineSet}}, nil
+}
+
+func TestNewVSphereMachineProviderSpecTags(t *testing.T) {
+	existing, err := json.Marshal(&mapi.VSphereMachineProviderSpec{
+		Network:   mapi.NetworkSpec{Devices: []mapi.NetworkDeviceSpec{{NetworkName: "network"}}},
+		Workspace: &mapi.Workspace{Server: "vcenter.example.com", Folder: "/dc/vm/infra"},
+	})
+	require.NoError(t, err)
+	machineSet := mapi.MachineSet{}
+	machineSet.Spec.Template.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: existing}
+	p := &Provider{
+		oc:                   &clusterinfo.OpenShift{Machine: &fakeMachineClient{machineSets: &fakeMachineSets{machineSet: machineSet}}},
+		InfrastructureStatus: &config.InfrastructureStatus{InfrastructureName: "infra"},
+	}
+	setEnv(t, []string{vmTemplateEnvVar, vmResourcePoolEnvVar, vmFolderEnvVar, vmDatastoreEnvVar}, nil)
+
+	t.Run("tagged", func(t *testing.T) {
+		setEnv(t, []string{vmOwnerTagEnvVar, vmJobIDEnvVar},
+			map[string]string{vmOwnerTagEnvVar: ownerTagID, vmJobIDEnvVar: jobTagID})
+		providerSpec, err := p.newVSphereMachineProviderSpec(context.Background(), windows.Server2022)
+		require.NoError(t, err)
+		assert.Equal(t, []string{ownerTagID, jobTagID}, providerSpec.TagIDs)
+
+		// the tags are kept in the provider spec embedded in the MachineSet
+		raw, err := json.Marshal(providerSpec)
+		require.NoError(t, err)
+		rendered := mapi.VSphereMachineProviderSpec{}
+		require.NoError(t, json.Unmarshal(raw, &rendered))
+		assert.Equal(t, []string{ownerTagID, jobTagID}, rendered.TagIDs)
+	})
+	t.Run("untagged", func(t *testing.T) {
+		setEnv(t, []string{vmOwnerTagEnvVar, vmJobIDEnvVar}, nil)
+		providerSpec, err := p.newVSphereMachineProviderSpec(context.Background(), windows.Server2022)
+		require.NoError(t, err)
+		assert.Empty(t, providerSpec.TagIDs)
+	})
+	t.Run("invalid tag", func(t *testing.T) {
+		setEnv(t, []string{vmOwnerTagEnvVar, vmJobIDEnvVar}, map[string]string{vmJobIDEnvVar: ""})
+		_, err := p.newVSphereMachineProviderSpec(context.Background(), windows.Server2022)
+		assert.Error(t, err)
+	})
+}
+
+func TestNewStorageClass(t *testing.T) {
+	csi := newStorageClass(csiDriverName)
+	assert.Equal(t, storageClassName, csi.GetName())
+	assert.Equal(t, csiDriverName, csi.Provisioner)
+	assert.Equal(t, map[string]string{csiFSTypeParameter: "ntfs"}, csi.Parameters)
+	assert.NoError(t, validateAccessModes(csi, pvcAccessModes))
+
+	inTree := newStorageClass(inTreeProvisionerName)
+	assert.Equal(t, storageClassName, inTree.GetName())
+	assert.Equal(t, inTreeProvisionerName, inTree.Provisioner)
+	assert.Equal(t, map[string]string{inTreeFSTypeParameter: "ntfs"}, inTree.Parameters)
+	assert.NoError(t, validateAccessModes(inTree, pvcAccessModes))
+}
@@ -2,6 +2,7 @@ package e2e
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -17,6 +18,7 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/openshift/windows-machine-config-operator/controllers"
+	"github.com/openshift/windows-machine-config-operator/test/e2e/providers"
 	"github.com/openshift/windows-machine-config-operator/test/e2e/smb"
 )
 
@@ -43,15 +45,24 @@ func testStorage(t *testing.T) {
 		pv, err = tc.createSMBPV()
 		require.NoError(t, err)
 	}
-	pvc, err := tc.CloudProvider.CreatePVC(tc.client.K8s, tc.workloadNamespace, pv)
+	pvc, err := providers.EnsurePVCIfSupported(context.TODO(), tc.CloudProvider, tc.client.K8s, tc.workloadNamespace, pv)
+	if errors.Is(err, providers.ErrStorageUnsupported) {
+		t.Skip(err.Error())
+	}
 	require.NoError(t, err)
 	if !skipWorkloadDeletion {
 		defer func() {
-			err := tc.client.K8s.CoreV1().PersistentVolumeClaims(tc.workloadNamespace).Delete(context.TODO(),
-				pvc.GetName(), meta.DeleteOptions{})
+			retainedPV, err := providers.DeletePVC(context.TODO(), tc.client.K8s, tc.workloadNamespace, pvc.GetName())
 			if err != nil {
 				log.Printf("error deleting PVC: %s", err)
 			}
+			if retainedPV != "" {
+				err = tc.client.K8s.CoreV1().PersistentVolumes().Delete(context.TODO(), retainedPV,
+					meta.DeleteOptions{})
+				if err != nil {
+					log.Printf("error deleting retained PV %s: %s", retainedPV, err)
+				}
+			}
 		}()
 	}
 	pvcVolumeSource := &core.PersistentVolumeClaimVolumeSource{ClaimName: pvc.GetName()}
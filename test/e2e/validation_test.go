@@ -5,12 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	config "github.com/openshift/api/config/v1"
 	operators "github.com/operator-framework/api/pkg/operators/v2"
@@ -384,9 +386,34 @@ func (tc *testContext) ensureTestRunnerRBAC() error {
 	return nil
 }
 
+var (
+	// errJobTimedOut is returned when a job is cancelled for running longer than its timeout
+	errJobTimedOut = errors.New("job timed out")
+	// errJobOutputTruncated is returned along with the partial output of a job whose output exceeded the maximum size
+	errJobOutputTruncated = errors.New("job output truncated")
+)
+
+// outputTruncatedMarker is appended to the output of a pod that was cut off at the maximum output size
+const outputTruncatedMarker = "\n<output truncated>"
+
+// jobLimits bounds the resources used by a job run through runJobWithLimits. A zero value means no limit is applied.
+type jobLimits struct {
+	// timeout is the amount of time the job can run for before being cancelled
+	timeout time.Duration
+	// maxOutputBytes is the maximum amount of output captured from each pod of the job
+	maxOutputBytes int64
+}
+
 // runPowerShellSSHJob creates and waits for a Kubernetes job to run. The command provided will be executed through
 // PowerShell, on the host specified by the provided IP.
 func (tc *testContext) runPowerShellSSHJob(name, command, ip string) (string, error) {
+	return tc.runPowerShellSSHJobWithLimits(name, command, ip, jobLimits{})
+}
+
+// runPowerShellSSHJobWithLimits behaves like runPowerShellSSHJob while bounding the job with the given limits. Returns
+// an error wrapping errJobTimedOut if the timeout is reached, or the truncated output and an error wrapping
+// errJobOutputTruncated if the output exceeds the maximum size.
+func (tc *testContext) runPowerShellSSHJobWithLimits(name, command, ip string, limits jobLimits) (string, error) {
 	// Modify command to work when default shell is the newer Powershell version present on Windows Server 2022.
 	powershellDefaultCommand := command
 	if tc.windowsServerVersion == e2e_windows.Server2022 {
@@ -411,12 +438,17 @@ func (tc *testContext) runPowerShellSSHJob(name, command, ip string) (string, er
 			filepath.Join(keyMountDir, secrets.PrivateKeySecretKey), tc.vmUsername(), ip,
 			filepath.Join(keyMountDir, secrets.PrivateKeySecretKey), tc.vmUsername(), ip)}
 
-	return tc.runJob(name, sshCommand)
+	return tc.runJobWithLimits(name, sshCommand, limits)
 }
 
 // runJob creates and waits for a Kubernetes job to run. The command provided will be executed on a Linux worker,
 // using the tools image.
 func (tc *testContext) runJob(name string, command []string) (string, error) {
+	return tc.runJobWithLimits(name, command, jobLimits{})
+}
+
+// runJobWithLimits behaves like runJob while bounding the job with the given limits
+func (tc *testContext) runJobWithLimits(name string, command []string, limits jobLimits) (string, error) {
 	// Create a job which runs the provided command via SSH
 	keyMountDir := "/private-key"
 	keyMode := int32(0600)
@@ -454,6 +486,12 @@ func (tc *testContext) runJob(name string, command []string) (string, error) {
 		},
 	}
 
+	if limits.timeout > 0 {
+		// the job controller terminates the job's pods once the deadline is reached
+		deadline := int64(math.Ceil(limits.timeout.Seconds()))
+		job.Spec.ActiveDeadlineSeconds = &deadline
+	}
+
 	jobsClient := tc.client.K8s.BatchV1().Jobs(tc.workloadNamespace)
 	job, err := jobsClient.Create(context.TODO(), job, meta.CreateOptions{})
 	if err != nil {
@@ -461,17 +499,40 @@ func (tc *testContext) runJob(name string, command []string) (string, error) {
 	}
 
 	// Wait for the job to complete then gather and return the pod output
-	if err = tc.waitUntilJobSucceeds(job.GetName()); err != nil {
+	if err = tc.waitUntilJobSucceedsWithLogLimit(job.GetName(), limits.maxOutputBytes); err != nil {
+		if deadlineExceeded, getErr := tc.jobDeadlineExceeded(job.GetName()); getErr == nil && deadlineExceeded {
+			return "", fmt.Errorf("job %s did not complete within %s: %w", job.GetName(), limits.timeout,
+				errJobTimedOut)
+		}
 		return "", fmt.Errorf("error waiting for job to succeed: %w", err)
 	}
 	labelSelector := "job-name=" + job.Name
-	logs, err := tc.getLogs(labelSelector)
+	logs, truncated, err := tc.getLogsWithLimit(labelSelector, limits.maxOutputBytes)
 	if err != nil {
 		return "", fmt.Errorf("error getting logs from job pod: %w", err)
 	}
+	if truncated {
+		return logs, fmt.Errorf("output of job %s exceeded %d bytes: %w", job.GetName(), limits.maxOutputBytes,
+			errJobOutputTruncated)
+	}
 	return logs, nil
 }
 
+// jobDeadlineExceeded returns true if the given job failed due to running longer than its active deadline
+func (tc *testContext) jobDeadlineExceeded(name string) (bool, error) {
+	job, err := tc.client.K8s.BatchV1().Jobs(tc.workloadNamespace).Get(context.TODO(), name, meta.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, jobCondition := range job.Status.Conditions {
+		if jobCondition.Type == batch.JobFailed && jobCondition.Status == core.ConditionTrue &&
+			jobCondition.Reason == batch.JobReasonDeadlineExceeded {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // getWinServices returns a map of Windows services from the instance with the given address, the map key being the
 // service's name
 func (tc *testContext) getWinServices(addr string) (map[string]winService, error) {
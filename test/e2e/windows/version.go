@@ -1,5 +1,13 @@
 package windows
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	config "github.com/openshift/api/config/v1"
+)
+
 type ServerVersion string
 
 const (
@@ -9,8 +17,14 @@ const (
 	Server2022 ServerVersion = "2022"
 )
 
+// DefaultAdminUsername is the local administrator of the Windows images used in CI, unless a provider says otherwise
+const DefaultAdminUsername = "Administrator"
+
+// DefaultVersion is the Windows Server version used when none is specified
+const DefaultVersion = Server2022
+
 // SupportedVersions are the Windows Server versions supported by the e2e test.
-// "" implies the default which is Server2022
+// "" implies the default which is DefaultVersion
 var SupportedVersions = []ServerVersion{Server2019, Server2022, ""}
 
 // BuildNumber returns the build for a given server version as defined by Microsoft
@@ -28,3 +42,19 @@ func IsSupported(version ServerVersion) bool {
 	}
 	return false
 }
+
+// ErrUnsupportedVersion is returned when a Windows Server version is requested from a provider which does not support it
+var ErrUnsupportedVersion = errors.New("unsupported Windows Server version")
+
+// CheckVersion returns ErrUnsupportedVersion if the given version, or DefaultVersion if empty, is not within the given
+// versions supported by the given platform
+func CheckVersion(platform config.PlatformType, supported []ServerVersion, version ServerVersion) error {
+	if version == "" {
+		version = DefaultVersion
+	}
+	if !slices.Contains(supported, version) {
+		return fmt.Errorf("%w: %s supports Windows Server %v, not %s", ErrUnsupportedVersion, platform, supported,
+			version)
+	}
+	return nil
+}
@@ -3,7 +3,9 @@ package version
 import (
 	"fmt"
 	"runtime"
+	"strings"
 
+	"golang.org/x/mod/semver"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -24,3 +26,56 @@ func Print() {
 func Get() string {
 	return Version
 }
+
+// Compare returns -1, 0 or +1 depending on whether version a is lower, equal to or greater than version b, compared as
+// semantic versions, with an optional "v" prefix. Build metadata is ignored. Returns an error if either version cannot
+// be parsed.
+func Compare(a, b string) (int, error) {
+	semverA, semverB := withPrefix(a), withPrefix(b)
+	if !semver.IsValid(semverA) {
+		return 0, fmt.Errorf("invalid semantic version '%s'", a)
+	}
+	if !semver.IsValid(semverB) {
+		return 0, fmt.Errorf("invalid semantic version '%s'", b)
+	}
+	return semver.Compare(semverA, semverB), nil
+}
+
+// CompareRelease returns -1, 0 or +1 depending on whether the release of version a is lower, equal to or greater than
+// the release of version b. Only the major.minor.patch core of the versions is compared: WMCO versions are suffixed
+// with the git hash they are built from, as "X.Y.Z-<githash>[-dirty]", which semver would order as a pre-release.
+// Returns an error if either version cannot be parsed.
+func CompareRelease(a, b string) (int, error) {
+	semverA, semverB := withPrefix(a), withPrefix(b)
+	if !semver.IsValid(semverA) {
+		return 0, fmt.Errorf("invalid semantic version '%s'", a)
+	}
+	if !semver.IsValid(semverB) {
+		return 0, fmt.Errorf("invalid semantic version '%s'", b)
+	}
+	return semver.Compare(releaseCore(semverA), releaseCore(semverB)), nil
+}
+
+// releaseCore returns the major.minor.patch core of the given valid semantic version
+func releaseCore(version string) string {
+	canonical := semver.Canonical(version)
+	return strings.TrimSuffix(canonical, semver.Prerelease(canonical))
+}
+
+// Equal returns true if the given versions are identical, or equal when compared as semantic versions. Versions which
+// differ and cannot be parsed are not equal.
+func Equal(a, b string) bool {
+	if a == b {
+		return true
+	}
+	result, err := Compare(a, b)
+	return err == nil && result == 0
+}
+
+// withPrefix returns the given version with the "v" prefix expected by the semver package
+func withPrefix(version string) string {
+	if strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
@@ -0,0 +1,146 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	testCases := []struct {
+		name        string
+		a           string
+		b           string
+		expected    int
+		expectedErr bool
+	}{
+		{
+			name:     "equal",
+			a:        "10.16.0",
+			b:        "10.16.0",
+			expected: 0,
+		},
+		{
+			name:     "optional prefix",
+			a:        "v10.16.0",
+			b:        "10.16.0",
+			expected: 0,
+		},
+		{
+			name:     "lower patch",
+			a:        "10.16.0",
+			b:        "10.16.1",
+			expected: -1,
+		},
+		{
+			name:     "greater minor",
+			a:        "10.17.0",
+			b:        "10.16.5",
+			expected: 1,
+		},
+		{
+			name:     "pre-release lower than release",
+			a:        "10.16.0-a1b2c3d",
+			b:        "10.16.0",
+			expected: -1,
+		},
+		{
+			name:     "pre-release identifiers compared",
+			a:        "10.16.0-rc.2",
+			b:        "10.16.0-rc.1",
+			expected: 1,
+		},
+		{
+			name:     "build metadata ignored",
+			a:        "10.16.0+build.1",
+			b:        "10.16.0+build.2",
+			expected: 0,
+		},
+		{
+			name:        "invalid first version",
+			a:           "incorrect",
+			b:           "10.16.0",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid second version",
+			a:           "10.16.0",
+			b:           "",
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := Compare(test.a, test.b)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+		})
+	}
+}
+
+func TestCompareRelease(t *testing.T) {
+	testCases := []struct {
+		name        string
+		a           string
+		b           string
+		expected    int
+		expectedErr bool
+	}{
+		{
+			name:     "builds of the same release",
+			a:        "10.16.0-f2e1d0c",
+			b:        "10.16.0-a1b2c3d",
+			expected: 0,
+		},
+		{
+			name:     "dirty build of the same release",
+			a:        "10.16.0-f2e1d0c-dirty",
+			b:        "10.16.0-a1b2c3d",
+			expected: 0,
+		},
+		{
+			name:     "build of a greater release",
+			a:        "10.17.0-a1b2c3d",
+			b:        "10.16.1-f2e1d0c",
+			expected: 1,
+		},
+		{
+			name:     "build of a lower release",
+			a:        "v10.16.0-f2e1d0c",
+			b:        "10.16.1",
+			expected: -1,
+		},
+		{
+			name:        "invalid version",
+			a:           "10.16.0-a1b2c3d",
+			b:           "incorrect",
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := CompareRelease(test.a, test.b)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	assert.True(t, Equal("10.16.0-a1b2c3d", "10.16.0-a1b2c3d"))
+	assert.True(t, Equal("10.16.0+build.1", "v10.16.0"))
+	// identical versions are equal even if they cannot be parsed
+	assert.True(t, Equal("", ""))
+	assert.False(t, Equal("10.16.0-a1b2c3d", "10.16.0"))
+	assert.False(t, Equal("incorrect", "10.16.0"))
+	assert.False(t, Equal("incorrect", "different"))
+}